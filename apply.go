@@ -0,0 +1,88 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// ApplyResult reports what [HybridController.Apply] changed, in the JSON
+// form of Ansible modules, such that lucigo fits into configuration
+// management playbooks:
+//
+//	{"changed": true, "diff": {"before": {"dhcp_enabled": true}, "after": {"dhcp_enabled": false}}}
+type ApplyResult struct {
+	Changed bool      `json:"changed"`
+	Diff    ApplyDiff `json:"diff"`
+}
+
+// ApplyDiff holds the settings differing from the desired state, before
+// and after applying. Settings already as desired are left out.
+type ApplyDiff struct {
+	Before map[string]interface{} `json:"before"`
+	After  map[string]interface{} `json:"after"`
+}
+
+// Apply brings the permanent settings into the desired state. The desired
+// state may be partial, settings not given are left alone, as are
+// settings already having the desired value: Only the differing ones are
+// sent with net_set, and nothing if none differ. In check mode, nothing is
+// sent at all, the result tells what would change.
+func (hc *HybridController) Apply(desired map[string]interface{}, check bool) (*ApplyResult, error) {
+	// compare as read from the device, such as with float64 numbers
+	raw, err := json.Marshal(desired)
+	if err != nil {
+		return nil, err
+	}
+	desired = nil
+	if err := json.Unmarshal(raw, &desired); err != nil {
+		return nil, err
+	}
+
+	current, err := hc.Query("net_get")
+	if err != nil {
+		return nil, err
+	}
+	before, after := settingsPatch(current.Msg, desired)
+	result := &ApplyResult{Changed: len(after) != 0, Diff: ApplyDiff{before, after}}
+	if !result.Changed || check {
+		return result, nil
+	}
+
+	if _, err := hc.QueryMsg("net_set", after); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// settingsPatch returns the current values of the settings differing from
+// the desired ones and the desired values, descending into sections.
+func settingsPatch(current, desired map[string]interface{}) (before, after map[string]interface{}) {
+	before, after = map[string]interface{}{}, map[string]interface{}{}
+	for key, want := range desired {
+		have, exists := current[key]
+		wantSection, isSection := want.(map[string]interface{})
+		haveSection, hasSection := have.(map[string]interface{})
+		if isSection && hasSection {
+			sectionBefore, sectionAfter := settingsPatch(haveSection, wantSection)
+			if len(sectionAfter) != 0 {
+				before[key], after[key] = sectionBefore, sectionAfter
+			}
+		} else if !exists || !reflect.DeepEqual(have, want) {
+			after[key] = want
+			if exists {
+				before[key] = have
+			}
+		}
+	}
+	return before, after
+}
+
+// Keys lists the settings differing, with sections flattened to keys such
+// as "ethernet.mtu", sorted.
+func (d ApplyDiff) Keys() []string {
+	return sortedKeys(flattenSettings("", d.After, nil))
+}
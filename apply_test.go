@@ -0,0 +1,53 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	var set []string // messages of net_set
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		switch sent.Type {
+		case "net_get":
+			fmt.Fprintf(w, `{"type":"net_get","id":"%s","code":0,"msg":{"dhcp_enabled":true,"jsonl_port":5732,"ethernet":{"mac":"04-E9-E5-14-74-BF","mtu":1500}}}`+"\n", sent.Id)
+		case "net_set":
+			msg, _ := json.Marshal(sent.Msg)
+			set = append(set, string(msg))
+			fmt.Fprintf(w, `{"type":"net_set","id":"%s","code":0,"msg":{}}`+"\n", sent.Id)
+		}
+	})
+
+	matching := map[string]interface{}{"jsonl_port": 5732, "ethernet": map[string]interface{}{"mtu": 1500}}
+	res, err := hc.Apply(matching, false)
+	if err != nil || res.Changed || len(set) != 0 {
+		t.Fatalf("expected no change for matching settings, got %+v, %v, net_set %v", res, err, set)
+	}
+
+	desired := map[string]interface{}{"jsonl_port": 5732, "dhcp_enabled": false, "ethernet": map[string]interface{}{"mtu": 9000}, "hostname": "lab1"}
+	res, err = hc.Apply(desired, true)
+	if err != nil || !res.Changed || len(set) != 0 {
+		t.Fatalf("expected a change without net_set in check mode, got %+v, %v, net_set %v", res, err, set)
+	}
+	out, _ := json.Marshal(res)
+	want := `{"changed":true,"diff":{"before":{"dhcp_enabled":true,"ethernet":{"mtu":1500}},"after":{"dhcp_enabled":false,"ethernet":{"mtu":9000},"hostname":"lab1"}}}`
+	if string(out) != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, out)
+	}
+	if keys := fmt.Sprint(res.Diff.Keys()); keys != "[dhcp_enabled ethernet.mtu hostname]" {
+		t.Fatalf("unexpected keys %s", keys)
+	}
+
+	if _, err := hc.Apply(desired, false); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(set) != 1 || set[0] != `{"dhcp_enabled":false,"ethernet":{"mtu":9000},"hostname":"lab1"}` {
+		t.Fatalf("expected only the differing settings to be sent, got %v", set)
+	}
+}
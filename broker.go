@@ -0,0 +1,286 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Broker holds the connection to a device open and shares it with any
+// number of clients, which connect over a Unix socket (on Windows as well)
+// and speak the JSONL protocol as to the device itself. Opening a serial
+// port and flushing what the device printed meanwhile takes seconds, which
+// short-lived invocations of tools save by going through a broker:
+//
+//	broker := lucigo.NewBroker(hc)
+//	listener, _ := net.Listen("unix", lucigo.DefaultBrokerSocket())
+//	broker.Serve(listener)
+//
+// Clients use a UnixEndpoint. Their requests are passed on one at a time,
+// such that concurrent tools do not interleave on the device, and each
+// answer goes to the client which asked. Requests the device does not answer
+// within the Timeout of the Controller fail with ErrTimeout, such that other
+// clients are not held up. Unsolicited messages, foremost run data, go to
+// the client which started the last run.
+type Broker struct {
+	Controller *HybridController
+
+	request sync.Mutex // held while a request is with the device
+
+	mu        sync.Mutex
+	pending   *brokerRequest
+	abandoned map[uuid.UUID]bool // requests timed out, whose answers are skipped
+	owner     *brokerClient      // of the last run
+	clients   map[*brokerClient]bool
+	err       error // why the device connection ended
+}
+
+// brokerRequest is the request of a client with the device.
+type brokerRequest struct {
+	Type     string
+	Id       uuid.UUID
+	answered chan bool // true once the answer was passed on, closed if it never comes
+	client   *brokerClient
+}
+
+// brokerClient is a connection of a client to the broker.
+type brokerClient struct {
+	conn net.Conn
+	mu   sync.Mutex // held while writing to conn
+}
+
+func (c *brokerClient) send(line []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.conn.Write(append(line, '\n'))
+	return err
+}
+
+// NewBroker creates a broker for the connected controller. The controller
+// must not be used otherwise while the broker serves.
+func NewBroker(hc *HybridController) *Broker {
+	return &Broker{Controller: hc, clients: make(map[*brokerClient]bool)}
+}
+
+// DefaultBrokerSocket is where a broker listens by default, in the runtime
+// directory of the user ($XDG_RUNTIME_DIR) or, with the id of the user in
+// the name, in the temporary one. As other users may create a socket there
+// first, check who owns it before using it.
+func DefaultBrokerSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "lucigo.sock")
+	}
+	uid := strconv.Itoa(os.Getuid())
+	if current, err := user.Current(); err == nil {
+		uid = current.Uid // the SID on Windows, which has no numeric one
+	}
+	return filepath.Join(os.TempDir(), "lucigo-"+uid+".sock")
+}
+
+// Serve accepts clients on the listener until it is closed or the device
+// connection ends, which is returned as error.
+func (b *Broker) Serve(listener net.Listener) error {
+	deviceDone := make(chan struct{})
+	go func() {
+		b.readDevice()
+		listener.Close()
+		close(deviceDone)
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-deviceDone:
+				return b.err
+			default:
+				return err
+			}
+		}
+		client := &brokerClient{conn: conn}
+		b.mu.Lock()
+		b.clients[client] = true
+		b.mu.Unlock()
+		go b.serveClient(client)
+	}
+}
+
+// readDevice passes the lines of the device on to the clients they are
+// meant for, until the connection ends.
+func (b *Broker) readDevice() {
+	reader := b.Controller.Reader
+	for reader.Scan() {
+		line := bytes.Clone(reader.Bytes())
+		b.Controller.TraceReceived(line)
+		var header recvHeader
+		if json.Unmarshal(line, &header) != nil {
+			continue // logging and boot noise
+		}
+		// unlike an echo of the request, as on the serial line, the
+		// answer has a code or error
+		answer := header.Code != nil || header.Error != nil
+		b.mu.Lock()
+		pending, to := b.pending, b.owner
+		switch {
+		case pending != nil && header.Type == pending.Type && header.Id == pending.Id && !answer:
+			to = nil // an echo of the request
+		case pending != nil && header.Type == pending.Type && header.Id == pending.Id:
+			b.pending, to = nil, pending.client
+			if header.Type == "start_run" || header.Type == "attach_run" {
+				b.owner = pending.client
+			}
+		case header.Id != uuid.Nil && b.abandoned[header.Id]:
+			// the late answer to a request timed out, or its echo
+			if answer {
+				delete(b.abandoned, header.Id)
+			}
+			pending, to = nil, nil
+		default:
+			pending = nil // unsolicited, for the owner of the run
+		}
+		b.mu.Unlock()
+		// sent from here, such that run data does not overtake the answer
+		// starting the run
+		if to != nil {
+			to.send(line)
+		}
+		if pending != nil && to == pending.client {
+			pending.answered <- true
+		}
+	}
+	err := reader.Err()
+	if err == nil {
+		err = io.EOF
+	}
+
+	b.mu.Lock()
+	b.err = fmt.Errorf("device connection ended: %w", err)
+	var waiting *brokerClient // is told why before hanging up
+	if b.pending != nil {
+		waiting = b.pending.client
+		close(b.pending.answered)
+		b.pending = nil
+	}
+	for client := range b.clients {
+		if client != waiting {
+			client.conn.Close()
+		}
+	}
+	b.mu.Unlock()
+}
+
+// serveClient passes the requests of a client on to the device, one at a
+// time, and its answers back.
+func (b *Broker) serveClient(client *brokerClient) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, client)
+		if b.owner == client {
+			b.owner = nil
+		}
+		b.mu.Unlock()
+		client.conn.Close()
+	}()
+	reader := NewLineReader(client.conn)
+	for reader.Scan() {
+		var sent SendEnvelope
+		if json.Unmarshal(reader.Bytes(), &sent) != nil {
+			continue // as the firmware, ignore what cannot be understood
+		}
+		if err := b.forward(client, sent, reader.Bytes()); err != nil {
+			failed, _ := json.Marshal(RecvEnvelope{Type: sent.Type, Id: sent.Id, Code: -1, Error: err.Error(), Msg: map[string]interface{}{}})
+			client.send(failed)
+			if !errors.Is(err, ErrTimeout) {
+				return
+			}
+		}
+	}
+}
+
+// forward sends the request to the device and waits until its answer was
+// passed on to the client, at most for the Timeout of the Controller.
+func (b *Broker) forward(client *brokerClient, sent SendEnvelope, line []byte) error {
+	b.request.Lock()
+	defer b.request.Unlock()
+
+	request := &brokerRequest{Type: sent.Type, Id: sent.Id, answered: make(chan bool, 1), client: client}
+	b.mu.Lock()
+	if b.err != nil {
+		b.mu.Unlock()
+		return b.err
+	}
+	b.pending = request
+	b.mu.Unlock()
+
+	if err := b.Controller.WriteLine(line); err != nil {
+		b.mu.Lock()
+		b.pending = nil
+		b.mu.Unlock()
+		return err
+	}
+	var timeout <-chan time.Time
+	if b.Controller.Timeout > 0 {
+		timer := time.NewTimer(b.Controller.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case ok := <-request.answered:
+		if !ok {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			return b.err
+		}
+		return nil
+	case <-timeout:
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending != request {
+		return b.err // answered meanwhile, or the connection ended
+	}
+	b.pending = nil
+	if request.Id != uuid.Nil {
+		if b.abandoned == nil {
+			b.abandoned = make(map[uuid.UUID]bool)
+		}
+		b.abandoned[request.Id] = true
+	}
+	return ErrTimeout
+}
+
+// UnixEndpoint connects to a Broker over a Unix socket. As URL, it is given
+// with the path of the socket, such as unix:///run/user/1000/lucigo.sock.
+type UnixEndpoint struct {
+	Path string
+}
+
+func (e UnixEndpoint) IsValid() bool {
+	return e.Path != ""
+}
+
+func (e UnixEndpoint) ToURL() string {
+	return "unix://" + e.Path
+}
+
+func (e UnixEndpoint) Open() (io.ReadWriter, error) {
+	if !e.IsValid() {
+		return nil, errors.New("invalid UnixEndpoint without path")
+	}
+	return net.Dial("unix", e.Path)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// DefaultCachedTypes are the queries a QueryCache keeps by default. Their
+// answers do not change while the device runs.
+var DefaultCachedTypes = []string{"sys_ident", "get_entities", "net_schema"}
+
+// DefaultInvalidates are the requests which invalidate cached answers by
+// default, see QueryCache.Invalidates.
+var DefaultInvalidates = map[string][]string{
+	"net_set":    {"*"}, // hostname and friends may show up in the identity
+	"net_reset":  {"*"},
+	"sys_reboot": {"*"},
+}
+
+// QueryCache keeps the answers to immutable or rarely changing queries of
+// a connection, such as sys_ident and get_entities, so that GUIs asking
+// for them on every page load do not each cost a round trip:
+//
+//	hc.Cache = lucigo.NewQueryCache()
+//	hc.Query("sys_ident") // asks the device
+//	hc.Query("sys_ident") // answered from the cache
+//
+// Only queries without message are cached, and only successful answers.
+// Whatever changes the answers outside of the known requests, such as
+// plugging in another module, has to be followed by Invalidate.
+//
+// A QueryCache is safe for concurrent use.
+type QueryCache struct {
+	// Invalidates lists, by request type, the cached types a request
+	// invalidates, "*" for all of them. Defaults to DefaultInvalidates.
+	Invalidates map[string][]string
+
+	// OnInvalidate is called with the types whose answers were dropped, if
+	// set, such as for telling GUIs to reload.
+	OnInvalidate func(types []string)
+
+	mu      sync.Mutex
+	types   map[string]bool
+	answers map[string]cachedAnswer
+}
+
+// cachedAnswer is kept encoded, so that callers modifying the Msg of the
+// envelope they got do not modify the cache.
+type cachedAnswer struct {
+	header recvHeader
+	msg    json.RawMessage
+}
+
+// NewQueryCache creates a cache of the answers to queries of the given
+// types, DefaultCachedTypes if none are given.
+func NewQueryCache(types ...string) *QueryCache {
+	if len(types) == 0 {
+		types = DefaultCachedTypes
+	}
+	c := &QueryCache{Invalidates: DefaultInvalidates, types: make(map[string]bool), answers: make(map[string]cachedAnswer)}
+	for _, Type := range types {
+		c.types[Type] = true
+	}
+	return c
+}
+
+// Caches reports whether answers to queries of the type are cached.
+func (c *QueryCache) Caches(Type string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.types[Type]
+}
+
+// Cacheable reports whether the request can be answered from the cache.
+func (c *QueryCache) Cacheable(sent SendEnvelope) bool {
+	switch msg := sent.Msg.(type) {
+	case nil:
+	case map[string]interface{}:
+		if len(msg) != 0 {
+			return false
+		}
+	default:
+		return false
+	}
+	return c.Caches(sent.Type)
+}
+
+// Get returns the cached answer to the query of the given type, with the
+// given Id as if it answered the request of that Id.
+func (c *QueryCache) Get(Type string, Id uuid.UUID) (*RecvEnvelope, bool) {
+	c.mu.Lock()
+	answer, ok := c.answers[Type]
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	header := answer.header
+	header.Id, header.Msg = Id, answer.msg
+	res := &RecvEnvelope{}
+	if err := header.decode(res, false); err != nil {
+		return nil, false
+	}
+	return res, true
+}
+
+// Put caches the answer, if it is a successful one to a cached type. Lines
+// without code or error, such as echoes of requests on the serial line, are
+// no answers and are not cached.
+func (c *QueryCache) Put(res *RecvEnvelope) {
+	if res == nil || !res.answer || !res.IsSuccess() || !c.Caches(res.Type) {
+		return
+	}
+	msg := res.raw
+	if msg == nil {
+		var err error
+		if msg, err = json.Marshal(res.Msg); err != nil {
+			return
+		}
+	}
+	code, message := res.Code, res.Error
+	c.put(recvHeader{Type: res.Type, Code: &code, Error: &message}, msg)
+}
+
+func (c *QueryCache) put(header recvHeader, msg json.RawMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.answers[header.Type] = cachedAnswer{header: header, msg: append(json.RawMessage(nil), msg...)}
+}
+
+// InvalidateBy drops the answers which a request of the given type
+// invalidates according to Invalidates. It is called before sending.
+func (c *QueryCache) InvalidateBy(Type string) {
+	if types, ok := c.Invalidates[Type]; ok {
+		for _, t := range types {
+			if t == "*" {
+				c.Invalidate()
+				return
+			}
+		}
+		c.Invalidate(types...)
+	}
+}
+
+// Invalidate drops the cached answers of the given types, or all of them
+// if no type is given.
+func (c *QueryCache) Invalidate(types ...string) {
+	c.mu.Lock()
+	var dropped []string
+	if len(types) == 0 {
+		for Type := range c.answers {
+			dropped = append(dropped, Type)
+		}
+		clear(c.answers)
+	} else {
+		for _, Type := range types {
+			if _, ok := c.answers[Type]; ok {
+				delete(c.answers, Type)
+				dropped = append(dropped, Type)
+			}
+		}
+	}
+	c.mu.Unlock()
+	if len(dropped) != 0 && c.OnInvalidate != nil {
+		c.OnInvalidate(dropped)
+	}
+}
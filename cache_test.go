@@ -0,0 +1,72 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestQueryCache(t *testing.T) {
+	asked := map[string]int{}
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		asked[sent.Type]++
+		fmt.Fprintf(w, `{"type":"%s","id":"%s","code":0,"msg":{"fw_build":"%d"}}`+"\n", sent.Type, sent.Id, asked[sent.Type])
+	})
+	hc.Cache = NewQueryCache()
+	var invalidated []string
+	hc.Cache.OnInvalidate = func(types []string) { invalidated = append(invalidated, types...) }
+
+	for i := 0; i < 3; i++ {
+		sent := hc.NewEnvelope("sys_ident")
+		res, err := hc.Command(sent)
+		if err != nil || res.Id != sent.Id || res.Msg["fw_build"] != "1" {
+			t.Fatalf("expected the first answer with the id %s, got %+v, %v", sent.Id, res, err)
+		}
+		res.Msg["fw_build"] = "modified"
+	}
+	hc.QueryMsg("sys_ident", map[string]interface{}{"verbose": true})
+	hc.Query("net_status")
+	hc.Query("net_status")
+	if want := map[string]int{"sys_ident": 2, "net_status": 2}; !reflect.DeepEqual(asked, want) {
+		t.Fatalf("expected the device to be asked %v, got %v", want, asked)
+	}
+
+	hc.Query("net_set")
+	if res, _ := hc.Query("sys_ident"); res.Msg["fw_build"] != "3" || !reflect.DeepEqual(invalidated, []string{"sys_ident"}) {
+		t.Fatalf("expected net_set to invalidate sys_ident, got %v, invalidated %v", res.Msg, invalidated)
+	}
+	hc.Cache.Invalidate("sys_ident")
+	if res, _ := hc.Query("sys_ident"); res.Msg["fw_build"] != "4" {
+		t.Fatalf("expected sys_ident to be asked after Invalidate, got %v", res.Msg)
+	}
+}
+
+func TestQueryCache_Put(t *testing.T) {
+	cache := NewQueryCache()
+	put := func(line []byte) {
+		// as the proxy does, see ParseRecvHeader
+		if res, err := ParseRecvHeader(line); err == nil {
+			cache.Put(res)
+		}
+	}
+	put([]byte(`{"type":"get_entities","id":"00000000-0000-0000-0000-000000000001","code":-1,"error":"busy"}`))
+	put([]byte(`{"type":"run_data","msg":{}}`))
+	put([]byte(`{"type":"get_entities","id":"00000000-0000-0000-0000-000000000001","msg":{}}`)) // an echo
+	if _, ok := cache.Get("get_entities", [16]byte{}); ok {
+		t.Fatalf("expected errors and echoes not to be cached")
+	}
+	line, err := MarshalRecvEnvelope(RecvEnvelope{Type: "get_entities", Msg: map[string]interface{}{"entities": make([]interface{}, 500)}}, "gzip")
+	if err != nil {
+		t.Fatalf("MarshalRecvEnvelope: %v", err)
+	}
+	put(line)
+	res, ok := cache.Get("get_entities", [16]byte{2})
+	if !ok || res.Id != [16]byte{2} || len(res.Msg["entities"].([]interface{})) != 500 {
+		t.Fatalf("expected the compressed answer to be cached, got %+v", res)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import "fmt"
+
+// Layout of a LUCIDAC cluster: The math blocks provide 16 outputs (and
+// take 16 inputs), M0 holding the integrators and M1 the multipliers.
+// A signal is routed from an output through one of the lanes of the U, C
+// and I blocks, scaled by the coefficient of its lane, to an input.
+// Inputs sum all signals routed to them.
+const (
+	NumIntegrators = 8  // M0: inputs and outputs 0 to 7
+	NumMultipliers = 4  // M1: inputs 8 to 15, outputs 8 to 11
+	NumMathPorts   = 16 // inputs and outputs of both math blocks
+	NumLanes       = 32
+	MaxCoefficient = 20
+	DefaultK0      = 10000 // time factor of the integrators, per second
+)
+
+// Circuit is the analog circuit of a LUCIDAC cluster, described by the
+// routes of signals between the math blocks.
+type Circuit struct {
+	Integrators [NumIntegrators]Integrator `json:"integrators"`
+	Routes      []Route                    `json:"routes"`
+
+	// ADC selects the math block output acquired by each DAQ channel.
+	// Without, channel i acquires output i.
+	ADC []int `json:"adc,omitempty"`
+}
+
+// Integrator is the configuration of one integrator of the M0 block.
+type Integrator struct {
+	IC float64 `json:"ic"` // initial condition, in machine units
+	K0 float64 `json:"k0"` // time factor, DefaultK0 if zero
+}
+
+// Route connects the output From to the input To over Lane, scaling the
+// signal by Coefficient.
+type Route struct {
+	From        int     `json:"from"`
+	Lane        int     `json:"lane"`
+	Coefficient float64 `json:"coefficient"`
+	To          int     `json:"to"`
+}
+
+// Validate checks that the circuit can be realized on a cluster, i.e.
+// ports, lanes and coefficients are in range and no lane is used twice.
+func (c *Circuit) Validate() error {
+	used := make(map[int]bool)
+	for i, r := range c.Routes {
+		switch {
+		case r.From < 0 || r.From >= NumMathPorts:
+			return fmt.Errorf("route %d: no output %d", i, r.From)
+		case r.To < 0 || r.To >= NumMathPorts:
+			return fmt.Errorf("route %d: no input %d", i, r.To)
+		case r.Lane < 0 || r.Lane >= NumLanes:
+			return fmt.Errorf("route %d: no lane %d", i, r.Lane)
+		case used[r.Lane]:
+			return fmt.Errorf("route %d: lane %d used twice", i, r.Lane)
+		case r.Coefficient < -MaxCoefficient || r.Coefficient > MaxCoefficient:
+			return fmt.Errorf("route %d: coefficient %g out of range", i, r.Coefficient)
+		}
+		used[r.Lane] = true
+	}
+	for i, ic := range c.Integrators {
+		if ic.IC < -1 || ic.IC > 1 {
+			return fmt.Errorf("integrator %d: initial condition %g out of range", i, ic.IC)
+		}
+	}
+	for ch, output := range c.ADC {
+		if output < 0 || output >= NumMathPorts {
+			return fmt.Errorf("ADC channel %d: no output %d", ch, output)
+		}
+	}
+	return nil
+}
+
+// adcOutput returns the output acquired by the given DAQ channel.
+func (c *Circuit) adcOutput(channel int) int {
+	if channel < len(c.ADC) {
+		return c.ADC[channel]
+	}
+	return channel
+}
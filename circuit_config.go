@@ -0,0 +1,241 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// IUpscaling is the factor of a lane upscaled in the I block. Coefficients
+// beyond ±1, the range of the C block, are realized with it.
+const IUpscaling = MaxCoefficient
+
+// CircuitConfig is the configuration of the analog circuit of a carrier, as
+// read with get_config and written with set_config:
+//
+//	{"entity": ["04-E9-E5-14-74-BF"],
+//	 "config": {"/0": {"/M0": {...}, "/U": {...}, "/C": {...}, "/I": {...}}, "adc_channels": [0, 1]}}
+//
+// Build it from the routes of a Circuit with [Circuit.Config], or block by
+// block for circuits beyond a single cluster.
+type CircuitConfig struct {
+	Entity []string      `json:"entity"` // path of the carrier, i.e. its MAC address
+	Config CarrierConfig `json:"config"`
+}
+
+// CarrierConfig configures the clusters of a carrier and its ADCs.
+type CarrierConfig struct {
+	Clusters map[int]*ClusterConfig // by index, "/0" and so on in JSON
+	// ADCChannels selects the math block output acquired by each DAQ
+	// channel, nil for unconfigured channels.
+	ADCChannels []*int
+}
+
+func (c CarrierConfig) MarshalJSON() ([]byte, error) {
+	fields := map[string]interface{}{}
+	for index, cluster := range c.Clusters {
+		fields["/"+strconv.Itoa(index)] = cluster
+	}
+	if c.ADCChannels != nil {
+		fields["adc_channels"] = c.ADCChannels
+	}
+	return json.Marshal(fields)
+}
+
+func (c *CarrierConfig) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*c = CarrierConfig{}
+	for key, raw := range fields {
+		if key == "adc_channels" {
+			if err := json.Unmarshal(raw, &c.ADCChannels); err != nil {
+				return fmt.Errorf("adc_channels: %w", err)
+			}
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimPrefix(key, "/"))
+		if err != nil || !strings.HasPrefix(key, "/") {
+			continue // not modelled
+		}
+		cluster := &ClusterConfig{}
+		if err := json.Unmarshal(raw, cluster); err != nil {
+			return fmt.Errorf("cluster %d: %w", index, err)
+		}
+		if c.Clusters == nil {
+			c.Clusters = make(map[int]*ClusterConfig)
+		}
+		c.Clusters[index] = cluster
+	}
+	return nil
+}
+
+// ClusterConfig configures the blocks of a cluster, blocks left nil are
+// left as they are.
+type ClusterConfig struct {
+	M0 *M0Config     `json:"/M0,omitempty"`
+	U  *UBlockConfig `json:"/U,omitempty"`
+	C  *CBlockConfig `json:"/C,omitempty"`
+	I  *IBlockConfig `json:"/I,omitempty"`
+}
+
+// M0Config configures the integrators.
+type M0Config struct {
+	Elements [NumIntegrators]IntegratorConfig `json:"elements"`
+}
+
+// IntegratorConfig configures a single integrator.
+type IntegratorConfig struct {
+	IC float64 `json:"ic"` // initial condition, in machine units
+	K  int     `json:"k"`  // time factor, per second
+}
+
+// UBlockConfig configures which math block output feeds each lane.
+type UBlockConfig struct {
+	Outputs [NumLanes]*int `json:"outputs"` // nil for unused lanes
+}
+
+// CBlockConfig configures the coefficient of each lane.
+type CBlockConfig struct {
+	Elements [NumLanes]float64 `json:"elements"` // within ±1
+}
+
+// IBlockConfig configures which lanes are summed into each math block
+// input, and which are upscaled by IUpscaling on the way.
+type IBlockConfig struct {
+	Outputs   [NumMathPorts][]int `json:"outputs"` // lanes, by input
+	Upscaling [NumLanes]bool      `json:"upscaling"`
+}
+
+// Validate checks that the blocks configured can be realized, i.e. ports,
+// lanes and values are in range.
+func (c *ClusterConfig) Validate() error {
+	if c.M0 != nil {
+		for i, integrator := range c.M0.Elements {
+			if integrator.IC < -1 || integrator.IC > 1 {
+				return fmt.Errorf("integrator %d: initial condition %g out of range", i, integrator.IC)
+			}
+			if integrator.K <= 0 {
+				return fmt.Errorf("integrator %d: time factor %d not positive", i, integrator.K)
+			}
+		}
+	}
+	if c.U != nil {
+		for lane, output := range c.U.Outputs {
+			if output != nil && (*output < 0 || *output >= NumMathPorts) {
+				return fmt.Errorf("lane %d: no output %d", lane, *output)
+			}
+		}
+	}
+	if c.C != nil {
+		for lane, coefficient := range c.C.Elements {
+			if coefficient < -1 || coefficient > 1 {
+				return fmt.Errorf("lane %d: coefficient %g out of range of the C block", lane, coefficient)
+			}
+		}
+	}
+	if c.I != nil {
+		summed := make(map[int]int)
+		for input, lanes := range c.I.Outputs {
+			for _, lane := range lanes {
+				if lane < 0 || lane >= NumLanes {
+					return fmt.Errorf("input %d: no lane %d", input, lane)
+				}
+				if other, ok := summed[lane]; ok {
+					return fmt.Errorf("lane %d: summed into inputs %d and %d", lane, other, input)
+				}
+				summed[lane] = input
+			}
+		}
+	}
+	return nil
+}
+
+// Config converts the circuit into the configuration of a cluster, with
+// coefficients beyond the range of the C block upscaled in the I block.
+func (c *Circuit) Config() (*ClusterConfig, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	config := &ClusterConfig{M0: &M0Config{}, U: &UBlockConfig{}, C: &CBlockConfig{}, I: &IBlockConfig{}}
+	for input := range config.I.Outputs {
+		config.I.Outputs[input] = []int{}
+	}
+	for i, integrator := range c.Integrators {
+		k := integrator.K0
+		if k == 0 {
+			k = DefaultK0
+		}
+		config.M0.Elements[i] = IntegratorConfig{IC: integrator.IC, K: int(math.Round(k))}
+	}
+	for _, r := range c.Routes {
+		from := r.From
+		config.U.Outputs[r.Lane] = &from
+		config.C.Elements[r.Lane] = r.Coefficient
+		if math.Abs(r.Coefficient) > 1 {
+			config.C.Elements[r.Lane] = r.Coefficient / IUpscaling
+			config.I.Upscaling[r.Lane] = true
+		}
+		config.I.Outputs[r.To] = append(config.I.Outputs[r.To], r.Lane)
+	}
+	return config, nil
+}
+
+// CircuitConfig converts the circuit into the configuration of the first
+// cluster of the carrier, including the ADCs.
+func (c *Circuit) CircuitConfig(carrier string) (*CircuitConfig, error) {
+	cluster, err := c.Config()
+	if err != nil {
+		return nil, err
+	}
+	config := &CircuitConfig{Entity: []string{carrier}, Config: CarrierConfig{Clusters: map[int]*ClusterConfig{0: cluster}}}
+	for ch := range c.ADC {
+		output := c.adcOutput(ch)
+		config.Config.ADCChannels = append(config.Config.ADCChannels, &output)
+	}
+	return config, nil
+}
+
+// GetConfig asks the device for the configuration of its circuit.
+func (hc *HybridController) GetConfig() (*CircuitConfig, error) {
+	res, err := hc.Query("get_config")
+	if err != nil {
+		return nil, err
+	}
+	config := &CircuitConfig{}
+	if err := decodeAnswer(res, "get_config", config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// SetConfig configures the circuit of the device with set_config, after
+// validating the clusters. Without Entity, the carrier is the device as
+// identified by its MAC address.
+func (hc *HybridController) SetConfig(config *CircuitConfig) error {
+	for index, cluster := range config.Config.Clusters {
+		if err := cluster.Validate(); err != nil {
+			return fmt.Errorf("cluster %d: %w", index, err)
+		}
+	}
+	if len(config.Entity) == 0 {
+		ident, err := hc.SysIdent()
+		if err != nil {
+			return fmt.Errorf("cannot identify the carrier: %w", err)
+		}
+		with := *config
+		with.Entity = []string{ident.Mac}
+		config = &with
+	}
+	sent := hc.NewEnvelope("set_config")
+	sent.Msg = config
+	_, err := answered(hc.Command(sent))
+	return err
+}
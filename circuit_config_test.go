@@ -0,0 +1,75 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestHybridController_SetConfig(t *testing.T) {
+	var configured []byte // as sent with set_config, answered to get_config
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		msg := []byte("{}")
+		switch sent.Type {
+		case "sys_ident":
+			msg = []byte(`{"mac":"04-E9-E5-14-74-BF"}`)
+		case "set_config":
+			configured, _ = json.Marshal(sent.Msg)
+		case "get_config":
+			msg = configured
+		case "get_entities":
+			msg = []byte(`{"entities":{"04-E9-E5-14-74-BF":{"class":1,"type":0,"variant":0,"version":"1.0.0","/0":{"class":2,"/M0":{"class":3},"/M1":{"class":3,"type":1},"/U":{"class":4}}}}}`)
+		}
+		fmt.Fprintf(w, `{"type":"%s","id":"%s","code":0,"msg":%s}`+"\n", sent.Type, sent.Id, msg)
+	})
+
+	circuit := harmonicOscillator
+	circuit.Routes = append([]Route{{From: 2, Lane: 5, Coefficient: -5, To: 2}}, circuit.Routes...)
+	cluster, err := circuit.Config()
+	if err != nil {
+		t.Fatalf("Config: %v", err)
+	}
+	if err := hc.SetConfig(&CircuitConfig{Config: CarrierConfig{Clusters: map[int]*ClusterConfig{0: cluster}}}); err != nil {
+		t.Fatalf("SetConfig: %v", err)
+	}
+
+	config, err := hc.GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig: %v", err)
+	}
+	read := config.Config.Clusters[0]
+	switch {
+	case len(config.Entity) != 1 || config.Entity[0] != "04-E9-E5-14-74-BF":
+		t.Fatalf("expected the carrier of the device configured, got %v", config.Entity)
+	case read == nil || read.M0.Elements[0] != (IntegratorConfig{IC: 1, K: DefaultK0}):
+		t.Fatalf("unexpected integrators %+v", read)
+	case *read.U.Outputs[1] != 0 || read.U.Outputs[2] != nil:
+		t.Fatalf("expected lane 1 fed by output 0 and lane 2 unused, got %v", read.U.Outputs)
+	case read.C.Elements[5] != -5.0/IUpscaling || !read.I.Upscaling[5] || read.I.Upscaling[0]:
+		t.Fatalf("expected only lane 5 upscaled, got %v and %v", read.C.Elements, read.I.Upscaling)
+	case fmt.Sprint(read.I.Outputs[2]) != "[5]":
+		t.Fatalf("expected lane 5 summed into input 2, got %v", read.I.Outputs)
+	}
+
+	read.C.Elements[0] = 2
+	if err := hc.SetConfig(config); err == nil {
+		t.Fatalf("expected a coefficient out of range of the C block refused")
+	}
+
+	carriers, err := hc.Entities()
+	if err != nil {
+		t.Fatalf("Entities: %v", err)
+	}
+	carrier := carriers["04-E9-E5-14-74-BF"]
+	if carrier == nil || carrier.Class != EntityCarrier || fmt.Sprint(carrier.Get("0").Names()) != "[M0 M1 U]" || carrier.Get("/0/M1").Type != 1 {
+		t.Fatalf("unexpected entities %+v", carrier)
+	}
+	if carrier.Get("0/C") != nil {
+		t.Fatalf("expected no C block")
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/anabrid/lucigo"
+)
+
+// apply brings the device settings into the state given as JSON file and
+// reports the result as JSON, as Ansible modules do. Failures are
+// reported the same way, with "failed" and "msg", and exit code 1.
+func apply() {
+	result, err := applyFile(CLI.Apply.File, CLI.Apply.Check)
+	if err != nil {
+		out, _ := json.Marshal(map[string]interface{}{"changed": false, "failed": true, "msg": err.Error()})
+		fmt.Printf("%s\n", out)
+		os.Exit(1)
+	}
+	out, _ := json.Marshal(result)
+	fmt.Printf("%s\n", out)
+}
+
+func applyFile(path string, check bool) (*lucigo.ApplyResult, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+	var desired map[string]interface{}
+	if err := json.NewDecoder(in).Decode(&desired); err != nil {
+		return nil, fmt.Errorf("cannot read the desired settings: %w", err)
+	}
+
+	hc := getHybridController()
+	result, err := hc.Apply(desired, check)
+	if err != nil {
+		return nil, err
+	}
+	if result.Changed && !check {
+		if res, err := hc.Query("net_get"); err == nil {
+			recordSettings(hc, "apply", res.Msg)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/anabrid/lucigo"
+)
+
+// benchReport holds the results of lucigo bench.
+type benchReport struct {
+	Endpoint string        `json:"endpoint"`
+	Type     string        `json:"type"`
+	Latency  *benchLatency `json:"latency,omitempty"`
+	Rate     *benchRate    `json:"rate,omitempty"`
+	DAQ      *benchDAQ     `json:"daq,omitempty"`
+}
+
+// benchLatency is the distribution of round trip times.
+type benchLatency struct {
+	Count int           `json:"count"`
+	Min   time.Duration `json:"min"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// benchRate is the rate of envelopes sent back to back.
+type benchRate struct {
+	Envelopes int           `json:"envelopes"`
+	Duration  time.Duration `json:"duration"`
+	PerSecond float64       `json:"per_second"`
+}
+
+// benchDAQ is the throughput of a streaming run.
+type benchDAQ struct {
+	Frames        int     `json:"frames"`
+	Samples       int     `json:"samples"`
+	Bytes         int64   `json:"bytes"`
+	Seconds       float64 `json:"seconds"`
+	SamplesPerSec float64 `json:"samples_per_second"`
+	BytesPerSec   float64 `json:"bytes_per_second"`
+	Lost          int     `json:"lost"` // samples, as reported by the integrity checks
+}
+
+// countingStream counts the bytes read from the device.
+type countingStream struct {
+	io.ReadWriter
+	read atomic.Int64
+}
+
+func (s *countingStream) Read(p []byte) (int, error) {
+	n, err := s.ReadWriter.Read(p)
+	s.read.Add(int64(n))
+	return n, err
+}
+
+func bench() {
+	if CLI.Bench.CpuProfile != "" {
+		f, err := os.Create(CLI.Bench.CpuProfile)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fatal(err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	hc := getHybridController()
+	hc.Cache = nil // measure the device, not the cache
+	stream := &countingStream{ReadWriter: hc.Stream}
+	hc.Stream, hc.Reader = stream, lucigo.NewLineReader(stream)
+	report := benchReport{Endpoint: hc.Endpoint.ToURL(), Type: CLI.Bench.Type}
+
+	if CLI.Bench.Count > 0 {
+		report.Latency = benchLatencies(hc)
+	}
+	if CLI.Bench.Duration > 0 {
+		report.Rate = benchEnvelopeRate(hc)
+	}
+	if CLI.Bench.Daq > 0 {
+		report.DAQ = benchStreaming(hc, stream)
+	}
+
+	if CLI.Bench.MemProfile != "" {
+		f, err := os.Create(CLI.Bench.MemProfile)
+		if err != nil {
+			fatal(err)
+		}
+		runtime.GC() // up-to-date statistics
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			fatal(err)
+		}
+		f.Close()
+	}
+	printBench(report)
+}
+
+// benchQuery sends a single query and fails on any error, as a benchmark
+// of failing commands is meaningless.
+func benchQuery(hc lucigo.Controller) {
+	if _, err := hc.Query(CLI.Bench.Type); err != nil {
+		fatal(err)
+	}
+}
+
+func benchLatencies(hc *lucigo.HybridController) *benchLatency {
+	rtts := make([]time.Duration, CLI.Bench.Count)
+	var sum time.Duration
+	for i := range rtts {
+		sent := time.Now()
+		benchQuery(hc)
+		rtts[i] = time.Since(sent)
+		sum += rtts[i]
+	}
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	percentile := func(p float64) time.Duration {
+		return rtts[int(p*float64(len(rtts)-1))]
+	}
+	return &benchLatency{
+		Count: len(rtts),
+		Min:   rtts[0],
+		Mean:  sum / time.Duration(len(rtts)),
+		P50:   percentile(0.5),
+		P90:   percentile(0.9),
+		P99:   percentile(0.99),
+		Max:   rtts[len(rtts)-1],
+	}
+}
+
+// benchEnvelopeRate sends queries back to back for the duration. As a
+// HybridController awaits each answer, this is the rate sustained by the
+// client and device together.
+func benchEnvelopeRate(hc *lucigo.HybridController) *benchRate {
+	started := time.Now()
+	n := 0
+	for time.Since(started) < CLI.Bench.Duration {
+		benchQuery(hc)
+		n++
+	}
+	elapsed := time.Since(started)
+	return &benchRate{Envelopes: n, Duration: elapsed, PerSecond: float64(n) / elapsed.Seconds()}
+}
+
+// benchStreaming runs for the OP time of --daq and measures how fast the
+// data arrives, without writing it anywhere.
+func benchStreaming(hc *lucigo.HybridController, stream *countingStream) *benchDAQ {
+	config := lucigo.RunConfig{IcTime: 100000, OpTime: uint64(CLI.Bench.Daq.Nanoseconds())}
+	daq := lucigo.DAQConfig{NumChannels: CLI.Bench.Channels, SampleOp: true, SampleOpEnd: true, SampleRate: CLI.Bench.SampleRate}
+	run, err := hc.StartRun(config, daq)
+	if err != nil {
+		fatalf("Could not start run: %v", err)
+	}
+	result := &benchDAQ{}
+	var before int64
+	var started time.Time
+	for frame := range run.Data() {
+		if started.IsZero() {
+			// timed from the first frame on, not including the start of the run
+			started = time.Now()
+			before = stream.read.Load()
+			continue
+		}
+		result.Frames++
+		result.Samples += len(frame.Samples)
+	}
+	if err := run.Err(); err != nil {
+		fatalf("Run failed: %v", err)
+	}
+	for _, gap := range run.Integrity().Gaps {
+		result.Lost += gap.Missing
+	}
+	if !started.IsZero() {
+		result.Seconds = time.Since(started).Seconds()
+		result.Bytes = stream.read.Load() - before
+	}
+	if result.Seconds > 0 {
+		result.SamplesPerSec = float64(result.Samples) / result.Seconds
+		result.BytesPerSec = float64(result.Bytes) / result.Seconds
+	}
+	return result
+}
+
+func printBench(report benchReport) {
+	if CLI.Bench.Json {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Printf("%s\n", out)
+		return
+	}
+	fmt.Printf("Endpoint: %s\n", report.Endpoint)
+	if l := report.Latency; l != nil {
+		fmt.Printf("Round trips of %s: %d, min %v, mean %v, p50 %v, p90 %v, p99 %v, max %v\n",
+			report.Type, l.Count, l.Min, l.Mean, l.P50, l.P90, l.P99, l.Max)
+	}
+	if r := report.Rate; r != nil {
+		fmt.Printf("Sustained rate: %d envelopes in %v, %.0f per second\n", r.Envelopes, r.Duration.Round(time.Millisecond), r.PerSecond)
+	}
+	if d := report.DAQ; d != nil {
+		fmt.Printf("DAQ streaming: %d samples in %d frames, %.0f samples/s, %.2f MB/s, %d samples lost\n",
+			d.Samples, d.Frames, d.SamplesPerSec, d.BytesPerSec/1e6, d.Lost)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/anabrid/lucigo"
+)
+
+// viaBroker lets commands without -e use a running broker, see
+// cliOrTryFindServers. The broker itself connects to the device.
+var viaBroker = true
+
+// brokerSocket returns the socket of the broker, from --socket or the default.
+func brokerSocket() string {
+	if CLI.Broker.Socket != "" {
+		return CLI.Broker.Socket
+	}
+	return lucigo.DefaultBrokerSocket()
+}
+
+// runningBroker returns the endpoint of a broker answering on the default
+// socket, if any. Sockets of other users are not used.
+func runningBroker() (lucigo.Endpoint, bool) {
+	if !viaBroker {
+		return nil, false
+	}
+	path := lucigo.DefaultBrokerSocket()
+	if err := checkSocketOwner(path); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Warning: Not using the broker, %v\n", err)
+		}
+		return nil, false
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, false
+	}
+	conn.Close()
+	return lucigo.UnixEndpoint{Path: path}, true
+}
+
+func broker() {
+	viaBroker = false
+	path := brokerSocket()
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		fatalf("Need another --socket, a broker is already listening on %s", path)
+	}
+	os.Remove(path) // left over by a broker which did not exit cleanly
+
+	hc := getHybridController()
+	listener, err := listenSocket(path)
+	if err != nil {
+		fatal(err)
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		listener.Close() // removes the socket
+	}()
+
+	log.Printf("broker: Sharing %s on unix://%s\n", hc.Endpoint.ToURL(), path)
+	err = lucigo.NewBroker(hc).Serve(listener)
+	select {
+	case <-interrupt:
+	default:
+		fatal(err)
+	}
+}
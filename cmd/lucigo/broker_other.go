@@ -0,0 +1,31 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build windows || plan9
+
+package main
+
+import (
+	"net"
+	"os"
+)
+
+// listenSocket listens on a Unix socket only the user may connect to.
+func listenSocket(path string) (net.Listener, error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// checkSocketOwner does not fail here: The socket is in the temporary
+// directory of the user, which other users have no access to.
+func checkSocketOwner(path string) error {
+	return nil
+}
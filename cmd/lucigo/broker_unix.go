@@ -0,0 +1,38 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenSocket listens on a Unix socket only the user may connect to.
+func listenSocket(path string) (net.Listener, error) {
+	mask := syscall.Umask(0o177)
+	defer syscall.Umask(mask)
+	return net.Listen("unix", path)
+}
+
+// checkSocketOwner fails unless the socket belongs to the user, such that
+// requests, with passwords, do not go to a socket another user put there.
+func checkSocketOwner(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("cannot tell the owner of %s", path)
+	}
+	if int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s belongs to user %d, not to you", path, stat.Uid)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/anabrid/lucigo"
+)
+
+// Shell completion scripts. They complete commands, and the values of -e
+// by asking lucigo __complete-endpoint, which offers the names and
+// endpoints of known devices (see knownDevices), the devices of the fleet
+// inventory, a running broker and what discovery finds within a second.
+var completionScripts = map[string]string{
+	"bash": `_lucigo() {
+	local line=${COMP_LINE:0:$COMP_POINT} cur prev candidates
+	local -a words=($line)
+	if [[ $line == *" " ]]; then
+		cur="" prev=${words[-1]}
+	else
+		cur=${words[-1]} prev=${words[-2]}
+	fi
+	if [[ $prev == -e || $prev == --endpoint ]]; then
+		candidates=$(lucigo __complete-endpoint "$cur" 2>/dev/null)
+	elif [[ $cur != -* ]]; then
+		candidates="@COMMANDS@"
+	fi
+	COMPREPLY=($(compgen -W "$candidates" -- "$cur"))
+	# bash splits words at colons, as in tcp://, and replaces the last part only
+	if [[ $cur == *:* ]]; then
+		local colon_prefix=${cur%"${cur##*:}"}
+		COMPREPLY=("${COMPREPLY[@]#"$colon_prefix"}")
+	fi
+}
+complete -F _lucigo lucigo
+`,
+	"zsh": `#compdef lucigo
+_lucigo() {
+	if [[ ${words[CURRENT-1]} == (-e|--endpoint) ]]; then
+		local -a endpoints=(${(f)"$(lucigo __complete-endpoint ${words[CURRENT]} 2>/dev/null)"})
+		compadd -a endpoints
+	elif [[ ${words[CURRENT]} != -* ]]; then
+		compadd -- @COMMANDS@
+	fi
+}
+compdef _lucigo lucigo
+`,
+	"fish": `complete -c lucigo -s e -l endpoint -x -a '(lucigo __complete-endpoint (commandline -ct) 2>/dev/null)'
+complete -c lucigo -n __fish_use_subcommand -x -a '@COMMANDS@'
+`,
+}
+
+// completion prints the completion script for the shell.
+func completion(parser *kong.Kong, shell string) {
+	var commands []string
+	for _, node := range parser.Model.Children {
+		if !node.Hidden {
+			commands = append(commands, node.Name)
+		}
+	}
+	fmt.Print(strings.ReplaceAll(completionScripts[shell], "@COMMANDS@", strings.Join(commands, " ")))
+}
+
+// completeEndpoint prints the candidates for -e beginning with prefix, one
+// per line.
+func completeEndpoint(prefix string) {
+	candidates := knownDevices().Complete(prefix)
+	seen := map[string]bool{}
+	for _, candidate := range candidates {
+		seen[candidate] = true
+	}
+	add := func(candidate string) {
+		if !seen[candidate] && strings.HasPrefix(candidate, prefix) {
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+	if fleet, err := lucigo.LoadFleet(CLI.Fleet.Inventory); err == nil {
+		for _, device := range fleet.Devices {
+			add(device.Name)
+			add(device.Endpoint)
+		}
+	}
+	if endpoint, ok := runningBroker(); ok {
+		add(endpoint.ToURL())
+	}
+	d := newDiscovery()
+	for _, device := range d.FindAll() {
+		add(device.Endpoint.ToURL())
+	}
+	for _, candidate := range candidates {
+		fmt.Println(candidate)
+	}
+}
+
+// knownDevices loads the devices remembered at --known-devices. Failing to,
+// it warns and starts over.
+func knownDevices() *lucigo.KnownDevices {
+	path := CLI.KnownDevices
+	if path == "" {
+		path = lucigo.DefaultKnownDevicesPath()
+	}
+	known, err := lucigo.LoadKnownDevices(path)
+	if err != nil {
+		log.Printf("Cannot read known devices: %v", err)
+	}
+	return known
+}
+
+// resolveEndpointName returns the endpoint of the device named such by -e,
+// looked up in the known devices and the fleet inventory.
+func resolveEndpointName(name string) (endpoint string, ok bool) {
+	if endpoint, ok := knownDevices().Resolve(name); ok {
+		return endpoint, true
+	}
+	if fleet, err := lucigo.LoadFleet(CLI.Fleet.Inventory); err == nil {
+		for _, device := range fleet.Devices {
+			if device.Name == name {
+				return device.Endpoint, true
+			}
+		}
+	}
+	return "", false
+}
+
+// rememberEndpoint records the device connected to as known, under the name
+// given with -e or else its host name. Brokers and the like are not
+// remembered, as they are no devices.
+func rememberEndpoint(endpoint lucigo.Endpoint, name string) {
+	switch endpoint := endpoint.(type) {
+	case lucigo.TCPEndpoint:
+		if name == "" && net.ParseIP(endpoint.Host) == nil {
+			name = endpoint.Host
+		}
+	case lucigo.TLSEndpoint:
+		if name == "" && net.ParseIP(endpoint.Host) == nil {
+			name = endpoint.Host
+		}
+	case lucigo.SerialEndpoint:
+	default:
+		return
+	}
+	known := knownDevices()
+	known.Remember(name, endpoint.ToURL())
+	if err := known.Save(); err != nil {
+		log.Printf("Cannot remember the device: %v", err)
+	}
+}
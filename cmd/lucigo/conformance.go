@@ -0,0 +1,46 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/anabrid/lucigo/lucitest"
+)
+
+func conformance() {
+	results := lucitest.RunConformance(getHybridController())
+
+	out, err := openOutput(CLI.Conformance.Output)
+	if err != nil {
+		fatal(err)
+	}
+	if CLI.Conformance.Format == "junit" {
+		err = lucitest.WriteJUnit(out, results)
+	} else {
+		err = lucitest.WriteJSON(out, results)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	failed := 0
+	for _, r := range results {
+		status := "PASS"
+		if !r.Passed() {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(os.Stderr, "%s %-20s %s\n", status, r.Name, r.Failure)
+	}
+	if failed != 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d checks failed\n", failed, len(results))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/anabrid/lucigo"
+)
+
+// storeName describes where credentials are kept, for the messages.
+func storeName(store lucigo.CredentialStore) string {
+	if file, ok := store.(*lucigo.FileStore); ok {
+		return file.Path
+	}
+	return "the keychain"
+}
+
+func credentials_set() {
+	password, err := readPassword(fmt.Sprintf("Password of %s for %s: ", CLI.Credentials.Set.User, CLI.Credentials.Set.Name))
+	if err != nil {
+		fatal(err)
+	}
+	store := lucigo.DefaultCredentialStore()
+	credential := lucigo.Credential{User: CLI.Credentials.Set.User, Password: password}
+	if err := store.Set(CLI.Credentials.Set.Name, credential); err != nil {
+		fatalf("Cannot store credential %s: %v", CLI.Credentials.Set.Name, err)
+	}
+	fmt.Fprintf(os.Stderr, "Stored credential %s in %s\n", CLI.Credentials.Set.Name, storeName(store))
+}
+
+func credentials_show() {
+	store := lucigo.DefaultCredentialStore()
+	credential, err := store.Get(CLI.Credentials.Show.Name)
+	if err != nil {
+		fatal(err)
+	}
+	// the password is never printed
+	fmt.Printf("%s: user %s in %s\n", CLI.Credentials.Show.Name, credential.User, storeName(store))
+}
+
+func credentials_delete() {
+	store := lucigo.DefaultCredentialStore()
+	if err := store.Delete(CLI.Credentials.Delete.Name); err != nil {
+		fatalf("Cannot delete credential %s: %v", CLI.Credentials.Delete.Name, err)
+	}
+}
+
+// readPassword reads the first line of stdin, after prompting for it on a
+// terminal, where it is not echoed if stty is available.
+func readPassword(prompt string) (string, error) {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, prompt)
+		if stty, err := exec.LookPath("stty"); err == nil {
+			echo := func(mode string) {
+				cmd := exec.Command(stty, mode)
+				cmd.Stdin = os.Stdin
+				cmd.Run()
+			}
+			echo("-echo")
+			defer func() {
+				echo("echo")
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("cannot read the password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
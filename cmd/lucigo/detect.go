@@ -0,0 +1,66 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/anabrid/lucigo"
+)
+
+// detect prints a table of the LUCIDACs found, such that several of them
+// can be told apart. Unknown columns are printed as "-".
+func detect() {
+	d := newDiscovery()
+	if CLI.Detect.Watch {
+		watch(&d)
+		return
+	}
+	devices := d.FindAll()
+	if len(devices) == 0 {
+		fmt.Println("No LUCIDAC found (tried Zeroconf and USB)")
+		return
+	}
+	orDash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	ip := func(ip net.IP) string {
+		if ip == nil {
+			return "-"
+		}
+		return ip.String()
+	}
+	fmt.Printf("%-20s %-28s %-15s %-25s %-17s %s\n", "NAME", "ENDPOINT", "IPV4", "IPV6", "MAC", "FIRMWARE")
+	for _, device := range devices {
+		name := device.Name
+		if name == "" {
+			name = device.SerialNumber
+		}
+		fmt.Printf("%-20s %-28s %-15s %-25s %-17s %s\n", orDash(name), device.Endpoint.ToURL(),
+			ip(device.IPv4), ip(device.IPv6),
+			orDash(device.Mac), orDash(device.Firmware))
+	}
+}
+
+// watch prints the LUCIDACs appearing and disappearing until Ctrl-C.
+func watch(d *lucigo.Discovery) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	defer d.Close()
+	d.Watch(ctx, func(event lucigo.DiscoveryEvent) {
+		sign := "+"
+		if event.Removed {
+			sign = "-"
+		}
+		fmt.Printf("%s %-28s %s\n", sign, event.Device.Endpoint.ToURL(), event.Device.Name)
+	})
+}
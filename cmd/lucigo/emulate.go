@@ -0,0 +1,199 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/anabrid/lucigo"
+	"github.com/anabrid/lucigo/lucitest"
+	"github.com/hashicorp/mdns"
+)
+
+// Upper limit of samples generated per emulated run
+const emulatedMaxSamples = 1 << 20
+
+// Samples per emulated run_data message
+const emulatedFrameSize = 256
+
+// emulator is a believable stand-in for a LUCIDAC on the network, for
+// developing GUIs and clients without hardware. It answers as the
+// emulator of emu:// does, persisting the settings, and adds entities,
+// health, runs and firmware uploads.
+type emulator struct {
+	*lucitest.Device
+	emulated  *lucigo.Emulator
+	statePath string
+
+	mu sync.Mutex // held while changing and persisting the settings
+}
+
+const emulatedMac = lucigo.EmulatedMac
+
+func newEmulator(statePath string) (*emulator, error) {
+	e := &emulator{Device: lucitest.NewDevice(), emulated: lucigo.NewEmulator(), statePath: statePath}
+	e.emulated.FwBuild = "lucigo-emulator/" + Version
+	if raw, err := os.ReadFile(statePath); err == nil {
+		var settings map[string]interface{}
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			return nil, fmt.Errorf("cannot read emulator state %s: %w", statePath, err)
+		}
+		e.emulated.SetSettings(settings)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, Type := range []string{"sys_ident", "net_status", "net_get", "net_set", "net_reset", "sys_reboot"} {
+		e.Handle(Type, e.answer)
+	}
+	e.Respond("get_entities", map[string]interface{}{
+		"entities": map[string]interface{}{
+			emulatedMac: map[string]interface{}{
+				"class": 1, "type": 0, "variant": 0, "version": "0.0.0",
+				"/0": map[string]interface{}{
+					"class": 2, "type": 0, "variant": 0, "version": "0.0.0",
+					"/M0": map[string]interface{}{"class": 3, "type": 0, "variant": 0, "version": "0.0.0"},
+					"/M1": map[string]interface{}{"class": 3, "type": 1, "variant": 0, "version": "0.0.0"},
+					"/U":  map[string]interface{}{"class": 4, "type": 0, "variant": 0, "version": "0.0.0"},
+					"/C":  map[string]interface{}{"class": 5, "type": 0, "variant": 0, "version": "0.0.0"},
+					"/I":  map[string]interface{}{"class": 6, "type": 0, "variant": 0, "version": "0.0.0"},
+				},
+			},
+		},
+	})
+	e.Respond("sys_health", map[string]interface{}{
+		"temperatures": map[string]interface{}{"mainboard": 38.5},
+		"voltages":     map[string]interface{}{"+15V": 15.0, "-15V": -15.0, "+3V3": 3.3},
+	})
+	e.Handle("start_run", e.startRun)
+	// takes firmware uploads, without installing them of course
+	(&lucitest.Firmware{}).Install(e.Device)
+	return e, nil
+}
+
+// answer answers as the emulator of emu:// and persists the settings it
+// changed.
+func (e *emulator) answer(req *lucitest.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	res := e.emulated.Answer(req.SendEnvelope)
+	if res.Code != 0 {
+		req.Fail(res.Code, res.Error)
+		return
+	}
+	if req.Type == "net_set" || req.Type == "net_reset" {
+		raw, _ := json.MarshalIndent(e.emulated.Settings(), "", "  ")
+		if err := os.WriteFile(e.statePath, raw, 0644); err != nil {
+			req.Fail(-1, fmt.Sprintf("cannot persist settings: %v", err))
+			return
+		}
+	}
+	req.Reply(res.Msg)
+}
+
+// startRun fakes a run: Even channels see a sine wave, odd ones an
+// exponential decay, both with the channel index entering the frequency
+// and time constant.
+func (e *emulator) startRun(req *lucitest.Request) {
+	var msg struct {
+		Id     string           `json:"id"`
+		Config lucigo.RunConfig `json:"config"`
+		DAQ    lucigo.DAQConfig `json:"daq_config"`
+	}
+	raw, _ := json.Marshal(req.Msg)
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		req.Fail(-1, fmt.Sprintf("cannot decode start_run: %v", err))
+		return
+	}
+	if err := msg.Config.Validate(); err != nil {
+		req.Fail(-1, err.Error())
+		return
+	}
+	req.Reply(map[string]interface{}{})
+
+	state := "NEW"
+	change := func(next string) {
+		req.Send("run_state_change", map[string]interface{}{"id": msg.Id, "old": state, "new": next})
+		state = next
+	}
+	change("TAKE_OFF")
+	change("IC")
+	change("OP")
+
+	samples := 0
+	if msg.DAQ.NumChannels > 0 && msg.DAQ.SampleRate > 0 {
+		samples = int(math.Min(float64(msg.Config.OpTime)*1e-9*float64(msg.DAQ.SampleRate), emulatedMaxSamples))
+	}
+	for offset := 0; offset < samples; offset += emulatedFrameSize {
+		frame := make([][]float64, 0, emulatedFrameSize)
+		for i := offset; i < samples && i < offset+emulatedFrameSize; i++ {
+			t := msg.DAQ.SampleTime(i) / (float64(msg.Config.OpTime) * 1e-9) // in units of OP time
+			sample := make([]float64, msg.DAQ.NumChannels)
+			for c := range sample {
+				var value float64
+				if c%2 == 0 {
+					value = math.Sin(2 * math.Pi * float64(c/2+1) * t)
+				} else {
+					value = math.Exp(-t * float64(c/2+1) * 5)
+				}
+				sample[c] = math.Round(value / lucigo.DefaultGain)
+			}
+			frame = append(frame, sample)
+		}
+		req.Send("run_data", map[string]interface{}{"id": msg.Id, "entity": []string{emulatedMac, "0"}, "offset": offset, "data": frame})
+	}
+
+	change("OP_END")
+	change("DONE")
+}
+
+// advertise announces the emulator via mDNS (Zeroconf), as the firmware does.
+func advertise(port int) (*mdns.Server, error) {
+	host, _ := os.Hostname()
+	service, err := mdns.NewMDNSService("lucidac-emulator", "_lucijsonl._tcp", "", "", port, nil,
+		[]string{"emulator", "mac=" + emulatedMac, "fw_name=LUCIDAC", "fw_build=lucigo-emulator/" + Version})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("emulate: Advertising on %s via mDNS\n", host)
+	return mdns.NewServer(&mdns.Config{Zone: service})
+}
+
+func emulate() {
+	e, err := newEmulator(CLI.Emulate.State)
+	if err != nil {
+		fatal(err)
+	}
+	listener, err := net.Listen("tcp", CLI.Emulate.Listen)
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Emulating a LUCIDAC at tcp://%s\n", listener.Addr())
+
+	if CLI.Emulate.Mdns {
+		// the advertisement ends with the process
+		if _, err := advertise(listener.Addr().(*net.TCPAddr).Port); err != nil {
+			fatalf("Cannot advertise via mDNS: %v", err)
+		}
+	}
+	fatal(e.Serve(listener))
+}
+
+// emu serves the emulator of emu:// on TCP, one for all connections.
+func emu() {
+	listener, err := net.Listen("tcp", CLI.Emu.Listen)
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Emulating a LUCIDAC at tcp://%s\n", listener.Addr())
+	fatal(lucigo.EmulatorEndpoint{Emulator: lucigo.NewEmulator()}.Serve(listener))
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/anabrid/lucigo"
+)
+
+// cliError is an error lucigo exits with. With --json-errors, it is written
+// to stderr as a single JSON object, for supervising scripts and the
+// lucigui backend:
+//
+//	{"class":"device","message":"net_get returned code -3: not logged in","code":-3,"endpoint":"tcp://192.168.1.101:5732"}
+type cliError struct {
+	Class    string `json:"class"`
+	Message  string `json:"message"`
+	Code     int    `json:"code,omitempty"`     // error code answered by the device
+	Endpoint string `json:"endpoint,omitempty"` // of the device talked to
+	Hint     string `json:"hint,omitempty"`
+}
+
+// Classes of a cliError
+const (
+	errorUsage       = "usage"       // invalid arguments or configuration
+	errorConnection  = "connection"  // no device found or the connection failed
+	errorDevice      = "device"      // the device answered with an error code
+	errorIO          = "io"          // reading or writing files
+	errorInterrupted = "interrupted" // by the user
+	errorUnsupported = "unsupported" // not built in
+	errorOther       = "error"
+)
+
+// endpointInUse is the endpoint of the device, once known.
+var endpointInUse string
+
+// deviceCode finds the error code in messages such as "net_get returned
+// code -3: not logged in", the wording of all errors answered by devices.
+var deviceCode = regexp.MustCompile(`returned code (-?\d+)`)
+
+// classifyError describes the error for --json-errors. Like classifyLog,
+// it falls back to the wording of the message.
+func classifyError(message string, err error) cliError {
+	e := cliError{Class: errorOther, Message: strings.TrimSpace(message), Endpoint: endpointInUse}
+	var pathErr *fs.PathError
+	var netErr net.Error
+	var refused *lucigo.DeviceError
+	lower := strings.ToLower(e.Message)
+	if errors.As(err, &refused) {
+		e.Class = errorDevice
+		e.Code = refused.Code
+		return e
+	}
+	if m := deviceCode.FindStringSubmatch(e.Message); m != nil {
+		e.Class = errorDevice
+		e.Code, _ = strconv.Atoi(m[1])
+		return e
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		e.Class = errorInterrupted
+	case errors.As(err, &pathErr) && strings.HasPrefix(pathErr.Path, "/dev/"):
+		e.Class = errorConnection // serial port
+		e.Hint = "Check that the LUCIDAC is plugged in and the serial port is not in use"
+	case errors.As(err, &pathErr):
+		e.Class = errorIO
+		e.Hint = "Check the path and its permissions"
+	case errors.As(err, &netErr), errors.Is(err, lucigo.ErrTimeout), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		e.Class = errorConnection
+		e.Hint = "Check that the LUCIDAC is powered and reachable, or give its endpoint with -e or LUCIDAC_ENDPOINT"
+	case strings.Contains(lower, "built without"):
+		e.Class = errorUnsupported
+		e.Hint = "Rebuild lucigo with the build tag, see the README"
+	case strings.HasPrefix(lower, "invalid") || strings.HasPrefix(lower, "unknown") || strings.HasPrefix(lower, "need") || strings.HasPrefix(lower, "no device"):
+		e.Class = errorUsage
+		e.Hint = "See lucigo --help"
+	}
+	return e
+}
+
+// fatal ends lucigo with the error like log.Fatal, or as JSON with
+// --json-errors.
+func fatal(v ...interface{}) {
+	exitWith(1, classifyError(fmt.Sprint(v...), errorIn(v)), true)
+}
+
+// fatalf is fatal with formatting, like log.Fatalf.
+func fatalf(format string, v ...interface{}) {
+	exitWith(1, classifyError(fmt.Sprintf(format, v...), errorIn(v)), true)
+}
+
+// errorIn returns the first error of the arguments of fatal, as cause.
+func errorIn(v []interface{}) error {
+	for _, arg := range v {
+		if err, ok := arg.(error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// exitWith reports the error and exits with the given status. Without
+// --json-errors, the message goes to the standard logger if viaLog is set,
+// as for log.Fatal, and to stderr otherwise.
+func exitWith(status int, e cliError, viaLog bool) {
+	switch {
+	case jsonErrors():
+		out, _ := json.Marshal(e)
+		fmt.Fprintf(os.Stderr, "%s\n", out)
+	case viaLog:
+		log.Print(e.Message)
+	default:
+		fmt.Fprintln(os.Stderr, e.Message)
+	}
+	os.Exit(status)
+}
+
+// jsonErrors tells whether --json-errors is given, also before the command
+// line is parsed completely.
+func jsonErrors() bool {
+	if CLI.JsonErrors {
+		return true
+	}
+	if value, ok := os.LookupEnv("LUCIGO_JSON_ERRORS"); ok {
+		enabled, _ := strconv.ParseBool(value)
+		return enabled
+	}
+	for _, arg := range os.Args[1:] {
+		if arg == "--json-errors" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+)
+
+// events prints the unsolicited messages of the device as JSON lines until
+// interrupted.
+func events() {
+	hc := getHybridController()
+	sub := hc.Subscribe(CLI.Events.Types...)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		sub.Close()
+	}()
+	for event := range sub.C {
+		out, _ := json.Marshal(event)
+		fmt.Printf("%s\n", out)
+	}
+	if dropped := sub.Dropped(); dropped != 0 {
+		log.Printf("events: Missed %d messages\n", dropped)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/anabrid/lucigo"
+)
+
+// flash uploads a firmware image. An upload interrupted with Ctrl-C, or by
+// a broken connection, continues where it stopped when run again.
+func flash() {
+	image, err := os.ReadFile(CLI.Flash.Image)
+	if err != nil {
+		fatal(err)
+	}
+	hc := getHybridController()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	started := time.Now()
+	resumed := -1 // bytes the device had of an earlier upload
+	upload := &lucigo.FirmwareUpload{
+		Image:     image,
+		ChunkSize: CLI.Flash.ChunkSize,
+		Window:    CLI.Flash.Window,
+		Progress: func(received, total int) {
+			if resumed < 0 {
+				resumed = received
+			}
+			rate := float64(received-resumed) / time.Since(started).Seconds()
+			fmt.Fprintf(os.Stderr, "\rUploaded %d of %d bytes (%.0f%%), %.1f kB/s ", received, total, 100*float64(received)/float64(max(total, 1)), rate/1e3)
+		},
+	}
+	err = upload.Run(ctx, hc)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		fatalf("Firmware upload failed, run again to resume: %v", err)
+	}
+	fmt.Printf("Installed %s (%d bytes) in %s\n", CLI.Flash.Image, len(image), time.Since(started).Round(time.Second))
+}
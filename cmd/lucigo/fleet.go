@@ -0,0 +1,269 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/anabrid/lucigo"
+)
+
+var unsafeFileName = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// fleetDevices loads the inventory and selects the devices by --tag.
+func fleetDevices() (*lucigo.Fleet, []lucigo.FleetDevice) {
+	fleet, err := lucigo.LoadFleet(CLI.Fleet.Inventory)
+	if err != nil {
+		fatal(err)
+	}
+	fleet.Concurrency = CLI.Fleet.Concurrency
+	fleet.Connect = func(device lucigo.FleetDevice) (*lucigo.HybridController, error) {
+		endpoint, err := lucigo.ParseEndpoint(device.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		hc := &lucigo.HybridController{Endpoint: endpoint, Tracer: commandTracer, Timeout: CLI.Timeout}
+		if err := hc.Connect(); err != nil {
+			return nil, err
+		}
+		if notifier != nil {
+			notifier.Observe(hc)
+		}
+		return hc, nil
+	}
+	devices, err := fleet.Select(CLI.Fleet.Tag...)
+	if err != nil {
+		fatal(err)
+	}
+	if len(devices) == 0 {
+		fatalf("No device of %s matches %v", CLI.Fleet.Inventory, CLI.Fleet.Tag)
+	}
+	return fleet, devices
+}
+
+// reportFleet prints the results, one line per device or as JSON, and
+// exits with code 1 if any device failed.
+func reportFleet(results []lucigo.FleetResult) {
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+	if CLI.Fleet.Json {
+		out, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Printf("%s\n", out)
+	} else {
+		for _, r := range results {
+			if r.OK {
+				fmt.Printf("%-20s ok     %v\n", r.Device, r.Result)
+			} else {
+				fmt.Printf("%-20s FAILED %s\n", r.Device, r.Error)
+			}
+		}
+		fmt.Printf("%d of %d devices ok\n", len(results)-failed, len(results))
+	}
+	if failed != 0 {
+		os.Exit(1)
+	}
+}
+
+func fleet_status() {
+	fleet, devices := fleetDevices()
+	reportFleet(fleet.Do(devices, func(hc *lucigo.HybridController, device lucigo.FleetDevice) (interface{}, error) {
+		sent := time.Now()
+		ident, err := hc.Query("sys_ident")
+		if err != nil {
+			return nil, err
+		}
+		rtt := time.Since(sent)
+		status, err := hc.Query("net_status")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"ident": ident.Msg, "status": status.Msg, "rtt": rtt.String()}, nil
+	}))
+}
+
+// fleet_query sends the query to all devices over a pool of connections,
+// such that it takes as long as the slowest device, not the sum of all.
+func fleet_query() {
+	var msg map[string]interface{}
+	if CLI.Fleet.Query.Msg != "" {
+		if err := json.Unmarshal([]byte(CLI.Fleet.Query.Msg), &msg); err != nil {
+			fatalf("Cannot read --msg: %v", err)
+		}
+	}
+	fleet, devices := fleetDevices()
+	pool, err := fleet.Pool(devices)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	connected := make(map[string]bool)
+	var results []lucigo.FleetResult
+	for _, r := range pool.QueryAll(CLI.Fleet.Query.Type, msg) {
+		connected[r.Device] = true
+		result := lucigo.FleetResult{Device: r.Device, OK: r.Err == nil, Duration: r.Duration}
+		if r.Err != nil {
+			result.Error = r.Err.Error()
+		} else {
+			result.Result = r.Res.Msg
+		}
+		results = append(results, result)
+	}
+	for _, device := range devices {
+		if !connected[device.Name] {
+			results = append(results, lucigo.FleetResult{Device: device.Name, Error: "not connected"})
+		}
+	}
+	pool.Close()
+	reportFleet(results)
+}
+
+// fleet_backup writes the settings of each device to <name>.json in the
+// backup directory and records them with --settings-repo, if given.
+func fleet_backup() {
+	fleet, devices := fleetDevices()
+	if err := os.MkdirAll(CLI.Fleet.Backup.Dir, 0o700); err != nil {
+		fatal(err)
+	}
+	reportFleet(fleet.Do(devices, func(hc *lucigo.HybridController, device lucigo.FleetDevice) (interface{}, error) {
+		res, err := hc.Query("net_get")
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.MarshalIndent(res.Msg, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(CLI.Fleet.Backup.Dir, unsafeFileName.ReplaceAllString(device.Name, "_")+".json")
+		if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+			return nil, err
+		}
+		recordSettings(hc, "backup", res.Msg)
+		return path, nil
+	}))
+}
+
+// fleet_flash uploads a firmware image to each device. Devices whose
+// upload was interrupted, such as with Ctrl-C, resume it when run again.
+func fleet_flash() {
+	image, err := os.ReadFile(CLI.Fleet.Flash.Image)
+	if err != nil {
+		fatal(err)
+	}
+	fleet, devices := fleetDevices()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	reportFleet(fleet.Do(devices, func(hc *lucigo.HybridController, device lucigo.FleetDevice) (interface{}, error) {
+		upload := &lucigo.FirmwareUpload{
+			Image:     image,
+			ChunkSize: CLI.Fleet.Flash.ChunkSize,
+			Window:    CLI.Fleet.Flash.Window,
+		}
+		if err := upload.Run(ctx, hc); err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("installed %s (%d bytes)", CLI.Fleet.Flash.Image, len(image)), nil
+	}))
+}
+
+// fleet_drift compares the settings of each device having a desired state
+// with it, once or every interval. Drift is logged and posted to webhooks
+// when it appears or changes, and written as InfluxDB line protocol to
+// --output on every check, for dashboards and alerts.
+func fleet_drift() {
+	fleet, selected := fleetDevices()
+	var devices []lucigo.FleetDevice // nothing desired, nothing to drift from
+	for _, device := range selected {
+		if device.Desired != "" {
+			devices = append(devices, device)
+		}
+	}
+	if len(devices) == 0 {
+		fatalf("No device selected has a desired state in %s", CLI.Fleet.Inventory)
+	}
+	var out io.WriteCloser
+	if CLI.Fleet.Drift.Output != "" {
+		var err error
+		if out, err = openOutput(CLI.Fleet.Drift.Output); err != nil {
+			fatal(err)
+		}
+		defer out.Close()
+	}
+
+	reported := make(map[string]string) // drifted keys by device, as last reported
+	for {
+		results := fleet.Do(devices, func(hc *lucigo.HybridController, device lucigo.FleetDevice) (interface{}, error) {
+			desired, err := device.DesiredSettings()
+			if err != nil {
+				return nil, err
+			}
+			res, err := hc.Apply(desired, true)
+			if err != nil {
+				return nil, err
+			}
+			return res.Diff.Keys(), nil
+		})
+
+		var buf []byte
+		for i, r := range results {
+			keys, _ := r.Result.([]string)
+			point := lucigo.InfluxPoint{
+				Measurement: "lucidac_drift",
+				Tags:        map[string]string{"device": r.Device},
+				Fields:      map[string]float64{"up": 0, "drifted": float64(len(keys))},
+				Time:        time.Now(),
+			}
+			if r.OK {
+				point.Fields["up"] = 1
+				reportDrift(devices[i], keys, reported)
+			} else {
+				log.Printf("fleet drift: Cannot check %s: %s\n", r.Device, r.Error)
+			}
+			buf = point.AppendLine(buf)
+		}
+		if out != nil {
+			if _, err := out.Write(buf); err != nil {
+				fatal(err)
+			}
+		}
+		if CLI.Fleet.Drift.Interval <= 0 {
+			return
+		}
+		time.Sleep(CLI.Fleet.Drift.Interval)
+	}
+}
+
+func reportDrift(device lucigo.FleetDevice, keys []string, reported map[string]string) {
+	summary := strings.Join(keys, ", ")
+	if reported[device.Name] == summary {
+		return
+	}
+	reported[device.Name] = summary
+	if len(keys) == 0 {
+		log.Printf("fleet drift: %s is in the desired state again\n", device.Name)
+		return
+	}
+	// printed also without -v, drift asks for attention
+	fmt.Fprintf(os.Stderr, "Drift: Settings of %s differ from %s: %s\n", device.Name, device.Desired, summary)
+	if notifier != nil {
+		notifier.Notify(lucigo.Event{
+			Type:     lucigo.EventSettingsDrift,
+			Endpoint: device.Endpoint,
+			Details:  map[string]interface{}{"device": device.Name, "settings": keys},
+		})
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// health prints the onboard temperatures and voltages and exits with code 1
+// if a temperature exceeds --max-temperature, such as for a cron job or the
+// exec check of a monitoring system.
+func health() {
+	hc := getHybridController()
+	health, err := hc.Health()
+	if err != nil {
+		fatal(err)
+	}
+	if CLI.Health.Json {
+		out, _ := json.MarshalIndent(health, "", "  ")
+		fmt.Printf("%s\n", out)
+	} else {
+		for _, sensor := range health.Sensors() {
+			fmt.Printf("%-20s %8.1f °C\n", sensor, health.Temperatures[sensor])
+		}
+		for _, rail := range health.Rails() {
+			fmt.Printf("%-20s %8.3f V\n", rail, health.Voltages[rail])
+		}
+	}
+	if sensor, celsius, ok := health.MaxTemperature(); ok && CLI.Health.MaxTemperature != 0 && celsius > CLI.Health.MaxTemperature {
+		fmt.Fprintf(os.Stderr, "Warning: %s is at %.1f °C, above %.1f °C\n", sensor, celsius, CLI.Health.MaxTemperature)
+		os.Exit(1)
+	}
+}
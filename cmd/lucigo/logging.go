@@ -0,0 +1,122 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/anabrid/lucigo"
+)
+
+// Priorities of syslog and the journal, as far as lucigo uses them
+type logPriority int
+
+const (
+	priorityErr     logPriority = 3
+	priorityWarning logPriority = 4
+	priorityInfo    logPriority = 6
+)
+
+// classifyLog guesses the priority of a message of the standard logger,
+// which has no levels, from its wording.
+func classifyLog(msg string) logPriority {
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(lower, "error") || strings.Contains(lower, "fail") || strings.Contains(lower, "cannot"):
+		return priorityErr
+	case strings.Contains(lower, "warn"):
+		return priorityWarning
+	}
+	return priorityInfo
+}
+
+// logComponent returns the component a message is about, by the
+// convention of prefixing messages with it, as in "run: Started run".
+func logComponent(msg string) string {
+	component, _, found := strings.Cut(msg, ": ")
+	if !found || strings.ContainsAny(component, " \t") {
+		return ""
+	}
+	return component
+}
+
+// layerFilter passes on the records of the library layers in --log-layer,
+// or of all if none are given.
+type layerFilter struct {
+	slog.Handler
+	layers []string
+	layer  string // of the logger, see lucigo.Logger
+}
+
+func (h layerFilter) Enabled(ctx context.Context, level slog.Level) bool {
+	shown := len(h.layers) == 0 || h.layer == "" || slices.Contains(h.layers, h.layer)
+	return shown && h.Handler.Enabled(ctx, level)
+}
+
+func (h layerFilter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	for _, attr := range attrs {
+		if attr.Key == "layer" {
+			h.layer = attr.Value.String()
+		}
+	}
+	h.Handler = h.Handler.WithAttrs(attrs)
+	return h
+}
+
+func (h layerFilter) WithGroup(name string) slog.Handler {
+	h.Handler = h.Handler.WithGroup(name)
+	return h
+}
+
+// setupLibraryLogging directs the logs of the library to the standard
+// logger, at --log-level and for the layers in --log-layer.
+func setupLibraryLogging() {
+	var level slog.Level
+	level.UnmarshalText([]byte(CLI.LogLevel))
+	options := &slog.HandlerOptions{Level: level}
+	if CLI.Log != "stderr" {
+		// timestamped by the receiver
+		options.ReplaceAttr = func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return attr
+		}
+	}
+	lucigo.Logger = slog.New(layerFilter{Handler: slog.NewTextHandler(log.Writer(), options), layers: CLI.LogLayer})
+}
+
+// setupLogging directs the standard logger to CLI.Log. Logs to stderr are
+// only shown with -v, logs to syslog or the journal always go there.
+func setupLogging(command string) {
+	defer setupLibraryLogging()
+	var w io.Writer
+	var err error
+	switch CLI.Log {
+	case "syslog":
+		w, err = newSyslogWriter()
+	case "journald":
+		w, err = newJournalWriter(map[string]string{
+			"LUCIGO_COMMAND":   command,
+			"LUCIDAC_ENDPOINT": CLI.Endpoint.String(),
+		})
+	default:
+		if !CLI.Verbose {
+			log.SetOutput(io.Discard)
+		}
+		return
+	}
+	if err != nil {
+		exitWith(2, classifyError(fmt.Sprintf("Cannot log to %s: %v", CLI.Log, err), err), false)
+	}
+	log.SetFlags(0) // timestamped by the receiver
+	log.SetOutput(w)
+}
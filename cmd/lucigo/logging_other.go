@@ -0,0 +1,21 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build windows || plan9
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+func newSyslogWriter() (io.Writer, error) {
+	return nil, fmt.Errorf("syslog is not available on %s", runtime.GOOS)
+}
+
+func newJournalWriter(fields map[string]string) (io.Writer, error) {
+	return nil, fmt.Errorf("the systemd journal is not available on %s", runtime.GOOS)
+}
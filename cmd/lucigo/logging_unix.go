@@ -0,0 +1,93 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/syslog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// syslogWriter sends each message with the priority of classifyLog.
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+func newSyslogWriter() (syslogWriter, error) {
+	w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, "lucigo")
+	return syslogWriter{w}, err
+}
+
+func (s syslogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	var err error
+	switch classifyLog(msg) {
+	case priorityErr:
+		err = s.w.Err(msg)
+	case priorityWarning:
+		err = s.w.Warning(msg)
+	default:
+		err = s.w.Info(msg)
+	}
+	return len(p), err
+}
+
+// Socket of the native protocol of systemd-journald
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalWriter sends each message to the systemd journal with the fields
+// PRIORITY, SYSLOG_IDENTIFIER, LUCIGO_COMPONENT (see logComponent) and the
+// given ones.
+type journalWriter struct {
+	conn   *net.UnixConn
+	fields map[string]string
+}
+
+func newJournalWriter(fields map[string]string) (*journalWriter, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalWriter{conn: conn, fields: fields}, nil
+}
+
+func (j *journalWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	var entry bytes.Buffer
+	journalField(&entry, "MESSAGE", msg)
+	journalField(&entry, "PRIORITY", strconv.Itoa(int(classifyLog(msg))))
+	journalField(&entry, "SYSLOG_IDENTIFIER", "lucigo")
+	journalField(&entry, "SYSLOG_PID", strconv.Itoa(os.Getpid()))
+	if component := logComponent(msg); component != "" {
+		journalField(&entry, "LUCIGO_COMPONENT", component)
+	}
+	for key, value := range j.fields {
+		if value != "" {
+			journalField(&entry, key, value)
+		}
+	}
+	_, err := j.conn.Write(entry.Bytes())
+	return len(p), err
+}
+
+// journalField appends a field in the native journal protocol, where values
+// spanning several lines are prefixed by their length.
+func journalField(entry *bytes.Buffer, key, value string) {
+	entry.WriteString(key)
+	if strings.Contains(value, "\n") {
+		entry.WriteByte('\n')
+		binary.Write(entry, binary.LittleEndian, uint64(len(value)))
+	} else {
+		entry.WriteByte('=')
+	}
+	entry.WriteString(value)
+	entry.WriteByte('\n')
+}
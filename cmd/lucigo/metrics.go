@@ -0,0 +1,109 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/anabrid/lucigo"
+)
+
+// metrics_push writes the health of the device as InfluxDB line protocol,
+// either once (for the exec input of Telegraf) or every interval.
+func metrics_push() {
+	hc := getHybridController()
+	tags := map[string]string{"endpoint": hc.Endpoint.ToURL()}
+	if ident, err := hc.SysIdent(); err == nil && ident.Mac != "" {
+		tags["mac"] = ident.Mac
+	}
+
+	var out io.WriteCloser // kept open, unless posting every point on its own
+	for {
+		line := healthPoint(hc, tags).AppendLine(nil)
+		var err error
+		if out == nil {
+			out, err = openOutput(CLI.Metrics.Push.Output)
+		}
+		if err == nil {
+			_, err = out.Write(line)
+		}
+		if isURL(CLI.Metrics.Push.Output) {
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+			out = nil
+		}
+		if err != nil {
+			fatal(err)
+		}
+		if CLI.Metrics.Push.Once {
+			break
+		}
+		time.Sleep(CLI.Metrics.Push.Interval)
+	}
+	if out != nil {
+		out.Close()
+	}
+}
+
+// healthPoint probes the device with net_status. The fields are up (0 or
+// 1), the round trip time in seconds, the count of malformed lines, all
+// numbers and booleans of the status, such as link=1, and the onboard
+// temperatures and voltages, such as temperature_mainboard=41.5, if the
+// firmware monitors them. An unreachable device is reconnected for the
+// next probe.
+func healthPoint(hc *lucigo.HybridController, tags map[string]string) lucigo.InfluxPoint {
+	point := lucigo.InfluxPoint{
+		Measurement: CLI.Metrics.Push.Measurement,
+		Tags:        tags,
+		Fields:      map[string]float64{"up": 0},
+		Time:        time.Now(),
+	}
+	res, err := hc.Query("net_status")
+	var refused *lucigo.DeviceError
+	if errors.As(err, &refused) {
+		log.Printf("metrics: %v", err)
+	} else if err != nil {
+		log.Printf("metrics: net_status failed: %v", err)
+		if err := hc.Reconnect(); err != nil {
+			log.Printf("metrics: Cannot reconnect: %v", err)
+		}
+	} else {
+		point.Fields["up"] = 1
+		point.Fields["rtt_seconds"] = time.Since(point.Time).Seconds()
+		flattenFields(point.Fields, "", res.Msg)
+		if health, err := hc.Health(); err == nil {
+			for sensor, celsius := range health.Temperatures {
+				point.Fields["temperature_"+sensor] = celsius
+			}
+			for rail, volts := range health.Voltages {
+				point.Fields["voltage_"+rail] = volts
+			}
+		}
+	}
+	point.Fields["malformed_lines"] = float64(hc.MalformedCount())
+	return point
+}
+
+// flattenFields adds the numbers and booleans of a JSON object to fields,
+// with the keys of nested objects joined by underscores.
+func flattenFields(fields map[string]float64, prefix string, msg map[string]interface{}) {
+	for key, value := range msg {
+		switch v := value.(type) {
+		case float64:
+			fields[prefix+key] = v
+		case bool:
+			fields[prefix+key] = 0
+			if v {
+				fields[prefix+key] = 1
+			}
+		case map[string]interface{}:
+			flattenFields(fields, prefix+key+"_", v)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/anabrid/lucigo"
+)
+
+// dialMQTT connects to an MQTT broker. It is only available with the mqtt
+// build tag, see mqtt_paho.go.
+var dialMQTT func(broker string, clientID string) (lucigo.MQTTClient, error)
+
+func run_mqtt() {
+	if dialMQTT == nil {
+		exitWith(2, classifyError("This lucigo is built without MQTT support. Rebuild it with -tags mqtt, see the README.", nil), false)
+	}
+	hc := getHybridController()
+	client, err := dialMQTT(CLI.Mqtt.Broker, CLI.Mqtt.ClientId)
+	if err != nil {
+		fatal(err)
+	}
+	defer client.Close()
+
+	bridge := &lucigo.MQTTBridge{
+		Controller:     hc,
+		Client:         client,
+		Topic:          CLI.Mqtt.Topic,
+		StatusInterval: CLI.Mqtt.StatusInterval,
+		Commands:       CLI.Mqtt.Commands,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "Bridging %s to MQTT below %s/\n", hc.Endpoint.ToURL(), CLI.Mqtt.Topic)
+	if err := bridge.Serve(ctx); err != nil {
+		fatal(err)
+	}
+}
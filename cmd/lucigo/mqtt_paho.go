@@ -0,0 +1,15 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build mqtt
+
+package main
+
+import (
+	"github.com/anabrid/lucigo"
+)
+
+func init() {
+	dialMQTT = lucigo.DialMQTT
+}
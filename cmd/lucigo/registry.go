@@ -0,0 +1,70 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/anabrid/lucigo"
+)
+
+// registry returns the client of the registry given with --registry, nil
+// without. The token is taken from the environment only, such that it does
+// not show up in process listings.
+func registry() *lucigo.Registry {
+	if CLI.Registry == "" {
+		return nil
+	}
+	return &lucigo.Registry{URL: CLI.Registry, Token: os.Getenv("LUCIGO_REGISTRY_TOKEN")}
+}
+
+func warnRegistry(err error) {
+	fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+}
+
+// register keeps the device registered until interrupted.
+func register() {
+	reg := registry()
+	if reg == nil {
+		fatal("Need the URL of the registry, given with --registry or LUCIGO_REGISTRY")
+	}
+	hc := getHybridController()
+	registration := lucigo.Registration{Kind: "device", Name: CLI.Register.Name, Endpoint: hc.Endpoint.ToURL()}
+	describe := func(r *lucigo.Registration) { r.Describe(hc) }
+	if CLI.Register.Once {
+		describe(&registration)
+		if err := reg.Put(registration); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "Registering %s at %s every %s\n", hc.Endpoint.ToURL(), CLI.Registry, CLI.Register.Interval)
+	reg.Heartbeat(ctx, registration, CLI.Register.Interval, describe, warnRegistry)
+}
+
+// registerProxy registers the webserver as proxy of its device, if
+// --registry is given. The device is only described once, before the
+// webserver talks to it.
+func registerProxy(server *LuciGoWebServer) {
+	reg := registry()
+	if reg == nil {
+		return
+	}
+	registration := lucigo.Registration{Kind: "proxy", Endpoint: "http://" + server.ListenAddress}
+	if hc, ok := server.proxied(); ok {
+		registration.Device = hc.Endpoint.ToURL()
+		registration.Describe(hc)
+	}
+	if host, err := os.Hostname(); err == nil && registration.Name != "" {
+		registration.Name = host + "-" + registration.Name
+	}
+	go reg.Heartbeat(context.Background(), registration, time.Minute, nil, warnRegistry)
+}
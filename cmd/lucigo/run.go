@@ -0,0 +1,320 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/anabrid/lucigo"
+)
+
+// openOutput opens the given file for writing, where "-" means stdout and
+// http(s) URLs are posted to, see httpOutput.
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "-" || path == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	if isURL(path) {
+		return postOutput(path), nil
+	}
+	return os.Create(path)
+}
+
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// httpOutput streams everything written as body of a POST request, such
+// as to the write API of InfluxDB. The Authorization header is taken from
+// the environment variable LUCIGO_HTTP_AUTHORIZATION (e.g. "Token ...").
+type httpOutput struct {
+	*io.PipeWriter
+	done chan error
+}
+
+func postOutput(url string) *httpOutput {
+	body, w := io.Pipe()
+	out := &httpOutput{w, make(chan error, 1)}
+	go func() {
+		req, err := http.NewRequest(http.MethodPost, url, body)
+		if err == nil {
+			if auth := os.Getenv("LUCIGO_HTTP_AUTHORIZATION"); auth != "" {
+				req.Header.Set("Authorization", auth)
+			}
+			var res *http.Response
+			if res, err = http.DefaultClient.Do(req); err == nil {
+				res.Body.Close()
+				if res.StatusCode >= 300 {
+					err = fmt.Errorf("POST %s: %s", url, res.Status)
+				}
+			}
+		}
+		body.CloseWithError(err) // let writes fail once the request did
+		out.done <- err
+	}()
+	return out
+}
+
+func (o *httpOutput) Close() error {
+	o.PipeWriter.Close()
+	return <-o.done
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// closingSink closes the output file once the sink is done.
+type closingSink struct {
+	lucigo.Sink
+	out io.Closer
+}
+
+func (s closingSink) Close() error {
+	err := s.Sink.Close()
+	if cerr := s.out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// sinkFormats maps the values of --format to constructors of the data sink
+// writing to the given output path. Formats with optional dependencies
+// register themselves in build-tagged files.
+var sinkFormats = map[string]func(output string) (lucigo.Sink, error){
+	"csv":    writerSink(func(w io.Writer) lucigo.Sink { return lucigo.NewCSVSink(w) }),
+	"ndjson": writerSink(func(w io.Writer) lucigo.Sink { return lucigo.NewNDJSONSink(w) }),
+	"npy":    writerSink(func(w io.Writer) lucigo.Sink { return lucigo.NewNPYSink(w) }),
+	"influx": writerSink(func(w io.Writer) lucigo.Sink { return lucigo.NewInfluxSink(w) }),
+	"npy-mmap": func(output string) (lucigo.Sink, error) {
+		if output == "-" || output == "" || isURL(output) {
+			return nil, fmt.Errorf("the npy-mmap format can only be written to a file")
+		}
+		return lucigo.NewMmapSink(output), nil
+	},
+}
+
+func writerSink(create func(io.Writer) lucigo.Sink) func(output string) (lucigo.Sink, error) {
+	return func(output string) (lucigo.Sink, error) {
+		out, err := openOutput(output)
+		if err != nil {
+			return nil, err
+		}
+		return closingSink{create(out), out}, nil
+	}
+}
+
+func formatNames() string {
+	names := []string{}
+	for name := range sinkFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func run_capture() {
+	names := CLI.Run.ChannelNames
+	num_channels := CLI.Run.Channels
+	if num_channels == 0 {
+		num_channels = len(names)
+	}
+
+	config := lucigo.RunConfig{
+		IcTime:         uint64(CLI.Run.IcTime.Nanoseconds()),
+		OpTime:         uint64(CLI.Run.OpTime.Nanoseconds()),
+		HaltOnOverload: CLI.Run.HaltOnOverload,
+		Repetitions:    CLI.Run.Repeat,
+
+		WaitForExternalTrigger: CLI.Run.WaitTrigger,
+		HaltOnExternalTrigger:  CLI.Run.HaltTrigger,
+	}
+	if err := config.Validate(); err != nil {
+		fatalf("Invalid run configuration: %v", err)
+	}
+	daq := lucigo.DAQConfig{
+		NumChannels:  num_channels,
+		SampleOp:     num_channels != 0,
+		SampleOpEnd:  num_channels != 0,
+		SampleRate:   CLI.Run.SampleRate,
+		ChannelNames: names,
+	}
+
+	newSink, ok := sinkFormats[CLI.Run.Format]
+	if !ok {
+		fatalf("Unknown data format '%s', available are: %s", CLI.Run.Format, formatNames())
+	}
+	output := CLI.Run.Output
+	var workspace *lucigo.WorkspaceRun
+	if CLI.Run.Workspace != "" {
+		workspace, output = openWorkspaceRun(output, config, daq)
+	}
+	var upload *s3Output
+	if isS3(output) {
+		upload, output = newS3Output(output)
+	}
+	sink, err := newSink(output)
+	if err != nil {
+		fatal(err)
+	}
+	if upload != nil {
+		sink = upload.upload(sink, output)
+	}
+	if CLI.Run.Decimate > 1 {
+		sink = lucigo.Decimate(sink, CLI.Run.Decimate)
+	}
+	if CLI.Run.Average > 1 {
+		sink = lucigo.BoxcarAverage(sink, CLI.Run.Average)
+	}
+
+	if CLI.Run.Simulate != "" {
+		circuit := loadCircuit(CLI.Run.Simulate)
+		if workspace != nil {
+			saveWorkspaceCircuit(workspace, nil, circuit)
+		}
+		run_simulated(circuit, config, daq, sink)
+		return
+	} else if len(CLI.Run.Var) != 0 {
+		fatalf("Circuit variables (--var) need a circuit template given with --simulate")
+	}
+
+	hc := getHybridController()
+	if workspace != nil {
+		saveWorkspaceCircuit(workspace, hc, nil)
+	}
+	sinks := []lucigo.Sink{sink}
+	if meta := metadataSink(hc, output); meta != nil {
+		if upload != nil {
+			meta = upload.upload(meta, metadataPath(output))
+		}
+		sinks = append(sinks, meta)
+	}
+
+	if config.Repetitions > 1 {
+		run_repeated(hc, config, daq, sinks...)
+		return
+	}
+
+	run, err := hc.StartRun(config, daq)
+	if err != nil {
+		fatalf("Could not start run: %v", err)
+	}
+	log.Printf("run: Started run %s\n", run.Id)
+	run.Backpressure = lucigo.Backpressure(CLI.Run.Backpressure)
+	run.Reattach = CLI.Run.Reattach
+	if notifier != nil {
+		notifier.ObserveRun(run)
+	}
+	stopOnInterrupt(run)
+
+	err = run.Capture(sinks...)
+	if frames, samples := run.Dropped(); frames != 0 {
+		// printed also without -v, as the data written is incomplete
+		fmt.Fprintf(os.Stderr, "Warning: Dropped %d frames (%d samples) as writing could not keep up\n", frames, samples)
+	}
+	if err != nil {
+		fatalf("Run %s failed: %v", run.Id, err)
+	}
+	log.Printf("run: Run %s finished in state %s\n", run.Id, run.State())
+}
+
+// stopOnInterrupt stops the run on the first interrupt, such that the data
+// acquired so far is written. Another interrupt aborts right away.
+func stopOnInterrupt(run *lucigo.Run) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		signal.Stop(interrupt)
+		log.Printf("run: Stopping run %s, interrupt again to abort\n", run.Id)
+		if err := run.Stop(); err != nil {
+			log.Printf("run: Could not stop run %s: %v\n", run.Id, err)
+		}
+	}()
+}
+
+// loadCircuit reads the circuit file at path, filling in the variables
+// given with --var if it is a template.
+func loadCircuit(path string) []byte {
+	tmpl, err := lucigo.LoadCircuitTemplate(path)
+	if err != nil {
+		fatal(err)
+	}
+	circuit, err := tmpl.Expand(CLI.Run.Var)
+	if err != nil {
+		fatalf("Invalid circuit template %s: %v", path, err)
+	}
+	return circuit
+}
+
+// run_simulated writes the data of a simulated run of the circuit to the sink.
+func run_simulated(circuit []byte, config lucigo.RunConfig, daq lucigo.DAQConfig, sink lucigo.Sink) {
+	if config.Repetitions > 1 {
+		fatalf("Simulated runs are deterministic, cannot repeat them")
+	}
+	sim := &lucigo.Simulator{}
+	if err := json.Unmarshal(circuit, &sim.Circuit); err != nil {
+		fatalf("Cannot read circuit %s: %v", CLI.Run.Simulate, err)
+	}
+	run, err := sim.StartRun(config, daq)
+	if err != nil {
+		fatalf("Could not start simulation: %v", err)
+	}
+	if err := run.Capture(sink); err != nil {
+		fatalf("Simulation failed: %v", err)
+	}
+	log.Printf("run: Simulation finished in state %s\n", run.State())
+}
+
+// metadataSink creates the sink for the metadata sidecar file next to the
+// data file at output, i.e. data.csv gets a data.meta.json. Nothing is
+// written for data sent to stdout or posted to a URL.
+func metadataSink(hc *lucigo.HybridController, output string) lucigo.Sink {
+	if !CLI.Run.Metadata || output == "-" || output == "" || isURL(output) {
+		return nil
+	}
+	out, err := os.Create(metadataPath(output))
+	if err != nil {
+		fatal(err)
+	}
+	meta := lucigo.NewMetadataSink(out, hc)
+	meta.Metadata.Lucigo = Version
+	return closingSink{meta, out}
+}
+
+func metadataPath(output string) string {
+	return strings.TrimSuffix(output, filepath.Ext(output)) + ".meta.json"
+}
+
+// run_repeated writes the aggregate over config.Repetitions runs to the sinks.
+func run_repeated(hc *lucigo.HybridController, config lucigo.RunConfig, daq lucigo.DAQConfig, sinks ...lucigo.Sink) {
+	agg, err := hc.RepeatRun(config, daq)
+	if err != nil {
+		fatalf("Repeated run failed: %v", err)
+	}
+	log.Printf("run: Aggregated %d runs\n", len(agg.Runs))
+
+	for _, sink := range sinks {
+		if err := sink.Begin(agg.Runs[len(agg.Runs)-1].Run); err != nil {
+			fatal(err) // not begun, so not to be closed
+		}
+		err = sink.WriteFrame(agg.Frame())
+		if cerr := sink.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fatal(err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/anabrid/lucigo"
+)
+
+func isS3(output string) bool {
+	return strings.HasPrefix(output, "s3://")
+}
+
+// s3Output stages the files of an s3:// output, i.e. the data file and
+// its metadata sidecar, in a temporary directory and uploads each once it
+// is completely written. This works for all formats, including those
+// which cannot be streamed such as HDF5.
+type s3Output struct {
+	bucket *lucigo.S3Bucket
+	prefix string // of the keys, the path of the URL up to the file name
+	dir    string
+}
+
+// newS3Output prepares the upload to the s3:// URL and returns the local
+// path to write the data file to.
+func newS3Output(output string) (*s3Output, string) {
+	bucket, key, err := lucigo.ParseS3URL(output)
+	if err != nil {
+		fatal(err)
+	}
+	if key == "" || strings.HasSuffix(key, "/") {
+		fatalf("Need a file name in the S3 URL, such as s3://%s/%srun.csv", bucket, key)
+	}
+	o := &s3Output{bucket: lucigo.NewS3BucketFromEnv(bucket)}
+	o.bucket.Retries = CLI.Run.S3Retries
+	o.prefix, key = path.Split(key)
+	if o.dir, err = os.MkdirTemp("", "lucigo-s3-"); err != nil {
+		fatal(err)
+	}
+	return o, filepath.Join(o.dir, key)
+}
+
+// upload wraps the sink writing the file at local, uploading it once the
+// sink is closed.
+func (o *s3Output) upload(sink lucigo.Sink, local string) lucigo.Sink {
+	return uploadingSink{sink, o, local}
+}
+
+type uploadingSink struct {
+	lucigo.Sink
+	o     *s3Output
+	local string
+}
+
+func (s uploadingSink) Close() error {
+	err := s.Sink.Close()
+	if err == nil {
+		key := s.o.prefix + filepath.Base(s.local)
+		log.Printf("run: Uploading %s to s3://%s/%s\n", filepath.Base(s.local), s.o.bucket.Bucket, key)
+		err = s.o.bucket.PutFile(key, s.local)
+	}
+	os.Remove(s.local)
+	os.Remove(s.o.dir) // once the last file is uploaded
+	return err
+}
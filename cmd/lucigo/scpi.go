@@ -0,0 +1,23 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/anabrid/lucigo"
+)
+
+func run_scpi() {
+	hc := getHybridController()
+	listener, err := net.Listen("tcp", CLI.Scpi.Listen)
+	if err != nil {
+		fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	fmt.Printf("Serving %s as SCPI instrument at TCPIP::<host>::%d::SOCKET\n", hc.Endpoint.ToURL(), port)
+	fatal(lucigo.NewSCPIServer(hc).Serve(listener))
+}
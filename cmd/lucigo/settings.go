@@ -0,0 +1,78 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/anabrid/lucigo"
+)
+
+// recording guards the repository, as devices of a fleet are backed up concurrently
+var recording sync.Mutex
+
+// recordSettings commits the settings of the device to the repository
+// given with --settings-repo, if any. Failing to record is only warned
+// about, the settings were read or written already.
+func recordSettings(hc *lucigo.HybridController, action string, settings map[string]interface{}) {
+	if CLI.SettingsRepo == "" {
+		return
+	}
+	serial := ""
+	if ident, err := hc.SysIdent(); err == nil {
+		serial = ident.Mac
+	}
+	history := &lucigo.SettingsHistory{Dir: CLI.SettingsRepo}
+	recording.Lock()
+	defer recording.Unlock()
+	commit, err := history.Record(serial, action, settings)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Warning: Could not record the settings in %s: %v\n", CLI.SettingsRepo, err)
+	case commit == "":
+		log.Printf("Settings unchanged since the last record in %s\n", CLI.SettingsRepo)
+	default:
+		log.Printf("Recorded the settings in %s as commit %s\n", CLI.SettingsRepo, commit)
+	}
+}
+
+// netReset resets the settings to the factory defaults, once confirmed.
+func netReset() {
+	hc := getHybridController()
+	device := hc.Endpoint.ToURL()
+	if ident, err := hc.SysIdent(); err == nil {
+		device = fmt.Sprintf("%s %s at %s", ident.FwName, ident.Mac, device)
+	}
+	if !CLI.NetReset.Yes && !confirm(fmt.Sprintf("Reset the permanent settings of %s to the factory defaults? [y/N] ", device)) {
+		fatalf("Not confirmed, nothing was reset")
+	}
+	if err := hc.ResetSettings(); err != nil {
+		fatalf("Cannot reset the settings: %v", err)
+	}
+	if res, err := hc.Query("net_get"); err == nil {
+		recordSettings(hc, "reset", res.Msg)
+	}
+	fmt.Fprintf(os.Stderr, "Reset the permanent settings of %s\n", device)
+	if CLI.NetReset.Reboot {
+		reboot(hc)
+	}
+}
+
+// confirm asks the question on the terminal and tells whether it was
+// answered with yes. Without terminal, nobody can answer.
+func confirm(question string) bool {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		fatalf("Cannot ask for confirmation without a terminal, confirm with --yes")
+	}
+	fmt.Fprint(os.Stderr, question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build hdf5
+
+package main
+
+import "github.com/anabrid/lucigo"
+
+func init() {
+	sinkFormats["hdf5"] = func(output string) (lucigo.Sink, error) {
+		return lucigo.NewHDF5Sink(output), nil
+	}
+}
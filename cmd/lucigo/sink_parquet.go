@@ -0,0 +1,17 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build parquet
+
+package main
+
+import (
+	"io"
+
+	"github.com/anabrid/lucigo"
+)
+
+func init() {
+	sinkFormats["parquet"] = writerSink(func(w io.Writer) lucigo.Sink { return lucigo.NewParquetSink(w) })
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/anabrid/lucigo"
+	"github.com/nqd/flat"
+)
+
+func snapshot_create() {
+	hc := getHybridController()
+	snap, err := lucigo.TakeSnapshot(hc)
+	if err != nil {
+		fatal(err)
+	}
+	snap.Lucigo = Version
+	recordSettings(hc, "backup", snap.Settings)
+	if err := snap.Save(CLI.Snapshot.Create.File); err != nil {
+		fatal(err)
+	}
+	log.Printf("Saved the state of %s to %s\n", snap.Firmware(), CLI.Snapshot.Create.File)
+}
+
+func snapshot_restore() {
+	snap, err := lucigo.LoadSnapshot(CLI.Snapshot.Restore.File)
+	if err != nil {
+		fatal(err)
+	}
+	if !CLI.Snapshot.Restore.Settings {
+		snap.Settings = nil
+	}
+	if !CLI.Snapshot.Restore.Circuit {
+		snap.Circuit = nil
+	}
+	hc := getHybridController()
+	current, err := lucigo.TakeSnapshot(hc)
+	if err != nil {
+		fatal(err)
+	}
+	if current.Firmware() != snap.Firmware() {
+		if !CLI.Snapshot.Restore.Force {
+			fatalf("The snapshot was taken from %s, the device runs %s. Restore anyway with --force.", snap.Firmware(), current.Firmware())
+		}
+		log.Printf("Restoring a snapshot of %s onto %s\n", snap.Firmware(), current.Firmware())
+	}
+	if err := hc.RestoreSnapshot(snap); err != nil {
+		fatal(err)
+	}
+	if snap.Settings != nil {
+		recordSettings(hc, "restore", snap.Settings)
+	}
+	log.Printf("Restored the state of %s taken %s\n", snap.Endpoint, snap.Created.Format("2006-01-02 15:04:05"))
+}
+
+func snapshot_inspect() {
+	snap, err := lucigo.LoadSnapshot(CLI.Snapshot.Inspect.File)
+	if err != nil {
+		fatal(err)
+	}
+	if CLI.Snapshot.Inspect.Json {
+		out, _ := json.MarshalIndent(struct {
+			*lucigo.Snapshot
+			Settings lucigo.NetSettings     `json:"settings,omitempty"`
+			Circuit  map[string]interface{} `json:"circuit,omitempty"`
+			Entities map[string]interface{} `json:"entities,omitempty"`
+		}{snap, snap.Settings, snap.Circuit, snap.Entities}, "", "  ")
+		fmt.Printf("%s\n", out)
+		return
+	}
+	fmt.Printf("Taken:     %s\n", snap.Created.Format("2006-01-02 15:04:05 MST"))
+	fmt.Printf("Endpoint:  %s\n", snap.Endpoint)
+	fmt.Printf("Firmware:  %s\n", snap.Firmware())
+	if snap.Lucigo != "" {
+		fmt.Printf("Lucigo:    %s\n", snap.Lucigo)
+	}
+	var parts []string
+	for _, part := range []struct {
+		name    string
+		present bool
+	}{{"settings", snap.Settings != nil}, {"circuit", snap.Circuit != nil}, {"entities", snap.Entities != nil}} {
+		if part.present {
+			parts = append(parts, part.name)
+		}
+	}
+	fmt.Printf("Contains:  %s\n", strings.Join(parts, ", "))
+	if calibration := snap.Calibration(); calibration != nil {
+		fmt.Println("Calibration:")
+		flattened, _ := flat.Flatten(calibration, nil)
+		keys := keys(flattened)
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("  %s = %v\n", k, flattened[k])
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/anabrid/lucigo"
+)
+
+// With --otel, commandTracer traces the commands of the controller and
+// instrumentHandler the requests to the webserver. startTracing sets them
+// up and is only available with the otel build tag, see trace_otel.go.
+var (
+	startTracing      func() (shutdown func(), err error)
+	commandTracer     lucigo.CommandTracer
+	instrumentHandler = func(h http.Handler) http.Handler { return h }
+)
+
+func setupTracing() (shutdown func()) {
+	if !CLI.Otel {
+		return func() {}
+	}
+	if startTracing == nil {
+		exitWith(2, classifyError("This lucigo is built without OpenTelemetry support. Rebuild it with -tags otel, see the README.", nil), false)
+	}
+	shutdown, err := startTracing()
+	if err != nil {
+		exitWith(2, classifyError(fmt.Sprintf("Cannot set up OpenTelemetry: %v", err), err), false)
+	}
+	return shutdown
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build otel
+
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/anabrid/lucigo"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func init() {
+	startTracing = func() (func(), error) {
+		// configured by OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_SERVICE_NAME etc.
+		exporter, err := otlptracehttp.New(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+		otel.SetTracerProvider(provider)
+
+		commandTracer = lucigo.NewOTelTracer(provider)
+		instrumentHandler = func(h http.Handler) http.Handler {
+			return otelhttp.NewHandler(h, "lucigo", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return r.Method + " " + r.URL.Path
+			}))
+		}
+		return func() { provider.Shutdown(context.Background()) }, nil
+	}
+}
@@ -6,6 +6,7 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
 	"embed"
 	"encoding/json"
 	"fmt"
@@ -18,6 +19,9 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/anabrid/lucigo"
 	"github.com/gorilla/websocket"
@@ -31,11 +35,18 @@ var embeddedLucigoAssets embed.FS
 type LuciGoWebServer struct {
 	// should also store other options
 	ListenAddress  string
-	Hc             *lucigo.HybridController
+	Hc             lucigo.Controller // commands of the GUIs go to, see forward
 	Upgrader       websocket.Upgrader
 	AllowOrigin    string
 	StaticPath     string
-	primaryGUIpath string // set internally at construction
+	KeepAlive      time.Duration // pinging the device when idle for that long, see keepAlive
+	primaryGUIpath string        // set internally at construction
+	daq            daqHub
+	reading        sync.Once // starts luci2ws
+	clientsMu      sync.Mutex
+	clients        map[*wsClient]bool // connected to /ws
+	lastSeen       atomic.Int64       // when the device sent the last line, in unix nanoseconds
+	ping           atomic.Value       // the id of the ping in flight, as string
 }
 
 func (server *LuciGoWebServer) getRoot(w http.ResponseWriter, r *http.Request) {
@@ -43,19 +54,141 @@ func (server *LuciGoWebServer) getRoot(w http.ResponseWriter, r *http.Request) {
 	io.WriteString(w, "GUI is served at "+server.primaryGUIpath+"\n")
 }
 
-func (server *LuciGoWebServer) luci2ws(ws *websocket.Conn, done chan struct{}) {
-	for server.Hc.Reader.Scan() {
-		if err := ws.WriteMessage(websocket.TextMessage, server.Hc.Reader.Bytes()); err != nil {
-			ws.Close()
-			break
+// wsClient is a websocket connected to /ws.
+type wsClient struct {
+	conn *websocket.Conn
+	mu   sync.Mutex  // held while writing to conn
+	send chan []byte // lines of the device, written by writeLines
+}
+
+// Lines of the device buffered per websocket. A client falling further
+// behind is disconnected, rather than stalling the device reader.
+const wsClientBuffer = 256
+
+func newWSClient(conn *websocket.Conn) *wsClient {
+	return &wsClient{conn: conn, send: make(chan []byte, wsClientBuffer)}
+}
+
+func (c *wsClient) write(message []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, message)
+}
+
+// writeLines writes the lines queued for the client until send is closed.
+func (c *wsClient) writeLines() {
+	for line := range c.send {
+		if err := c.write(line); err != nil {
+			c.conn.Close() // ends reading from it, too
 		}
 	}
+}
 
-	if server.Hc.Reader.Err() != nil {
-		log.Println("scan: ", server.Hc.Reader.Err())
+// proxied returns the controller whose connection is proxied line by line,
+// if server.Hc is a HybridController. Other controllers have no lines to
+// pass on, their commands are given one by one, see forward.
+func (server *LuciGoWebServer) proxied() (*lucigo.HybridController, bool) {
+	hc, ok := server.Hc.(*lucigo.HybridController)
+	return hc, ok && hc != nil
+}
+
+// forward passes a message of the websocket on to the device. Answers come
+// back by luci2ws, unless server.Hc is not proxied, which answers right away.
+func (server *LuciGoWebServer) forward(client *wsClient, message []byte) error {
+	if hc, ok := server.proxied(); ok {
+		return hc.WriteLine(message)
+	}
+	var sent lucigo.SendEnvelope
+	if err := json.Unmarshal(message, &sent); err != nil {
+		return err
 	}
+	res, err := server.Hc.Command(sent)
+	if err != nil {
+		return err
+	}
+	answer, err := lucigo.MarshalRecvEnvelope(*res, sent.AcceptEncoding)
+	if err != nil {
+		return err
+	}
+	return client.write(answer)
+}
 
-	close(done)
+// luci2ws passes every line of the device on to all connected websockets,
+// as answers cannot be told apart by the client they are meant for. It is
+// the only reader of the device, however many websockets are connected, so
+// lines are queued per websocket, see wsClientBuffer.
+func (server *LuciGoWebServer) luci2ws() {
+	hc, ok := server.proxied()
+	if !ok {
+		return // answered by forward
+	}
+	reader := hc.Reader
+	for reader.Scan() {
+		server.lastSeen.Store(time.Now().UnixNano())
+		hc.TraceReceived(reader.Bytes())
+		if ping, _ := server.ping.Load().(string); ping != "" && bytes.Contains(reader.Bytes(), []byte(ping)) {
+			server.ping.CompareAndSwap(ping, "")
+			continue // answered to keepAlive, not to a GUI
+		}
+		if hc.Cache != nil || bytes.Contains(reader.Bytes(), []byte(`"run_data"`)) {
+			// decoded once for both, the message only if needed
+			if envelope, err := lucigo.ParseRecvHeader(reader.Bytes()); err == nil {
+				server.publishRunData(envelope)
+				if hc.Cache != nil {
+					hc.Cache.Put(envelope)
+				}
+			}
+		}
+		line := bytes.Clone(reader.Bytes())
+		server.clientsMu.Lock()
+		for client := range server.clients {
+			select {
+			case client.send <- line:
+			default:
+				log.Printf("luci2ws: Disconnecting a websocket too slow to keep up\n")
+				client.conn.Close()
+				delete(server.clients, client)
+			}
+		}
+		server.clientsMu.Unlock()
+	}
+
+	if reader.Err() != nil {
+		log.Println("scan: ", reader.Err())
+	}
+}
+
+// keepAlive notices when the device is lost, such as after a reboot, which
+// the proxy would not before a GUI sends the next request. Every interval
+// without lines from the device, it is pinged, and if it stays silent for
+// another interval, lucigo ends for a service manager to restart it.
+// lucigo.HybridController.KeepAlive does likewise for controllers whose
+// commands are matched to their answers.
+func (server *LuciGoWebServer) keepAlive() {
+	hc, ok := server.proxied()
+	if !ok {
+		return // a lost device fails the commands of forward
+	}
+	server.lastSeen.Store(time.Now().UnixNano())
+	server.reading.Do(func() { go server.luci2ws() })
+	var pinged time.Time
+	for range time.Tick(server.KeepAlive) {
+		seen := time.Unix(0, server.lastSeen.Load())
+		switch {
+		case !pinged.IsZero() && seen.Before(pinged):
+			fatalf("Lost the LUCIDAC: %v", lucigo.ErrTimeout)
+		case time.Since(seen) < server.KeepAlive:
+			pinged = time.Time{}
+			continue
+		}
+		ping := hc.NewEnvelope(lucigo.PingType)
+		line, _ := json.Marshal(ping)
+		server.ping.Store(ping.Id.String())
+		pinged = time.Now()
+		if err := hc.WriteLine(line); err != nil {
+			fatalf("Lost the LUCIDAC: %v", err)
+		}
+	}
 }
 
 func (server *LuciGoWebServer) startWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -70,8 +203,21 @@ func (server *LuciGoWebServer) startWebSocket(w http.ResponseWriter, r *http.Req
 	}
 	defer c.Close()
 
-	done := make(chan struct{})
-	go server.luci2ws(c, done)
+	client := newWSClient(c)
+	go client.writeLines()
+	server.clientsMu.Lock()
+	if server.clients == nil {
+		server.clients = make(map[*wsClient]bool)
+	}
+	server.clients[client] = true
+	server.clientsMu.Unlock()
+	defer func() {
+		server.clientsMu.Lock()
+		delete(server.clients, client)
+		server.clientsMu.Unlock()
+		close(client.send) // luci2ws only sends to the clients listed
+	}()
+	server.reading.Do(func() { go server.luci2ws() })
 
 	// ws2luci
 	for {
@@ -82,18 +228,151 @@ func (server *LuciGoWebServer) startWebSocket(w http.ResponseWriter, r *http.Req
 		}
 		log.Printf("recv: %s", message)
 
-		_, err = server.Hc.Stream.Write(append(message, []byte("\r\n")...))
-		if err != nil {
+		if answer := server.cachedAnswer(message); answer != nil {
+			if err := client.write(answer); err != nil {
+				log.Println("cache2ws:", err)
+				break
+			}
+			continue
+		}
+
+		if err := server.forward(client, message); err != nil {
 			log.Println("ws2luci:", err)
 			break
 		}
 	}
 }
 
+// cachedAnswer returns the answer to the request from the query cache,
+// nil if the request has to be passed on to the device.
+func (server *LuciGoWebServer) cachedAnswer(message []byte) []byte {
+	hc, ok := server.proxied()
+	if !ok || hc.Cache == nil {
+		return nil
+	}
+	cache := hc.Cache
+	var sent lucigo.SendEnvelope
+	if json.Unmarshal(message, &sent) != nil {
+		return nil
+	}
+	cache.InvalidateBy(sent.Type)
+	if !cache.Cacheable(sent) {
+		return nil
+	}
+	res, ok := cache.Get(sent.Type, sent.Id)
+	if !ok {
+		return nil
+	}
+	answer, err := lucigo.MarshalRecvEnvelope(*res, sent.AcceptEncoding)
+	if err != nil {
+		return nil
+	}
+	return answer
+}
+
+// daqHub fans out messages to all connected /daq websockets. Slow clients
+// miss messages rather than stalling the proxy.
+type daqHub struct {
+	mu      sync.Mutex
+	clients map[chan []byte]bool
+}
+
+func (h *daqHub) subscribe() chan []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients == nil {
+		h.clients = make(map[chan []byte]bool)
+	}
+	c := make(chan []byte, 16)
+	h.clients[c] = true
+	return c
+}
+
+func (h *daqHub) unsubscribe(c chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, c)
+}
+
+func (h *daqHub) publish(msg []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		select {
+		case c <- msg:
+		default: // client too slow
+		}
+	}
+}
+
+// publishRunData forwards run_data messages passing through the proxy,
+// decoded to machine units, to the subscribers of /daq.
+func (server *LuciGoWebServer) publishRunData(envelope *lucigo.RecvEnvelope) {
+	if envelope.Type != "run_data" {
+		return
+	}
+	id, frame, err := lucigo.DecodeRunData(envelope, nil)
+	if err != nil {
+		log.Printf("publishRunData: %v\n", err)
+		return
+	}
+	names := make([]string, len(frame.Channels))
+	for i, channel := range frame.Channels {
+		names[i] = channel.Name
+	}
+	msg, _ := json.Marshal(map[string]interface{}{
+		"run":      id,
+		"channels": names,
+		"samples":  frame.Samples,
+	})
+	server.daq.publish(msg)
+}
+
+// streamDAQ is the websocket behind the live plot: It only sends the
+// decoded run data, see publishRunData.
+func (server *LuciGoWebServer) streamDAQ(w http.ResponseWriter, r *http.Request) {
+	server.Upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	c, err := server.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Print("upgrade:", err)
+		return
+	}
+	defer c.Close()
+
+	messages := server.daq.subscribe()
+	defer server.daq.unsubscribe(messages)
+
+	gone := make(chan struct{})
+	go func() {
+		// nothing is expected from the client, but reading notices when it leaves
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				close(gone)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-messages:
+			if err := c.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+func (server *LuciGoWebServer) servePlot(w http.ResponseWriter, r *http.Request) {
+	http.ServeFileFS(w, r, embeddedLucigoAssets, "web-assets/plot.html")
+}
+
 func (server *LuciGoWebServer) webServerIdent(w http.ResponseWriter, r *http.Request) {
 	var proxy_target string
-	if server.Hc != nil && len(server.Hc.Endpoint.ToURL()) != 0 {
-		proxy_target = server.Hc.Endpoint.ToURL()
+	if hc, ok := server.proxied(); ok && len(hc.Endpoint.ToURL()) != 0 {
+		proxy_target = hc.Endpoint.ToURL()
 	}
 
 	ident := map[string]interface{}{
@@ -133,7 +412,7 @@ func openWebBrowser(url string) {
 		err = fmt.Errorf("please point your browser to this URL: %s", url)
 	}
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 }
 
@@ -146,9 +425,9 @@ func (server *LuciGoWebServer) DaemonRun() (server_err chan error) {
 	select {
 	case err_val, received := <-server_err:
 		if received {
-			log.Fatalln("Webserver prematurly ended.")
+			fatal("Webserver prematurly ended.")
 			if err_val != nil {
-				log.Fatal(server_err)
+				fatal(server_err)
 			}
 		}
 	default: // no error received, still running
@@ -160,7 +439,7 @@ func DaemonWait(server_err chan error) {
 	// wait until webserver completed
 	err_val := <-server_err
 	if err_val != nil {
-		log.Fatal(err_val)
+		fatal(err_val)
 	}
 }
 
@@ -174,13 +453,15 @@ func (server *LuciGoWebServer) StartWebserver() error {
 	// this is how to also print what is embedded at build time:
 	matches, err := fs.Glob(embeddedLucigoAssets, "*/*")
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 	log.Printf("StartWebserver: Embedded files: %+v\n", matches)
 
 	http.HandleFunc("/", server.getRoot) // also any 404...
 	http.HandleFunc("/.well-known/lucidac.json", server.webServerIdent)
 	http.HandleFunc("/ws", server.startWebSocket)
+	http.HandleFunc("/daq", server.streamDAQ)
+	http.HandleFunc("/plot", server.servePlot)
 
 	// serve build-time embedded snapshot of directory
 	if is_lucigui_bundled() {
@@ -217,15 +498,18 @@ func (server *LuciGoWebServer) StartWebserver() error {
 		}
 	}
 
-	err = http.ListenAndServe(server.ListenAddress, nil)
+	if server.KeepAlive > 0 {
+		go server.keepAlive()
+	}
+	err = http.ListenAndServe(server.ListenAddress, instrumentHandler(http.DefaultServeMux))
 	return err
 }
 
-func NewLuciGoWebServer(hc *lucigo.HybridController) (server *LuciGoWebServer) {
+func NewLuciGoWebServer(hc lucigo.Controller) (server *LuciGoWebServer) {
 	return &LuciGoWebServer{
 		Hc:             hc,
 		ListenAddress:  "127.0.0.1:8000",
 		primaryGUIpath: "/index.html",
-		Upgrader:       websocket.Upgrader{ /*defaults*/ },
+		Upgrader:       websocket.Upgrader{EnableCompression: true},
 	}
 }
@@ -0,0 +1,29 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"github.com/anabrid/lucigo"
+)
+
+// notifier posts to the webhooks given with --webhook, if any.
+var notifier *lucigo.Notifier
+
+// setupWebhooks creates the notifier and returns a function waiting
+// until the events are posted.
+func setupWebhooks() (wait func()) {
+	if len(CLI.Webhook) == 0 {
+		return func() {}
+	}
+	notifier = &lucigo.Notifier{}
+	for _, spec := range CLI.Webhook {
+		hook, err := lucigo.ParseWebhook(spec)
+		if err != nil {
+			exitWith(2, classifyError(err.Error(), err), false)
+		}
+		notifier.Webhooks = append(notifier.Webhooks, hook)
+	}
+	return notifier.Wait
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anabrid/lucigo"
+)
+
+// formatExtensions are the file extensions of the data formats, for naming
+// the data file of a run in a workspace. Other formats use their name.
+var formatExtensions = map[string]string{
+	"csv":      ".csv",
+	"ndjson":   ".ndjson",
+	"npy":      ".npy",
+	"npy-mmap": ".npy",
+	"influx":   ".lp",
+}
+
+// openWorkspaceRun creates the directory of the run in --workspace and
+// records the configuration there. It returns where to write the data to:
+// data.<ext> if not given with -o, the file given with -o in the directory
+// of the run if relative, and anything else (URLs) unchanged.
+func openWorkspaceRun(output string, config lucigo.RunConfig, daq lucigo.DAQConfig) (*lucigo.WorkspaceRun, string) {
+	workspace, err := lucigo.OpenWorkspace(CLI.Run.Workspace)
+	if err != nil {
+		fatalf("Cannot open workspace %s: %v", CLI.Run.Workspace, err)
+	}
+	run, err := workspace.NewRun()
+	if err != nil {
+		fatalf("Cannot create run in workspace %s: %v", CLI.Run.Workspace, err)
+	}
+	err = run.WriteJSON("run.json", struct {
+		Config    lucigo.RunConfig   `json:"config"`
+		DAQ       lucigo.DAQConfig   `json:"daq_config"`
+		Format    string             `json:"format"`
+		Variables map[string]float64 `json:"variables,omitempty"` // of the circuit template
+		Command   []string           `json:"command"`
+	}{config, daq, CLI.Run.Format, CLI.Run.Var, os.Args})
+	if err != nil {
+		fatal(err)
+	}
+	log.Printf("run: Keeping the run in %s\n", run.Dir)
+
+	switch {
+	case output == "-" || output == "":
+		ext, ok := formatExtensions[CLI.Run.Format]
+		if !ok {
+			ext = "." + CLI.Run.Format
+		}
+		return run, run.Path("data" + ext)
+	case isURL(output) || isS3(output) || filepath.IsAbs(output):
+		return run, output
+	}
+	return run, run.Path(output)
+}
+
+// saveWorkspaceCircuit records the circuit of the run in the workspace: the
+// one configured on the device, or the simulated one as expanded.
+func saveWorkspaceCircuit(run *lucigo.WorkspaceRun, hc lucigo.Controller, simulated []byte) {
+	var circuit interface{}
+	if simulated != nil {
+		circuit = json.RawMessage(simulated)
+	} else if res, err := hc.Query("get_config"); err == nil {
+		circuit = res.Msg
+	} else {
+		log.Printf("run: No circuit configuration for the workspace: %v\n", err)
+		return
+	}
+	if err := run.WriteJSON("circuit.json", circuit); err != nil {
+		fatal(err)
+	}
+}
+
+func loadWorkspace(dir string) *lucigo.Workspace {
+	workspace, err := lucigo.LoadWorkspace(dir)
+	if err != nil {
+		fatalf("Cannot open workspace %s: %v", dir, err)
+	}
+	return workspace
+}
+
+func workspace_list() {
+	runs, err := loadWorkspace(CLI.Workspace.List.Dir).Index()
+	if err != nil {
+		fatal(err)
+	}
+	if CLI.Workspace.List.Json {
+		out, _ := json.MarshalIndent(runs, "", "  ")
+		fmt.Printf("%s\n", out)
+		return
+	}
+	for _, run := range runs {
+		state, samples := "-", "-"
+		if run.Metadata != nil {
+			state, samples = string(run.Metadata.State), fmt.Sprint(run.Metadata.Samples)
+		}
+		fmt.Printf("%-20s %-8s %10s  %s\n", run.Name, state, samples, strings.Join(run.Files, " "))
+	}
+}
+
+func workspace_show() {
+	run, err := loadWorkspace(CLI.Workspace.Show.Dir).Run(CLI.Workspace.Show.Run)
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Println(run.Dir)
+	if CLI.Workspace.Show.Path {
+		return
+	}
+	for _, file := range run.Files {
+		fmt.Printf("  %s\n", file)
+	}
+	if run.Metadata != nil {
+		out, _ := json.MarshalIndent(run.Metadata, "", "  ")
+		fmt.Printf("%s\n", out)
+	}
+}
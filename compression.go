@@ -0,0 +1,143 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Large messages, such as settings dumps, entity trees or buffered run data,
+// can be compressed, which cuts the transfer time over the serial line many
+// times. A client announces the encodings it understands in the
+// accept_encoding field of its request, most preferred first:
+//
+//	{"type": "net_get", "id": "...", "msg": {}, "accept_encoding": "zstd,gzip"}
+//
+// A device (or proxy) supporting one of them may answer, and send run data,
+// with the message compressed, then base64 encoded as JSON string:
+//
+//	{"type": "net_get", "id": "...", "code": 0, "encoding": "gzip", "msg": "H4sIAAAAAAAA/..."}
+//
+// Firmware not knowing the field ignores it and answers as usual, which is
+// why compression is safe to request. The HybridController requests it with
+// AcceptEncoding and decompresses transparently.
+
+// CompressThreshold is the size of a message in bytes from which on
+// MarshalRecvEnvelope compresses it. Smaller ones do not gain enough.
+const CompressThreshold = 1024
+
+// MaxDecompressedSize bounds the size of a message once decompressed, in
+// bytes. Larger ones fail to decode, rather than a small line inflating to
+// whatever memory is left.
+var MaxDecompressedSize = 256 << 20
+
+// encoding compresses and decompresses messages.
+type encoding struct {
+	compress   func(w io.Writer) (io.WriteCloser, error)
+	decompress func(r io.Reader) (io.Reader, error)
+}
+
+// encodings are the message encodings understood, by name. Encodings with
+// optional dependencies register themselves in build-tagged files.
+var encodings = map[string]encoding{
+	"gzip": {
+		compress: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, gzip.BestSpeed)
+		},
+		decompress: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+	},
+}
+
+// Encodings returns the names of the message encodings understood, most
+// preferred first, as for HybridController.AcceptEncoding.
+func Encodings() []string {
+	var names []string
+	for _, name := range []string{"zstd", "gzip"} {
+		if _, ok := encodings[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// NegotiateEncoding returns the first encoding of the accept_encoding field
+// of a request which is understood, or "" for none.
+func NegotiateEncoding(accept string) string {
+	for _, name := range strings.Split(accept, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := encodings[name]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// MarshalRecvEnvelope encodes the envelope as line of the JSONL protocol,
+// as a device does. A message of CompressThreshold bytes or more is
+// compressed with the encoding negotiated from accept, the accept_encoding
+// field of the request.
+func MarshalRecvEnvelope(envelope RecvEnvelope, accept string) ([]byte, error) {
+	name := NegotiateEncoding(accept)
+	if name == "" {
+		return json.Marshal(envelope)
+	}
+	msg, err := json.Marshal(envelope.Msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) < CompressThreshold {
+		return json.Marshal(envelope)
+	}
+	var compressed bytes.Buffer
+	base := base64.NewEncoder(base64.StdEncoding, &compressed)
+	w, err := encodings[name].compress(base)
+	if err != nil {
+		return nil, err
+	}
+	w.Write(msg)
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	base.Close()
+	return json.Marshal(struct {
+		recvHeader
+		Msg string `json:"msg"`
+	}{recvHeader{Type: envelope.Type, Id: envelope.Id, Code: &envelope.Code, Error: &envelope.Error, Encoding: name}, compressed.String()})
+}
+
+// decompressMsg returns the JSON of a message compressed with the encoding.
+func decompressMsg(name string, msg json.RawMessage) ([]byte, error) {
+	enc, ok := encodings[name]
+	if !ok {
+		return nil, fmt.Errorf("message of unknown encoding '%s'", name)
+	}
+	var payload string
+	if err := json.Unmarshal(msg, &payload); err != nil {
+		return nil, fmt.Errorf("%s encoded message is no string: %w", name, err)
+	}
+	r, err := enc.decompress(base64.NewDecoder(base64.StdEncoding, strings.NewReader(payload)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress %s message: %w", name, err)
+	}
+	if closer, ok := r.(io.Closer); ok {
+		defer closer.Close()
+	}
+	raw, err := io.ReadAll(io.LimitReader(r, int64(MaxDecompressedSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress %s message: %w", name, err)
+	}
+	if len(raw) > MaxDecompressedSize {
+		return nil, fmt.Errorf("%s message decompresses to more than %d bytes", name, MaxDecompressedSize)
+	}
+	return raw, nil
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	settings := map[string]interface{}{"names": strings.Repeat("lucidac ", 1000)}
+	frame := "[" + strings.TrimSuffix(strings.Repeat("[1,2],", 500), ",") + "]"
+	var sizes []int
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		write := func(envelope RecvEnvelope) {
+			line, err := MarshalRecvEnvelope(envelope, sent.AcceptEncoding)
+			if err != nil {
+				t.Errorf("MarshalRecvEnvelope: %v", err)
+			}
+			sizes = append(sizes, len(line))
+			w.Write(append(line, '\n'))
+		}
+		switch sent.Type {
+		case "net_get":
+			write(RecvEnvelope{Type: sent.Type, Id: sent.Id, Msg: settings})
+		case "start_run":
+			var out bytes.Buffer
+			serveRun(frame)(sent, &out)
+			for _, line := range bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n")) {
+				envelope, _ := ParseRecvEnvelope(line)
+				write(*envelope)
+			}
+		}
+	})
+
+	res, err := hc.Query("net_get")
+	if err != nil || res.Msg["names"] != settings["names"] {
+		t.Fatalf("expected the settings uncompressed, got %v", err)
+	}
+	plain := sizes[0]
+
+	hc.AcceptEncoding = []string{"br", "gzip"}
+	res, err = hc.Query("net_get")
+	if err != nil || res.Msg["names"] != settings["names"] {
+		t.Fatalf("expected the compressed settings decoded, got %v", err)
+	}
+	if compressed := sizes[1]; compressed*10 > plain {
+		t.Fatalf("expected the settings compressed, got %d of %d bytes", compressed, plain)
+	}
+
+	run, err := hc.StartRun(testRunConfig, DAQConfig{NumChannels: 2})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	samples := 0
+	for frame := range run.Data() {
+		samples += len(frame.Samples)
+	}
+	if run.Err() != nil || samples != 500 {
+		t.Fatalf("expected 500 samples of compressed run data, got %d, %v", samples, run.Err())
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for accept, want := range map[string]string{"": "", "br": "", "br, gzip": "gzip", "gzip,br": "gzip"} {
+		if got := NegotiateEncoding(accept); got != want {
+			t.Fatalf("NegotiateEncoding(%q): expected %q, got %q", accept, want, got)
+		}
+	}
+	if _, err := ParseRecvEnvelope([]byte(`{"type":"net_get","encoding":"gzip","msg":"bm90IGd6aXA="}`)); err == nil {
+		t.Fatalf("expected an error for a message which is not gzip")
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	line, err := MarshalRecvEnvelope(RecvEnvelope{Type: "net_get", Msg: map[string]interface{}{"names": strings.Repeat("lucidac ", 1000)}}, "gzip")
+	if err != nil {
+		t.Fatalf("MarshalRecvEnvelope: %v", err)
+	}
+	defer func(size int) { MaxDecompressedSize = size }(MaxDecompressedSize)
+	MaxDecompressedSize = 8000
+	if _, err := ParseRecvEnvelope(line); err == nil || !strings.Contains(err.Error(), "more than 8000 bytes") {
+		t.Fatalf("expected the message to exceed the limit, got %v", err)
+	}
+	MaxDecompressedSize = 8100
+	if _, err := ParseRecvEnvelope(line); err != nil {
+		t.Fatalf("expected the message within the limit, got %v", err)
+	}
+}
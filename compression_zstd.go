@@ -0,0 +1,33 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build zstd
+
+// The zstd library is only built with the zstd build tag:
+//
+//	go get github.com/klauspost/compress
+//	go build -tags zstd ./...
+
+package lucigo
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func init() {
+	encodings["zstd"] = encoding{
+		compress: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		},
+		decompress: func(r io.Reader) (io.Reader, error) {
+			dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return dec.IOReadCloser(), nil
+		},
+	}
+}
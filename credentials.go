@@ -0,0 +1,323 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Credential authenticates at a device.
+type Credential struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+// String returns the user only, such that printing or logging a
+// credential, or an endpoint with one, does not give away the password.
+func (c Credential) String() string {
+	return c.User
+}
+
+// CredentialStore keeps credentials by name, such that devices are given
+// a name to log in with (see FleetDevice.Credential) instead of passwords
+// on command lines or in plain-text files.
+type CredentialStore interface {
+	Get(name string) (Credential, error) // ErrNoCredential if there is none
+	Set(name string, credential Credential) error
+	Delete(name string) error
+}
+
+// ErrNoCredential is returned by a CredentialStore for unknown names.
+var ErrNoCredential = errors.New("no such credential")
+
+// DefaultCredentialStore returns the keychain of the operating system, if
+// available, and otherwise an encrypted file in the configuration
+// directory of the user, with the passphrase from the environment variable
+// LUCIGO_CREDENTIALS_PASSPHRASE.
+func DefaultCredentialStore() CredentialStore {
+	if keychain := (KeychainStore{}); keychain.Available() {
+		return keychain
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return &FileStore{
+		Path:       filepath.Join(dir, "lucigo", "credentials.enc"),
+		Passphrase: []byte(os.Getenv("LUCIGO_CREDENTIALS_PASSPHRASE")),
+	}
+}
+
+// KeychainStore keeps credentials in the keychain of the operating
+// system, through its command line tool: security on macOS and
+// secret-tool (libsecret, such as the GNOME keyring or KWallet) on Linux
+// and the BSDs. Each credential is an item of the service, with the name
+// as account.
+type KeychainStore struct {
+	Service string // defaults to "lucigo"
+}
+
+func (k KeychainStore) service() string {
+	if k.Service == "" {
+		return "lucigo"
+	}
+	return k.Service
+}
+
+func (k KeychainStore) tool() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "security"
+	case "windows":
+		return "" // cmdkey cannot read passwords back
+	}
+	return "secret-tool"
+}
+
+// Available tells whether the tool of the keychain is installed.
+func (k KeychainStore) Available() bool {
+	if k.tool() == "" {
+		return false
+	}
+	_, err := exec.LookPath(k.tool())
+	return err == nil
+}
+
+func (k KeychainStore) Get(name string) (Credential, error) {
+	var args []string
+	if k.tool() == "security" {
+		args = []string{"find-generic-password", "-s", k.service(), "-a", name, "-w"}
+	} else {
+		args = []string{"lookup", "service", k.service(), "account", name}
+	}
+	out, err := exec.Command(k.tool(), args...).Output()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) || (err == nil && len(bytes.TrimSpace(out)) == 0) {
+		return Credential{}, fmt.Errorf("%w: %s", ErrNoCredential, name)
+	} else if err != nil {
+		return Credential{}, err
+	}
+	var credential Credential
+	if err := json.Unmarshal(bytes.TrimSpace(out), &credential); err != nil {
+		return Credential{}, fmt.Errorf("invalid credential %s in the keychain: %w", name, err)
+	}
+	return credential, nil
+}
+
+func (k KeychainStore) Set(name string, credential Credential) error {
+	secret, err := json.Marshal(credential)
+	if err != nil {
+		return err
+	}
+	var cmd *exec.Cmd
+	if k.tool() == "security" {
+		// as command on stdin, such that the secret is not in the
+		// arguments, which other users can see
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", quoteSecurity(k.service()), quoteSecurity(name), quoteSecurity(string(secret))))
+	} else {
+		cmd = exec.Command("secret-tool", "store", "--label", k.service()+" "+name, "service", k.service(), "account", name)
+		cmd.Stdin = bytes.NewReader(secret)
+	}
+	return runTool(cmd)
+}
+
+func (k KeychainStore) Delete(name string) error {
+	if k.tool() == "security" {
+		return runTool(exec.Command("security", "delete-generic-password", "-s", k.service(), "-a", name))
+	}
+	return runTool(exec.Command("secret-tool", "clear", "service", k.service(), "account", name))
+}
+
+// quoteSecurity quotes an argument for the command language of security -i.
+func quoteSecurity(arg string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+func runTool(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", filepath.Base(cmd.Path), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// DefaultIterations of the key derivation of a FileStore, as recommended
+// by OWASP for PBKDF2-HMAC-SHA256.
+const DefaultIterations = 600000
+
+// FileStore keeps credentials in a file encrypted with AES-256-GCM, with
+// the key derived from the passphrase by PBKDF2-HMAC-SHA256. The file is
+// only readable by its owner; on Unix, files readable by others are
+// refused, as with ssh.
+type FileStore struct {
+	Path       string
+	Passphrase []byte
+	Iterations int // of the key derivation for new files, defaults to DefaultIterations
+}
+
+// credentialFile is the format of the file of a FileStore.
+type credentialFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"` // the encrypted map of credentials by name
+}
+
+func (f *FileStore) Get(name string) (Credential, error) {
+	credentials, err := f.load()
+	if err != nil {
+		return Credential{}, err
+	}
+	credential, ok := credentials[name]
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: %s", ErrNoCredential, name)
+	}
+	return credential, nil
+}
+
+func (f *FileStore) Set(name string, credential Credential) error {
+	credentials, err := f.load()
+	if err != nil {
+		return err
+	}
+	credentials[name] = credential
+	return f.save(credentials)
+}
+
+func (f *FileStore) Delete(name string) error {
+	credentials, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := credentials[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrNoCredential, name)
+	}
+	delete(credentials, name)
+	return f.save(credentials)
+}
+
+func (f *FileStore) load() (map[string]Credential, error) {
+	if len(f.Passphrase) == 0 {
+		return nil, errors.New("need a passphrase for the credentials file, such as in LUCIGO_CREDENTIALS_PASSPHRASE")
+	}
+	raw, err := os.ReadFile(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]Credential{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(f.Path); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("credentials file %s is accessible by others (%v), restrict it with chmod 600", f.Path, info.Mode().Perm())
+	}
+	var file credentialFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("cannot read credentials file %s: %w", f.Path, err)
+	}
+	if file.Version != 1 || file.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("credentials file %s: unknown version %d or key derivation %s", f.Path, file.Version, file.KDF)
+	}
+	aead, err := newCredentialCipher(f.Passphrase, file.Salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt credentials file %s, wrong passphrase?", f.Path)
+	}
+	credentials := map[string]Credential{}
+	if err := json.Unmarshal(plain, &credentials); err != nil {
+		return nil, fmt.Errorf("cannot read credentials file %s: %w", f.Path, err)
+	}
+	return credentials, nil
+}
+
+func (f *FileStore) save(credentials map[string]Credential) error {
+	file := credentialFile{Version: 1, KDF: "pbkdf2-sha256", Iterations: f.Iterations, Salt: make([]byte, 16)}
+	if file.Iterations <= 0 {
+		file.Iterations = DefaultIterations
+	}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	aead, err := newCredentialCipher(f.Passphrase, file.Salt, file.Iterations)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	plain, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+	file.Data = aead.Seal(nil, file.Nonce, plain, nil)
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o700); err != nil {
+		return err
+	}
+	// written aside and renamed, such that a failure keeps the old file
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+func newCredentialCipher(passphrase, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations <= 0 {
+		return nil, fmt.Errorf("invalid iterations %d of the key derivation", iterations)
+	}
+	block, err := aes.NewCipher(pbkdf2SHA256(passphrase, salt, iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 derives a key of the given length as in RFC 8018.
+func pbkdf2SHA256(password, salt []byte, iterations, length int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < length; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := bytes.Clone(u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:length]
+}
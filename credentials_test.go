@@ -0,0 +1,69 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	for _, c := range []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645"},
+		{"Password", "NaCl", 3, "2cbf669a7229a97b4823c88db2edc2bc37e84c55a40ea0dd548b22141c820da86de0e3757b6d928d"},
+	} {
+		if got := hex.EncodeToString(pbkdf2SHA256([]byte(c.password), []byte(c.salt), c.iterations, 40)); got != c.want {
+			t.Fatalf("pbkdf2(%s, %s, %d): expected %s, got %s", c.password, c.salt, c.iterations, c.want, got)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := t.TempDir() + "/lucigo/credentials.enc"
+	store := &FileStore{Path: path, Passphrase: []byte("correct horse"), Iterations: 10}
+	if _, err := store.Get("lab1"); !errors.Is(err, ErrNoCredential) {
+		t.Fatalf("expected no credential in a new store, got %v", err)
+	}
+	lab1 := Credential{User: "admin", Password: "s3cret"}
+	if err := store.Set("lab1", lab1); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := store.Set("lab2", Credential{User: "student"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got, err := store.Get("lab1"); err != nil || got != lab1 {
+		t.Fatalf("expected %+v, got %+v, %v", lab1, got, err)
+	}
+	raw, _ := os.ReadFile(path)
+	if strings.Contains(string(raw), "s3cret") || strings.Contains(string(raw), "admin") {
+		t.Fatalf("expected the file to be encrypted:\n%s", raw)
+	}
+
+	wrong := &FileStore{Path: path, Passphrase: []byte("wrong")}
+	if _, err := wrong.Get("lab1"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Fatalf("expected a wrong passphrase to fail, got %v", err)
+	}
+	if err := store.Delete("lab1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get("lab1"); !errors.Is(err, ErrNoCredential) {
+		t.Fatalf("expected lab1 to be deleted, got %v", err)
+	}
+
+	if runtime.GOOS != "windows" {
+		os.Chmod(path, 0o644)
+		if _, err := store.Get("lab2"); err == nil || !strings.Contains(err.Error(), "accessible by others") {
+			t.Fatalf("expected a file readable by others to be refused, got %v", err)
+		}
+	}
+}
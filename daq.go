@@ -0,0 +1,146 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// The firmware sends DAQ samples as raw signed ADC codes. The full scale
+// code corresponds to the full input range of the ADC, given in machine units.
+const (
+	daqFullScaleCode    = 1 << 15
+	daqMachineUnitRange = 1.25
+)
+
+// MaxChannels is the number of channels the DAQ can acquire at most.
+const MaxChannels = 8
+
+// DefaultGain converts raw ADC codes of an uncalibrated channel to machine units.
+const DefaultGain = daqMachineUnitRange / daqFullScaleCode
+
+// Channel describes one acquired DAQ channel. Gain and Offset map raw ADC
+// codes to machine units, see [Channel.Scale].
+type Channel struct {
+	Index  int     `json:"index"` // ADC channel on the device
+	Name   string  `json:"name"`  // defaults to "ch<Index>"
+	Gain   float64 `json:"gain"`
+	Offset float64 `json:"offset"` // in raw ADC codes
+}
+
+// Scale converts a raw ADC code to machine units.
+func (c Channel) Scale(raw float64) float64 {
+	return (raw - c.Offset) * c.Gain
+}
+
+// defaultChannel is the metadata of an unnamed, uncalibrated channel.
+func defaultChannel(index int) Channel {
+	return Channel{Index: index, Name: fmt.Sprintf("ch%d", index), Gain: DefaultGain}
+}
+
+// Channels returns the metadata of the channels acquired with this
+// configuration, named by ChannelNames where given.
+func (daq DAQConfig) Channels() []Channel {
+	channels := make([]Channel, daq.NumChannels)
+	for i := range channels {
+		channels[i] = defaultChannel(i)
+		if i < len(daq.ChannelNames) && daq.ChannelNames[i] != "" {
+			channels[i].Name = daq.ChannelNames[i]
+		}
+	}
+	return channels
+}
+
+// Column returns the values of a single channel over all samples of the frame.
+func (f Frame) Column(channel int) []float64 {
+	column := make([]float64, len(f.Samples))
+	for i, sample := range f.Samples {
+		column[i] = sample[channel]
+	}
+	return column
+}
+
+// DecodeRunData decodes a run_data message into a frame of samples in
+// machine units and returns it together with the id of the run it belongs
+// to. Without channels given, uncalibrated default channels are assumed.
+// The timing fields of the frame are left empty, except for the Offset if
+// the firmware sends it.
+//
+// Both the JSON encoded and the packed data of [FrameDecoder] are understood.
+func DecodeRunData(envelope *RecvEnvelope, channels []Channel) (uuid.UUID, Frame, error) {
+	msg, frame, err := decodeRunData(envelope, channels, nil)
+	if err == nil && msg.Offset != nil {
+		frame.Offset = *msg.Offset
+	}
+	return msg.Id, frame, err
+}
+
+// decodeRunData is DecodeRunData reusing the buffers of dec, if given.
+func decodeRunData(envelope *RecvEnvelope, channels []Channel, dec *FrameDecoder) (runDataMsg, Frame, error) {
+	if dec == nil {
+		dec = NewFrameDecoder(channels)
+	}
+	msg := runDataMsg{Data: dec.data[:0]}
+	err := envelope.DecodeMsg(&msg)
+	dec.data = msg.Data[:0]
+	if err != nil {
+		return msg, Frame{}, fmt.Errorf("cannot decode run_data: %w", err)
+	}
+
+	var samples [][]float64
+	if len(msg.Data) != 0 && msg.Data[0] == '"' {
+		payload := msg.Data[1 : len(msg.Data)-1]
+		if bytes.IndexByte(payload, '\\') >= 0 {
+			// base64 needs no escapes, but "/" may be escaped anyway
+			var unquoted string
+			if err := json.Unmarshal(msg.Data, &unquoted); err != nil {
+				return msg, Frame{}, fmt.Errorf("cannot decode run_data: %w", err)
+			}
+			payload = []byte(unquoted)
+		}
+		if msg.NumChannels < 0 || msg.NumChannels > MaxChannels {
+			return msg, Frame{}, fmt.Errorf("packed run_data holds %d channels, at most %d are possible", msg.NumChannels, MaxChannels)
+		}
+		if len(channels) == 0 {
+			for i := 0; i < msg.NumChannels; i++ {
+				channels = append(channels, defaultChannel(i))
+			}
+		} else if msg.NumChannels != 0 && msg.NumChannels != len(channels) {
+			return msg, Frame{}, fmt.Errorf("packed run_data holds %d channels but %d are acquired", msg.NumChannels, len(channels))
+		}
+		dec.Channels = channels
+		samples, err = dec.DecodePartial(payload, msg.Partial)
+	} else if len(msg.Data) != 0 {
+		var n, width int
+		n, width, err = dec.parseJSON(msg.Data)
+		if err != nil {
+			return msg, Frame{}, fmt.Errorf("cannot decode run_data: %w", err)
+		}
+		if n != 0 && width == 0 {
+			return msg, Frame{}, fmt.Errorf("samples of run_data hold no values")
+		}
+		if len(channels) == 0 {
+			for i := 0; i < width; i++ {
+				channels = append(channels, defaultChannel(i))
+			}
+		}
+		if n != 0 && width != len(channels) {
+			return msg, Frame{}, fmt.Errorf("samples hold %d values but %d channels are acquired", width, len(channels))
+		}
+		if n != 0 {
+			dec.Channels = channels
+			samples = dec.scale(width)
+		}
+	}
+	if err != nil {
+		return msg, Frame{}, err
+	}
+	// the decoder buffers are reused for the next frame
+	return msg, Frame{Entity: msg.Entity, Channels: channels, Samples: copySamples(samples)}, nil
+}
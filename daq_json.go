@@ -0,0 +1,174 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// DecodeJSON is Decode for frames sent as JSON, an array of samples each
+// holding the raw codes of all channels, such as [[12,-3],[14,-2]]. The
+// codes are parsed right into the buffers of the decoder, instead of
+// allocating a slice per sample as json.Unmarshal does.
+func (d *FrameDecoder) DecodeJSON(data []byte) ([][]float64, error) {
+	width := len(d.Channels)
+	if width == 0 {
+		return nil, fmt.Errorf("cannot decode frame without channels")
+	}
+	samples, n, err := d.parseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	if samples == 0 {
+		return nil, nil
+	}
+	if n != width {
+		return nil, fmt.Errorf("samples hold %d values but %d channels are acquired", n, width)
+	}
+	return d.scale(width), nil
+}
+
+// parseJSON parses the raw codes of a JSON frame into d.values and returns
+// the number of samples and of codes per sample, which all samples have to
+// agree on.
+func (d *FrameDecoder) parseJSON(data []byte) (samples, width int, err error) {
+	p := codeParser{data: data}
+	values := d.values[:0]
+	defer func() { d.values = values }()
+
+	p.skipSpace()
+	if p.literal("null") {
+		return 0, 0, p.end()
+	}
+	if !p.consume('[') {
+		return 0, 0, p.errorf("expected array of samples")
+	}
+	if p.consume(']') {
+		return 0, 0, p.end()
+	}
+	for {
+		if !p.consume('[') {
+			return 0, 0, p.errorf("expected sample")
+		}
+		n := 0
+		if !p.consume(']') {
+			for {
+				code, err := p.number()
+				if err != nil {
+					return 0, 0, err
+				}
+				values = append(values, code)
+				n++
+				if p.consume(']') {
+					break
+				}
+				if !p.consume(',') {
+					return 0, 0, p.errorf("expected , or ] in sample")
+				}
+			}
+		}
+		if samples == 0 {
+			width = n
+		} else if n != width {
+			return 0, 0, fmt.Errorf("sample %d holds %d values but sample 0 holds %d", samples, n, width)
+		}
+		samples++
+		if p.consume(']') {
+			return samples, width, p.end()
+		}
+		if !p.consume(',') {
+			return 0, 0, p.errorf("expected , or ] after sample")
+		}
+	}
+}
+
+// codeParser reads the JSON of a frame. Its methods skip the whitespace
+// following what they consumed.
+type codeParser struct {
+	data []byte
+	pos  int
+}
+
+func (p *codeParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid frame at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *codeParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\r', '\n':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *codeParser) consume(c byte) bool {
+	if p.pos < len(p.data) && p.data[p.pos] == c {
+		p.pos++
+		p.skipSpace()
+		return true
+	}
+	return false
+}
+
+func (p *codeParser) literal(s string) bool {
+	if len(p.data)-p.pos >= len(s) && string(p.data[p.pos:p.pos+len(s)]) == s {
+		p.pos += len(s)
+		p.skipSpace()
+		return true
+	}
+	return false
+}
+
+func (p *codeParser) end() error {
+	if p.pos != len(p.data) {
+		return p.errorf("unexpected data after frame")
+	}
+	return nil
+}
+
+// number parses a JSON number. Integers, as the firmware sends, are
+// converted right away, anything else by strconv.
+func (p *codeParser) number() (float64, error) {
+	start := p.pos
+	integer := true
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c >= '0' && c <= '9' || c == '-' && p.pos == start {
+			p.pos++
+		} else if c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-' {
+			integer = false
+			p.pos++
+		} else {
+			break
+		}
+	}
+	token := p.data[start:p.pos]
+	p.skipSpace()
+
+	digits := token
+	if len(digits) > 0 && digits[0] == '-' {
+		digits = digits[1:]
+	}
+	if integer && len(digits) > 0 && len(digits) <= 15 && (digits[0] != '0' || len(digits) == 1) {
+		var v int64
+		for _, c := range digits {
+			v = 10*v + int64(c-'0')
+		}
+		if len(token) != len(digits) {
+			v = -v
+		}
+		return float64(v), nil
+	}
+	v, err := strconv.ParseFloat(string(token), 64)
+	if err != nil || len(digits) == 0 || digits[0] < '0' || digits[0] > '9' {
+		p.pos = start
+		return 0, p.errorf("invalid number %q", token)
+	}
+	return v, nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+)
+
+// FrameDecoder decodes the packed DAQ frames sent by the firmware at high
+// sample rates, where encoding every sample as JSON array cannot keep up.
+// A packed frame is the base64 encoding of the raw ADC codes as little
+// endian int16, sample after sample, each sample holding one code per channel.
+//
+// The decoder keeps its buffers between calls to Decode, so decoding a
+// stream of frames of similar size does not allocate once the buffers have
+// grown large enough. A FrameDecoder must not be used concurrently.
+type FrameDecoder struct {
+	Channels []Channel
+
+	data    []byte      // undecoded message, see decodeRunData
+	raw     []byte      // base64 decoded payload
+	rest    []byte      // incomplete sample of a partial frame, see DecodePartial
+	values  []float64   // backing storage of samples
+	samples [][]float64 // one view into values per sample
+}
+
+// NewFrameDecoder creates a decoder for frames of the given channels.
+func NewFrameDecoder(channels []Channel) *FrameDecoder {
+	return &FrameDecoder{Channels: channels}
+}
+
+// Decode converts the base64 payload of a packed frame to samples in machine
+// units, indexed as samples[sample][channel]. The returned samples share
+// memory with the decoder and are only valid until the next call to Decode.
+func (d *FrameDecoder) Decode(payload []byte) ([][]float64, error) {
+	return d.DecodePartial(payload, false)
+}
+
+// DecodePartial decodes a packed frame like Decode, which may end within a
+// sample if partial: The firmware splits the data of long frames across
+// several run_data messages at arbitrary bytes. The incomplete sample is
+// kept and completed by the next frame decoded.
+func (d *FrameDecoder) DecodePartial(payload []byte, partial bool) ([][]float64, error) {
+	width := len(d.Channels)
+	if width == 0 {
+		return nil, fmt.Errorf("cannot decode packed frame without channels")
+	}
+
+	rest := len(d.rest)
+	d.raw = grow(d.raw, rest+base64.StdEncoding.DecodedLen(len(payload)))
+	copy(d.raw, d.rest)
+	d.rest = d.rest[:0]
+	n, err := base64.StdEncoding.Decode(d.raw[rest:], payload)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode packed frame: %w", err)
+	}
+	raw := d.raw[:rest+n]
+	whole := len(raw) - len(raw)%(2*width)
+	if whole != len(raw) && !partial {
+		return nil, fmt.Errorf("packed frame of %d bytes does not hold whole samples of %d channels", len(raw), width)
+	}
+	d.rest = append(d.rest, raw[whole:]...)
+	raw = raw[:whole]
+
+	codes := len(raw) / 2
+	d.values = grow(d.values, codes)
+	for i := 0; i < codes; i++ {
+		d.values[i] = float64(int16(binary.LittleEndian.Uint16(raw[2*i:])))
+	}
+	return d.scale(width), nil
+}
+
+// scale converts the raw codes in d.values to machine units and returns
+// them as samples of the given width.
+func (d *FrameDecoder) scale(width int) [][]float64 {
+	for i := range d.values {
+		d.values[i] = d.Channels[i%width].Scale(d.values[i])
+	}
+	d.samples = grow(d.samples, len(d.values)/width)
+	for i := range d.samples {
+		d.samples[i] = d.values[i*width : (i+1)*width : (i+1)*width]
+	}
+	return d.samples
+}
+
+// grow returns buf resized to n, reusing its storage where large enough.
+func grow[T any](buf []T, n int) []T {
+	if cap(buf) < n {
+		return make([]T, n)
+	}
+	return buf[:n]
+}
+
+// copySamples copies samples out of the decoder buffers, using a single
+// allocation for the values of all samples.
+func copySamples(samples [][]float64) [][]float64 {
+	if len(samples) == 0 {
+		return nil
+	}
+	width := len(samples[0])
+	values := make([]float64, len(samples)*width)
+	out := make([][]float64, len(samples))
+	for i, sample := range samples {
+		out[i] = values[i*width : (i+1)*width : (i+1)*width]
+		copy(out[i], sample)
+	}
+	return out
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDAQConfig_Channels(t *testing.T) {
+	channels := DAQConfig{NumChannels: 3, ChannelNames: []string{"x", ""}}.Channels()
+	names := []string{"x", "ch1", "ch2"}
+	for i, channel := range channels {
+		if channel.Index != i || channel.Name != names[i] {
+			t.Fatalf("channel %d: expected index %d named %s, got %+v", i, i, names[i], channel)
+		}
+	}
+}
+
+func TestFrameDecoder_DecodeJSON(t *testing.T) {
+	channels := []Channel{defaultChannel(0), {Index: 1, Gain: 0.5, Offset: 10}}
+	dec := NewFrameDecoder(channels)
+	samples, err := dec.DecodeJSON([]byte(` [[32768, 12],[-16384,1e1] ]`))
+	if err != nil {
+		t.Fatalf("DecodeJSON: %v", err)
+	}
+	expected := [][]float64{{daqMachineUnitRange, 1}, {-daqMachineUnitRange / 2, 0}}
+	for i := range expected {
+		for c := range expected[i] {
+			if math.Abs(samples[i][c]-expected[i][c]) > 1e-12 {
+				t.Fatalf("sample %d channel %d: expected %v, got %v", i, c, expected[i][c], samples[i][c])
+			}
+		}
+	}
+
+	for _, data := range []string{`[[1,2,3]]`, `[[1,2],[3]]`, `[[1,2],]`, `[[1,-]]`, `[[1,2]] x`, `{}`} {
+		if _, err := dec.DecodeJSON([]byte(data)); err == nil {
+			t.Fatalf("DecodeJSON expected error for %s", data)
+		}
+	}
+
+	data := []byte(strings.Repeat("[-1234,5678],", 511) + "[0,0]")
+	data = append(append([]byte("["), data...), ']')
+	allocs := testing.AllocsPerRun(100, func() { dec.DecodeJSON(data) })
+	if allocs != 0 {
+		t.Fatalf("expected no allocations when decoding into grown buffers, got %v", allocs)
+	}
+}
+
+// packFrame encodes raw codes the way the firmware packs them.
+func packFrame(codes ...int16) []byte {
+	raw := make([]byte, 2*len(codes))
+	for i, code := range codes {
+		binary.LittleEndian.PutUint16(raw[2*i:], uint16(code))
+	}
+	return []byte(base64.StdEncoding.EncodeToString(raw))
+}
+
+func TestFrameDecoder(t *testing.T) {
+	channels := []Channel{defaultChannel(0), {Index: 1, Gain: 0.5, Offset: 10}}
+	dec := NewFrameDecoder(channels)
+	samples, err := dec.Decode(packFrame(daqFullScaleCode-1, 12, -daqFullScaleCode/2, 10))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	expected := [][]float64{{(daqFullScaleCode - 1) * DefaultGain, 1}, {-daqMachineUnitRange / 2, 0}}
+	if len(samples) != len(expected) {
+		t.Fatalf("expected %d samples, got %d", len(expected), len(samples))
+	}
+	for i := range expected {
+		for c := range expected[i] {
+			if math.Abs(samples[i][c]-expected[i][c]) > 1e-12 {
+				t.Fatalf("sample %d channel %d: expected %v, got %v", i, c, expected[i][c], samples[i][c])
+			}
+		}
+	}
+
+	if _, err := dec.Decode(packFrame(1, 2, 3)); err == nil {
+		t.Fatalf("Decode expected error for a partial sample")
+	}
+	if _, err := dec.Decode([]byte("not base64!")); err == nil {
+		t.Fatalf("Decode expected error for invalid base64")
+	}
+
+	payload := packFrame(make([]int16, 2*512)...)
+	allocs := testing.AllocsPerRun(100, func() { dec.Decode(payload) })
+	if allocs != 0 {
+		t.Fatalf("expected no allocations when decoding into grown buffers, got %v", allocs)
+	}
+}
+
+func TestFrameDecoder_DecodePartial(t *testing.T) {
+	dec := NewFrameDecoder(DAQConfig{NumChannels: 2}.Channels())
+	raw, _ := base64.StdEncoding.DecodeString(string(packFrame(1, 2, 3, 4, 5, 6)))
+	var codes []float64
+	for _, chunk := range [][]byte{raw[:5], raw[5:7], raw[7:]} {
+		samples, err := dec.DecodePartial([]byte(base64.StdEncoding.EncodeToString(chunk)), true)
+		if err != nil {
+			t.Fatalf("DecodePartial: %v", err)
+		}
+		for _, sample := range samples {
+			for _, value := range sample {
+				codes = append(codes, math.Round(value/DefaultGain))
+			}
+		}
+	}
+	if fmt.Sprint(codes) != "[1 2 3 4 5 6]" {
+		t.Fatalf("expected the samples split across chunks, got %v", codes)
+	}
+
+	if _, err := dec.DecodePartial(packFrame(1, 2, 3), true); err != nil {
+		t.Fatalf("DecodePartial: %v", err)
+	}
+	if samples, err := dec.Decode(packFrame(4)); err != nil || len(samples) != 1 || math.Round(samples[0][0]/DefaultGain) != 3 {
+		t.Fatalf("expected the incomplete sample completed by the next frame, got %v, %v", samples, err)
+	}
+}
+
+func TestDecodeRunData_packed(t *testing.T) {
+	envelope := &RecvEnvelope{Type: "run_data", Msg: map[string]interface{}{
+		"data":         string(packFrame(0, daqFullScaleCode/2, 1, 2, 3, 4)),
+		"num_channels": 3,
+	}}
+	_, frame, err := DecodeRunData(envelope, nil)
+	if err != nil {
+		t.Fatalf("DecodeRunData: %v", err)
+	}
+	if len(frame.Channels) != 3 || len(frame.Samples) != 2 {
+		t.Fatalf("expected 2 samples of 3 channels, got %d of %d", len(frame.Samples), len(frame.Channels))
+	}
+	if frame.Samples[0][1] != daqMachineUnitRange/2 || frame.Samples[1][2] != 4*DefaultGain {
+		t.Fatalf("unexpected samples %v", frame.Samples)
+	}
+
+	if _, _, err := DecodeRunData(envelope, DAQConfig{NumChannels: 2}.Channels()); err == nil {
+		t.Fatalf("DecodeRunData expected error for a channel count mismatch")
+	}
+}
+
+func BenchmarkFrameDecoder(b *testing.B) {
+	dec := NewFrameDecoder(DAQConfig{NumChannels: 8}.Channels())
+	payload := packFrame(make([]int16, 8*1024)...)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	for i := 0; i < b.N; i++ {
+		if _, err := dec.Decode(payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestDecodeRunData_allocs checks that decoding the run_data lines of a run
+// allocates per frame, not per sample.
+func TestDecodeRunData_allocs(t *testing.T) {
+	hc := &HybridController{}
+	hc.handleOOB("run_data", func(*RecvEnvelope) {})
+	var dec FrameDecoder
+	channels := DAQConfig{NumChannels: 2}.Channels()
+	for _, samples := range []int{16, 1024} {
+		line := []byte(`{"type":"run_data","id":"00000000-0000-0000-0000-000000000001","code":0,"msg":{"id":"00000000-0000-0000-0000-000000000002","entity":[],"offset":0,"data":[` +
+			strings.Repeat("[-1234,5678],", samples-1) + `[0,0]]}}`)
+		var envelope RecvEnvelope
+		allocs := testing.AllocsPerRun(100, func() {
+			if err := hc.parseLine(line, &envelope); err != nil {
+				t.Fatalf("parseLine: %v", err)
+			}
+			if _, frame, err := decodeRunData(&envelope, channels, &dec); err != nil || len(frame.Samples) != samples {
+				t.Fatalf("decodeRunData: %d samples, %v", len(frame.Samples), err)
+			}
+		})
+		if envelope.Msg != nil || allocs > 10 {
+			t.Fatalf("%d samples: expected the message left undecoded and a few allocations, got %v", samples, allocs)
+		}
+	}
+}
+
+func BenchmarkDecodeRunData(b *testing.B) {
+	hc := &HybridController{}
+	hc.handleOOB("run_data", func(*RecvEnvelope) {})
+	var dec FrameDecoder
+	channels := DAQConfig{NumChannels: 8}.Channels()
+	line := []byte(`{"type":"run_data","id":"00000000-0000-0000-0000-000000000001","code":0,"msg":{"id":"00000000-0000-0000-0000-000000000002","entity":[],"data":[` +
+		strings.Repeat("[-1234,5678,0,1,-2,3,-4,32767],", 1023) + `[0,0,0,0,0,0,0,0]]}}`)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(line)))
+	var envelope RecvEnvelope
+	for i := 0; i < b.N; i++ {
+		if err := hc.parseLine(line, &envelope); err != nil {
+			b.Fatal(err)
+		}
+		if _, _, err := decodeRunData(&envelope, channels, &dec); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
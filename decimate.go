@@ -0,0 +1,84 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+// decimator reduces the sample rate by factor before passing the frames
+// on to the wrapped sink. Blocks of samples may span several frames.
+type decimator struct {
+	Sink
+	factor  int
+	average bool
+
+	sum   []float64 // of the current block, when averaging
+	seen  int       // samples of the current block seen so far
+	start float64   // time of the first sample of the current block
+	count int       // samples passed on so far
+	gap   int       // of frames not passed on yet
+}
+
+// Decimate wraps sink such that it receives only every factor-th sample.
+// This keeps slow consumers (such as plots) from being overwhelmed by the
+// full DAQ rate.
+func Decimate(sink Sink, factor int) Sink {
+	return &decimator{Sink: sink, factor: factor}
+}
+
+// BoxcarAverage wraps sink such that it receives the mean of every factor
+// consecutive samples, which reduces the rate as [Decimate] does but also
+// the noise. Samples of a trailing incomplete block are dropped.
+func BoxcarAverage(sink Sink, factor int) Sink {
+	return &decimator{Sink: sink, factor: factor, average: true}
+}
+
+func (d *decimator) WriteFrame(frame Frame) error {
+	if d.factor <= 1 {
+		return d.Sink.WriteFrame(frame)
+	}
+
+	out := frame
+	out.Samples = nil
+	out.Offset = d.count
+	out.Interval = frame.Interval * float64(d.factor)
+
+	for i, sample := range frame.Samples {
+		if d.seen == 0 {
+			d.start = frame.Time(i)
+		}
+		if d.average {
+			if len(d.sum) != len(sample) {
+				d.sum = make([]float64, len(sample))
+			}
+			for c, value := range sample {
+				d.sum[c] += value
+			}
+		}
+		d.seen++
+
+		if len(out.Samples) == 0 {
+			out.Start = d.start // of the first block emitted with this frame
+		}
+		if d.average && d.seen == d.factor {
+			mean := make([]float64, len(d.sum))
+			for c := range d.sum {
+				mean[c] = d.sum[c] / float64(d.factor)
+				d.sum[c] = 0
+			}
+			out.Samples = append(out.Samples, mean)
+		} else if !d.average && d.seen == 1 {
+			out.Samples = append(out.Samples, sample)
+		}
+		if d.seen == d.factor {
+			d.seen = 0
+		}
+	}
+
+	d.gap += frame.Gap
+	if len(out.Samples) == 0 {
+		return nil
+	}
+	out.Gap, d.gap = d.gap, 0 // still in samples at the original rate
+	d.count += len(out.Samples)
+	return d.Sink.WriteFrame(out)
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"reflect"
+	"testing"
+)
+
+// feed writes frames of single channel samples with values 0, 1, 2, ...
+// at one sample per second into sink, split at the given frame sizes.
+func feed(sink Sink, sizes ...int) {
+	n := 0
+	for _, size := range sizes {
+		frame := Frame{Channels: []Channel{defaultChannel(0)}, Offset: n, Start: float64(n), Interval: 1}
+		for i := 0; i < size; i++ {
+			frame.Samples = append(frame.Samples, []float64{float64(n)})
+			n++
+		}
+		sink.WriteFrame(frame)
+	}
+}
+
+func TestDecimate(t *testing.T) {
+	rec := &Recording{}
+	feed(Decimate(rec, 3), 2, 5, 3)
+	if expected := []float64{0, 3, 6, 9}; !reflect.DeepEqual(rec.Column(0), expected) || !reflect.DeepEqual(rec.Time, expected) {
+		t.Fatalf("expected samples and times %v, got %v and %v", expected, rec.Column(0), rec.Time)
+	}
+}
+
+func TestBoxcarAverage(t *testing.T) {
+	rec := &Recording{}
+	feed(BoxcarAverage(rec, 4), 3, 3, 4)
+	if expected := []float64{1.5, 5.5}; !reflect.DeepEqual(rec.Column(0), expected) {
+		t.Fatalf("expected samples %v, got %v", expected, rec.Column(0))
+	}
+	if expected := []float64{0, 4}; !reflect.DeepEqual(rec.Time, expected) {
+		t.Fatalf("expected times %v, got %v", expected, rec.Time)
+	}
+}
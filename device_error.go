@@ -0,0 +1,74 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import "fmt"
+
+// DeviceError is an error code answered by the device, i.e. a request it
+// refused or failed at. Query and friends return it, along with the
+// answer, for codes other than 0:
+//
+//	_, err := hc.Query("net_get")
+//	var refused *lucigo.DeviceError
+//	if errors.As(err, &refused) {
+//		log.Printf("code %d", refused.Code)
+//	}
+//	if errors.Is(err, lucigo.ErrNotLoggedIn) {
+//		...
+//	}
+type DeviceError struct {
+	Type    string // of the request
+	Code    int
+	Message string // as answered, may be empty
+}
+
+func (e *DeviceError) Error() string {
+	return fmt.Sprintf("%s returned code %d: %s", e.Type, e.Code, e.Message)
+}
+
+// Is reports whether the target is a DeviceError of the same code and,
+// unless the Type of target is empty, of the same request type, such that
+// the errors of DeviceCodes can be tested for with errors.Is.
+func (e *DeviceError) Is(target error) bool {
+	t, ok := target.(*DeviceError)
+	return ok && t.Code == e.Code && (t.Type == "" || t.Type == e.Type)
+}
+
+// Codes answered by the firmware for any type of request. Codes beyond
+// those are specific to the request type.
+const (
+	CodeFailed      = -1 // generic, such as for unknown request types or a busy device
+	CodeNotLoggedIn = -3 // the request needs a login
+)
+
+// Errors of the known codes, to be tested for with errors.Is.
+var (
+	ErrDeviceFailed = &DeviceError{Code: CodeFailed}
+	ErrNotLoggedIn  = &DeviceError{Code: CodeNotLoggedIn}
+)
+
+// DeviceCodes describes the known codes answered by the firmware.
+var DeviceCodes = map[int]string{
+	0:               "success",
+	CodeFailed:      "the request failed",
+	CodeNotLoggedIn: "not logged in",
+}
+
+// Err returns the error code answered as *DeviceError, nil for success.
+func (recv *RecvEnvelope) Err() error {
+	if recv.IsSuccess() {
+		return nil
+	}
+	return &DeviceError{Type: recv.Type, Code: recv.Code, Message: recv.Error}
+}
+
+// answered passes on the answer to a command and its error, which is the
+// error code answered if there is no other.
+func answered(res *RecvEnvelope, err error) (*RecvEnvelope, error) {
+	if err == nil {
+		err = res.Err()
+	}
+	return res, err
+}
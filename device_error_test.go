@@ -0,0 +1,28 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDeviceError(t *testing.T) {
+	var err error = &DeviceError{Type: "net_get", Code: CodeNotLoggedIn, Message: "not logged in"}
+	if err.Error() != "net_get returned code -3: not logged in" {
+		t.Fatalf("unexpected wording %q", err)
+	}
+	wrapped := fmt.Errorf("cannot back up: %w", err)
+	if !errors.Is(wrapped, ErrNotLoggedIn) || errors.Is(wrapped, ErrDeviceFailed) {
+		t.Fatalf("expected the code to tell the error, got %v", wrapped)
+	}
+	if !errors.Is(wrapped, &DeviceError{Type: "net_get", Code: CodeNotLoggedIn}) || errors.Is(wrapped, &DeviceError{Type: "net_set", Code: CodeNotLoggedIn}) {
+		t.Fatalf("expected the type to tell the error, if given")
+	}
+	if (&RecvEnvelope{Type: "net_get"}).Err() != nil {
+		t.Fatalf("expected no error for success")
+	}
+}
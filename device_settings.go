@@ -0,0 +1,266 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+)
+
+// DeviceSettings are the permanent settings of a device as typed structure,
+// for those which know what they want to set, in contrast to NetSettings,
+// which holds whatever the firmware has. Sections the firmware does not have
+// are nil, settings it does not have are left at zero:
+//
+//	{"ethernet": {"hostname": "lucidac-lab1", "mtu": 1500},
+//	 "ipv4": {"dhcp_enabled": false, "static_ipv4_address": "10.0.0.7", ...}}
+//
+// Settings the firmware has beyond those are kept by NetSettings.Merge.
+type DeviceSettings struct {
+	Ethernet      *EthernetSettings      `json:"ethernet,omitempty"`
+	IPv4          *IPv4Settings          `json:"ipv4,omitempty"`
+	JSONL         *ServerSettings        `json:"jsonl,omitempty"`
+	Webserver     *ServerSettings        `json:"webserver,omitempty"`
+	MDNS          *ServerSettings        `json:"mdns,omitempty"`
+	AccessControl *AccessControlSettings `json:"access_control,omitempty"`
+	MQTT          *MQTTSettings          `json:"mqtt,omitempty"`
+	Syslog        *SyslogSettings        `json:"syslog,omitempty"`
+}
+
+// EthernetSettings are the settings of section ethernet.
+type EthernetSettings struct {
+	Mac      string `json:"mac,omitempty"` // read-only
+	Hostname string `json:"hostname,omitempty"`
+	MTU      int    `json:"mtu,omitempty"`
+}
+
+// IPv4Settings are the settings of section ipv4. The static addresses are
+// used without DHCP only.
+type IPv4Settings struct {
+	DHCPEnabled   bool   `json:"dhcp_enabled"`
+	StaticAddress string `json:"static_ipv4_address,omitempty"`
+	StaticNetmask string `json:"static_netmask,omitempty"`
+	StaticGateway string `json:"static_gateway,omitempty"`
+	StaticDNS     string `json:"static_dns,omitempty"`
+}
+
+// ServerSettings are the settings of a service of the device, such as
+// the JSONL server in section jsonl.
+type ServerSettings struct {
+	Enabled bool `json:"enabled"`
+	Port    int  `json:"port,omitempty"`
+}
+
+// AccessControlSettings restrict the clients of the device, section
+// access_control.
+type AccessControlSettings struct {
+	Enabled bool     `json:"enabled"`
+	Allowed []string `json:"allowed_ips,omitempty"` // addresses or networks, such as 10.0.0.0/24
+}
+
+// MQTTSettings are the settings of section mqtt, for devices publishing
+// their state to a broker.
+type MQTTSettings struct {
+	Enabled bool   `json:"enabled"`
+	Broker  string `json:"broker,omitempty"` // host or host:port
+	Topic   string `json:"topic,omitempty"`
+}
+
+// SyslogSettings are the settings of section syslog, for devices logging
+// to a remote server.
+type SyslogSettings struct {
+	Enabled bool   `json:"enabled"`
+	Server  string `json:"server,omitempty"` // host or host:port
+}
+
+// Typed decodes the settings into DeviceSettings.
+func (s NetSettings) Typed() (*DeviceSettings, error) {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	settings := &DeviceSettings{}
+	if err := json.Unmarshal(raw, settings); err != nil {
+		return nil, fmt.Errorf("unexpected settings: %w", err)
+	}
+	return settings, nil
+}
+
+// Merge sets the typed settings, keeping the settings not typed as they are.
+func (s NetSettings) Merge(settings *DeviceSettings) error {
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	var typed map[string]interface{}
+	if err := json.Unmarshal(raw, &typed); err != nil {
+		return err
+	}
+	for key, value := range flattenSettings("", typed, nil) {
+		s.Set(key, value)
+	}
+	return nil
+}
+
+// Validate tells why the settings would leave the device misconfigured,
+// such as with an invalid address or without any address at all, nil if
+// they look fine. All problems found are returned, joined.
+func (d *DeviceSettings) Validate() error {
+	var problems []error
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if e := d.Ethernet; e != nil {
+		check(checkHostname("ethernet.hostname", e.Hostname))
+		if e.MTU != 0 && (e.MTU < 576 || e.MTU > 9000) {
+			check(fmt.Errorf("ethernet.mtu must be 576..9000, got %d", e.MTU))
+		}
+		if _, err := net.ParseMAC(e.Mac); e.Mac != "" && err != nil {
+			check(fmt.Errorf("ethernet.mac must be a MAC address, got %q", e.Mac))
+		}
+	}
+	if ip := d.IPv4; ip != nil {
+		check(checkIPv4("ipv4.static_ipv4_address", ip.StaticAddress))
+		check(checkIPv4("ipv4.static_gateway", ip.StaticGateway))
+		check(checkIPv4("ipv4.static_dns", ip.StaticDNS))
+		check(checkIPv4("ipv4.static_netmask", ip.StaticNetmask))
+		if mask := net.ParseIP(ip.StaticNetmask).To4(); mask != nil {
+			if _, bits := net.IPMask(mask).Size(); bits == 0 {
+				check(fmt.Errorf("ipv4.static_netmask must be a netmask, such as 255.255.255.0, got %q", ip.StaticNetmask))
+			}
+		}
+		if address := net.ParseIP(ip.StaticAddress); !ip.DHCPEnabled && (address == nil || address.IsUnspecified()) {
+			check(errors.New("ipv4.static_ipv4_address is needed without DHCP"))
+		}
+	}
+	for name, server := range map[string]*ServerSettings{"jsonl": d.JSONL, "webserver": d.Webserver, "mdns": d.MDNS} {
+		if server != nil && (server.Port < 0 || server.Port > 65535) {
+			check(fmt.Errorf("%s.port must be 1..65535, or 0 to leave it as is, got %d", name, server.Port))
+		}
+	}
+	if acl := d.AccessControl; acl != nil {
+		for _, allowed := range acl.Allowed {
+			_, _, err := net.ParseCIDR(allowed)
+			if err != nil && net.ParseIP(allowed) == nil {
+				check(fmt.Errorf("access_control.allowed_ips must be addresses or networks, got %q", allowed))
+			}
+		}
+		if acl.Enabled && len(acl.Allowed) == 0 {
+			check(errors.New("access_control.allowed_ips is needed with access control, or no client is allowed"))
+		}
+	}
+	if mqtt := d.MQTT; mqtt != nil {
+		check(checkHostPort("mqtt.broker", mqtt.Broker, mqtt.Enabled))
+	}
+	if syslog := d.Syslog; syslog != nil {
+		check(checkHostPort("syslog.server", syslog.Server, syslog.Enabled))
+	}
+	return errors.Join(problems...)
+}
+
+// ValidateChanges is Validate for the sections which differ from before
+// only, such that settings a device has already, even if invalid, do not
+// stand in the way of unrelated changes.
+func (d *DeviceSettings) ValidateChanges(before *DeviceSettings) error {
+	changed := &DeviceSettings{}
+	now, was := reflect.ValueOf(d).Elem(), reflect.ValueOf(before).Elem()
+	sections := reflect.ValueOf(changed).Elem()
+	for i := 0; i < now.NumField(); i++ {
+		if !reflect.DeepEqual(now.Field(i).Interface(), was.Field(i).Interface()) {
+			sections.Field(i).Set(now.Field(i))
+		}
+	}
+	return changed.Validate()
+}
+
+// checkHostname checks a hostname as the device announces it, a single
+// label of RFC 1123.
+func checkHostname(key, hostname string) error {
+	if len(hostname) > 63 {
+		return fmt.Errorf("%s must be up to 63 characters, got %d", key, len(hostname))
+	}
+	for i, c := range hostname {
+		letterOrDigit := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !letterOrDigit && (c != '-' || i == 0 || i == len(hostname)-1) {
+			return fmt.Errorf("%s must be letters, digits and inner hyphens, got %q", key, hostname)
+		}
+	}
+	return nil
+}
+
+// checkIPv4 checks an IPv4 address, if given.
+func checkIPv4(key, address string) error {
+	if address != "" && net.ParseIP(address).To4() == nil {
+		return fmt.Errorf("%s must be an IPv4 address, got %q", key, address)
+	}
+	return nil
+}
+
+// checkHostPort checks a server given as host or host:port, which is
+// needed if enabled.
+func checkHostPort(key, server string, needed bool) error {
+	if server == "" {
+		if needed {
+			return fmt.Errorf("%s is needed if enabled", key)
+		}
+		return nil
+	}
+	host := server
+	if strings.Contains(server, ":") {
+		var err error
+		if host, _, err = net.SplitHostPort(server); err != nil {
+			return fmt.Errorf("%s must be host or host:port, got %q", key, server)
+		}
+	}
+	if net.ParseIP(host) == nil {
+		for _, label := range strings.Split(host, ".") {
+			if label == "" || checkHostname(key, label) != nil {
+				return fmt.Errorf("%s must be host or host:port, got %q", key, server)
+			}
+		}
+	}
+	return nil
+}
+
+// DeviceSettings reads the permanent settings as typed structure.
+func (hc *HybridController) DeviceSettings() (*DeviceSettings, error) {
+	settings, err := hc.NetSettings()
+	if err != nil {
+		return nil, err
+	}
+	return settings.Typed()
+}
+
+// UpdateDeviceSettings is UpdateSettings on the typed settings: update
+// changes them, and the sections changed are validated before anything is
+// written (see ValidateChanges):
+//
+//	err := hc.UpdateDeviceSettings(func(s *lucigo.DeviceSettings) error {
+//		s.IPv4.DHCPEnabled = false
+//		s.IPv4.StaticAddress = "10.0.0.7"
+//		return nil
+//	})
+func (hc *HybridController) UpdateDeviceSettings(update func(s *DeviceSettings) error) error {
+	return hc.UpdateSettings(func(s *NetSettings) error {
+		typed, err := s.Typed()
+		if err != nil {
+			return err
+		}
+		before, _ := s.Typed()
+		if err := update(typed); err != nil {
+			return err
+		}
+		if err := typed.ValidateChanges(before); err != nil {
+			return err
+		}
+		return s.Merge(typed)
+	})
+}
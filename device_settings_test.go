@@ -0,0 +1,98 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeviceSettings_Validate(t *testing.T) {
+	valid := DeviceSettings{
+		Ethernet: &EthernetSettings{Hostname: "lucidac-lab1", MTU: 1500, Mac: EmulatedMac},
+		IPv4:     &IPv4Settings{StaticAddress: "10.0.0.7", StaticNetmask: "255.255.255.0", StaticGateway: "10.0.0.1"},
+		JSONL:    &ServerSettings{Enabled: true, Port: 5732},
+		MQTT:     &MQTTSettings{Enabled: true, Broker: "broker.lab:1883"},
+		Syslog:   &SyslogSettings{Server: "10.0.0.2"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid settings, got %v", err)
+	}
+
+	invalid := DeviceSettings{
+		Ethernet:      &EthernetSettings{Hostname: "-lab_1", MTU: 100},
+		IPv4:          &IPv4Settings{StaticAddress: "10.0.0.300", StaticNetmask: "255.0.255.0"},
+		AccessControl: &AccessControlSettings{Enabled: true, Allowed: []string{"10.0.0.0/33"}},
+		MQTT:          &MQTTSettings{Enabled: true},
+		Webserver:     &ServerSettings{Enabled: true, Port: 70000},
+	}
+	err := invalid.Validate()
+	for _, key := range []string{"ethernet.hostname", "ethernet.mtu", "ipv4.static_ipv4_address must", "ipv4.static_ipv4_address is needed", "ipv4.static_netmask", "access_control.allowed_ips", "mqtt.broker", "webserver.port"} {
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Fatalf("expected a problem with %s, got %v", key, err)
+		}
+	}
+}
+
+func TestNetSettings_Typed(t *testing.T) {
+	settings := NetSettings{
+		"ethernet": map[string]interface{}{"hostname": "lab1", "mtu": 1500.0, "wol": true},
+		"ipv4":     map[string]interface{}{"dhcp_enabled": true},
+	}
+	typed, err := settings.Typed()
+	if err != nil || typed.Ethernet.Hostname != "lab1" || typed.Ethernet.MTU != 1500 || !typed.IPv4.DHCPEnabled || typed.MQTT != nil {
+		t.Fatalf("expected the settings typed, got %+v, %v", typed, err)
+	}
+	typed.Ethernet.Hostname = "lab2"
+	if err := settings.Merge(typed); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if hostname, _ := settings.Get("ethernet.hostname"); hostname != "lab2" {
+		t.Fatalf("expected the hostname merged, got %v", hostname)
+	}
+	if wol, _ := settings.Get("ethernet.wol"); wol != true {
+		t.Fatalf("expected the settings not typed to be kept, got %v", settings)
+	}
+}
+
+func TestUpdateDeviceSettings(t *testing.T) {
+	hc, err := NewHybridControllerFromString("emu://")
+	if err != nil {
+		t.Fatalf("NewHybridControllerFromString: %v", err)
+	}
+	defer hc.Close()
+
+	err = hc.UpdateDeviceSettings(func(s *DeviceSettings) error {
+		s.IPv4.DHCPEnabled = false
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "needed without DHCP") {
+		t.Fatalf("expected disabling DHCP without address to be refused, got %v", err)
+	}
+	err = hc.UpdateDeviceSettings(func(s *DeviceSettings) error {
+		s.IPv4.DHCPEnabled = false
+		s.IPv4.StaticAddress = "10.0.0.7"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateDeviceSettings: %v", err)
+	}
+	settings, err := hc.DeviceSettings()
+	if err != nil || settings.IPv4.DHCPEnabled || settings.IPv4.StaticAddress != "10.0.0.7" || settings.Ethernet.Mac != EmulatedMac {
+		t.Fatalf("expected the static address set, got %+v, %v", settings.IPv4, err)
+	}
+
+	// settings already invalid do not stand in the way of unrelated changes
+	if _, err := hc.QueryMsg("net_set", map[string]interface{}{"ipv4": map[string]interface{}{"static_ipv4_address": "0.0.0.0"}}); err != nil {
+		t.Fatalf("net_set: %v", err)
+	}
+	err = hc.UpdateDeviceSettings(func(s *DeviceSettings) error {
+		s.Ethernet.Hostname = "lucidac-lab2"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected only the sections changed to be validated, got %v", err)
+	}
+}
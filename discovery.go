@@ -0,0 +1,329 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/mdns"
+)
+
+// DeviceInfo describes a LUCIDAC found by a Discovery, such that several
+// of them can be told apart. Apart from the Endpoint, fields are empty if
+// unknown: MAC address and firmware are taken from the mDNS TXT records,
+// keyed as in the answer to sys_ident (mac, fw_name and fw_build), as far
+// as the device advertises them; devices attached by USB tell their
+// product and serial number only.
+type DeviceInfo struct {
+	Endpoint     Endpoint
+	Name         string // of the mDNS service, or the USB product
+	Host         string
+	IPv4         net.IP
+	IPv6         net.IP
+	Mac          string
+	Firmware     string            // such as "LUCIDAC 0.3.1", see SysIdent.Firmware
+	SerialNumber string            // of the USB device
+	TXT          map[string]string // all TXT records, those without value map to ""
+}
+
+func (info DeviceInfo) String() string {
+	return fmt.Sprintf("%s (%s)", info.Endpoint.ToURL(), info.Name)
+}
+
+// newDeviceInfo describes the device behind an mDNS service entry.
+func newDeviceInfo(entry *mdns.ServiceEntry, endpoint Endpoint) DeviceInfo {
+	info := DeviceInfo{
+		Endpoint: endpoint,
+		Name:     strings.TrimSuffix(entry.Name, "._lucijsonl._tcp.local."),
+		Host:     strings.TrimSuffix(entry.Host, "."),
+		IPv4:     entry.AddrV4,
+		IPv6:     entry.AddrV6,
+		TXT:      make(map[string]string),
+	}
+	for _, field := range entry.InfoFields {
+		key, value, _ := strings.Cut(field, "=")
+		info.TXT[key] = value
+	}
+	info.Mac = info.TXT["mac"]
+	ident := SysIdent{FwName: info.TXT["fw_name"], FwBuild: info.TXT["fw_build"]}
+	info.Firmware = ident.Firmware()
+	return info
+}
+
+// DiscoveryOptions configure the mDNS lookups of a Discovery. The zero
+// value queries on the default interface with IPv4 and IPv6 multicast for
+// a second.
+type DiscoveryOptions struct {
+	// Timeout is how long to wait for answers, such as longer on Wi-Fi,
+	// one second if zero.
+	Timeout time.Duration
+
+	// Interfaces are the names of the network interfaces to query, such as
+	// "eth0", instead of the default one, to keep away from VPNs.
+	Interfaces []string
+
+	DisableIPv4 bool // no IPv4 multicast
+	DisableIPv6 bool // no IPv6 multicast
+}
+
+func (o DiscoveryOptions) timeout() time.Duration {
+	if o.Timeout <= 0 {
+		return time.Second
+	}
+	return o.Timeout
+}
+
+// Discovery finds LUCIDACs in the local IP broadcast domain by mDNS
+// Zeroconf and attached by USB, see NewDiscovery.
+type Discovery struct {
+	entries    chan *mdns.ServiceEntry
+	found      chan DeviceInfo
+	done       chan struct{} // closed by Close
+	options    DiscoveryOptions
+	interfaces []*net.Interface // to query, nil for the default one
+}
+
+func (d *Discovery) offer(info DeviceInfo) {
+	select {
+	case d.found <- info:
+	case <-d.done:
+	}
+}
+
+func (d *Discovery) checkServer() {
+	for entry := range d.entries {
+		logger(LayerDiscovery).Debug("Found mDNS service", "name", entry.Name, "host", entry.Host, "ipv4", entry.AddrV4, "ipv6", entry.AddrV6)
+		d.offer(resolve(entry))
+	}
+}
+
+// resolve describes the device behind an mDNS service entry, reached by
+// its host name if that resolves to its IPv4 address, else by the address.
+// Devices without IPv4, such as on IPv6-only networks, are reached by their
+// IPv6 address.
+func resolve(entry *mdns.ServiceEntry) DeviceInfo {
+	if entry.AddrV4 == nil && entry.AddrV6 != nil {
+		return newDeviceInfo(entry, TCPEndpoint{Host: entry.AddrV6.String(), Port: defaultTcpPort})
+	}
+	resolvableIPv4 := false
+	ips, err := net.LookupIP(entry.Host)
+	if err != nil {
+		//fmt.Printf("Could not resolve Host, take instead %s\n", entry.AddrV4)
+	} else {
+		for _, ip := range ips {
+			if ip.String() == entry.AddrV4.String() {
+				resolvableIPv4 = true
+			}
+		}
+	}
+	if resolvableIPv4 {
+		return newDeviceInfo(entry, TCPEndpoint{Host: entry.Host, Port: defaultTcpPort})
+	}
+	return newDeviceInfo(entry, TCPEndpoint{Host: entry.AddrV4.String(), Port: defaultTcpPort})
+}
+
+// checkUSB offers the LUCIDACs attached by USB.
+func (d *Discovery) checkUSB() {
+	devices, err := FindUSB()
+	if err != nil {
+		logger(LayerDiscovery).Warn("Cannot enumerate serial ports", "err", err)
+	}
+	for _, info := range devices {
+		d.offer(info)
+	}
+}
+
+// NewDiscovery looks for LUCIDACs by mDNS Zeroconf discovery/detection in
+// the local IP broadcast domain and among the serial ports of USB
+// devices, see FindUSB.
+func NewDiscovery() Discovery {
+	d, _ := NewDiscoveryWith(DiscoveryOptions{})
+	return d
+}
+
+// NewDiscoveryWith looks for LUCIDACs as NewDiscovery does, with the mDNS
+// lookups configured by options. It fails for unknown interfaces.
+func NewDiscoveryWith(options DiscoveryOptions) (Discovery, error) {
+	d := Discovery{
+		entries: make(chan *mdns.ServiceEntry, 4),
+		found:   make(chan DeviceInfo),
+		done:    make(chan struct{}),
+		options: options,
+	}
+	for _, name := range options.Interfaces {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return d, fmt.Errorf("cannot discover on %s: %w", name, err)
+		}
+		d.interfaces = append(d.interfaces, iface)
+	}
+	go d.checkServer()
+	go d.checkUSB()
+	go func() {
+		if err := d.query(d.entries); err != nil {
+			logger(LayerDiscovery).Warn("mDNS query failed", "err", err)
+		}
+		close(d.entries)
+	}()
+	return d, nil
+}
+
+// query sends the answers to a single mDNS query on every interface to
+// entries, and returns once the timeout is over.
+func (d *Discovery) query(entries chan<- *mdns.ServiceEntry) error {
+	interfaces := d.interfaces
+	if len(interfaces) == 0 {
+		interfaces = []*net.Interface{nil}
+	}
+	errs := make(chan error, len(interfaces))
+	for _, iface := range interfaces {
+		params := mdns.DefaultParams("_lucijsonl._tcp")
+		params.Entries = entries
+		params.Timeout = d.options.timeout()
+		params.Interface = iface
+		params.DisableIPv4 = d.options.DisableIPv4
+		params.DisableIPv6 = d.options.DisableIPv6
+		go func() { errs <- mdns.Query(params) }()
+	}
+	var err error
+	for range interfaces {
+		err = errors.Join(err, <-errs)
+	}
+	return err
+}
+
+// Close stops passing on devices found.
+func (d *Discovery) Close() {
+	close(d.done)
+}
+
+// FindAll returns the devices found within the timeout of the options.
+func (d *Discovery) FindAll() []DeviceInfo {
+	var results []DeviceInfo
+	timeout := time.After(d.options.timeout())
+	for {
+		select {
+		case result := <-d.found:
+			logger(LayerDiscovery).Debug("Found", "device", result)
+			results = append(results, result)
+		case <-timeout:
+			logger(LayerDiscovery).Info("Found devices", "count", len(results))
+			d.Close()
+			return results
+		}
+	}
+}
+
+func (d *Discovery) FindMaxOne() (result DeviceInfo, ok bool) {
+	select {
+	case result = <-d.found:
+		logger(LayerDiscovery).Info("Decided for", "device", result)
+		ok = true
+	case <-time.After(d.options.timeout()):
+		logger(LayerDiscovery).Info("No device found", "timeout", d.options.timeout())
+		ok = false
+	}
+	d.Close()
+	return result, ok
+}
+
+// WatchInterval is the time between the lookups of Discovery.Watch.
+var WatchInterval = 5 * time.Second
+
+// WatchMisses is the number of lookups in a row a device must not answer
+// to until Discovery.Watch considers it gone. Single mDNS answers get lost
+// easily, such as on congested Wi-Fi.
+var WatchMisses = 3
+
+// DiscoveryEvent tells that a device appeared or, if Removed, disappeared,
+// see Discovery.Watch.
+type DiscoveryEvent struct {
+	Device  DeviceInfo
+	Removed bool
+}
+
+// Watch keeps looking for LUCIDACs by mDNS, as configured by the options,
+// and USB every WatchInterval until ctx is done, and calls events whenever
+// a device appears or disappears, such as to keep a device picker up to
+// date. Devices are
+// told apart by their endpoint. Unlike FindAll and FindMaxOne, Watch does
+// not close the Discovery and returns ctx.Err().
+func (d *Discovery) Watch(ctx context.Context, events func(DiscoveryEvent)) error {
+	w := watcher{devices: make(map[string]DeviceInfo), misses: make(map[string]int)}
+	for {
+		found, err := d.lookup()
+		if err != nil {
+			logger(LayerDiscovery).Warn("mDNS query failed", "err", err)
+		} else {
+			w.update(found, events)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(WatchInterval):
+		}
+	}
+}
+
+// lookup returns the devices answering to a single mDNS query, and those
+// attached by USB.
+func (d *Discovery) lookup() ([]DeviceInfo, error) {
+	entries := make(chan *mdns.ServiceEntry, 4)
+	resolved := make(chan []DeviceInfo)
+	go func() {
+		var found []DeviceInfo
+		for entry := range entries {
+			found = append(found, resolve(entry))
+		}
+		resolved <- found
+	}()
+	err := d.query(entries)
+	close(entries)
+	found := <-resolved
+	if err != nil {
+		return nil, err
+	}
+	usb, err := FindUSB()
+	if err != nil {
+		logger(LayerDiscovery).Warn("Cannot enumerate serial ports", "err", err)
+	}
+	return append(found, usb...), nil
+}
+
+// watcher keeps the devices seen by Watch.
+type watcher struct {
+	devices map[string]DeviceInfo // by endpoint URL
+	misses  map[string]int        // lookups in a row without answer
+}
+
+// update tells events about the devices found new, and those missing for
+// WatchMisses lookups.
+func (w *watcher) update(found []DeviceInfo, events func(DiscoveryEvent)) {
+	answered := make(map[string]bool)
+	for _, device := range found {
+		url := device.Endpoint.ToURL()
+		answered[url] = true
+		w.misses[url] = 0
+		if _, known := w.devices[url]; !known {
+			events(DiscoveryEvent{Device: device})
+		}
+		w.devices[url] = device
+	}
+	for url, device := range w.devices {
+		if answered[url] {
+			continue
+		}
+		if w.misses[url]++; w.misses[url] >= WatchMisses {
+			delete(w.devices, url)
+			delete(w.misses, url)
+			events(DiscoveryEvent{Device: device, Removed: true})
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/mdns"
+)
+
+func TestNewDeviceInfo(t *testing.T) {
+	entry := &mdns.ServiceEntry{
+		Name:       "lucidac-04-E9-E5-17-5E-B4._lucijsonl._tcp.local.",
+		Host:       "lucidac-04-E9-E5-17-5E-B4.local.",
+		AddrV4:     net.IPv4(192, 168, 1, 101),
+		AddrV6:     net.ParseIP("fe80::6e9:e5ff:fe17:5eb4"),
+		InfoFields: []string{"emulator", "mac=04-E9-E5-17-5E-B4", "fw_name=LUCIDAC", "fw_build=0.3.1"},
+	}
+	endpoint := TCPEndpoint{Host: "192.168.1.101", Port: defaultTcpPort}
+	info := newDeviceInfo(entry, endpoint)
+	if info.Endpoint != endpoint || info.Name != "lucidac-04-E9-E5-17-5E-B4" || info.Host != "lucidac-04-E9-E5-17-5E-B4.local" {
+		t.Fatalf("unexpected endpoint, name or host in %+v", info)
+	}
+	if !info.IPv4.Equal(entry.AddrV4) || !info.IPv6.Equal(entry.AddrV6) {
+		t.Fatalf("unexpected addresses in %+v", info)
+	}
+	if info.Mac != "04-E9-E5-17-5E-B4" || info.Firmware != "LUCIDAC 0.3.1" {
+		t.Fatalf("expected MAC and firmware from TXT, got %q and %q", info.Mac, info.Firmware)
+	}
+	if value, ok := info.TXT["emulator"]; !ok || value != "" {
+		t.Fatalf("expected TXT record without value, got %q, %v", value, ok)
+	}
+}
+
+func TestResolve_IPv6(t *testing.T) {
+	entry := &mdns.ServiceEntry{Name: "lucidac", Host: "lucidac.local.", AddrV6: net.ParseIP("2001:db8::1")}
+	info := resolve(entry)
+	if info.Endpoint.ToURL() != "tcp://[2001:db8::1]:5732" {
+		t.Fatalf("expected the IPv6 address as endpoint, got %s", info.Endpoint.ToURL())
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	a := DeviceInfo{Endpoint: TCPEndpoint{Host: "192.168.1.101", Port: defaultTcpPort}}
+	b := DeviceInfo{Endpoint: SerialEndpoint{Device: "/dev/ttyACM0"}}
+	w := watcher{devices: make(map[string]DeviceInfo), misses: make(map[string]int)}
+	var events []DiscoveryEvent
+	record := func(event DiscoveryEvent) { events = append(events, event) }
+
+	w.update([]DeviceInfo{a, b}, record)
+	if len(events) != 2 || events[0].Removed || events[1].Removed {
+		t.Fatalf("expected both devices added, got %+v", events)
+	}
+	events = nil
+	for i := 1; i < WatchMisses; i++ {
+		w.update([]DeviceInfo{a}, record)
+	}
+	w.update([]DeviceInfo{a, b}, record)
+	if len(events) != 0 {
+		t.Fatalf("expected no events for a device missing less than WatchMisses times, got %+v", events)
+	}
+	for i := 0; i < WatchMisses; i++ {
+		w.update([]DeviceInfo{a}, record)
+	}
+	if len(events) != 1 || !events[0].Removed || events[0].Device.Endpoint != b.Endpoint {
+		t.Fatalf("expected %v removed, got %+v", b, events)
+	}
+}
+
+func TestNewDiscoveryWith(t *testing.T) {
+	if _, err := NewDiscoveryWith(DiscoveryOptions{Interfaces: []string{"no-such-interface0"}}); err == nil {
+		t.Fatalf("expected an error for an unknown interface")
+	}
+	if timeout := (DiscoveryOptions{}).timeout(); timeout != time.Second {
+		t.Fatalf("expected a second by default, got %v", timeout)
+	}
+}
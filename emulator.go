@@ -0,0 +1,157 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+)
+
+// EmulatedMac is the MAC address of emulated LUCIDACs, from the range
+// reserved for documentation.
+const EmulatedMac = "00-00-5E-00-53-00"
+
+// EmulatorEndpoint connects to a minimal LUCIDAC emulated in-process, for
+// exercising clients without a device, such as in CI. It answers sys_ident,
+// net_status, net_get and sys_reboot, net_set by merging the settings given
+// into those of net_get, and net_reset by restoring EmulatedSettings. Other
+// types are answered with CodeFailed. `lucigo emu` serves it on TCP,
+// `lucigo emulate` a more complete emulator built on it, with runs.
+//
+// As URL, it is given as emu://.
+type EmulatorEndpoint struct {
+	// Emulator answers, shared by all connections. By default, each
+	// connection has its own, for as long as it lasts.
+	Emulator *Emulator
+}
+
+func (e EmulatorEndpoint) IsValid() bool {
+	return true
+}
+
+func (e EmulatorEndpoint) ToURL() string {
+	return "emu://"
+}
+
+func (e EmulatorEndpoint) Open() (io.ReadWriter, error) {
+	return e.loopback().Open()
+}
+
+// Serve accepts connections on the listener and answers each as one opened
+// with e, such that other clients reach the emulator over TCP. It returns
+// once the listener is closed.
+func (e EmulatorEndpoint) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go e.loopback().serve(conn)
+	}
+}
+
+func (e EmulatorEndpoint) loopback() LoopbackEndpoint {
+	emulator := e.Emulator
+	if emulator == nil {
+		emulator = NewEmulator()
+	}
+	return LoopbackEndpoint{Transform: emulator.Answer}
+}
+
+// EmulatedSettings returns the factory defaults of the permanent settings
+// of emulated LUCIDACs.
+func EmulatedSettings() map[string]interface{} {
+	return map[string]interface{}{
+		"ethernet": map[string]interface{}{"mac": EmulatedMac, "hostname": "lucidac-emulator"},
+		"ipv4":     map[string]interface{}{"dhcp_enabled": true, "static_ipv4_address": "0.0.0.0"},
+		"jsonl":    map[string]interface{}{"enabled": true, "port": defaultTcpPort},
+	}
+}
+
+// Emulator is the state of an emulated LUCIDAC, see EmulatorEndpoint. It is
+// safe for concurrent use.
+type Emulator struct {
+	// FwBuild is answered to sys_ident, "lucigo-emulator" by default.
+	FwBuild string
+
+	mu       sync.Mutex
+	settings map[string]interface{} // permanent settings, as for net_get
+}
+
+// NewEmulator creates an emulator with the settings of EmulatedSettings.
+func NewEmulator() *Emulator {
+	return &Emulator{settings: EmulatedSettings()}
+}
+
+// Settings returns a copy of the permanent settings, as for net_get.
+func (e *Emulator) Settings() map[string]interface{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return toMsg(e.settings)
+}
+
+// SetSettings replaces the permanent settings, such as by those persisted.
+func (e *Emulator) SetSettings(settings map[string]interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.settings = toMsg(settings)
+}
+
+// Answer answers an envelope as the emulated device.
+func (e *Emulator) Answer(sent SendEnvelope) RecvEnvelope {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	res := RecvEnvelope{Type: sent.Type, Id: sent.Id, Msg: map[string]interface{}{}}
+	switch sent.Type {
+	case "sys_ident":
+		build := e.FwBuild
+		if build == "" {
+			build = "lucigo-emulator"
+		}
+		res.Msg = toMsg(SysIdent{FwName: "LUCIDAC", FwBuild: build, Mac: EmulatedMac})
+	case "net_status":
+		res.Msg = toMsg(NetStatus{HasEthernet: true, Link: true})
+	case "net_get":
+		res.Msg = toMsg(e.settings)
+	case "sys_reboot":
+		// the settings are kept, as on a device
+	case "net_reset":
+		e.settings = EmulatedSettings()
+	case "net_set":
+		settings, _ := sent.Msg.(map[string]interface{})
+		mergeSettings(e.settings, toMsg(settings))
+		res.Msg = settings
+	default:
+		res.Code = CodeFailed
+		res.Error = "unknown type"
+	}
+	return res
+}
+
+// mergeSettings merges update into settings one level deep, as net_set
+// does: Sections given replace only the keys they have.
+func mergeSettings(settings, update map[string]interface{}) {
+	for key, value := range update {
+		section, isSection := value.(map[string]interface{})
+		current, hasSection := settings[key].(map[string]interface{})
+		if isSection && hasSection {
+			for k, v := range section {
+				current[k] = v
+			}
+		} else {
+			settings[key] = value
+		}
+	}
+}
+
+// toMsg converts v to the map of a message.
+func toMsg(v interface{}) map[string]interface{} {
+	var msg map[string]interface{}
+	raw, _ := json.Marshal(v)
+	json.Unmarshal(raw, &msg)
+	return msg
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestEmulatorEndpoint(t *testing.T) {
+	hc, err := NewHybridControllerFromString("emu://")
+	if err != nil {
+		t.Fatalf("NewHybridControllerFromString: %v", err)
+	}
+	defer hc.Close()
+
+	ident, err := hc.SysIdent()
+	if err != nil || ident.Mac != EmulatedMac || ident.FwName != "LUCIDAC" {
+		t.Fatalf("expected the emulated identity, got %+v, %v", ident, err)
+	}
+	status, err := hc.NetStatus()
+	if err != nil || !status.HasEthernet || !status.Link {
+		t.Fatalf("expected ethernet with link, got %+v, %v", status, err)
+	}
+
+	set := map[string]interface{}{"ethernet": map[string]interface{}{"hostname": "lab-1"}}
+	res, err := hc.QueryMsg("net_set", set)
+	if err != nil || res.Msg["ethernet"] == nil {
+		t.Fatalf("expected net_set echoed, got %+v, %v", res, err)
+	}
+	res, err = hc.Query("net_get")
+	if err != nil {
+		t.Fatalf("net_get: %v", err)
+	}
+	ethernet, _ := res.Msg["ethernet"].(map[string]interface{})
+	if ethernet["hostname"] != "lab-1" || ethernet["mac"] != EmulatedMac {
+		t.Fatalf("expected the hostname set and the MAC kept, got %v", res.Msg)
+	}
+
+	if _, err := hc.Query("sys_reboot"); err != nil {
+		t.Fatalf("sys_reboot: %v", err)
+	}
+	if _, err := hc.Query("start_run"); !errors.Is(err, ErrDeviceFailed) {
+		t.Fatalf("expected other types to fail, got %v", err)
+	}
+}
+
+func TestEmulatorEndpoint_Serve(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+	go EmulatorEndpoint{Emulator: NewEmulator()}.Serve(listener)
+
+	url := "tcp://" + listener.Addr().String()
+	first, err := NewHybridControllerFromString(url)
+	if err != nil {
+		t.Fatalf("NewHybridControllerFromString: %v", err)
+	}
+	defer first.Close()
+	if _, err := first.QueryMsg("net_set", map[string]interface{}{"ethernet": map[string]interface{}{"hostname": "lab-2"}}); err != nil {
+		t.Fatalf("net_set: %v", err)
+	}
+
+	// the settings are shared by the connections
+	second, err := NewHybridControllerFromString(url)
+	if err != nil {
+		t.Fatalf("NewHybridControllerFromString: %v", err)
+	}
+	defer second.Close()
+	res, err := second.Query("net_get")
+	if err != nil {
+		t.Fatalf("net_get: %v", err)
+	}
+	if ethernet, _ := res.Msg["ethernet"].(map[string]interface{}); ethernet["hostname"] != "lab-2" {
+		t.Fatalf("expected the hostname set on the other connection, got %v", res.Msg)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Ensemble couples several LUCIDACs into one larger analog computation by
+// running them together. Setup configures each device (for instance by
+// uploading its part of the circuit), then the runs are started on all
+// devices as close to simultaneously as possible.
+//
+//	ensemble := &lucigo.Ensemble{
+//		Controllers: []*lucigo.HybridController{hc1, hc2},
+//		Setup:       func(i int, hc *lucigo.HybridController) error { ... },
+//		Config:      lucigo.RunConfig{IcTime: 100000, OpTime: 1000000},
+//		DAQ:         lucigo.DAQConfig{NumChannels: 2, SampleOp: true, SampleRate: 100000},
+//	}
+//	runs, err := ensemble.Start()
+//	log.Printf("skew %s", runs.Skew())
+//
+// Starting over the network leaves a skew of typically some hundred
+// microseconds between the devices. For sample accurate synchronization,
+// wire the devices to a common trigger and set WaitForExternalTrigger.
+type Ensemble struct {
+	Controllers []*HybridController
+	Setup       func(index int, hc *HybridController) error // optional
+	Config      RunConfig
+	DAQ         DAQConfig
+}
+
+// EnsembleRun holds the runs of an Ensemble, indexed as the Controllers.
+type EnsembleRun struct {
+	Runs []*Run
+
+	// Estimated start of the run on each device: The midpoint between
+	// sending start_run and receiving the answer, give or take Uncertainty.
+	Started     []time.Time
+	Uncertainty []time.Duration // half the round trip time of start_run
+}
+
+// Start sets up all devices and then starts their runs in parallel. If
+// any device fails, the error is returned together with the runs which
+// did start (the others being nil), which still have to be consumed.
+func (e *Ensemble) Start() (*EnsembleRun, error) {
+	n := len(e.Controllers)
+	if e.Setup != nil {
+		for i, hc := range e.Controllers {
+			if err := e.Setup(i, hc); err != nil {
+				return nil, fmt.Errorf("cannot set up device %d: %w", i, err)
+			}
+		}
+	}
+
+	runs := &EnsembleRun{
+		Runs:        make([]*Run, n),
+		Started:     make([]time.Time, n),
+		Uncertainty: make([]time.Duration, n),
+	}
+	errs := make([]error, n)
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	for i, hc := range e.Controllers {
+		started.Add(1)
+		go func(i int, hc *HybridController) {
+			defer started.Done()
+			<-release // all goroutines are ready, keep their start close together
+			sent := time.Now()
+			run, err := hc.StartRun(e.Config, e.DAQ)
+			rtt := time.Since(sent)
+			if err != nil {
+				errs[i] = fmt.Errorf("cannot start run on device %d: %w", i, err)
+				return
+			}
+			runs.Runs[i] = run
+			runs.Started[i] = sent.Add(rtt / 2)
+			runs.Uncertainty[i] = rtt / 2
+		}(i, hc)
+	}
+	close(release)
+	started.Wait()
+	return runs, errors.Join(errs...)
+}
+
+// Skew returns the difference between the earliest and the latest
+// estimated start of the runs.
+func (r *EnsembleRun) Skew() time.Duration {
+	var first, last time.Time
+	for i, started := range r.Started {
+		if r.Runs[i] == nil {
+			continue
+		}
+		if first.IsZero() || started.Before(first) {
+			first = started
+		}
+		if last.IsZero() || started.After(last) {
+			last = started
+		}
+	}
+	return last.Sub(first)
+}
+
+// Capture feeds the data of each run into its sinks, sinks[i] being the
+// ones of run i, all runs in parallel. It returns the errors of all runs.
+func (r *EnsembleRun) Capture(sinks [][]Sink) error {
+	errs := make([]error, len(r.Runs))
+	var done sync.WaitGroup
+	for i, run := range r.Runs {
+		if run == nil {
+			continue
+		}
+		var runSinks []Sink
+		if i < len(sinks) {
+			runSinks = sinks[i]
+		}
+		done.Add(1)
+		go func(i int, run *Run) {
+			defer done.Done()
+			if err := run.Capture(runSinks...); err != nil {
+				errs[i] = fmt.Errorf("device %d: %w", i, err)
+			}
+		}(i, run)
+	}
+	done.Wait()
+	return errors.Join(errs...)
+}
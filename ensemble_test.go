@@ -0,0 +1,61 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"io"
+	"testing"
+)
+
+func TestEnsemble(t *testing.T) {
+	setup := []int{}
+	ensemble := &Ensemble{
+		Controllers: []*HybridController{
+			newPipeController(serveRun("[[1],[2]]")),
+			newPipeController(serveRun("[[3],[4]]", "[[5]]")),
+		},
+		Setup: func(i int, hc *HybridController) error {
+			setup = append(setup, i)
+			return nil
+		},
+		Config: testRunConfig,
+		DAQ:    DAQConfig{NumChannels: 1, SampleRate: 1},
+	}
+	runs, err := ensemble.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if len(setup) != 2 || len(runs.Runs) != 2 || runs.Skew() < 0 {
+		t.Fatalf("expected 2 devices set up and started, got %v and %+v", setup, runs)
+	}
+
+	recordings := []*Recording{{}, {}}
+	if err := runs.Capture([][]Sink{{recordings[0]}, {recordings[1]}}); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if len(recordings[0].Samples) != 2 || len(recordings[1].Samples) != 3 {
+		t.Fatalf("expected 2 and 3 samples, got %d and %d", len(recordings[0].Samples), len(recordings[1].Samples))
+	}
+}
+
+func TestEnsemble_failure(t *testing.T) {
+	failing := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		w.Write([]byte(`{"type":"start_run","code":-1,"error":"busy","msg":{}}` + "\n"))
+	})
+	ensemble := &Ensemble{
+		Controllers: []*HybridController{newPipeController(serveRun("[[1]]")), failing},
+		Config:      testRunConfig,
+	}
+	runs, err := ensemble.Start()
+	if err == nil {
+		t.Fatalf("expected an error for the failing device")
+	}
+	if runs.Runs[0] == nil || runs.Runs[1] != nil {
+		t.Fatalf("expected only the first run to be started, got %v", runs.Runs)
+	}
+	if err := runs.Capture(nil); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EntityClass tells what kind of hardware an entity is.
+type EntityClass int
+
+const (
+	EntityCarrier EntityClass = 1 // the board, named by its MAC address
+	EntityCluster EntityClass = 2 // "0", "1", ... on the carrier
+	EntityMBlock  EntityClass = 3 // "M0" (integrators) and "M1" (multipliers)
+	EntityUBlock  EntityClass = 4 // "U", distributing outputs to the lanes
+	EntityCBlock  EntityClass = 5 // "C", scaling the lanes by coefficients
+	EntityIBlock  EntityClass = 6 // "I", summing the lanes into inputs
+)
+
+// Entity is a node of the entity tree of a device, as answered to
+// get_entities:
+//
+//	{"04-E9-E5-14-74-BF": {"class": 1, "type": 0, "variant": 0, "version": "1.0.0",
+//	  "/0": {"class": 2, ..., "/M0": {"class": 3, ...}, "/U": {"class": 4, ...}}}}
+//
+// Which entities there are depends on the hardware revision and assembly.
+type Entity struct {
+	Class    EntityClass
+	Type     int
+	Variant  int
+	Version  string
+	Children map[string]*Entity // by name, such as "0" or "M0"
+}
+
+type entityJSON struct {
+	Class   EntityClass `json:"class"`
+	Type    int         `json:"type"`
+	Variant int         `json:"variant"`
+	Version string      `json:"version"`
+}
+
+func (e *Entity) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var attrs entityJSON
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return err
+	}
+	*e = Entity{Class: attrs.Class, Type: attrs.Type, Variant: attrs.Variant, Version: attrs.Version}
+	for key, raw := range fields {
+		if !strings.HasPrefix(key, "/") {
+			continue
+		}
+		child := &Entity{}
+		if err := json.Unmarshal(raw, child); err != nil {
+			return fmt.Errorf("entity %s: %w", key, err)
+		}
+		if e.Children == nil {
+			e.Children = make(map[string]*Entity)
+		}
+		e.Children[key[1:]] = child
+	}
+	return nil
+}
+
+func (e *Entity) MarshalJSON() ([]byte, error) {
+	fields := map[string]interface{}{"class": e.Class, "type": e.Type, "variant": e.Variant, "version": e.Version}
+	for name, child := range e.Children {
+		fields["/"+name] = child
+	}
+	return json.Marshal(fields)
+}
+
+// Get returns the entity at the path below e, such as "0/M0", nil if there
+// is none.
+func (e *Entity) Get(path string) *Entity {
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if e = e.Children[name]; e == nil {
+			return nil
+		}
+	}
+	return e
+}
+
+// Names returns the names of the children, sorted.
+func (e *Entity) Names() []string {
+	names := make([]string, 0, len(e.Children))
+	for name := range e.Children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Entities asks the device for its entity tree. It returns the carrier
+// boards by their name, which is the MAC address.
+func (hc *HybridController) Entities() (map[string]*Entity, error) {
+	res, err := hc.Query("get_entities")
+	if err != nil {
+		return nil, err
+	}
+	var msg struct {
+		Entities map[string]*Entity `json:"entities"`
+	}
+	if err := decodeAnswer(res, "get_entities", &msg); err != nil {
+		return nil, err
+	}
+	return msg.Entities, nil
+}
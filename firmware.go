@@ -0,0 +1,190 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Firmware images are uploaded over the JSONL protocol in chunks. Waiting
+// for the answer to each chunk before sending the next one makes an upload
+// over the serial line take many minutes, so chunks are pipelined instead:
+//
+//	{"type": "ota_begin", "msg": {"size": 1048576, "sha256": "9f86...", "chunk_size": 4096}}
+//	  -> {"code": 0, "msg": {"offset": 0, "window": 16}}
+//	{"type": "ota_chunk", "msg": {"offset": 0, "data": "<base64>"}}
+//	{"type": "ota_chunk", "msg": {"offset": 4096, "data": "<base64>"}}
+//	  -> {"code": 0, "msg": {"received": 4096}}
+//	...
+//	{"type": "ota_commit", "msg": {"sha256": "9f86..."}}
+//	  -> {"code": 0, "msg": {}}
+//
+// The answer to ota_begin tells how much of an image with that digest the
+// device already has, from an interrupted upload, and how many chunks it
+// buffers. That many chunks are sent without waiting for answers. Each
+// chunk is answered with the number of bytes received in a row so far; a
+// chunk which cannot be taken, such as one out of order, is answered with
+// an error, upon which the upload goes back to what was received. With
+// ota_commit, the device checks the digest and installs the image.
+
+// DefaultChunkBytes and DefaultWindow are used by a FirmwareUpload unless
+// configured otherwise or, for the window, told by the device.
+const (
+	DefaultChunkBytes = 4096
+	DefaultWindow     = 8
+)
+
+// FirmwareUpload uploads a firmware image to a device and installs it:
+//
+//	upload := &lucigo.FirmwareUpload{Image: image}
+//	err := upload.Run(ctx, hc)
+//
+// An interrupted upload is resumed by running it again, also over a new
+// connection, as long as the device was not restarted meanwhile.
+type FirmwareUpload struct {
+	Image     []byte
+	ChunkSize int // bytes of the image per chunk, defaults to DefaultChunkBytes
+	Window    int // chunks in flight, defaults to what the device buffers
+	Retries   int // errors in a row at the same offset before giving up, defaults to 3
+
+	// Progress is called with the bytes the device confirmed, if set.
+	Progress func(received, total int)
+}
+
+// otaBegin is the answer to ota_begin.
+type otaBegin struct {
+	Offset int `json:"offset"`
+	Window int `json:"window"`
+}
+
+// Run uploads and installs the image. Cancelling ctx stops the upload
+// between chunks; it can be resumed later.
+func (u *FirmwareUpload) Run(ctx context.Context, hc *HybridController) error {
+	chunkSize := u.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkBytes
+	}
+	sum := sha256.Sum256(u.Image)
+	digest := hex.EncodeToString(sum[:])
+
+	res, err := hc.QueryMsg("ota_begin", map[string]interface{}{"size": len(u.Image), "sha256": digest, "chunk_size": chunkSize})
+	if err != nil {
+		return err
+	}
+	var begin otaBegin
+	if err := res.DecodeMsg(&begin); err != nil {
+		return fmt.Errorf("cannot decode answer to ota_begin: %w", err)
+	}
+	if begin.Offset < 0 || begin.Offset > len(u.Image) {
+		return fmt.Errorf("device claims to have %d bytes of an image of %d", begin.Offset, len(u.Image))
+	}
+	window := u.Window
+	if window <= 0 {
+		window = begin.Window
+	}
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	if err := u.send(ctx, hc, begin.Offset, chunkSize, window); err != nil {
+		return err
+	}
+
+	_, err = hc.QueryMsg("ota_commit", map[string]interface{}{"sha256": digest})
+	return err
+}
+
+// send transmits the image from the offset on with at most window chunks
+// unanswered.
+func (u *FirmwareUpload) send(ctx context.Context, hc *HybridController, offset, chunkSize, window int) error {
+	retries := u.Retries
+	if retries <= 0 {
+		retries = 3
+	}
+	answers := make(chan *Call, window)
+
+	received, next := offset, offset
+	pending := make(map[uuid.UUID]bool) // chunks in flight, by id
+	stale := make(map[uuid.UUID]bool)   // in flight, but sent before going back
+	failures := 0
+	if u.Progress != nil {
+		u.Progress(received, len(u.Image))
+	}
+	for received < len(u.Image) {
+		if err := ctx.Err(); err != nil {
+			u.await(answers, pending, stale)
+			return err
+		}
+		for next < len(u.Image) && len(pending)+len(stale) < window {
+			end := min(next+chunkSize, len(u.Image))
+			sent := hc.NewEnvelope("ota_chunk")
+			sent.Msg = map[string]interface{}{"offset": next, "data": base64.StdEncoding.EncodeToString(u.Image[next:end])}
+			pending[sent.Id] = true
+			hc.Go(sent, answers)
+			next = end
+		}
+		if len(pending)+len(stale) == 0 {
+			// all chunks answered, but not all received
+			if failures++; failures > retries {
+				return fmt.Errorf("device received only %d of %d bytes", received, len(u.Image))
+			}
+			next = received
+			continue
+		}
+
+		call := <-answers
+		if call.Err != nil {
+			return call.Err
+		}
+		if stale[call.Sent.Id] {
+			delete(stale, call.Sent.Id)
+			continue
+		}
+		delete(pending, call.Sent.Id)
+		res := call.Res
+		var ack struct {
+			Received *int `json:"received"`
+		}
+		res.DecodeMsg(&ack)
+		if ack.Received != nil && *ack.Received > received && *ack.Received <= len(u.Image) {
+			received, failures = *ack.Received, 0
+			if u.Progress != nil {
+				u.Progress(received, len(u.Image))
+			}
+		}
+		if !res.IsSuccess() {
+			if failures++; failures > retries {
+				return fmt.Errorf("failed at %d bytes: %w", received, res.Err())
+			}
+			// go back to what the device has, ignoring the answers to what
+			// was sent meanwhile
+			for id := range pending {
+				stale[id] = true
+			}
+			clear(pending)
+			next = received
+		}
+	}
+	return u.await(answers, pending, stale)
+}
+
+// await waits for the chunks still in flight to be answered, before the
+// device is given further commands.
+func (u *FirmwareUpload) await(answers chan *Call, pending, stale map[uuid.UUID]bool) error {
+	for len(pending)+len(stale) != 0 {
+		call := <-answers
+		if call.Err != nil {
+			return call.Err
+		}
+		delete(pending, call.Sent.Id)
+		delete(stale, call.Sent.Id)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fleet is an inventory of devices, such as all LUCIDACs of a lab or a
+// course, to operate on together. It is read from a file like
+//
+//	{"devices": [
+//	  {"name": "lab1", "endpoint": "tcp://192.168.1.101", "tags": {"room": "A1", "course": "analog101"}, "desired": "analog101.json"},
+//	  {"name": "lab2", "endpoint": "tcp://192.168.1.102", "tags": {"room": "A1"}}
+//	]}
+//
+// or the same in YAML, if built with the yaml build tag. The desired state
+// of a device is a settings file as for [HybridController.Apply], which
+// its settings are checked against for drift.
+type Fleet struct {
+	Devices []FleetDevice `json:"devices"`
+
+	Concurrency int                                          `json:"-" yaml:"-"` // devices operated on at once, defaults to 8
+	Connect     func(FleetDevice) (*HybridController, error) `json:"-" yaml:"-"` // defaults to connecting to the Endpoint
+}
+
+// FleetDevice is a device of a Fleet.
+type FleetDevice struct {
+	Name     string            `json:"name"`
+	Endpoint string            `json:"endpoint"` // as for NewHybridControllerFromString
+	Tags     map[string]string `json:"tags,omitempty"`
+	Desired  string            `json:"desired,omitempty"` // file of the desired settings, relative to the inventory
+
+	// Credential is the name of the credential to log in with, kept in a
+	// CredentialStore, such that the inventory holds no passwords
+	Credential string `json:"credential,omitempty"`
+}
+
+// DesiredSettings reads the desired settings of the device, nil if it has none.
+func (d FleetDevice) DesiredSettings() (map[string]interface{}, error) {
+	if d.Desired == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(d.Desired)
+	if err != nil {
+		return nil, err
+	}
+	var desired map[string]interface{}
+	if err := json.Unmarshal(data, &desired); err != nil {
+		return nil, fmt.Errorf("cannot read desired settings %s: %w", d.Desired, err)
+	}
+	return desired, nil
+}
+
+// fleetDecoders read inventories by file extension. Formats with optional
+// dependencies register themselves in build-tagged files.
+var fleetDecoders = map[string]func(data []byte, fleet *Fleet) error{
+	".json": func(data []byte, fleet *Fleet) error { return json.Unmarshal(data, fleet) },
+}
+
+// LoadFleet reads the inventory in the file at path.
+func LoadFleet(path string) (*Fleet, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	decode, ok := fleetDecoders[ext]
+	if !ok {
+		return nil, fmt.Errorf("cannot read inventory %s: unknown format '%s'", path, ext)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fleet := &Fleet{}
+	if err := decode(data, fleet); err != nil {
+		return nil, fmt.Errorf("cannot read inventory %s: %w", path, err)
+	}
+	for i, device := range fleet.Devices {
+		if device.Endpoint == "" {
+			return nil, fmt.Errorf("inventory %s: device %d (%s) has no endpoint", path, i, device.Name)
+		}
+		if device.Name == "" {
+			fleet.Devices[i].Name = device.Endpoint
+		}
+		if device.Desired != "" && !filepath.IsAbs(device.Desired) {
+			fleet.Devices[i].Desired = filepath.Join(filepath.Dir(path), device.Desired)
+		}
+	}
+	return fleet, nil
+}
+
+// Select returns the devices matching all selectors, given as key=value.
+// The key "name" matches the name of the device, all others its tags.
+func (f *Fleet) Select(selectors ...string) ([]FleetDevice, error) {
+	var selected []FleetDevice
+	for _, device := range f.Devices {
+		matches := true
+		for _, selector := range selectors {
+			key, value, ok := strings.Cut(selector, "=")
+			if !ok {
+				return nil, fmt.Errorf("need to select devices by key=value. Given was '%s'", selector)
+			}
+			if key == "name" {
+				matches = matches && device.Name == value
+			} else {
+				matches = matches && device.Tags[key] == value
+			}
+		}
+		if matches {
+			selected = append(selected, device)
+		}
+	}
+	return selected, nil
+}
+
+// FleetResult is the outcome of an operation on a device of a Fleet.
+type FleetResult struct {
+	Device   string        `json:"device"`
+	OK       bool          `json:"ok"`
+	Result   interface{}   `json:"result,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Do connects to each of the devices and runs op on it, with at most
+// Concurrency devices at once. The results come in the order of the
+// devices. Failing devices do not stop the others.
+func (f *Fleet) Do(devices []FleetDevice, op func(hc *HybridController, device FleetDevice) (interface{}, error)) []FleetResult {
+	connect := f.connector()
+	results := make([]FleetResult, len(devices))
+	parallel(len(devices), f.Concurrency, func(i int) {
+		device := devices[i]
+		started := time.Now()
+		result := FleetResult{Device: device.Name}
+		hc, err := connect(device)
+		if err == nil {
+			result.Result, err = op(hc, device)
+			hc.Close()
+		}
+		result.OK = err == nil
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.Duration = time.Since(started)
+		results[i] = result
+	})
+	return results
+}
+
+// Pool connects to the devices, with at most Concurrency at once, and
+// keeps the connections for queries to all of them, see [Pool.QueryAll].
+// Devices which cannot be connected to are left out and reported in the
+// error, the pool holds the others.
+func (f *Fleet) Pool(devices []FleetDevice) (*Pool, error) {
+	connect := f.connector()
+	hcs := make([]*HybridController, len(devices))
+	errs := make([]error, len(devices))
+	parallel(len(devices), f.Concurrency, func(i int) {
+		hc, err := connect(devices[i])
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", devices[i].Name, err)
+		}
+		hcs[i] = hc
+	})
+	pool := NewPool()
+	pool.Concurrency = f.Concurrency
+	for i, hc := range hcs {
+		if hc != nil {
+			pool.Add(devices[i].Name, hc)
+		}
+	}
+	return pool, errors.Join(errs...)
+}
+
+func (f *Fleet) connector() func(FleetDevice) (*HybridController, error) {
+	if f.Connect != nil {
+		return f.Connect
+	}
+	return func(device FleetDevice) (*HybridController, error) {
+		return NewHybridControllerFromString(device.Endpoint)
+	}
+}
+
+// parallel calls fn for each 0 <= i < n, with at most concurrency calls at
+// once, 8 if not positive, and returns when all are done.
+func parallel(n, concurrency int, fn func(i int)) {
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+	slots := make(chan struct{}, concurrency)
+	var done sync.WaitGroup
+	for i := 0; i < n; i++ {
+		done.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer func() { <-slots; done.Done() }()
+			fn(i)
+		}(i)
+	}
+	done.Wait()
+}
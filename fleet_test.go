@@ -0,0 +1,106 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadFleet(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fleet.json")
+	os.WriteFile(filepath.Join(dir, "analog101.json"), []byte(`{"dhcp_enabled": true}`), 0o644)
+	os.WriteFile(path, []byte(`{"devices": [
+		{"name": "lab1", "endpoint": "tcp://192.168.1.101", "tags": {"room": "A1", "course": "analog101"}, "desired": "analog101.json"},
+		{"name": "lab2", "endpoint": "tcp://192.168.1.102", "tags": {"room": "A1"}},
+		{"endpoint": "tcp://192.168.1.103", "tags": {"room": "B2", "course": "analog101"}}
+	]}`), 0o644)
+	fleet, err := LoadFleet(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if desired, err := fleet.Devices[0].DesiredSettings(); err != nil || desired["dhcp_enabled"] != true {
+		t.Fatalf("expected the desired settings relative to the inventory, got %v, %v", desired, err)
+	}
+	if desired, err := fleet.Devices[1].DesiredSettings(); err != nil || desired != nil {
+		t.Fatalf("expected no desired settings, got %v, %v", desired, err)
+	}
+	for selectors, want := range map[string][]string{
+		"course=analog101": {"lab1", "tcp://192.168.1.103"},
+		"room=A1":          {"lab1", "lab2"},
+		"name=lab2":        {"lab2"},
+		"room=C3":          nil,
+	} {
+		devices, err := fleet.Select(selectors)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		var names []string
+		for _, device := range devices {
+			names = append(names, device.Name)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(want) {
+			t.Fatalf("expected %s to select %v, got %v", selectors, want, names)
+		}
+	}
+	if devices, _ := fleet.Select("room=A1", "course=analog101"); len(devices) != 1 {
+		t.Fatalf("expected selectors to be combined, got %v", devices)
+	}
+	if _, err := fleet.Select("analog101"); err == nil {
+		t.Fatalf("expected an error for a selector without value")
+	}
+	if _, err := LoadFleet(filepath.Join(t.TempDir(), "fleet.ini")); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+}
+
+func TestFleet_Do(t *testing.T) {
+	var running, most atomic.Int32
+	fleet := &Fleet{
+		Devices: []FleetDevice{{Name: "a"}, {Name: "b"}, {Name: "down"}, {Name: "c"}},
+
+		Concurrency: 2,
+		Connect: func(device FleetDevice) (*HybridController, error) {
+			if device.Name == "down" {
+				return nil, errors.New("connection refused")
+			}
+			return newPipeController(func(sent SendEnvelope, w io.Writer) {
+				fmt.Fprintf(w, `{"type":"sys_ident","id":"%s","code":0,"msg":{"mac":"%s"}}`+"\n", sent.Id, device.Name)
+			}), nil
+		},
+	}
+	results := fleet.Do(fleet.Devices, func(hc *HybridController, device FleetDevice) (interface{}, error) {
+		if n := running.Add(1); n > most.Load() {
+			most.Store(n)
+		}
+		defer running.Add(-1)
+		time.Sleep(10 * time.Millisecond)
+		res, err := hc.Query("sys_ident")
+		if err != nil {
+			return nil, err
+		}
+		return res.Msg["mac"], nil
+	})
+
+	if most.Load() > 2 {
+		t.Fatalf("expected at most 2 devices at once, got %d", most.Load())
+	}
+	for i, want := range []string{"a", "b", "", "c"} {
+		r := results[i]
+		if r.Device != fleet.Devices[i].Name || r.OK != (want != "") || (r.OK && r.Result != want) {
+			t.Fatalf("unexpected result %d: %+v", i, r)
+		}
+	}
+	if results[2].Error != "connection refused" {
+		t.Fatalf("expected the failure to be reported, got %+v", results[2])
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build yaml
+
+// Inventories in YAML are only read with the yaml build tag:
+//
+//	go get gopkg.in/yaml.v3
+//	go build -tags yaml ./...
+
+package lucigo
+
+import "gopkg.in/yaml.v3"
+
+func init() {
+	decode := func(data []byte, fleet *Fleet) error { return yaml.Unmarshal(data, fleet) }
+	fleetDecoders[".yaml"] = decode
+	fleetDecoders[".yml"] = decode
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"testing"
+)
+
+// The fuzz targets make sure malformed device output or user input cannot
+// crash a client. Run them with, for instance,
+//
+//	go test -fuzz FuzzParseRecvEnvelope
+
+func FuzzParseRecvEnvelope(f *testing.F) {
+	f.Add([]byte(`{"type":"net_get","id":"00000000-0000-0000-0000-000000000001","code":0,"msg":{"dhcp":true}}`))
+	f.Add([]byte(`{"type":"net_get","id":"not-a-uuid","code":"0"}`))
+	f.Add([]byte(`{"type":"run_data","msg":{"data":[[1,2]]}}`))
+	f.Add([]byte(`booting...`))
+	f.Add([]byte(`null`))
+	f.Fuzz(func(t *testing.T, line []byte) {
+		envelope, err := ParseRecvEnvelope(line)
+		if (envelope == nil) == (err == nil) {
+			t.Fatalf("expected either an envelope or an error, got %+v, %v", envelope, err)
+		}
+	})
+}
+
+func FuzzParseEndpoint(f *testing.F) {
+	for _, test := range valid_candidates {
+		f.Add(test.input)
+	}
+	for _, test := range known_failures {
+		f.Add(test)
+	}
+	f.Add("tcp://:5732")
+	f.Add("tcp://1.2.3.4:99999")
+	f.Fuzz(func(t *testing.T, url string) {
+		endpoint, err := ParseEndpoint(url)
+		if err == nil && !endpoint.IsValid() {
+			t.Fatalf("ParseEndpoint(%q) yields invalid %#v", url, endpoint)
+		}
+	})
+}
+
+func FuzzDecodeRunData(f *testing.F) {
+	f.Add([]byte(`{"type":"run_data","msg":{"id":"00000000-0000-0000-0000-000000000001","entity":[],"data":[[1,2],[3,4]]}}`), 2)
+	f.Add([]byte(`{"type":"run_data","msg":{"data":"AAABAA==","num_channels":2,"offset":7}}`), 0)
+	f.Add([]byte(`{"type":"run_data","msg":{"data":"AAAB","num_channels":1000000000}}`), 0)
+	f.Add([]byte(`{"type":"run_data","msg":{"data":[[1],[2,3]]}}`), 1)
+	f.Add([]byte(`{"type":"run_data","msg":{"data":[[],[]]}}`), 0)
+	f.Fuzz(func(t *testing.T, line []byte, numChannels int) {
+		envelope, err := ParseRecvEnvelope(line)
+		if err != nil {
+			return
+		}
+		channels := DAQConfig{NumChannels: min(max(numChannels, 0), MaxChannels)}.Channels()
+		_, frame, err := DecodeRunData(envelope, channels)
+		if err != nil {
+			return
+		}
+		for i, sample := range frame.Samples {
+			if len(sample) != len(frame.Channels) {
+				t.Fatalf("sample %d holds %d values for %d channels", i, len(sample), len(frame.Channels))
+			}
+		}
+	})
+}
+
+func FuzzFrameDecoder(f *testing.F) {
+	f.Add(packFrame(1, 2, 3, 4), 2)
+	f.Add(packFrame(1, 2, 3), 2)
+	f.Add([]byte("not base64"), 1)
+	dec := NewFrameDecoder(nil)
+	f.Fuzz(func(t *testing.T, payload []byte, numChannels int) {
+		dec.Channels = DAQConfig{NumChannels: min(max(numChannels, 0), MaxChannels)}.Channels()
+		samples, err := dec.Decode(payload)
+		if err != nil {
+			return
+		}
+		for i, sample := range samples {
+			if len(sample) != len(dec.Channels) {
+				t.Fatalf("sample %d holds %d values for %d channels", i, len(sample), len(dec.Channels))
+			}
+		}
+	})
+}
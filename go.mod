@@ -1,18 +1,26 @@
 module github.com/anabrid/lucigo
 
-go 1.22.4
+go 1.24.9
 
 require (
 	github.com/gorilla/websocket v1.5.3
-	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
+	github.com/nqd/flat v0.2.0
+	github.com/parquet-go/parquet-go v0.32.0
+	gonum.org/v1/hdf5 v0.0.0-20210714002203-8c5d23bc6946
 )
 
 require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
 	github.com/creack/goselect v0.1.2 // indirect
 	github.com/imdario/mergo v0.3.12 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
 	github.com/miekg/dns v1.1.41 // indirect
-	github.com/nqd/flat v0.2.0 // indirect
+	github.com/parquet-go/bitpack v1.0.0 // indirect
+	github.com/parquet-go/jsonlite v1.0.0 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	github.com/twpayne/go-geom v1.6.1 // indirect
 	golang.org/x/net v0.0.0-20210410081132-afb366fc7cd1 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
 )
 
 require (
@@ -20,5 +28,5 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/hashicorp/mdns v1.0.5
 	go.bug.st/serial v1.6.2
-	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/sys v0.38.0 // indirect
 )
@@ -0,0 +1,69 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"sort"
+)
+
+// Health are the onboard monitoring values of a device, as answered to
+// sys_health:
+//
+//	{"temperatures": {"mainboard": 41.5, "adc": 38.2}, "voltages": {"+15V": 14.98, "-15V": -15.02, "+3V3": 3.31}}
+//
+// Which sensors and rails are monitored depends on the hardware revision.
+type Health struct {
+	Temperatures map[string]float64 `json:"temperatures,omitempty"` // in °C, by sensor
+	Voltages     map[string]float64 `json:"voltages,omitempty"`     // in V, by rail
+}
+
+// Health asks the device for its monitoring values. Firmware without
+// monitoring answers with an error code, which is returned as error.
+func (hc *HybridController) Health() (*Health, error) {
+	res, err := hc.Query("sys_health")
+	if err != nil {
+		return nil, err
+	}
+	return DecodeHealth(res)
+}
+
+// DecodeHealth decodes the answer to sys_health, such as one observed by a
+// CommandTracer.
+func DecodeHealth(res *RecvEnvelope) (*Health, error) {
+	health := &Health{}
+	if err := decodeAnswer(res, "sys_health", health); err != nil {
+		return nil, err
+	}
+	return health, nil
+}
+
+// MaxTemperature returns the hottest sensor, ok is false without any.
+func (h *Health) MaxTemperature() (sensor string, celsius float64, ok bool) {
+	for _, name := range h.Sensors() {
+		if !ok || h.Temperatures[name] > celsius {
+			sensor, celsius, ok = name, h.Temperatures[name], true
+		}
+	}
+	return sensor, celsius, ok
+}
+
+// Sensors returns the names of the temperature sensors, sorted.
+func (h *Health) Sensors() []string {
+	return sortedNames(h.Temperatures)
+}
+
+// Rails returns the names of the voltage rails, sorted.
+func (h *Health) Rails() []string {
+	return sortedNames(h.Voltages)
+}
+
+func sortedNames(values map[string]float64) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	monitoring := true
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		if !monitoring {
+			fmt.Fprintf(w, `{"type":"sys_health","id":"%s","code":-1,"error":"unknown type"}`+"\n", sent.Id)
+			return
+		}
+		fmt.Fprintf(w, `{"type":"sys_health","id":"%s","code":0,"msg":{"temperatures":{"mainboard":41.5,"adc":67},"voltages":{"-15V":-15.02,"+15V":14.98}}}`+"\n", sent.Id)
+	})
+	health, err := hc.Health()
+	if err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	if sensor, celsius, ok := health.MaxTemperature(); !ok || sensor != "adc" || celsius != 67 {
+		t.Fatalf("expected adc at 67 °C as hottest, got %s at %g", sensor, celsius)
+	}
+	if rails := health.Rails(); !reflect.DeepEqual(rails, []string{"+15V", "-15V"}) {
+		t.Fatalf("expected the rails sorted, got %v", rails)
+	}
+
+	monitoring = false
+	if _, err := hc.Health(); err == nil {
+		t.Fatalf("expected firmware without monitoring to fail")
+	}
+	if _, _, ok := (&Health{}).MaxTemperature(); ok {
+		t.Fatalf("expected no hottest sensor without sensors")
+	}
+}
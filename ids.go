@@ -0,0 +1,45 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+// IDSource produces the ids of envelopes and runs. It has to be safe for
+// concurrent use.
+type IDSource func() uuid.UUID
+
+// SequentialIDs returns an IDSource counting up from
+// 00000000-0000-0000-0000-000000000001. With it, the traffic of a
+// HybridController is the same on every run of a program, which makes
+// transcripts and golden tests reproducible byte for byte:
+//
+//	hc.IDs = lucigo.SequentialIDs()
+func SequentialIDs() IDSource {
+	var counter atomic.Uint64
+	return func() uuid.UUID {
+		var id uuid.UUID
+		binary.BigEndian.PutUint64(id[8:], counter.Add(1))
+		return id
+	}
+}
+
+// newID returns the next id from hc.IDs, or a random UUID without one.
+func (hc *HybridController) newID() uuid.UUID {
+	if hc.IDs != nil {
+		return hc.IDs()
+	}
+	return uuid.New()
+}
+
+// NewEnvelope creates a SendEnvelope for a given type with an id from
+// hc.IDs and empty Msg.
+func (hc *HybridController) NewEnvelope(Type string) SendEnvelope {
+	return SendEnvelope{Type: Type, Id: hc.newID()}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// PingType is the query KeepAlive pings the device with. Any answer tells
+// that the device is alive, also the error code of firmware not knowing it.
+const PingType = "ping"
+
+// KeepAlive checks in the background that the device still answers, for
+// long-lived connections such as of daemons, which otherwise notice a
+// rebooted device only once they give the next command:
+//
+//	stop := hc.KeepAlive(10*time.Second, func(err error) {
+//		log.Printf("LUCIDAC lost: %v", err)
+//	})
+//	defer stop()
+//
+// Every interval, the device is pinged and given the interval to answer.
+// Once it does not, or the connection breaks, lost is called with the
+// error, such as ErrTimeout or io.EOF, and checking ends; reconnecting is
+// up to lost. Calling stop, or closing the controller, ends checking
+// without calling lost. On TCP, the KeepAlive of the TCPEndpoint
+// additionally detects dead peers on the level of the socket.
+func (hc *HybridController) KeepAlive(interval time.Duration, lost func(error)) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+	stop = func() { once.Do(func() { close(done) }) }
+
+	report := func(err error) {
+		select {
+		case <-done:
+		default:
+			if !errors.Is(err, ErrClosed) {
+				lost(err)
+			}
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			broken, why := hc.lost()
+			select {
+			case <-done:
+				return
+			case <-broken:
+				report(why())
+				return
+			case <-ticker.C:
+			}
+			ping := hc.NewEnvelope(PingType)
+			ping.Timeout = interval
+			if call := <-hc.Go(ping, nil).Done; call.Err != nil {
+				report(call.Err)
+				return
+			}
+		}
+	}()
+	return stop
+}
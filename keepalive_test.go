@@ -0,0 +1,88 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// pingDevice answers the given number of pings, as firmware not knowing
+// them does, and then hangs.
+func pingDevice(t *testing.T, answers int) (*HybridController, net.Conn) {
+	client, device := net.Pipe()
+	t.Cleanup(func() { device.Close() })
+	go func() {
+		requests := bufio.NewScanner(device)
+		for requests.Scan() {
+			var sent SendEnvelope
+			json.Unmarshal(requests.Bytes(), &sent)
+			if answers == 0 {
+				continue
+			}
+			answers--
+			fmt.Fprintf(device, `{"type":"%s","id":"%s","code":-1,"error":"Unknown message type"}`+"\n", sent.Type, sent.Id)
+		}
+	}()
+	return &HybridController{Stream: client, Reader: NewLineReader(client)}, device
+}
+
+func TestKeepAlive(t *testing.T) {
+	hc, _ := pingDevice(t, 3)
+	lost := make(chan error, 1)
+	began := time.Now()
+	stop := hc.KeepAlive(10*time.Millisecond, func(err error) { lost <- err })
+	defer stop()
+	select {
+	case err := <-lost:
+		if !errors.Is(err, ErrTimeout) {
+			t.Fatalf("expected the hanging device to time out, got %v", err)
+		}
+		if time.Since(began) < 30*time.Millisecond {
+			t.Fatalf("expected error answers to keep the device alive, lost after %v", time.Since(began))
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the hanging device to be lost")
+	}
+}
+
+func TestKeepAlive_broken(t *testing.T) {
+	hc, device := pingDevice(t, -1)
+	lost := make(chan error, 1)
+	stop := hc.KeepAlive(time.Hour, func(err error) { lost <- err })
+	defer stop()
+	device.Close() // rebooted
+	select {
+	case err := <-lost:
+		if !errors.Is(err, io.EOF) {
+			t.Fatalf("expected the connection to be lost, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the broken connection to be noticed before the next ping")
+	}
+}
+
+func TestKeepAlive_stop(t *testing.T) {
+	hc, _ := pingDevice(t, 0)
+	lost := make(chan error, 1)
+	stop := hc.KeepAlive(10*time.Millisecond, func(err error) { lost <- err })
+	stop()
+	stop()
+	hc2, _ := pingDevice(t, 0)
+	stop2 := hc2.KeepAlive(10*time.Millisecond, func(err error) { lost <- err })
+	defer stop2()
+	hc2.Close()
+	select {
+	case err := <-lost:
+		t.Fatalf("expected no loss reported once stopped or closed, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
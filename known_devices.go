@@ -0,0 +1,124 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MaxKnownDevices is the number of devices KnownDevices remembers, the
+// least recently used are forgotten.
+var MaxKnownDevices = 50
+
+// KnownDevices remembers the devices connected to, by name and endpoint,
+// such that they can be given by name and completed in the shell:
+//
+//	known, _ := lucigo.LoadKnownDevices(lucigo.DefaultKnownDevicesPath())
+//	known.Remember("lab1", "tcp://192.168.1.101:5732")
+//	known.Save()
+//	known.Resolve("lab1") // tcp://192.168.1.101:5732
+type KnownDevices struct {
+	Path    string        `json:"-"`
+	Devices []KnownDevice `json:"devices"` // most recently used first
+}
+
+// KnownDevice is a device of KnownDevices.
+type KnownDevice struct {
+	Name     string    `json:"name,omitempty"` // such as the host name, "" if none
+	Endpoint string    `json:"endpoint"`       // URL, as for ParseEndpoint
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// DefaultKnownDevicesPath is where KnownDevices are kept by default, in the
+// cache directory of the user.
+func DefaultKnownDevicesPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "lucigo", "devices.json")
+}
+
+// LoadKnownDevices reads the devices remembered at path. A missing file
+// is no error but no devices.
+func LoadKnownDevices(path string) (*KnownDevices, error) {
+	known := &KnownDevices{Path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return known, nil
+	} else if err != nil {
+		return known, err
+	}
+	if err := json.Unmarshal(data, known); err != nil {
+		return &KnownDevices{Path: path}, err
+	}
+	return known, nil
+}
+
+// Remember records the device as just used. A device is identified by its
+// endpoint; an empty name keeps the name known.
+func (k *KnownDevices) Remember(name, endpoint string) {
+	device := KnownDevice{Name: name, Endpoint: endpoint, LastSeen: time.Now()}
+	for i, d := range k.Devices {
+		if d.Endpoint == endpoint {
+			if name == "" {
+				device.Name = d.Name
+			}
+			k.Devices = append(k.Devices[:i], k.Devices[i+1:]...)
+			break
+		}
+	}
+	k.Devices = append([]KnownDevice{device}, k.Devices...)
+	if len(k.Devices) > MaxKnownDevices {
+		k.Devices = k.Devices[:MaxKnownDevices]
+	}
+}
+
+// Save writes the devices to Path, creating its directory if missing.
+func (k *KnownDevices) Save() error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.Path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(k.Path, append(data, '\n'), 0o644)
+}
+
+// Resolve returns the endpoint of the device with the given name, that of
+// the most recently used if several share it.
+func (k *KnownDevices) Resolve(name string) (endpoint string, ok bool) {
+	for _, d := range k.Devices {
+		if d.Name == name {
+			return d.Endpoint, true
+		}
+	}
+	return "", false
+}
+
+// Complete returns the names and endpoints beginning with prefix, most
+// recently used first and without duplicates.
+func (k *KnownDevices) Complete(prefix string) []string {
+	var candidates []string
+	seen := map[string]bool{}
+	add := func(candidate string) {
+		if candidate != "" && !seen[candidate] && strings.HasPrefix(candidate, prefix) {
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+	for _, d := range k.Devices {
+		add(d.Name)
+		add(d.Endpoint)
+	}
+	return candidates
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKnownDevices(t *testing.T) {
+	path := t.TempDir() + "/lucigo/devices.json"
+	known, err := LoadKnownDevices(path)
+	if err != nil || len(known.Devices) != 0 {
+		t.Fatalf("expected no devices without file, got %+v, %v", known, err)
+	}
+	known.Remember("lab1", "tcp://192.168.1.101:5732")
+	known.Remember("lab2", "tcp://192.168.1.102:5732")
+	known.Remember("", "tcp://192.168.1.101:5732")
+	known.Remember("", "serial:///dev/ttyACM0")
+	if err := known.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	known, err = LoadKnownDevices(path)
+	if err != nil || len(known.Devices) != 3 {
+		t.Fatalf("expected 3 devices, got %+v, %v", known, err)
+	}
+	if endpoint, ok := known.Resolve("lab1"); !ok || endpoint != "tcp://192.168.1.101:5732" {
+		t.Fatalf("expected lab1 to keep its name, got %q", endpoint)
+	}
+	if got, want := known.Complete("lab"), []string{"lab1", "lab2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if got, want := known.Complete("tcp://"), []string{"tcp://192.168.1.101:5732", "tcp://192.168.1.102:5732"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the most recently used first, %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// lineBufferSize is the size of the read buffer of a LineReader. Lines up
+// to this size are returned without copying them.
+const lineBufferSize = 64 * 1024
+
+// ErrLineTooLong is the error of a line longer than LineReader.MaxLineSize.
+var ErrLineTooLong = errors.New("line too long")
+
+// LineReader reads the lines of the JSONL protocol from the device. It
+// works like a bufio.Scanner splitting lines, but has no limit on the
+// length of a line, such that run_data messages with large base64 payloads
+// stream through: Lines fitting into the read buffer are returned in place,
+// longer ones are assembled in a second buffer which grows as needed and is
+// reused for the next long line.
+//
+// Lines longer than MaxLineSize, if set, end Scan with ErrLineTooLong, as
+// a bound on the memory taken by a misbehaving device.
+//
+// A read interrupted by a deadline (os.ErrDeadlineExceeded), as set by
+// HybridController.CommandCtx, ends Scan like an error, but the next Scan
+// continues the line begun.
+type LineReader struct {
+	// MaxLineSize is the length of the longest line accepted, in bytes,
+	// without limit if zero.
+	MaxLineSize int
+
+	r       *bufio.Reader
+	line    []byte
+	long    []byte
+	err     error
+	partial bool // long holds the beginning of a line interrupted by a deadline
+}
+
+// NewLineReader creates a LineReader reading from r.
+func NewLineReader(r io.Reader) *LineReader {
+	return &LineReader{r: bufio.NewReaderSize(r, lineBufferSize)}
+}
+
+// Scan advances to the next line, which is then available through Bytes
+// or Text. It returns false at the end of the input or on an error, see Err.
+func (l *LineReader) Scan() bool {
+	if l.err != nil && !errors.Is(l.err, os.ErrDeadlineExceeded) {
+		l.line = nil
+		return false
+	}
+	l.err = nil
+	if !l.partial {
+		l.long = l.long[:0]
+	}
+	l.partial = false
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			l.long = append(l.long, chunk...)
+			if l.tooLong(l.long) {
+				return false
+			}
+			continue
+		}
+		line := chunk
+		if len(l.long) != 0 {
+			l.long = append(l.long, chunk...)
+			line = l.long
+		}
+		if l.tooLong(bytes.TrimSuffix(line, []byte("\n"))) {
+			return false
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if len(l.long) == 0 {
+				l.long = append(l.long, chunk...)
+			}
+			l.err, l.line, l.partial = err, nil, true
+			return false
+		}
+		if err != nil {
+			l.err = err
+			if err != io.EOF || len(line) == 0 {
+				l.line = nil
+				return false
+			}
+			// the last line lacks the newline
+		}
+		l.line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+		return true
+	}
+}
+
+// tooLong ends scanning with ErrLineTooLong if line exceeds MaxLineSize.
+func (l *LineReader) tooLong(line []byte) bool {
+	if l.MaxLineSize <= 0 || len(line) <= l.MaxLineSize {
+		return false
+	}
+	l.err, l.line, l.long = ErrLineTooLong, nil, nil
+	return true
+}
+
+// Bytes returns the current line without the line ending. The slice is
+// only valid until the next call to Scan.
+func (l *LineReader) Bytes() []byte {
+	return l.line
+}
+
+// Text returns the current line as string.
+func (l *LineReader) Text() string {
+	return string(l.line)
+}
+
+// Err returns the error which ended Scan, or nil at the end of the input.
+func (l *LineReader) Err() error {
+	if l.err == io.EOF {
+		return nil
+	}
+	return l.err
+}
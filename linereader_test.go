@@ -0,0 +1,106 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 3*lineBufferSize+17)
+	input := "first\r\n\n" + long + "\nlast"
+	lines := NewLineReader(iotest.OneByteReader(strings.NewReader(input)))
+	var got []string
+	for lines.Scan() {
+		got = append(got, lines.Text())
+	}
+	if err := lines.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	want := []string{"first", "", long, "last"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d lines, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("line %d: expected %d bytes, got %d", i, len(want[i]), len(got[i]))
+		}
+	}
+
+	broken := errors.New("broken")
+	lines = NewLineReader(io.MultiReader(strings.NewReader("a\n"), iotest.ErrReader(broken)))
+	if !lines.Scan() || lines.Text() != "a" || lines.Scan() || lines.Err() != broken {
+		t.Fatalf("expected a line followed by the error, got %v", lines.Err())
+	}
+}
+
+func TestLineReader_deadline(t *testing.T) {
+	lines := NewLineReader(&stepReader{steps: []string{"a\npar", "", "tial\n"}, err: os.ErrDeadlineExceeded})
+	if !lines.Scan() || lines.Text() != "a" || lines.Scan() || !errors.Is(lines.Err(), os.ErrDeadlineExceeded) {
+		t.Fatalf("expected a line followed by the deadline, got %v", lines.Err())
+	}
+	if !lines.Scan() || lines.Text() != "partial" {
+		t.Fatalf("expected the interrupted line to be continued, got %q, %v", lines.Text(), lines.Err())
+	}
+}
+
+// stepReader returns one step per Read, and err for empty ones.
+type stepReader struct {
+	steps []string
+	err   error
+}
+
+func (r *stepReader) Read(p []byte) (int, error) {
+	if len(r.steps) == 0 {
+		return 0, io.EOF
+	}
+	step := r.steps[0]
+	r.steps = r.steps[1:]
+	if step == "" {
+		return 0, r.err
+	}
+	return copy(p, step), nil
+}
+
+func TestHybridController_longLine(t *testing.T) {
+	payload := strings.Repeat("A", 1<<20)
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		fmt.Fprintf(w, `{"type":"%s","id":"%s","code":0,"msg":{"data":"%s"}}`+"\n", sent.Type, sent.Id, payload)
+	})
+	res, err := hc.Query("dump")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if res.Msg["data"] != payload {
+		t.Fatalf("expected the payload of %d bytes", len(payload))
+	}
+}
+
+func TestHybridController_MaxLineSize(t *testing.T) {
+	payload := strings.Repeat("A", 1<<20)
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		fmt.Fprintf(w, `{"type":"%s","id":"%s","code":0,"msg":{"data":"%s"}}`+"\n", sent.Type, sent.Id, payload)
+	})
+	defer hc.Close()
+	hc.MaxLineSize = 1 << 19
+	if _, err := hc.Query("dump"); !errors.Is(err, ErrLineTooLong) {
+		t.Fatalf("expected ErrLineTooLong, got %v", err)
+	}
+
+	lines := NewLineReader(strings.NewReader("short\n" + strings.Repeat("B", 100) + "\n"))
+	lines.MaxLineSize = 10
+	if !lines.Scan() || lines.Text() != "short" {
+		t.Fatalf("expected the short line, got %q, %v", lines.Text(), lines.Err())
+	}
+	if lines.Scan() || !errors.Is(lines.Err(), ErrLineTooLong) {
+		t.Fatalf("expected ErrLineTooLong within the read buffer, got %v", lines.Err())
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"log/slog"
+)
+
+// Logger is where the package logs to, such as the connections made, the
+// devices discovered and the messages nobody waited for. By default, that
+// is slog.Default(), which writes to the standard logger of the log package.
+// A HybridController logs to its own Logger, if set.
+//
+// Every record has the layer it stems from as attribute "layer", such that
+// a slog.Handler can select what to see:
+//
+//	LayerProtocol   envelopes and runs, such as unexpected answers (warnings)
+//	LayerDiscovery  mDNS and USB, such as every service found (debug)
+//	LayerEndpoint   connections, such as connecting (info)
+//	LayerWebhook    notifications posted, such as failing to (error)
+var Logger *slog.Logger
+
+// The layers of the package, as attribute "layer" of the log records.
+const (
+	LayerProtocol  = "protocol"
+	LayerDiscovery = "discovery"
+	LayerEndpoint  = "endpoint"
+	LayerWebhook   = "webhook"
+)
+
+// logger returns the logger for a layer of the package.
+func logger(layer string) *slog.Logger {
+	l := Logger
+	if l == nil {
+		l = slog.Default()
+	}
+	return l.With("layer", layer)
+}
+
+// logger returns the logger for a layer of hc, see HybridController.Logger.
+// A nil hc logs to the Logger of the package.
+func (hc *HybridController) logger(layer string) *slog.Logger {
+	if hc == nil || hc.Logger == nil {
+		return logger(layer)
+	}
+	return hc.Logger.With("layer", layer)
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHybridController_Logger(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		fmt.Fprintf(w, `{"type":"other","id":"%s","code":0,"msg":{}}`+"\n", sent.Id)
+	})
+	defer hc.Close()
+	var logged bytes.Buffer
+	hc.Logger = slog.New(slog.NewJSONHandler(&logged, nil))
+	if _, err := hc.Query("net_get"); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var record struct {
+		Level, Msg, Layer, Expected, Type string
+	}
+	if err := json.Unmarshal(logged.Bytes(), &record); err != nil {
+		t.Fatalf("expected a JSON record, got %q: %v", logged.String(), err)
+	}
+	if record.Level != "WARN" || record.Layer != LayerProtocol || record.Expected != "net_get" || record.Type != "other" {
+		t.Fatalf("expected a protocol warning about the type, got %+v", record)
+	}
+}
+
+func TestHybridController_Logger_Connect(t *testing.T) {
+	var logged bytes.Buffer
+	hc := &HybridController{Endpoint: EmulatorEndpoint{}, Logger: slog.New(slog.NewTextHandler(&logged, nil))}
+	if err := hc.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer hc.Close()
+	if !strings.Contains(logged.String(), "Connecting") {
+		t.Fatalf("expected connecting to be logged to hc.Logger, got %q", logged.String())
+	}
+}
+
+// logLines passes the records written on, as far as there is room.
+type logLines chan string
+
+func (l logLines) Write(p []byte) (int, error) {
+	select {
+	case l <- string(p):
+	default:
+	}
+	return len(p), nil
+}
+
+func TestHybridController_Logger_Call(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		fmt.Fprintf(w, `{"type":"%s","id":"%s","code":0,"msg":{}}`+"\n", sent.Type, sent.Id)
+	})
+	defer hc.Close()
+	logged := make(logLines, 1)
+	hc.Logger = slog.New(slog.NewTextHandler(logged, nil))
+	done := make(chan *Call, 1)
+	done <- nil // full
+	hc.Go(hc.NewEnvelope("net_get"), done)
+	select {
+	case record := <-logged:
+		if !strings.Contains(record, "Done channel is full") {
+			t.Fatalf("expected the answer dropped to be logged, got %q", record)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the answer dropped to be logged to hc.Logger")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"time"
+)
+
+// LoopbackEndpoint answers every envelope by itself, without any device
+// or emulator behind it. It is meant for benchmarks and for testing the
+// plumbing of a client, such as the matching of answers to commands.
+//
+// As URL, it is given as loopback:// with an optional latency, for
+// instance loopback://?latency=10ms.
+type LoopbackEndpoint struct {
+	// Latency before each answer.
+	Latency time.Duration
+
+	// Transform computes the answer to an envelope sent. By default,
+	// the answer is successful and carries the message sent.
+	Transform func(SendEnvelope) RecvEnvelope
+}
+
+func (e LoopbackEndpoint) IsValid() bool {
+	return true
+}
+
+func (e LoopbackEndpoint) ToURL() string {
+	if e.Latency != 0 {
+		return "loopback://?latency=" + e.Latency.String()
+	}
+	return "loopback://"
+}
+
+func (e LoopbackEndpoint) Open() (io.ReadWriter, error) {
+	client, server := net.Pipe()
+	go e.serve(server)
+	return client, nil
+}
+
+func (e LoopbackEndpoint) serve(conn net.Conn) {
+	defer conn.Close()
+	transform := e.Transform
+	if transform == nil {
+		transform = loopbackEcho
+	}
+	lines := NewLineReader(conn)
+	for lines.Scan() {
+		var sent SendEnvelope
+		if err := json.Unmarshal(lines.Bytes(), &sent); err != nil {
+			continue // like the firmware, ignore what cannot be understood
+		}
+		time.Sleep(e.Latency)
+		answer, err := json.Marshal(transform(sent))
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(append(answer, '\n')); err != nil {
+			return
+		}
+	}
+}
+
+// loopbackEcho answers successfully with the message sent.
+func loopbackEcho(sent SendEnvelope) RecvEnvelope {
+	msg, _ := sent.Msg.(map[string]interface{})
+	return RecvEnvelope{Type: sent.Type, Id: sent.Id, Msg: msg}
+}
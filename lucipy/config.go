@@ -0,0 +1,107 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucipy
+
+import (
+	"github.com/anabrid/lucigo"
+	"github.com/google/uuid"
+)
+
+// RunConfig is the run_config attribute of lucipy's LUCIDAC class, with
+// the keys in its order. lucipy names the halt on the external trigger
+// halt_external, where lucigo names it halt_on_external_trigger.
+type RunConfig struct {
+	HaltExternal   bool   `json:"halt_external"`
+	HaltOnOverload bool   `json:"halt_on_overload"`
+	IcTime         uint64 `json:"ic_time"`
+	OpTime         uint64 `json:"op_time"`
+}
+
+// DAQConfig is the daq_config attribute of lucipy's LUCIDAC class.
+type DAQConfig struct {
+	NumChannels int  `json:"num_channels"`
+	SampleOp    bool `json:"sample_op"`
+	SampleOpEnd bool `json:"sample_op_end"`
+	SampleRate  int  `json:"sample_rate"`
+}
+
+// FromRunConfig converts a lucigo run configuration. lucipy knows no
+// arming on the external trigger nor repetitions, they are dropped.
+func FromRunConfig(c lucigo.RunConfig) RunConfig {
+	return RunConfig{
+		HaltExternal:   c.HaltOnExternalTrigger,
+		HaltOnOverload: c.HaltOnOverload,
+		IcTime:         c.IcTime,
+		OpTime:         c.OpTime,
+	}
+}
+
+// RunConfig converts to the lucigo run configuration.
+func (c RunConfig) RunConfig() lucigo.RunConfig {
+	return lucigo.RunConfig{
+		IcTime:                c.IcTime,
+		OpTime:                c.OpTime,
+		HaltOnExternalTrigger: c.HaltExternal,
+		HaltOnOverload:        c.HaltOnOverload,
+	}
+}
+
+// FromDAQConfig converts a lucigo DAQ configuration. Channel names are
+// not known to lucipy and dropped.
+func FromDAQConfig(c lucigo.DAQConfig) DAQConfig {
+	return DAQConfig{
+		NumChannels: c.NumChannels,
+		SampleOp:    c.SampleOp,
+		SampleOpEnd: c.SampleOpEnd,
+		SampleRate:  c.SampleRate,
+	}
+}
+
+// DAQConfig converts to the lucigo DAQ configuration.
+func (c DAQConfig) DAQConfig() lucigo.DAQConfig {
+	return lucigo.DAQConfig{
+		NumChannels: c.NumChannels,
+		SampleOp:    c.SampleOp,
+		SampleOpEnd: c.SampleOpEnd,
+		SampleRate:  c.SampleRate,
+	}
+}
+
+// StartRun is the message of the start_run command as lucipy sends it.
+type StartRun struct {
+	Id        uuid.UUID `json:"id"`
+	Session   *string   `json:"session"`
+	Config    RunConfig `json:"config"`
+	DAQConfig DAQConfig `json:"daq_config"`
+}
+
+// Envelope is an envelope sent by lucipy, which puts the id first.
+type Envelope struct {
+	Id   uuid.UUID   `json:"id"`
+	Type string      `json:"type"`
+	Msg  interface{} `json:"msg,omitempty"`
+}
+
+// FromEnvelope converts an envelope sent by lucigo.
+func FromEnvelope(e lucigo.SendEnvelope) Envelope {
+	return Envelope{Id: e.Id, Type: e.Type, Msg: e.Msg}
+}
+
+// Envelope converts to the envelope lucigo sends.
+func (e Envelope) Envelope() lucigo.SendEnvelope {
+	return lucigo.SendEnvelope{Type: e.Type, Id: e.Id, Msg: e.Msg}
+}
+
+// NewStartRun creates the start_run envelope lucipy would send for the
+// configurations, with the ids of envelope and run from hc.
+func NewStartRun(hc *lucigo.HybridController, config lucigo.RunConfig, daq lucigo.DAQConfig) Envelope {
+	env := FromEnvelope(hc.NewEnvelope("start_run"))
+	env.Msg = StartRun{
+		Id:        hc.NewEnvelope("").Id,
+		Config:    FromRunConfig(config),
+		DAQConfig: FromDAQConfig(daq),
+	}
+	return env
+}
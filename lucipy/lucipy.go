@@ -0,0 +1,167 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+/*
+Package lucipy converts artifacts between lucigo and lucipy, the Python
+client of the LUCIDAC, such that teams using both can interchange them.
+
+lucipy writes JSON with Python's json.dumps, which differs from Go's
+encoding/json in separators, escaping, the notation of floats and by
+keeping the order of object keys. [Marshal] writes the Python notation,
+[Object] keeps the key order of documents read, so a settings document
+written by lucipy is written back byte for byte:
+
+	doc, err := lucipy.ReadObject(f)
+	doc.Set("dhcp_enabled", false)
+	out, err := lucipy.Marshal(doc)
+
+The test vectors in testdata are written as lucipy writes them; see
+testdata/README.md for regenerating them with lucipy itself.
+*/
+package lucipy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Marshal encodes v as Python's json.dumps(v) does with default arguments.
+// Struct fields come in their order and [Object] keys in theirs, while
+// the keys of Go maps are sorted, as with encoding/json.
+//
+// Python distinguishes int and float, Go does not: Numbers without
+// fraction are written as int, which is what lucipy uses for all integral
+// quantities (times, counts, rates).
+func Marshal(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var out bytes.Buffer
+	if err := reformat(dec, &out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// reformat rewrites the next JSON value of dec in Python notation.
+func reformat(dec *json.Decoder, out *bytes.Buffer) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		out.WriteRune(rune(t))
+		closing := json.Delim('}')
+		if t == '[' {
+			closing = ']'
+		}
+		for i := 0; dec.More(); i++ {
+			if i != 0 {
+				out.WriteString(", ")
+			}
+			if t == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				writeString(out, key.(string))
+				out.WriteString(": ")
+			}
+			if err := reformat(dec, out); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		out.WriteRune(rune(closing))
+	case string:
+		writeString(out, t)
+	case json.Number:
+		return writeNumber(out, t)
+	case bool:
+		out.WriteString(strconv.FormatBool(t))
+	case nil:
+		out.WriteString("null")
+	}
+	return nil
+}
+
+// writeString writes s escaped as with ensure_ascii=True.
+func writeString(out *bytes.Buffer, s string) {
+	out.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			out.WriteString(`\"`)
+		case r == '\\':
+			out.WriteString(`\\`)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r == '\b':
+			out.WriteString(`\b`)
+		case r == '\f':
+			out.WriteString(`\f`)
+		case r < 0x20 || (r >= 0x7f && r < 0x10000):
+			fmt.Fprintf(out, `\u%04x`, r)
+		case r >= 0x10000:
+			r1, r2 := utf16.EncodeRune(r)
+			fmt.Fprintf(out, `\u%04x\u%04x`, r1, r2)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	out.WriteByte('"')
+}
+
+// writeNumber writes integers as they are and floats as Python's repr does.
+func writeNumber(out *bytes.Buffer, n json.Number) error {
+	if !strings.ContainsAny(string(n), ".eE") {
+		out.WriteString(string(n))
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return err
+	}
+	out.WriteString(FormatFloat(f))
+	return nil
+}
+
+// FormatFloat formats f as Python's repr(float) does: The shortest
+// representation, in scientific notation for exponents below -4 or from
+// 16 on, and with ".0" for integral values.
+func FormatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	sci := strconv.FormatFloat(f, 'e', -1, 64)
+	exp, _ := strconv.Atoi(sci[strings.IndexByte(sci, 'e')+1:])
+	if exp < -4 || exp >= 16 {
+		return sci
+	}
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucipy
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anabrid/lucigo"
+)
+
+// vector reads a test vector without its trailing newline.
+func vector(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return bytes.TrimSuffix(data, []byte("\n"))
+}
+
+func TestFormatFloat(t *testing.T) {
+	for f, want := range map[float64]string{
+		1:            "1.0",
+		-0.5:         "-0.5",
+		0.0001:       "0.0001",
+		1e-05:        "1e-05",
+		1.5e-07:      "1.5e-07",
+		123456789.25: "123456789.25",
+		1e15:         "1000000000000000.0",
+		1e16:         "1e+16",
+		math.Inf(-1): "-Infinity",
+	} {
+		if got := FormatFloat(f); got != want {
+			t.Fatalf("FormatFloat(%v) = %s, expected %s", f, got, want)
+		}
+	}
+}
+
+func TestVectors_roundtrip(t *testing.T) {
+	for _, name := range []string{"run_config.json", "daq_config.json", "start_run.json", "settings.json", "strings.json"} {
+		want := vector(t, name)
+		doc, err := ReadObject(bytes.NewReader(want))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := Marshal(doc)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: expected\n%s\ngot\n%s", name, want, got)
+		}
+	}
+}
+
+func TestObject_Set(t *testing.T) {
+	doc, err := ReadObject(bytes.NewReader(vector(t, "settings.json")))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	doc.Set("dhcp_enabled", false)
+	doc.Set("comment", "set by lucigo")
+	got, err := Marshal(doc)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	want := bytes.Replace(vector(t, "settings.json"), []byte(`"dhcp_enabled": true`), []byte(`"dhcp_enabled": false`), 1)
+	want = append(want[:len(want)-1], []byte(`, "comment": "set by lucigo"}`)...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("expected\n%s\ngot\n%s", want, got)
+	}
+	if port, _ := doc.Map()["jsonl_port"].(float64); port != 5732 {
+		t.Fatalf("expected jsonl_port 5732 in the map, got %v", doc.Map()["jsonl_port"])
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	var config RunConfig
+	if err := json.Unmarshal(vector(t, "run_config.json"), &config); err != nil {
+		t.Fatalf("%v", err)
+	}
+	want := lucigo.RunConfig{IcTime: 100000, OpTime: 500000, HaltOnOverload: true}
+	if got := config.RunConfig(); got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	got, err := Marshal(FromRunConfig(want))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !bytes.Equal(got, vector(t, "run_config.json")) {
+		t.Fatalf("unexpected run config %s", got)
+	}
+}
+
+func TestNewStartRun(t *testing.T) {
+	hc := &lucigo.HybridController{IDs: lucigo.SequentialIDs()}
+	config := lucigo.RunConfig{IcTime: 100000, OpTime: 500000, HaltOnOverload: true, Repetitions: 3}
+	daq := lucigo.DAQConfig{NumChannels: 2, SampleOp: true, SampleOpEnd: true, SampleRate: 500000, ChannelNames: []string{"x", "y"}}
+	got, err := Marshal(NewStartRun(hc, config, daq))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if want := vector(t, "start_run.json"); !bytes.Equal(got, want) {
+		t.Fatalf("expected\n%s\ngot\n%s", want, got)
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(got, &env); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if sent := env.Envelope(); sent.Type != "start_run" || sent.Id.String() != "00000000-0000-0000-0000-000000000001" {
+		t.Fatalf("unexpected envelope %+v", sent)
+	}
+}
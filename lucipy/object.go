@@ -0,0 +1,147 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucipy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Object is a JSON object keeping the order of its keys, as Python's dict
+// does. Nested objects are Objects as well, numbers are json.Number with
+// their literal notation, so that reading and marshalling a document
+// reproduces it.
+type Object []Member
+
+// Member is a key and its value within an Object.
+type Member struct {
+	Key   string
+	Value interface{}
+}
+
+// ReadObject reads a JSON object, such as a settings document.
+func ReadObject(r io.Reader) (Object, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	v, err := decodeValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := v.(Object)
+	if !ok {
+		return nil, fmt.Errorf("expected a JSON object, got %T", v)
+	}
+	return obj, nil
+}
+
+func decodeValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := Object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, Member{key.(string), value})
+		}
+		_, err = dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = dec.Token()
+		return list, err
+	}
+	return tok, nil
+}
+
+// Get returns the value of key.
+func (o Object) Get(key string) (interface{}, bool) {
+	for _, m := range o {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set replaces the value of key, or appends it as Python does.
+func (o *Object) Set(key string, value interface{}) {
+	for i, m := range *o {
+		if m.Key == key {
+			(*o)[i].Value = value
+			return
+		}
+	}
+	*o = append(*o, Member{key, value})
+}
+
+// MarshalJSON writes the members in their order.
+func (o Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(m.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Map converts the object to the maps lucigo uses for messages, such as
+// for [lucigo.HybridController.QueryMsg].
+func (o Object) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(o))
+	for _, member := range o {
+		m[member.Key] = plain(member.Value)
+	}
+	return m
+}
+
+func plain(v interface{}) interface{} {
+	switch t := v.(type) {
+	case Object:
+		return t.Map()
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, e := range t {
+			list[i] = plain(e)
+		}
+		return list
+	case json.Number:
+		f, _ := t.Float64()
+		return f
+	}
+	return v
+}
@@ -0,0 +1,47 @@
+#!/usr/bin/env python3
+# Regenerates the test vectors as lucipy writes them. Run it from this
+# directory with lucipy installed and compare with git diff.
+
+import json, uuid
+
+from lucipy import LUCIDAC
+
+def write(name, obj):
+    with open(name, "w") as f:
+        f.write(json.dumps(obj) + "\n")
+
+# the attributes lucipy sends with start_run, without connecting
+hc = LUCIDAC.__new__(LUCIDAC)
+hc.run_config = dict(halt_external=False, halt_on_overload=True, ic_time=100000, op_time=500000)
+hc.daq_config = dict(num_channels=2, sample_op=True, sample_op_end=True, sample_rate=500000)
+write("run_config.json", hc.run_config)
+write("daq_config.json", hc.daq_config)
+
+envelope = dict(id=str(uuid.UUID(int=1)), type="start_run")
+envelope["msg"] = dict(id=str(uuid.UUID(int=2)), session=None, config=hc.run_config, daq_config=hc.daq_config)
+write("start_run.json", envelope)
+
+write("settings.json", {
+    "ethernet": {"mac": "04-E9-E5-14-74-BF"},
+    "dhcp_enabled": True,
+    "static_ipaddr": "192.168.1.100",
+    "static_netmask": "255.255.255.0",
+    "static_gw": "192.168.1.1",
+    "hostname": "lucidac-caf\u00e9",
+    "webserver_port": 80,
+    "jsonl_port": 5732,
+    "calibration": {"offset": -0.00012, "gain": 1.0, "scale": 1e-05, "range": [-1.0, 1.0]},
+})
+
+write("strings.json", {
+    "quote": 'say "hi"',
+    "backslash": "C:\\lucidac",
+    "newline": "a\nb",
+    "tab": "a\tb",
+    "control": "\x01",
+    "del": "\x7f",
+    "html": '<a href="x">&amp;</a>',
+    "umlaut": "\u00fc",
+    "emoji": "\U0001F600",
+    "slash": "/",
+})
@@ -0,0 +1,177 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucitest
+
+import (
+	"bufio"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/anabrid/lucigo"
+)
+
+// Chaos wraps an endpoint and injects faults into its traffic, for
+// hardening clients against unreliable connections and for reproducing
+// bug reports from the field. The zero values of the fields inject nothing.
+//
+//	chaos := &lucitest.Chaos{Endpoint: endpoint, Latency: 50 * time.Millisecond, DropRate: 0.01, Seed: 42}
+//	hc, err := lucigo.NewHybridController(chaos)
+type Chaos struct {
+	Endpoint lucigo.Endpoint
+
+	Latency time.Duration // before passing on each line received
+	Jitter  time.Duration // random additional latency, up to this
+
+	// DropRate is the probability of losing a line received.
+	DropRate float64
+
+	// ChunkSize splits the traffic in both directions into partial
+	// reads and writes of at most this many bytes.
+	ChunkSize int
+
+	// EchoRate is the probability of a line sent being echoed back, as
+	// happens on serial connections. With ReorderEchoes, the echo arrives
+	// after the next line received instead of right away.
+	EchoRate      float64
+	ReorderEchoes bool
+
+	// DisconnectAfter hangs up after passing on this many lines received.
+	DisconnectAfter int
+
+	// Seed makes the random faults reproducible.
+	Seed int64
+}
+
+func (c *Chaos) IsValid() bool {
+	return c.Endpoint != nil && c.Endpoint.IsValid()
+}
+
+func (c *Chaos) ToURL() string {
+	return c.Endpoint.ToURL()
+}
+
+func (c *Chaos) Open() (io.ReadWriter, error) {
+	inner, err := c.Endpoint.Open()
+	if err != nil {
+		return nil, err
+	}
+	client, server := net.Pipe()
+	conn := &chaosConn{Chaos: c, inner: inner, client: server, rand: rand.New(rand.NewSource(c.Seed))}
+	go conn.receive()
+	go conn.send()
+	return client, nil
+}
+
+type chaosConn struct {
+	*Chaos
+	inner  io.ReadWriter
+	client net.Conn // our end of the pipe to the client
+
+	mu      sync.Mutex // of the following and of writes to client
+	rand    *rand.Rand
+	pending [][]byte // reordered echoes
+}
+
+func (c *chaosConn) chance(p float64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return p > 0 && c.rand.Float64() < p
+}
+
+// receive passes lines from the device on to the client.
+func (c *chaosConn) receive() {
+	defer c.hangUp()
+	lines := bufio.NewReader(c.inner)
+	for received := 0; ; {
+		line, err := lines.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		if c.chance(c.DropRate) {
+			continue
+		}
+		delay := c.Latency
+		if c.Jitter > 0 {
+			c.mu.Lock()
+			delay += time.Duration(c.rand.Int63n(int64(c.Jitter)))
+			c.mu.Unlock()
+		}
+		time.Sleep(delay)
+
+		c.mu.Lock()
+		err = c.write(line)
+		for _, echo := range c.pending {
+			if err == nil {
+				err = c.write(echo)
+			}
+		}
+		c.pending = nil
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+
+		received++
+		if c.DisconnectAfter > 0 && received >= c.DisconnectAfter {
+			return
+		}
+	}
+}
+
+// send passes the lines of the client on to the device.
+func (c *chaosConn) send() {
+	defer c.hangUp()
+	lines := bufio.NewReader(c.client)
+	for {
+		line, err := lines.ReadBytes('\n')
+		if len(line) != 0 {
+			if werr := c.chunked(c.inner, line); werr != nil {
+				return
+			}
+			if c.chance(c.EchoRate) {
+				c.mu.Lock()
+				if c.ReorderEchoes {
+					c.pending = append(c.pending, line)
+				} else if c.write(line) != nil {
+					err = io.ErrClosedPipe
+				}
+				c.mu.Unlock()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// write passes data on to the client, the caller holds mu.
+func (c *chaosConn) write(data []byte) error {
+	return c.chunked(c.client, data)
+}
+
+func (c *chaosConn) chunked(w io.Writer, data []byte) error {
+	size := c.ChunkSize
+	if size <= 0 {
+		size = len(data)
+	}
+	for len(data) > 0 {
+		n := min(size, len(data))
+		if _, err := w.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func (c *chaosConn) hangUp() {
+	c.client.Close()
+	if closer, ok := c.inner.(io.Closer); ok {
+		closer.Close()
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucitest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anabrid/lucigo"
+)
+
+func TestChaos(t *testing.T) {
+	dev := NewDevice()
+	chaos := &Chaos{Endpoint: dev.Endpoint(), Latency: time.Millisecond, Jitter: time.Millisecond, ChunkSize: 3, EchoRate: 1}
+	hc, err := lucigo.NewHybridController(chaos)
+	if err != nil {
+		t.Fatalf("NewHybridController: %v", err)
+	}
+	for _, query := range []string{"sys_ident", "net_get", "sys_ident"} {
+		res, err := hc.Query(query)
+		if err != nil || res.Type != query || !res.IsSuccess() {
+			t.Fatalf("%s despite echoes and partial reads: %+v, %v", query, res, err)
+		}
+	}
+}
+
+func TestChaos_disconnect(t *testing.T) {
+	dev := NewDevice()
+	dev.Handle("start_run", ServeRun([][]float64{{1}}, [][]float64{{2}}, [][]float64{{3}}))
+	hc, err := lucigo.NewHybridController(&Chaos{Endpoint: dev.Endpoint(), DisconnectAfter: 2})
+	if err != nil {
+		t.Fatalf("NewHybridController: %v", err)
+	}
+	run, err := hc.StartRun(lucigo.RunConfig{OpTime: 1000}, lucigo.DAQConfig{NumChannels: 1})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	samples := 0
+	for frame := range run.Data() {
+		samples += len(frame.Samples)
+	}
+	if samples != 1 || run.Err() == nil {
+		t.Fatalf("expected the run to break off after 1 sample, got %d samples and error %v", samples, run.Err())
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucitest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/anabrid/lucigo"
+)
+
+// ConformanceCheck is a check of the protocol behavior of a device.
+type ConformanceCheck struct {
+	Name        string
+	Description string
+	Check       func(hc *lucigo.HybridController) error
+}
+
+// ConformanceChecks is the battery of protocol checks run by
+// [RunConformance], as qualification of firmware releases. The checks only
+// change the state of the device temporarily: Settings are written back
+// unchanged and runs are short.
+var ConformanceChecks = []ConformanceCheck{
+	{"envelope", "Answers carry the type and id of the request", checkEnvelope},
+	{"unknown_type", "Unknown request types are answered with an error code and message", checkUnknownType},
+	{"sys_ident", "sys_ident answers with the firmware identity", checkSysIdent},
+	{"settings_roundtrip", "Settings written back unchanged with net_set read the same with net_get", checkSettingsRoundtrip},
+	{"run_lifecycle", "A short run passes through its states up to DONE and delivers data", checkRunLifecycle},
+}
+
+// ConformanceResult is the outcome of a single ConformanceCheck.
+type ConformanceResult struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Duration    time.Duration `json:"duration_ns"`
+	Failure     string        `json:"failure,omitempty"`
+}
+
+// Passed tells whether the check succeeded.
+func (r ConformanceResult) Passed() bool {
+	return r.Failure == ""
+}
+
+// RunConformance runs all ConformanceChecks against the device.
+func RunConformance(hc *lucigo.HybridController) []ConformanceResult {
+	results := make([]ConformanceResult, len(ConformanceChecks))
+	for i, check := range ConformanceChecks {
+		start := time.Now()
+		err := check.Check(hc)
+		results[i] = ConformanceResult{Name: check.Name, Description: check.Description, Duration: time.Since(start)}
+		if err != nil {
+			results[i].Failure = err.Error()
+		}
+	}
+	return results
+}
+
+// WriteJSON writes the results as indented JSON.
+func WriteJSON(w io.Writer, results []ConformanceResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     float64     `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes the results as JUnit XML report, as understood by
+// most CI systems.
+func WriteJUnit(w io.Writer, results []ConformanceResult) error {
+	suite := junitSuite{Name: "lucidac-conformance", Tests: len(results)}
+	for _, r := range results {
+		c := junitCase{Name: r.Name, ClassName: "conformance", Time: r.Duration.Seconds()}
+		if !r.Passed() {
+			suite.Failures++
+			c.Failure = &junitFailure{Message: r.Failure}
+		}
+		suite.Time += c.Time
+		suite.Cases = append(suite.Cases, c)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func checkEnvelope(hc *lucigo.HybridController) error {
+	sent := hc.NewEnvelope("sys_ident")
+	res, err := hc.Command(sent)
+	if err != nil {
+		return err
+	}
+	if res.Type != sent.Type {
+		return fmt.Errorf("expected type %s, got %q", sent.Type, res.Type)
+	}
+	if res.Id != sent.Id {
+		return fmt.Errorf("expected id %s, got %s", sent.Id, res.Id)
+	}
+	return nil
+}
+
+func checkUnknownType(hc *lucigo.HybridController) error {
+	res, err := hc.Command(hc.NewEnvelope("lucigo_conformance_no_such_type"))
+	if err != nil {
+		return err
+	}
+	if res.IsSuccess() {
+		return fmt.Errorf("expected an error code, got success")
+	}
+	if res.Error == "" {
+		return fmt.Errorf("expected an error message for code %d", res.Code)
+	}
+	return nil
+}
+
+func checkSysIdent(hc *lucigo.HybridController) error {
+	res, err := hc.QueryMsg("sys_ident", nil)
+	if err != nil {
+		return err
+	}
+	if len(res.Msg) == 0 {
+		return fmt.Errorf("expected the identity, got an empty message")
+	}
+	return nil
+}
+
+func checkSettingsRoundtrip(hc *lucigo.HybridController) error {
+	before, err := hc.QueryMsg("net_get", nil)
+	if err != nil {
+		return err
+	}
+	if _, err := hc.QueryMsg("net_set", before.Msg); err != nil {
+		return err
+	}
+	after, err := hc.QueryMsg("net_get", nil)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(before.Msg, after.Msg) {
+		return fmt.Errorf("settings changed from %v to %v", before.Msg, after.Msg)
+	}
+	return nil
+}
+
+func checkRunLifecycle(hc *lucigo.HybridController) error {
+	run, err := hc.StartRun(
+		lucigo.RunConfig{IcTime: 100000, OpTime: 1000000},
+		lucigo.DAQConfig{NumChannels: 1, SampleOp: true, SampleRate: 10000})
+	if err != nil {
+		return err
+	}
+	rec := &lucigo.Recording{}
+	if err := run.Capture(rec); err != nil {
+		return err
+	}
+	if run.State() != lucigo.RunStateDone {
+		return fmt.Errorf("expected the run to end in state %s, got %s", lucigo.RunStateDone, run.State())
+	}
+	if len(rec.Samples) == 0 {
+		return fmt.Errorf("expected data, got none")
+	}
+	if integrity := run.Integrity(); !integrity.OK() {
+		return fmt.Errorf("data is not intact: %+v", integrity)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucitest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunConformance(t *testing.T) {
+	dev := NewDevice()
+	settings := map[string]interface{}{"ipv4": map[string]interface{}{"dhcp_enabled": true}}
+	dev.Handle("net_get", func(req *Request) { req.Reply(settings) })
+	dev.Handle("net_set", func(req *Request) {
+		settings = req.MsgMap()
+		req.Reply(map[string]interface{}{})
+	})
+	dev.Handle("start_run", ServeRun([][]float64{{1}, {2}}))
+	hc, err := dev.Controller()
+	if err != nil {
+		t.Fatalf("Controller: %v", err)
+	}
+
+	results := RunConformance(hc)
+	for _, r := range results {
+		if !r.Passed() {
+			t.Fatalf("check %s failed: %s", r.Name, r.Failure)
+		}
+	}
+
+	// without runs and settings
+	hc, _ = NewDevice().Controller()
+	results = RunConformance(hc)
+	var report bytes.Buffer
+	if err := WriteJUnit(&report, results); err != nil {
+		t.Fatalf("WriteJUnit: %v", err)
+	}
+	if !strings.Contains(report.String(), `tests="5" failures="2"`) || !strings.Contains(report.String(), "Unknown message type") {
+		t.Fatalf("unexpected report:\n%s", report.String())
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucitest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/anabrid/lucigo"
+)
+
+// Firmware is the firmware update facility of a fake Device, taking
+// uploads as lucigo.FirmwareUpload sends them:
+//
+//	fw := &lucitest.Firmware{}
+//	fw.Install(dev)
+//	err := (&lucigo.FirmwareUpload{Image: image}).Run(ctx, hc)
+//	fw.Installed() // the image
+//
+// Like a device, it keeps what it received of an interrupted upload until
+// an upload of another image begins.
+type Firmware struct {
+	Window int // chunks the device claims to buffer, 16 if not set
+
+	mu        sync.Mutex
+	size      int
+	digest    string
+	data      []byte // received in a row
+	installed []byte
+}
+
+// Install registers the handlers of ota_begin, ota_chunk and ota_commit
+// on the device.
+func (f *Firmware) Install(d *Device) {
+	d.Handle("ota_begin", f.begin)
+	d.Handle("ota_chunk", f.chunk)
+	d.Handle("ota_commit", f.commit)
+}
+
+// Received returns the number of bytes of the current upload received.
+func (f *Firmware) Received() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.data)
+}
+
+// Installed returns the image of the last upload committed, nil if none.
+func (f *Firmware) Installed() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.installed
+}
+
+func (f *Firmware) begin(req *Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg := req.MsgMap()
+	size, _ := msg["size"].(float64)
+	digest, _ := msg["sha256"].(string)
+	if digest == "" {
+		req.Fail(-1, "missing sha256")
+		return
+	}
+	if digest != f.digest || int(size) != f.size {
+		f.size, f.digest, f.data = int(size), digest, nil
+	}
+	window := f.Window
+	if window <= 0 {
+		window = 16
+	}
+	req.Reply(map[string]interface{}{"offset": len(f.data), "window": window})
+}
+
+func (f *Firmware) chunk(req *Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg := req.MsgMap()
+	offset, _ := msg["offset"].(float64)
+	encoded, _ := msg["data"].(string)
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	switch {
+	case f.digest == "":
+		req.Fail(-1, "no upload begun")
+	case err != nil:
+		f.fail(req, fmt.Sprintf("invalid data: %v", err))
+	case int(offset) != len(f.data):
+		f.fail(req, fmt.Sprintf("expected offset %d, got %d", len(f.data), int(offset)))
+	case len(f.data)+len(data) > f.size:
+		f.fail(req, "chunk exceeds the image")
+	default:
+		f.data = append(f.data, data...)
+		req.Reply(map[string]interface{}{"received": len(f.data)})
+	}
+}
+
+// fail answers a chunk with an error telling what was received so far.
+func (f *Firmware) fail(req *Request, message string) {
+	req.write(lucigo.RecvEnvelope{Type: req.Type, Id: req.Id, Code: -2, Error: message, Msg: map[string]interface{}{"received": len(f.data)}})
+}
+
+func (f *Firmware) commit(req *Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sum := sha256.Sum256(f.data)
+	digest, _ := req.MsgMap()["sha256"].(string)
+	switch {
+	case f.digest == "" || digest != f.digest:
+		req.Fail(-1, "no upload of this image begun")
+	case len(f.data) != f.size || hex.EncodeToString(sum[:]) != f.digest:
+		req.Fail(-2, fmt.Sprintf("image incomplete or corrupt, %d of %d bytes", len(f.data), f.size))
+	default:
+		f.installed = f.data
+		f.size, f.digest, f.data = 0, "", nil
+		req.Reply(map[string]interface{}{})
+	}
+}
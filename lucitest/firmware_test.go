@@ -0,0 +1,77 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucitest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/anabrid/lucigo"
+)
+
+func TestFirmware(t *testing.T) {
+	image := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(image)
+	dev := NewDevice()
+	fw := &Firmware{Window: 4}
+	fw.Install(dev)
+	dev.FailNext("ota_chunk", -3, "flash busy")
+
+	// with echoes of all lines, as on the serial console
+	hc, err := lucigo.NewHybridController(&Chaos{Endpoint: dev.Endpoint(), Latency: time.Millisecond, ChunkSize: 100, EchoRate: 1})
+	if err != nil {
+		t.Fatalf("NewHybridController: %v", err)
+	}
+	upload := &lucigo.FirmwareUpload{Image: image, ChunkSize: 1000}
+	if err := upload.Run(context.Background(), hc); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !bytes.Equal(fw.Installed(), image) {
+		t.Fatalf("expected the image to be installed, got %d bytes", len(fw.Installed()))
+	}
+	if res, err := hc.Query("sys_ident"); err != nil || res.Type != "sys_ident" {
+		t.Fatalf("expected the connection to be usable after the upload, got %+v, %v", res, err)
+	}
+}
+
+func TestFirmware_resume(t *testing.T) {
+	image := bytes.Repeat([]byte("lucidac"), 10000)
+	dev := NewDevice()
+	fw := &Firmware{}
+	fw.Install(dev)
+
+	hc, _ := dev.Controller()
+	ctx, cancel := context.WithCancel(context.Background())
+	upload := &lucigo.FirmwareUpload{Image: image, ChunkSize: 1024, Progress: func(received, total int) {
+		if received > total/2 {
+			cancel()
+		}
+	}}
+	if err := upload.Run(ctx, hc); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the upload to be cancelled, got %v", err)
+	}
+	interrupted := fw.Received()
+	if interrupted <= len(image)/2 || interrupted == len(image) || fw.Installed() != nil {
+		t.Fatalf("expected the upload to stop halfway, got %d bytes", interrupted)
+	}
+
+	hc, _ = dev.Controller()
+	var resumed int
+	upload.Progress = func(received, total int) {
+		if resumed == 0 {
+			resumed = received
+		}
+	}
+	if err := upload.Run(context.Background(), hc); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if resumed != interrupted || !bytes.Equal(fw.Installed(), image) {
+		t.Fatalf("expected the upload to resume at %d, got %d", interrupted, resumed)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+/*
+Package lucitest provides an in-process fake LUCIDAC for testing code which
+uses lucigo, without any hardware at hand.
+
+	dev := lucitest.NewDevice()
+	dev.Respond("net_get", map[string]interface{}{"dhcp": true})
+	dev.FailNext("net_set", -2, "not permitted")
+
+	hc, err := lucigo.NewHybridController(dev.Endpoint())
+	...
+	if len(dev.Requests()) != 2 { ... }
+
+The device answers every request with the handler registered for its type.
+Types without handler are answered with an error, as the firmware does.
+*/
+package lucitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/anabrid/lucigo"
+)
+
+// Handler answers a request to the fake device.
+type Handler func(req *Request)
+
+// Device is a programmable fake LUCIDAC. It is safe for concurrent use and
+// may serve any number of connections at a time.
+type Device struct {
+	mu       sync.Mutex
+	handlers map[string]Handler
+	failures map[string][]failure // scripted, by type
+	requests []lucigo.SendEnvelope
+	conns    map[net.Conn]bool
+}
+
+type failure struct {
+	code    int
+	message string
+}
+
+// DefaultIdent is the answer of a new Device to sys_ident.
+var DefaultIdent = map[string]interface{}{
+	"fw_name":  "LUCIDAC",
+	"fw_build": "lucitest",
+	"mac":      "00-00-00-00-00-00",
+}
+
+// NewDevice creates a device answering sys_ident, net_status, net_get and
+// get_config with believable canned responses.
+func NewDevice() *Device {
+	d := &Device{
+		handlers: make(map[string]Handler),
+		failures: make(map[string][]failure),
+		conns:    make(map[net.Conn]bool),
+	}
+	d.Respond("sys_ident", DefaultIdent)
+	d.Respond("net_status", map[string]interface{}{"has_ethernet": true, "link": true})
+	d.Respond("net_get", map[string]interface{}{"dhcp": true, "hostname": "lucitest"})
+	d.Respond("get_config", map[string]interface{}{"entity": []string{}, "config": map[string]interface{}{}})
+	return d
+}
+
+// Handle registers the handler for requests of the given type, replacing
+// any previous one. A nil handler removes the registration.
+func (d *Device) Handle(Type string, handler Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if handler == nil {
+		delete(d.handlers, Type)
+		return
+	}
+	d.handlers[Type] = handler
+}
+
+// Respond answers all requests of the given type successfully with msg.
+func (d *Device) Respond(Type string, msg map[string]interface{}) {
+	d.Handle(Type, func(req *Request) { req.Reply(msg) })
+}
+
+// FailNext lets the next request of the given type fail with the error code
+// and message, regardless of its handler. Calling it several times fails
+// as many requests in turn.
+func (d *Device) FailNext(Type string, code int, message string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failures[Type] = append(d.failures[Type], failure{code, message})
+}
+
+// Requests returns all requests received so far, in order.
+func (d *Device) Requests() []lucigo.SendEnvelope {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]lucigo.SendEnvelope(nil), d.requests...)
+}
+
+// Disconnect drops all connections, as a crashing device or a broken
+// network would.
+func (d *Device) Disconnect() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for conn := range d.conns {
+		conn.Close()
+	}
+}
+
+// Endpoint returns an endpoint connecting to the device.
+func (d *Device) Endpoint() lucigo.Endpoint {
+	return Endpoint{d}
+}
+
+// Controller connects a HybridController to the device.
+func (d *Device) Controller() (*lucigo.HybridController, error) {
+	return lucigo.NewHybridController(d.Endpoint())
+}
+
+// Endpoint connects to a fake Device, see [Device.Endpoint].
+type Endpoint struct {
+	Device *Device
+}
+
+func (e Endpoint) IsValid() bool {
+	return e.Device != nil
+}
+
+func (e Endpoint) ToURL() string {
+	return "lucitest://"
+}
+
+func (e Endpoint) Open() (io.ReadWriter, error) {
+	if !e.IsValid() {
+		return nil, fmt.Errorf("Invalid lucitest Endpoint (no device)")
+	}
+	client, server := net.Pipe()
+	e.Device.mu.Lock()
+	e.Device.conns[server] = true
+	e.Device.mu.Unlock()
+	go e.Device.serve(server)
+	return client, nil
+}
+
+// Serve accepts connections on the listener and serves each, such that
+// the device can be reached over TCP like a real one. It returns once the
+// listener is closed.
+func (d *Device) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		d.mu.Lock()
+		d.conns[conn] = true
+		d.mu.Unlock()
+		go d.serve(conn)
+	}
+}
+
+func (d *Device) serve(conn net.Conn) {
+	defer func() {
+		d.mu.Lock()
+		delete(d.conns, conn)
+		d.mu.Unlock()
+		conn.Close()
+	}()
+	lines := lucigo.NewLineReader(conn)
+	for lines.Scan() {
+		var envelope lucigo.SendEnvelope
+		if err := json.Unmarshal(lines.Bytes(), &envelope); err != nil {
+			continue // the firmware ignores garbage, too
+		}
+		req := &Request{SendEnvelope: envelope, conn: conn}
+
+		d.mu.Lock()
+		d.requests = append(d.requests, envelope)
+		handler := d.handlers[envelope.Type]
+		var fail *failure
+		if queued := d.failures[envelope.Type]; len(queued) != 0 {
+			fail, d.failures[envelope.Type] = &queued[0], queued[1:]
+		}
+		d.mu.Unlock()
+
+		switch {
+		case fail != nil:
+			req.Fail(fail.code, fail.message)
+		case handler != nil:
+			handler(req)
+		default:
+			req.Fail(-1, fmt.Sprintf("Unknown message type '%s'", envelope.Type))
+		}
+	}
+}
+
+// Request is a request received by the fake device, together with the
+// means to answer it.
+type Request struct {
+	lucigo.SendEnvelope
+	conn net.Conn
+}
+
+// MsgMap returns the message of the request as map, as sent by lucigo.
+func (req *Request) MsgMap() map[string]interface{} {
+	msg, _ := req.Msg.(map[string]interface{})
+	return msg
+}
+
+// Reply answers the request successfully.
+func (req *Request) Reply(msg map[string]interface{}) {
+	req.write(lucigo.RecvEnvelope{Type: req.Type, Id: req.Id, Msg: msg})
+}
+
+// Fail answers the request with an error.
+func (req *Request) Fail(code int, message string) {
+	req.write(lucigo.RecvEnvelope{Type: req.Type, Id: req.Id, Code: code, Error: message, Msg: map[string]interface{}{}})
+}
+
+// Send writes an unsolicited message, such as run data, to the client.
+func (req *Request) Send(Type string, msg map[string]interface{}) {
+	req.write(lucigo.RecvEnvelope{Type: Type, Msg: msg})
+}
+
+// write sends the envelope, compressed as the request accepts.
+func (req *Request) write(envelope lucigo.RecvEnvelope) {
+	line, _ := lucigo.MarshalRecvEnvelope(envelope, req.AcceptEncoding)
+	req.conn.Write(append(line, '\n')) // fails once the client hung up
+}
+
+// ServeRun returns a handler for start_run which streams the given raw data
+// frames (indexed as frame[sample][channel], in ADC codes) and then
+// finishes the run in state DONE.
+func ServeRun(frames ...[][]float64) Handler {
+	return func(req *Request) {
+		id := req.MsgMap()["id"]
+		req.Reply(map[string]interface{}{})
+		offset := 0
+		for _, data := range frames {
+			req.Send("run_data", map[string]interface{}{"id": id, "entity": []string{}, "offset": offset, "data": data})
+			offset += len(data)
+		}
+		req.Send("run_state_change", map[string]interface{}{"id": id, "old": "OP", "new": "DONE"})
+	}
+}
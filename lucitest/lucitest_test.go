@@ -0,0 +1,63 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucitest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/anabrid/lucigo"
+)
+
+func TestDevice(t *testing.T) {
+	dev := NewDevice()
+	dev.Respond("net_get", map[string]interface{}{"hostname": "foo"})
+	dev.FailNext("net_get", -2, "not now")
+
+	hc, err := dev.Controller()
+	if err != nil {
+		t.Fatalf("Controller: %v", err)
+	}
+
+	res, err := hc.Query("net_get")
+	var refused *lucigo.DeviceError
+	if !errors.As(err, &refused) || refused.Code != -2 || refused.Message != "not now" {
+		t.Fatalf("expected the scripted failure, got %+v, %v", res, err)
+	}
+	res, err = hc.Query("net_get")
+	if err != nil || !res.IsSuccess() || res.Msg["hostname"] != "foo" {
+		t.Fatalf("expected the canned response, got %+v, %v", res, err)
+	}
+	res, err = hc.Query("no_such_thing")
+	if !errors.Is(err, lucigo.ErrDeviceFailed) {
+		t.Fatalf("expected an error for an unknown type, got %+v, %v", res, err)
+	}
+
+	requests := dev.Requests()
+	if len(requests) != 3 || requests[2].Type != "no_such_thing" {
+		t.Fatalf("unexpected requests %+v", requests)
+	}
+}
+
+func TestServeRun(t *testing.T) {
+	dev := NewDevice()
+	dev.Handle("start_run", ServeRun([][]float64{{1, 2}, {3, 4}}, [][]float64{{5, 6}}))
+	hc, err := dev.Controller()
+	if err != nil {
+		t.Fatalf("Controller: %v", err)
+	}
+
+	run, err := hc.StartRun(lucigo.RunConfig{OpTime: 1000}, lucigo.DAQConfig{NumChannels: 2})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	rec := &lucigo.Recording{}
+	if err := run.Capture(rec); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if len(rec.Samples) != 3 || run.State() != lucigo.RunStateDone || !run.Integrity().OK() {
+		t.Fatalf("expected 3 samples in state DONE, got %d in %s", len(rec.Samples), run.State())
+	}
+}
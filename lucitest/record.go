@@ -0,0 +1,126 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/anabrid/lucigo"
+)
+
+// Recorder wraps an endpoint, passing all traffic through while writing it
+// as [Transcript] to Out. Lines which are no JSON (such as the logging on
+// serial connections) are not recorded.
+type Recorder struct {
+	Endpoint lucigo.Endpoint
+	Out      io.Writer
+
+	mu sync.Mutex // of Out
+}
+
+// Record creates a Recorder for the endpoint writing to w.
+func Record(endpoint lucigo.Endpoint, w io.Writer) *Recorder {
+	return &Recorder{Endpoint: endpoint, Out: w}
+}
+
+func (r *Recorder) IsValid() bool {
+	return r.Endpoint != nil && r.Endpoint.IsValid()
+}
+
+func (r *Recorder) ToURL() string {
+	return r.Endpoint.ToURL()
+}
+
+func (r *Recorder) Open() (io.ReadWriter, error) {
+	stream, err := r.Endpoint.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &recordingStream{stream: stream, rec: r}, nil
+}
+
+// record writes a complete line in the given direction ("send" or "recv").
+func (r *Recorder) record(direction string, line []byte) {
+	line = bytes.TrimSpace(line)
+	if !json.Valid(line) {
+		return
+	}
+	entry, _ := json.Marshal(map[string]json.RawMessage{direction: line})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Out.Write(append(entry, '\n'))
+}
+
+type recordingStream struct {
+	stream     io.ReadWriter
+	rec        *Recorder
+	sent, recv []byte // incomplete lines
+}
+
+func (s *recordingStream) Read(p []byte) (int, error) {
+	n, err := s.stream.Read(p)
+	s.recv = s.split("recv", append(s.recv, p[:n]...))
+	return n, err
+}
+
+func (s *recordingStream) Write(p []byte) (int, error) {
+	// recorded before it is passed on, as the answer may be read meanwhile
+	s.sent = s.split("send", append(s.sent, p...))
+	return s.stream.Write(p)
+}
+
+// split records the complete lines in buf and returns the remainder.
+func (s *recordingStream) split(direction string, buf []byte) []byte {
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			return buf
+		}
+		s.rec.record(direction, buf[:i])
+		buf = buf[i+1:]
+	}
+}
+
+func (s *recordingStream) Close() error {
+	if closer, ok := s.stream.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Transcribed returns a HybridController for integration tests which are
+// captured once against hardware and then replayed: If the environment
+// variable LUCIGO_RECORD is set, it connects to the device given by
+// LUCIDAC_ENDPOINT and records the traffic to path. Otherwise, the
+// transcript at path is replayed as with [Golden]. Either way, the
+// controller uses [lucigo.SequentialIDs], so recording the same test
+// again yields the same transcript.
+func Transcribed(t testing.TB, path string) *lucigo.HybridController {
+	t.Helper()
+	if os.Getenv("LUCIGO_RECORD") == "" {
+		return Golden(t, path)
+	}
+	endpoint, err := lucigo.ParseEndpoint(os.Getenv("LUCIDAC_ENDPOINT"))
+	if err != nil {
+		t.Fatalf("Transcribed: Cannot record, %v", err)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Transcribed: %v", err)
+	}
+	t.Cleanup(func() { out.Close() })
+	hc, err := lucigo.NewHybridController(Record(endpoint, out))
+	if err != nil {
+		t.Fatalf("Transcribed: %v", err)
+	}
+	hc.IDs = lucigo.SequentialIDs()
+	t.Cleanup(func() { hc.Close() })
+	return hc
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucitest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/anabrid/lucigo"
+)
+
+func TestRecord_replay(t *testing.T) {
+	session := func(hc *lucigo.HybridController) {
+		if res, err := hc.Query("sys_ident"); err != nil || res.Msg["fw_build"] != "lucitest" {
+			t.Fatalf("sys_ident: %+v, %v", res, err)
+		}
+		run, err := hc.StartRun(lucigo.RunConfig{OpTime: 1000}, lucigo.DAQConfig{NumChannels: 1})
+		if err != nil {
+			t.Fatalf("StartRun: %v", err)
+		}
+		if err := run.Capture(&lucigo.Recording{}); err != nil {
+			t.Fatalf("Capture: %v", err)
+		}
+	}
+
+	dev := NewDevice()
+	dev.Handle("start_run", ServeRun([][]float64{{1}, {2}}))
+	var transcript bytes.Buffer
+	hc, err := lucigo.NewHybridController(Record(dev.Endpoint(), &transcript))
+	if err != nil {
+		t.Fatalf("NewHybridController: %v", err)
+	}
+	session(hc)
+
+	tr, err := ReadTranscript(&transcript)
+	if err != nil {
+		t.Fatalf("ReadTranscript: %v", err)
+	}
+	// sys_ident and start_run, each with answer, then data and state change
+	if len(tr) != 6 || tr[0].Send == nil || tr[1].Recv == nil {
+		t.Fatalf("unexpected transcript %s", transcript.String())
+	}
+
+	replay := Replay(tr)
+	hc, err = lucigo.NewHybridController(replay.Endpoint())
+	if err != nil {
+		t.Fatalf("NewHybridController: %v", err)
+	}
+	session(hc)
+	if err := replay.Close(); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+}
+
+func TestRecord_reproducible(t *testing.T) {
+	record := func() []byte {
+		dev := NewDevice()
+		var transcript bytes.Buffer
+		hc, err := lucigo.NewHybridController(Record(dev.Endpoint(), &transcript))
+		if err != nil {
+			t.Fatalf("NewHybridController: %v", err)
+		}
+		hc.IDs = lucigo.SequentialIDs()
+		for _, query := range []string{"sys_ident", "net_get"} {
+			if _, err := hc.Query(query); err != nil {
+				t.Fatalf("%s: %v", query, err)
+			}
+		}
+		return transcript.Bytes()
+	}
+	first, second := record(), record()
+	if !bytes.Equal(first, second) {
+		t.Fatalf("expected the same transcript twice, got\n%s\nand\n%s", first, second)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/anabrid/lucigo"
+	"github.com/google/uuid"
+)
+
+// A Transcript is a recorded conversation with a device, stored as JSONL
+// with one object per line holding either what the client sent or what
+// the device answered:
+//
+//	{"send":{"type":"net_get","id":"5b0e...","msg":null}}
+//	{"recv":{"type":"net_get","id":"5b0e...","code":0,"msg":{"dhcp":true}}}
+//
+// Blank lines and lines starting with '#' are ignored, as are other fields,
+// such as the time in the traces written by
+// [lucigo.HybridController.TraceWriter], which are transcripts as well.
+type Transcript []TranscriptLine
+
+// TranscriptLine is either a line sent by the client or one received.
+type TranscriptLine struct {
+	Send json.RawMessage `json:"send,omitempty"`
+	Recv json.RawMessage `json:"recv,omitempty"`
+}
+
+// ReadTranscript parses a transcript, see [Transcript].
+func ReadTranscript(r io.Reader) (Transcript, error) {
+	var tr Transcript
+	lines := lucigo.NewLineReader(r)
+	for n := 1; lines.Scan(); n++ {
+		line := bytes.TrimSpace(lines.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		var tl TranscriptLine
+		if err := json.Unmarshal(line, &tl); err != nil {
+			return nil, fmt.Errorf("transcript line %d: %w", n, err)
+		}
+		if (tl.Send == nil) == (tl.Recv == nil) {
+			return nil, fmt.Errorf("transcript line %d: expected either send or recv", n)
+		}
+		tr = append(tr, tl)
+	}
+	return tr, lines.Err()
+}
+
+// LoadTranscript reads a transcript file, see [Transcript].
+func LoadTranscript(path string) (Transcript, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTranscript(f)
+}
+
+// Golden returns a HybridController talking to a fake device which plays
+// the transcript at path, see [Replay]. Requests deviating from the
+// transcript fail the test, as does leaving parts of the transcript
+// unplayed when the test ends. The controller uses [lucigo.SequentialIDs].
+func Golden(t testing.TB, path string) *lucigo.HybridController {
+	t.Helper()
+	tr, err := LoadTranscript(path)
+	if err != nil {
+		t.Fatalf("Golden: %v", err)
+	}
+	replay := Replay(tr)
+	t.Cleanup(func() {
+		if err := replay.Close(); err != nil {
+			t.Errorf("Golden %s: %v", path, err)
+		}
+	})
+	hc, err := lucigo.NewHybridController(replay.Endpoint())
+	if err != nil {
+		t.Fatalf("Golden: %v", err)
+	}
+	hc.IDs = lucigo.SequentialIDs()
+	return hc
+}
+
+// Replayer is a fake device which plays a transcript: Every request sent
+// has to match the next one recorded and is answered with the recorded
+// lines received. On the first deviation, it hangs up.
+//
+// As UUIDs are random, those of the recording are matched to the ones
+// actually sent by their first appearance and replaced in the answers.
+type Replayer struct {
+	transcript Transcript
+	pos        int               // of the next line to play
+	ids        map[string]string // recorded UUIDs to the ones actually used
+	err        error             // first deviation
+
+	mu   sync.Mutex
+	conn net.Conn // of the client, once connected
+	done sync.WaitGroup
+}
+
+// Replay creates a Replayer for the transcript. It serves only a single
+// connection, opened with its Endpoint.
+func Replay(tr Transcript) *Replayer {
+	return &Replayer{transcript: tr, ids: make(map[string]string)}
+}
+
+// Endpoint returns the endpoint to connect to the Replayer.
+func (p *Replayer) Endpoint() lucigo.Endpoint {
+	return replayEndpoint{p}
+}
+
+type replayEndpoint struct {
+	p *Replayer
+}
+
+func (e replayEndpoint) IsValid() bool { return e.p != nil }
+func (e replayEndpoint) ToURL() string { return "replay://" }
+
+func (e replayEndpoint) Open() (io.ReadWriter, error) {
+	p := e.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		return nil, fmt.Errorf("transcript can only be replayed once")
+	}
+	client, server := net.Pipe()
+	p.conn = client
+	p.done.Add(1)
+	go p.play(server)
+	return client, nil
+}
+
+// Close hangs up and returns the deviation from the transcript, if any, or
+// whether parts of it were left unplayed.
+func (p *Replayer) Close() error {
+	p.mu.Lock()
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.mu.Unlock()
+	p.done.Wait()
+	if p.err == nil && p.pos < len(p.transcript) {
+		return fmt.Errorf("transcript played up to line %d of %d", p.pos, len(p.transcript))
+	}
+	return p.err
+}
+
+func (p *Replayer) play(conn net.Conn) {
+	defer p.done.Done()
+	defer conn.Close()
+	requests := lucigo.NewLineReader(conn)
+	for ; p.pos < len(p.transcript); p.pos++ {
+		line := p.transcript[p.pos]
+		if line.Recv != nil {
+			if _, err := conn.Write(append(p.substitute(line.Recv), '\n')); err != nil {
+				return // client gone before consuming
+			}
+			continue
+		}
+		if !requests.Scan() {
+			return // client gone before sending
+		}
+		var expected, actual interface{}
+		json.Unmarshal(line.Send, &expected)
+		if err := json.Unmarshal(requests.Bytes(), &actual); err != nil || !p.match(expected, actual) {
+			p.err = fmt.Errorf("request %s deviates from the transcript, expected %s", requests.Bytes(), line.Send)
+			return
+		}
+	}
+	if requests.Scan() {
+		p.err = fmt.Errorf("unexpected request %s after the end of the transcript", requests.Bytes())
+	}
+}
+
+// match compares JSON values, binding recorded UUIDs to actual ones.
+func (p *Replayer) match(expected, actual interface{}) bool {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok || len(a) != len(e) {
+			return false
+		}
+		for k, v := range e {
+			if !p.match(v, a[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(e) {
+			return false
+		}
+		for i := range e {
+			if !p.match(e[i], a[i]) {
+				return false
+			}
+		}
+		return true
+	case string:
+		a, ok := actual.(string)
+		if _, err := uuid.Parse(e); ok && err == nil && len(e) == len(a) {
+			if bound, known := p.ids[e]; known {
+				return bound == a
+			}
+			p.ids[e] = a
+			return true
+		}
+		return ok && e == a
+	}
+	return reflect.DeepEqual(expected, actual)
+}
+
+// substitute replaces the recorded UUIDs in a line by the actual ones.
+func (p *Replayer) substitute(line []byte) []byte {
+	for recorded, actual := range p.ids {
+		line = bytes.ReplaceAll(line, []byte(recorded), []byte(actual))
+	}
+	return line
+}
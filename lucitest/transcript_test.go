@@ -0,0 +1,70 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucitest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/anabrid/lucigo"
+)
+
+func TestGolden(t *testing.T) {
+	hc := Golden(t, "testdata/net_get.jsonl")
+	res, err := hc.Query("net_get")
+	if err != nil || !res.IsSuccess() {
+		t.Fatalf("net_get failed: %+v, %v", res, err)
+	}
+	if res.Msg["ipv4"].(map[string]interface{})["dhcp_enabled"] != true {
+		t.Fatalf("unexpected answer %+v", res.Msg)
+	}
+}
+
+func TestGolden_run(t *testing.T) {
+	hc := Golden(t, "testdata/start_run.jsonl")
+	run, err := hc.StartRun(lucigo.RunConfig{IcTime: 100000, OpTime: 20000}, lucigo.DAQConfig{NumChannels: 2, SampleOp: true, SampleRate: 100000})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	rec := &lucigo.Recording{}
+	if err := run.Capture(rec); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if len(rec.Samples) != 2 || run.State() != lucigo.RunStateDone {
+		t.Fatalf("expected 2 samples in state DONE, got %d in %s", len(rec.Samples), run.State())
+	}
+}
+
+// failureRecorder collects the failures of a test which is expected to fail
+type failureRecorder struct {
+	testing.TB
+	failures []string
+	cleanups []func()
+}
+
+func (r *failureRecorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *failureRecorder) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func (r *failureRecorder) finish() {
+	for _, f := range r.cleanups {
+		f()
+	}
+}
+
+func TestGolden_deviation(t *testing.T) {
+	r := &failureRecorder{TB: t}
+	hc := Golden(r, "testdata/net_get.jsonl")
+	hc.Query("net_status") // the player hangs up on the deviation
+	r.finish()
+	if len(r.failures) != 1 || !strings.Contains(r.failures[0], "deviates") {
+		t.Fatalf("expected the deviation to be reported, got %q", r.failures)
+	}
+}
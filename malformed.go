@@ -0,0 +1,71 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"fmt"
+)
+
+// MalformedPolicy selects how a HybridController treats lines from the
+// device which are no JSON envelope, such as truncated lines or the debug
+// output the firmware prints on the serial console.
+type MalformedPolicy string
+
+const (
+	// MalformedSkip ignores such lines, but counts them. This is the default.
+	MalformedSkip MalformedPolicy = "skip"
+	// MalformedReport skips and counts such lines and additionally sends
+	// a *MalformedLineError to the MalformedErrors channel, if any.
+	MalformedReport MalformedPolicy = "report"
+	// MalformedAbort fails the command (or run) with a *MalformedLineError.
+	// Not recommended for serial connections, which see logging noise.
+	MalformedAbort MalformedPolicy = "abort"
+)
+
+// MalformedLineError is a line received from the device which could not
+// be decoded as envelope.
+type MalformedLineError struct {
+	Line string
+	Err  error
+}
+
+func (e *MalformedLineError) Error() string {
+	line := e.Line
+	if len(line) > 80 {
+		line = line[:80] + "..."
+	}
+	return fmt.Sprintf("malformed line from device (%v): %q", e.Err, line)
+}
+
+func (e *MalformedLineError) Unwrap() error {
+	return e.Err
+}
+
+// MalformedCount returns the number of malformed lines received so far.
+func (hc *HybridController) MalformedCount() int64 {
+	return hc.malformed.Load()
+}
+
+// decodeLine decodes a line received from the device into the envelope.
+// A malformed line is counted and reported as hc.Malformed demands and
+// yields skip, or an error if it shall abort.
+func (hc *HybridController) decodeLine(line []byte, envelope *RecvEnvelope) (skip bool, err error) {
+	parseErr := hc.parseLine(line, envelope)
+	if parseErr == nil {
+		return false, nil
+	}
+	hc.malformed.Add(1)
+	malformed := &MalformedLineError{Line: string(line), Err: parseErr}
+	switch hc.Malformed {
+	case MalformedAbort:
+		return true, malformed
+	case MalformedReport:
+		select {
+		case hc.MalformedErrors <- malformed:
+		default: // nobody listening, or lagging behind
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RunMetadata describes how the data of a run was obtained, such that
+// results remain reproducible and attributable long after the fact.
+type RunMetadata struct {
+	RunId    uuid.UUID `json:"run_id"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	State    RunState  `json:"state"`
+	Samples  int       `json:"samples"`
+	// Repetitions is the number of runs the data aggregates as mean and
+	// standard deviation, see RepeatRun, zero for the data of a single run
+	Repetitions int `json:"repetitions,omitempty"`
+	// Gaps and duplicates in the data, i.e. whether it can be trusted
+	Integrity Integrity `json:"integrity"`
+
+	Config   RunConfig `json:"config"`
+	DAQ      DAQConfig `json:"daq_config"`
+	Channels []Channel `json:"channels"`
+
+	Endpoint    string                 `json:"endpoint,omitempty"`
+	Device      map[string]interface{} `json:"device,omitempty"`       // as answered to sys_ident
+	CircuitHash string                 `json:"circuit_hash,omitempty"` // SHA-256 of the get_config answer
+	Lucigo      string                 `json:"lucigo,omitempty"`       // version of the writing program
+}
+
+// MetadataSink writes the RunMetadata as JSON once the run is finished.
+// Combine it with a sink writing the actual data:
+//
+//	meta := lucigo.NewMetadataSink(metaFile, hc)
+//	run, err := hc.StartRun(config, daq)
+//	err = run.Capture(lucigo.NewCSVSink(dataFile), meta)
+type MetadataSink struct {
+	Metadata RunMetadata
+	out      io.Writer
+	run      *Run
+}
+
+// NewMetadataSink creates a MetadataSink writing to w. The device identity
+// and circuit are asked for right away, such that the sink is best created
+// right before the run is started. Devices which do not answer these
+// queries are tolerated.
+func NewMetadataSink(w io.Writer, hc *HybridController) *MetadataSink {
+	s := &MetadataSink{out: w}
+	if hc.Endpoint != nil {
+		s.Metadata.Endpoint = hc.Endpoint.ToURL()
+	}
+	if res, err := hc.Query("sys_ident"); err == nil {
+		s.Metadata.Device = res.Msg
+	} else {
+		hc.logger(LayerProtocol).Warn("NewMetadataSink: No device identity", "err", err)
+	}
+	if res, err := hc.Query("get_config"); err == nil {
+		if circuit, err := json.Marshal(res.Msg); err == nil {
+			hash := sha256.Sum256(circuit)
+			s.Metadata.CircuitHash = hex.EncodeToString(hash[:])
+		}
+	} else {
+		hc.logger(LayerProtocol).Warn("NewMetadataSink: No circuit configuration", "err", err)
+	}
+	return s
+}
+
+func (s *MetadataSink) Begin(run *Run) error {
+	s.run = run
+	s.Metadata.RunId = run.Id
+	s.Metadata.Started = run.Started
+	s.Metadata.Config = run.Config
+	s.Metadata.DAQ = run.DAQ
+	s.Metadata.Channels = run.Channels
+	if run.Config.Repetitions > 1 {
+		s.Metadata.Repetitions = run.Config.Repetitions
+	}
+	return nil
+}
+
+func (s *MetadataSink) WriteFrame(frame Frame) error {
+	s.Metadata.Channels = frame.Channels
+	s.Metadata.Samples += len(frame.Samples)
+	return nil
+}
+
+func (s *MetadataSink) Close() error {
+	s.Metadata.Finished = time.Now()
+	if s.run != nil {
+		s.Metadata.State = s.run.State()
+		s.Metadata.Integrity = s.run.Integrity()
+	}
+	enc := json.NewEncoder(s.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.Metadata)
+}
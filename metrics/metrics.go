@@ -0,0 +1,307 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+/*
+Package metrics instruments HybridControllers for monitoring with
+Prometheus, such that services embedding lucigo need not write their own.
+
+	collector := metrics.NewCollector()
+	collector.Watch(hc)
+	http.Handle("/metrics", collector)
+
+The Collector counts the commands and their errors, measures their
+latency and tracks whether the device answers. Runs are counted once
+started, and by the state they end in if passed to WatchRun. Onboard
+temperatures and voltages are taken from the answers to sys_health, i.e.
+are exported once hc.Health is called, such as periodically. It writes
+the Prometheus text format by itself; with the prometheus build tag, it
+is also a prometheus.Collector to register with client_golang:
+
+	prometheus.MustRegister(collector)
+*/
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anabrid/lucigo"
+)
+
+// Buckets are the upper bounds of the command latency histogram, in seconds.
+var Buckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// Collector gathers the metrics of the devices it watches. It is safe for
+// concurrent use.
+type Collector struct {
+	Namespace string // prefix of the metric names, defaults to "lucidac"
+
+	mu      sync.Mutex
+	devices []*device
+}
+
+// device holds the metrics of a watched HybridController.
+type device struct {
+	hc       *lucigo.HybridController
+	endpoint string
+	up       float64
+	commands map[string]float64 // by type
+	errors   map[[2]string]float64
+	buckets  []float64 // counts, cumulative when written
+	count    float64
+	sum      float64
+	started  float64
+	runs     map[lucigo.RunState]float64 // ended, by state
+	health   *lucigo.Health              // last answered to sys_health, nil if never
+}
+
+// NewCollector creates a Collector watching no device yet.
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Watch collects the metrics of hc. It observes the commands as hc.Tracer,
+// passing them on to the tracer set before.
+func (c *Collector) Watch(hc *lucigo.HybridController) {
+	d := &device{
+		hc:       hc,
+		commands: make(map[string]float64),
+		errors:   make(map[[2]string]float64),
+		buckets:  make([]float64, len(Buckets)),
+		runs:     make(map[lucigo.RunState]float64),
+	}
+	if hc.Endpoint != nil {
+		d.endpoint = hc.Endpoint.ToURL()
+	}
+	c.mu.Lock()
+	c.devices = append(c.devices, d)
+	c.mu.Unlock()
+	hc.Tracer = tracer{c, d, hc.Tracer}
+}
+
+// WatchRun counts the run by the state it ends in, as hooked into
+// run.OnStateChange, passing the changes on to the hook set before. The
+// controller of the run has to be watched.
+func (c *Collector) WatchRun(hc *lucigo.HybridController, run *lucigo.Run) {
+	next := run.OnStateChange
+	run.OnStateChange = func(run *lucigo.Run) {
+		if next != nil {
+			next(run)
+		}
+		if run.State() != lucigo.RunStateDone && run.State() != lucigo.RunStateError {
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, d := range c.devices {
+			if d.hc == hc {
+				d.runs[run.State()]++
+			}
+		}
+	}
+}
+
+type tracer struct {
+	c    *Collector
+	d    *device
+	next lucigo.CommandTracer
+}
+
+func (t tracer) StartCommand(hc *lucigo.HybridController, sent lucigo.SendEnvelope) func(*lucigo.RecvEnvelope, error) {
+	var end func(*lucigo.RecvEnvelope, error)
+	if t.next != nil {
+		end = t.next.StartCommand(hc, sent)
+	}
+	begin := time.Now()
+	return func(res *lucigo.RecvEnvelope, err error) {
+		if end != nil {
+			end(res, err)
+		}
+		seconds := time.Since(begin).Seconds()
+		t.c.mu.Lock()
+		defer t.c.mu.Unlock()
+		d := t.d
+		d.commands[sent.Type]++
+		d.count++
+		d.sum += seconds
+		for i, bound := range Buckets {
+			if seconds <= bound {
+				d.buckets[i]++
+				break
+			}
+		}
+		switch {
+		case err != nil:
+			d.up = 0
+			d.errors[[2]string{sent.Type, "io"}]++
+		case !res.IsSuccess():
+			d.up = 1
+			d.errors[[2]string{sent.Type, strconv.Itoa(res.Code)}]++
+		default:
+			d.up = 1
+			switch sent.Type {
+			case "start_run":
+				d.started++
+			case "sys_health":
+				if health, err := lucigo.DecodeHealth(res); err == nil {
+					d.health = health
+				}
+			}
+		}
+	}
+}
+
+// Family is a metric with all its label combinations, as exposed to
+// Prometheus.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string // counter, gauge or histogram
+	Metrics []Metric
+}
+
+// Metric is a value of a Family. Histograms have Buckets, cumulative
+// counts by upper bound as in Buckets, Count and Sum instead of a Value.
+type Metric struct {
+	Labels  map[string]string
+	Value   float64
+	Buckets []float64
+	Count   float64
+	Sum     float64
+}
+
+// Gather returns the current metrics of all devices watched.
+func (c *Collector) Gather() []Family {
+	ns := c.Namespace
+	if ns == "" {
+		ns = "lucidac"
+	}
+	families := []Family{
+		{Name: ns + "_up", Type: "gauge", Help: "Whether the device answered the last command."},
+		{Name: ns + "_commands_total", Type: "counter", Help: "Commands sent, by type."},
+		{Name: ns + "_command_errors_total", Type: "counter", Help: "Commands failed, by type and error code, io for failures of the connection."},
+		{Name: ns + "_command_duration_seconds", Type: "histogram", Help: "Time until commands were answered."},
+		{Name: ns + "_runs_started_total", Type: "counter", Help: "Runs started."},
+		{Name: ns + "_runs_total", Type: "counter", Help: "Runs ended, by state."},
+		{Name: ns + "_malformed_lines_total", Type: "counter", Help: "Lines received which could not be decoded."},
+		{Name: ns + "_temperature_celsius", Type: "gauge", Help: "Onboard temperatures, by sensor, as last answered to sys_health."},
+		{Name: ns + "_voltage_volts", Type: "gauge", Help: "Supply rail voltages, by rail, as last answered to sys_health."},
+	}
+	add := func(i int, value float64, labels ...string) {
+		m := Metric{Labels: map[string]string{}, Value: value}
+		for j := 0; j < len(labels); j += 2 {
+			m.Labels[labels[j]] = labels[j+1]
+		}
+		families[i].Metrics = append(families[i].Metrics, m)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, d := range c.devices {
+		add(0, d.up, "endpoint", d.endpoint)
+		for _, typ := range sortedKeys(d.commands) {
+			add(1, d.commands[typ], "endpoint", d.endpoint, "type", typ)
+		}
+		errors := make([][2]string, 0, len(d.errors))
+		for key := range d.errors {
+			errors = append(errors, key)
+		}
+		sort.Slice(errors, func(i, j int) bool {
+			return errors[i][0] < errors[j][0] || errors[i][0] == errors[j][0] && errors[i][1] < errors[j][1]
+		})
+		for _, key := range errors {
+			add(2, d.errors[key], "endpoint", d.endpoint, "type", key[0], "code", key[1])
+		}
+		histogram := Metric{Labels: map[string]string{"endpoint": d.endpoint}, Count: d.count, Sum: d.sum}
+		var cumulative float64
+		for _, n := range d.buckets {
+			cumulative += n
+			histogram.Buckets = append(histogram.Buckets, cumulative)
+		}
+		families[3].Metrics = append(families[3].Metrics, histogram)
+		add(4, d.started, "endpoint", d.endpoint)
+		for _, state := range []lucigo.RunState{lucigo.RunStateDone, lucigo.RunStateError} {
+			add(5, d.runs[state], "endpoint", d.endpoint, "state", string(state))
+		}
+		add(6, float64(d.hc.MalformedCount()), "endpoint", d.endpoint)
+		if d.health != nil {
+			for _, sensor := range d.health.Sensors() {
+				add(7, d.health.Temperatures[sensor], "endpoint", d.endpoint, "sensor", sensor)
+			}
+			for _, rail := range d.health.Rails() {
+				add(8, d.health.Voltages[rail], "endpoint", d.endpoint, "rail", rail)
+			}
+		}
+	}
+	return families
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	var buf strings.Builder
+	for _, f := range c.Gather() {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", f.Name, f.Help, f.Name, f.Type)
+		for _, m := range f.Metrics {
+			if f.Type != "histogram" {
+				fmt.Fprintf(&buf, "%s%s %s\n", f.Name, formatLabels(m.Labels, "", ""), formatValue(m.Value))
+				continue
+			}
+			for i, bound := range Buckets {
+				fmt.Fprintf(&buf, "%s_bucket%s %s\n", f.Name, formatLabels(m.Labels, "le", formatValue(bound)), formatValue(m.Buckets[i]))
+			}
+			fmt.Fprintf(&buf, "%s_bucket%s %s\n", f.Name, formatLabels(m.Labels, "le", "+Inf"), formatValue(m.Count))
+			fmt.Fprintf(&buf, "%s_sum%s %s\n", f.Name, formatLabels(m.Labels, "", ""), formatValue(m.Sum))
+			fmt.Fprintf(&buf, "%s_count%s %s\n", f.Name, formatLabels(m.Labels, "", ""), formatValue(m.Count))
+		}
+	}
+	n, err := io.WriteString(w, buf.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics to Prometheus.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats the labels sorted by name, with an extra label if given.
+func formatLabels(labels map[string]string, extraName, extraValue string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		parts = append(parts, name+`="`+labelEscaper.Replace(labels[name])+`"`)
+	}
+	if extraName != "" {
+		parts = append(parts, extraName+`="`+extraValue+`"`)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
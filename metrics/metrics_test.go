@@ -0,0 +1,64 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anabrid/lucigo"
+	"github.com/anabrid/lucigo/lucitest"
+)
+
+func TestCollector(t *testing.T) {
+	dev := lucitest.NewDevice()
+	dev.FailNext("net_get", -2, "not permitted")
+	dev.Respond("sys_health", map[string]interface{}{"temperatures": map[string]interface{}{"mainboard": 41.5}, "voltages": map[string]interface{}{"+15V": 14.98}})
+	hc, err := lucigo.NewHybridController(dev.Endpoint())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	collector := NewCollector()
+	collector.Watch(hc)
+
+	for _, typ := range []string{"sys_ident", "net_get", "net_get"} {
+		if _, err := hc.Command(hc.NewEnvelope(typ)); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	if _, err := hc.Health(); err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+	endpoint := hc.Endpoint.ToURL()
+	for _, want := range []string{
+		"# TYPE lucidac_up gauge\n",
+		`lucidac_up{endpoint="` + endpoint + `"} 1` + "\n",
+		`lucidac_commands_total{endpoint="` + endpoint + `",type="net_get"} 2` + "\n",
+		`lucidac_commands_total{endpoint="` + endpoint + `",type="sys_ident"} 1` + "\n",
+		`lucidac_command_errors_total{code="-2",endpoint="` + endpoint + `",type="net_get"} 1` + "\n",
+		`lucidac_command_duration_seconds_bucket{endpoint="` + endpoint + `",le="+Inf"} 4` + "\n",
+		`lucidac_command_duration_seconds_count{endpoint="` + endpoint + `"} 4` + "\n",
+		`lucidac_runs_total{endpoint="` + endpoint + `",state="DONE"} 0` + "\n",
+		`lucidac_temperature_celsius{endpoint="` + endpoint + `",sensor="mainboard"} 41.5` + "\n",
+		`lucidac_voltage_volts{endpoint="` + endpoint + `",rail="+15V"} 14.98` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	got := formatLabels(map[string]string{"b": `say "hi"`, "a": `C:\`}, "le", "0.5")
+	if want := `{a="C:\\",b="say \"hi\"",le="0.5"}`; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
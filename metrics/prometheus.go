@@ -0,0 +1,55 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build prometheus
+
+// The Prometheus client library is only built with the prometheus build tag:
+//
+//	go get github.com/prometheus/client_golang
+//	go build -tags prometheus ./...
+
+package metrics
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// Describe sends no descriptions, which makes the Collector unchecked: The
+// label combinations depend on the commands sent.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect sends the current metrics, see Gather.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, f := range c.Gather() {
+		for _, m := range f.Metrics {
+			names := make([]string, 0, len(m.Labels))
+			for name := range m.Labels {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			values := make([]string, len(names))
+			for i, name := range names {
+				values[i] = m.Labels[name]
+			}
+			desc := prometheus.NewDesc(f.Name, f.Help, names, nil)
+
+			switch f.Type {
+			case "histogram":
+				buckets := make(map[float64]uint64, len(Buckets))
+				for i, bound := range Buckets {
+					buckets[bound] = uint64(m.Buckets[i])
+				}
+				ch <- prometheus.MustNewConstHistogram(desc, uint64(m.Count), m.Sum, buckets, values...)
+			case "counter":
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, m.Value, values...)
+			default:
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, m.Value, values...)
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MQTTClient is the connection to an MQTT broker used by the MQTTBridge.
+// [DialMQTT] provides one when built with the mqtt build tag.
+type MQTTClient interface {
+	Publish(topic string, retained bool, payload []byte) error
+	Subscribe(topic string, handler func(payload []byte)) error
+	Close() error
+}
+
+// MQTTCommands are the request types accepted on the command topic of an
+// MQTTBridge by default. Commands changing the device permanently (such as
+// net_set) are deliberately left out.
+var MQTTCommands = []string{"sys_ident", "net_status", "net_get", "get_config", "start_run"}
+
+// MQTTBridge publishes a LUCIDAC to MQTT, integrating it into lab
+// telemetry. All topics are below Topic:
+//
+//	<Topic>/ident      sys_ident of the device (retained)
+//	<Topic>/status     net_status, every StatusInterval (retained)
+//	<Topic>/command    requests such as {"type":"net_get","msg":{}}
+//	<Topic>/response   answers to the requests, as RecvEnvelope
+//	<Topic>/run/state  state changes of runs, {"run":"<id>","state":"OP"}
+//	<Topic>/run/data   data of runs, one message per Frame
+//
+// A start_run request carries the run configuration as {"config":
+// RunConfig, "daq": DAQConfig}. The run is answered with its id and then
+// captured to run/state and run/data, meanwhile no other request is served.
+type MQTTBridge struct {
+	Controller *HybridController
+	Client     MQTTClient
+
+	Topic          string        // prefix of all topics, defaults to "lucidac"
+	StatusInterval time.Duration // defaults to 10 seconds
+	Commands       []string      // request types accepted, defaults to MQTTCommands
+}
+
+// Requests waiting on the command topic, more are rejected
+const mqttCommandQueue = 16
+
+type mqttRequest struct {
+	Type string          `json:"type"`
+	Msg  json.RawMessage `json:"msg"`
+}
+
+type mqttRunRequest struct {
+	Config RunConfig `json:"config"`
+	DAQ    DAQConfig `json:"daq"`
+}
+
+type mqttRunState struct {
+	Run   uuid.UUID `json:"run"`
+	State RunState  `json:"state"`
+}
+
+type mqttFrame struct {
+	Run      uuid.UUID   `json:"run"`
+	Seq      int         `json:"seq"` // of the first sample within the run
+	Gap      int         `json:"gap,omitempty"`
+	Time     float64     `json:"time"`     // of the first sample, see Frame.Start
+	Interval float64     `json:"interval"` // between samples
+	Channels []string    `json:"channels"`
+	Samples  [][]float64 `json:"samples"`
+}
+
+// Serve publishes the device and serves the command topic until ctx is
+// done or the device or broker fail.
+func (b *MQTTBridge) Serve(ctx context.Context) error {
+	requests := make(chan []byte, mqttCommandQueue)
+	err := b.Client.Subscribe(b.topic("command"), func(payload []byte) {
+		select {
+		case requests <- payload:
+		default:
+			b.respond(&RecvEnvelope{Code: -1, Error: "too many requests"})
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("cannot subscribe to commands: %w", err)
+	}
+
+	ident, err := b.Controller.Query("sys_ident")
+	if err != nil {
+		return err
+	}
+	if err := b.publish("ident", true, ident.Msg); err != nil {
+		return err
+	}
+
+	interval := b.StatusInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	if err := b.publishStatus(); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := b.publishStatus(); err != nil {
+				return err
+			}
+		case payload := <-requests:
+			if err := b.serve(payload); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (b *MQTTBridge) topic(name string) string {
+	if b.Topic == "" {
+		return "lucidac/" + name
+	}
+	return b.Topic + "/" + name
+}
+
+func (b *MQTTBridge) publish(name string, retained bool, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Client.Publish(b.topic(name), retained, payload)
+}
+
+func (b *MQTTBridge) respond(res *RecvEnvelope) error {
+	return b.publish("response", false, res)
+}
+
+func (b *MQTTBridge) publishStatus() error {
+	status, err := b.Controller.Query("net_status")
+	if err != nil {
+		return err
+	}
+	return b.publish("status", true, status.Msg)
+}
+
+// serve answers a request from the command topic. Only failures of the
+// device or broker are returned, bad requests are answered with an error.
+func (b *MQTTBridge) serve(payload []byte) error {
+	var req mqttRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return b.respond(&RecvEnvelope{Code: -1, Error: fmt.Sprintf("cannot decode request: %v", err)})
+	}
+	commands := b.Commands
+	if commands == nil {
+		commands = MQTTCommands
+	}
+	if !slices.Contains(commands, req.Type) {
+		return b.respond(&RecvEnvelope{Type: req.Type, Code: -1, Error: "request type not allowed"})
+	}
+	if req.Type == "start_run" {
+		return b.startRun(req.Msg)
+	}
+	var msg map[string]interface{}
+	if len(req.Msg) != 0 {
+		if err := json.Unmarshal(req.Msg, &msg); err != nil {
+			return b.respond(&RecvEnvelope{Type: req.Type, Code: -1, Error: fmt.Sprintf("cannot decode request: %v", err)})
+		}
+	}
+	res, err := b.Controller.QueryMsg(req.Type, msg)
+	if err != nil {
+		return err
+	}
+	return b.respond(res)
+}
+
+func (b *MQTTBridge) startRun(msg json.RawMessage) error {
+	var req mqttRunRequest
+	if len(msg) != 0 {
+		if err := json.Unmarshal(msg, &req); err != nil {
+			return b.respond(&RecvEnvelope{Type: "start_run", Code: -1, Error: fmt.Sprintf("cannot decode run configuration: %v", err)})
+		}
+	}
+	run, err := b.Controller.StartRun(req.Config, req.DAQ)
+	if err != nil {
+		return b.respond(&RecvEnvelope{Type: "start_run", Code: -1, Error: err.Error()})
+	}
+	if err := b.respond(&RecvEnvelope{Type: "start_run", Id: run.Id, Msg: map[string]interface{}{"id": run.Id}}); err != nil {
+		return err
+	}
+
+	sink := &mqttSink{b: b}
+	run.OnStateChange = sink.publishState
+	err = run.Capture(sink)
+	if sink.err != nil {
+		return sink.err
+	}
+	if err != nil && run.State() != RunStateError {
+		// the run failed, not the bridge
+		return b.publish("run/state", false, mqttRunState{run.Id, RunStateError})
+	}
+	return nil
+}
+
+// mqttSink publishes the frames of a run to the run/data topic.
+type mqttSink struct {
+	b   *MQTTBridge
+	run *Run
+	err error // first failure to publish
+}
+
+func (s *mqttSink) Begin(run *Run) error {
+	s.run = run
+	return nil
+}
+
+func (s *mqttSink) publishState(run *Run) {
+	if err := s.b.publish("run/state", false, mqttRunState{run.Id, run.State()}); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *mqttSink) WriteFrame(frame Frame) error {
+	msg := mqttFrame{
+		Run:      s.run.Id,
+		Seq:      frame.Offset,
+		Gap:      frame.Gap,
+		Time:     frame.Start,
+		Interval: frame.Interval,
+		Channels: make([]string, len(frame.Channels)),
+		Samples:  frame.Samples,
+	}
+	for i, channel := range frame.Channels {
+		msg.Channels[i] = channel.Name
+	}
+	if err := s.b.publish("run/data", false, msg); err != nil && s.err == nil {
+		s.err = err
+	}
+	return s.err
+}
+
+func (s *mqttSink) Close() error {
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMQTT is a broker connection recording what is published.
+type fakeMQTT struct {
+	mu        sync.Mutex
+	published map[string][]string // payloads by topic
+	handler   func(payload []byte)
+}
+
+func (c *fakeMQTT) Publish(topic string, retained bool, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published[topic] = append(c.published[topic], string(payload))
+	return nil
+}
+
+func (c *fakeMQTT) Subscribe(topic string, handler func(payload []byte)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if topic != "lab/lucidac/command" {
+		return fmt.Errorf("unexpected subscription to %s", topic)
+	}
+	c.handler = handler
+	return nil
+}
+
+func (c *fakeMQTT) Close() error {
+	return nil
+}
+
+// wait returns the payloads published on topic, once there are n.
+func (c *fakeMQTT) wait(t *testing.T, topic string, n int) []string {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		c.mu.Lock()
+		payloads := c.published[topic]
+		c.mu.Unlock()
+		if len(payloads) >= n {
+			return payloads
+		}
+	}
+	t.Fatalf("expected %d messages on %s, got %v", n, topic, c.published)
+	return nil
+}
+
+func (c *fakeMQTT) command(payload string) {
+	c.mu.Lock()
+	handler := c.handler
+	c.mu.Unlock()
+	handler([]byte(payload))
+}
+
+func TestMQTTBridge(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		switch sent.Type {
+		case "sys_ident":
+			fmt.Fprintf(w, `{"type":"sys_ident","id":"%s","code":0,"msg":{"fw_name":"LUCIDAC"}}`+"\n", sent.Id)
+		case "net_status":
+			fmt.Fprintf(w, `{"type":"net_status","id":"%s","code":0,"msg":{"link":true}}`+"\n", sent.Id)
+		case "start_run":
+			serveRun(`[[4096]]`)(sent, w)
+		}
+	})
+	client := &fakeMQTT{published: make(map[string][]string)}
+	bridge := &MQTTBridge{Controller: hc, Client: client, Topic: "lab/lucidac", StatusInterval: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- bridge.Serve(ctx) }()
+
+	if ident := client.wait(t, "lab/lucidac/ident", 1); ident[0] != `{"fw_name":"LUCIDAC"}` {
+		t.Fatalf("unexpected ident %s", ident[0])
+	}
+	client.wait(t, "lab/lucidac/status", 1)
+
+	client.command(`{"type":"net_set","msg":{"dhcp":false}}`)
+	if res := client.wait(t, "lab/lucidac/response", 1); !strings.Contains(res[0], "not allowed") {
+		t.Fatalf("expected net_set to be refused, got %s", res[0])
+	}
+
+	client.command(`{"type":"start_run","msg":{"config":{"ic_time":100000,"op_time":1000000},"daq":{"num_channels":1,"sample_op":true,"sample_rate":1000}}}`)
+	states := client.wait(t, "lab/lucidac/run/state", 1)
+	if !strings.Contains(states[len(states)-1], `"state":"DONE"`) {
+		t.Fatalf("expected the run to be DONE, got %v", states)
+	}
+	if data := client.wait(t, "lab/lucidac/run/data", 1); !strings.Contains(data[0], `"samples":[[0.15625]]`) {
+		t.Fatalf("unexpected data %s", data[0])
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build otel
+
+// OpenTelemetry support is only built with the otel build tag:
+//
+//	go get go.opentelemetry.io/otel
+//	go build -tags otel ./...
+
+package lucigo
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the instrumentation scope of the spans
+const otelScope = "github.com/anabrid/lucigo"
+
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+// NewOTelTracer returns a CommandTracer recording every command as span
+// "lucidac <type>" with the attributes lucidac.endpoint, lucidac.type,
+// lucidac.id and lucidac.code. Commands answered with an error code or
+// failing otherwise are marked as errors.
+//
+//	hc.Tracer = lucigo.NewOTelTracer(otel.GetTracerProvider())
+func NewOTelTracer(provider trace.TracerProvider) CommandTracer {
+	return otelTracer{provider.Tracer(otelScope)}
+}
+
+func (t otelTracer) StartCommand(hc *HybridController, sent SendEnvelope) func(*RecvEnvelope, error) {
+	attrs := []attribute.KeyValue{
+		attribute.String("lucidac.type", sent.Type),
+		attribute.String("lucidac.id", sent.Id.String()),
+	}
+	if hc.Endpoint != nil {
+		attrs = append(attrs, attribute.String("lucidac.endpoint", hc.Endpoint.ToURL()))
+	}
+	_, span := t.tracer.Start(context.Background(), "lucidac "+sent.Type,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return func(res *RecvEnvelope, err error) {
+		defer span.End()
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return
+		}
+		span.SetAttributes(attribute.Int("lucidac.code", res.Code))
+		if !res.IsSuccess() {
+			span.SetStatus(codes.Error, fmt.Sprintf("code %d: %s", res.Code, res.Error))
+		}
+	}
+}
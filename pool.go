@@ -0,0 +1,133 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"sync"
+	"time"
+)
+
+// Pool holds the connections to many devices, such as the LUCIDACs of a
+// classroom, to query all of them at once instead of one after the other:
+//
+//	pool, err := fleet.Pool(devices)
+//	for _, r := range pool.QueryAll("sys_ident", nil) {
+//		fmt.Println(r.Device, r.Res, r.Err)
+//	}
+//
+// A Pool is safe for concurrent use. Queries to the same device are
+// serialized, as a HybridController handles one command at a time.
+type Pool struct {
+	Concurrency int // devices queried at once, defaults to 8
+
+	mu      sync.Mutex
+	names   []string
+	devices map[string]*poolDevice
+}
+
+type poolDevice struct {
+	hc *HybridController
+	mu sync.Mutex // held while querying
+}
+
+// PoolResult is the answer of a device of a Pool to a query.
+type PoolResult struct {
+	Device   string
+	Res      *RecvEnvelope // nil if the device did not answer
+	Err      error         // why the device did not answer, or the error it answered with
+	Duration time.Duration
+}
+
+// NewPool creates an empty Pool.
+func NewPool() *Pool {
+	return &Pool{devices: make(map[string]*poolDevice)}
+}
+
+// Add puts the device connected by hc into the pool under the given name,
+// replacing any device of that name.
+func (p *Pool) Add(name string, hc *HybridController) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.devices[name]; !ok {
+		p.names = append(p.names, name)
+	}
+	p.devices[name] = &poolDevice{hc: hc}
+}
+
+// Remove takes the device out of the pool and returns its controller, nil
+// if there is no device of that name.
+func (p *Pool) Remove(name string) *HybridController {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	device, ok := p.devices[name]
+	if !ok {
+		return nil
+	}
+	delete(p.devices, name)
+	for i, n := range p.names {
+		if n == name {
+			p.names = append(p.names[:i:i], p.names[i+1:]...)
+			break
+		}
+	}
+	return device.hc
+}
+
+// Names returns the names of the devices, in the order they were added.
+func (p *Pool) Names() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.names...)
+}
+
+// QueryAll sends the query to every device, with at most Concurrency at
+// once, and returns the answers in the order of Names. A device failing
+// does not affect the others.
+func (p *Pool) QueryAll(Type string, Msg map[string]interface{}) []PoolResult {
+	p.mu.Lock()
+	names := append([]string(nil), p.names...)
+	devices := make([]*poolDevice, len(names))
+	for i, name := range names {
+		devices[i] = p.devices[name]
+	}
+	p.mu.Unlock()
+
+	results := make([]PoolResult, len(names))
+	parallel(len(names), p.Concurrency, func(i int) {
+		device := devices[i]
+		device.mu.Lock()
+		defer device.mu.Unlock()
+		started := time.Now()
+		res, err := device.hc.QueryMsg(Type, Msg)
+		results[i] = PoolResult{Device: names[i], Res: res, Err: err, Duration: time.Since(started)}
+	})
+	return results
+}
+
+// Close closes the connections to all devices at once and empties the
+// pool. The first error of closing is returned.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var first error
+	for _, name := range p.names {
+		wg.Add(1)
+		go func(hc *HybridController) {
+			defer wg.Done()
+			if err := hc.Close(); err != nil {
+				errMu.Lock()
+				if first == nil {
+					first = err
+				}
+				errMu.Unlock()
+			}
+		}(p.devices[name].hc)
+	}
+	wg.Wait()
+	p.names, p.devices = nil, make(map[string]*poolDevice)
+	return first
+}
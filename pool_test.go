@@ -0,0 +1,62 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPool_QueryAll(t *testing.T) {
+	fleet := &Fleet{Concurrency: 30}
+	for i := 0; i < 30; i++ {
+		fleet.Devices = append(fleet.Devices, FleetDevice{Name: fmt.Sprintf("lab%d", i)})
+	}
+	fleet.Devices = append(fleet.Devices, FleetDevice{Name: "down"}, FleetDevice{Name: "locked"})
+	fleet.Connect = func(device FleetDevice) (*HybridController, error) {
+		if device.Name == "down" {
+			return nil, errors.New("connection refused")
+		}
+		return newPipeController(func(sent SendEnvelope, w io.Writer) {
+			time.Sleep(20 * time.Millisecond)
+			if device.Name == "locked" {
+				fmt.Fprintf(w, `{"type":"%s","id":"%s","code":-3,"error":"not logged in"}`+"\n", sent.Type, sent.Id)
+				return
+			}
+			fmt.Fprintf(w, `{"type":"%s","id":"%s","code":0,"msg":{"mac":"%s"}}`+"\n", sent.Type, sent.Id, device.Name)
+		}), nil
+	}
+
+	pool, err := fleet.Pool(fleet.Devices)
+	if err == nil || !strings.Contains(err.Error(), "down: connection refused") {
+		t.Fatalf("expected the device down to be reported, got %v", err)
+	}
+	defer pool.Close()
+	if names := pool.Names(); len(names) != 31 || names[0] != "lab0" || names[30] != "locked" {
+		t.Fatalf("unexpected devices %v", names)
+	}
+
+	started := time.Now()
+	results := pool.QueryAll("sys_ident", nil)
+	if elapsed := time.Since(started); elapsed > 300*time.Millisecond {
+		t.Fatalf("expected the devices to be queried at once, took %v", elapsed)
+	}
+	for i, r := range results[:30] {
+		if r.Err != nil || r.Device != fleet.Devices[i].Name || r.Res.Msg["mac"] != r.Device {
+			t.Fatalf("unexpected result %d: %+v", i, r)
+		}
+	}
+	if r := results[30]; r.Device != "locked" || r.Err == nil || r.Res == nil || r.Res.Code != -3 {
+		t.Fatalf("expected the error code to be reported, got %+v", r)
+	}
+
+	if pool.Remove("locked") == nil || len(pool.Names()) != 30 || pool.Remove("locked") != nil {
+		t.Fatalf("expected the device to be removed once, got %v", pool.Names())
+	}
+}
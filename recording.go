@@ -0,0 +1,70 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import "math"
+
+// Recording is a Sink which keeps all data of a run in memory, for
+// analysis within Go programs, e.g. assertions in circuit test benches:
+//
+//	rec := &lucigo.Recording{}
+//	if err := run.Capture(rec); err != nil { ... }
+//	stats := rec.Stats()
+type Recording struct {
+	Run      *Run
+	Channels []Channel
+	Time     []float64   // in seconds, per sample
+	Samples  [][]float64 // indexed as Samples[sample][channel]
+}
+
+func (r *Recording) Begin(run *Run) error {
+	r.Run = run
+	return nil
+}
+
+func (r *Recording) WriteFrame(frame Frame) error {
+	r.Channels = frame.Channels
+	for i, sample := range frame.Samples {
+		r.Time = append(r.Time, frame.Time(i))
+		r.Samples = append(r.Samples, sample)
+	}
+	return nil
+}
+
+func (r *Recording) Close() error {
+	return nil
+}
+
+// Column returns the values of a single channel over all samples.
+func (r *Recording) Column(channel int) []float64 {
+	return Frame{Samples: r.Samples}.Column(channel)
+}
+
+// ChannelStats holds basic statistics of the values of a channel.
+type ChannelStats struct {
+	Channel
+	Min, Max, Mean float64
+}
+
+// Stats computes minimum, maximum and mean of every channel. They are NaN
+// for a recording without samples.
+func (r *Recording) Stats() []ChannelStats {
+	stats := make([]ChannelStats, len(r.Channels))
+	for c, channel := range r.Channels {
+		s := ChannelStats{Channel: channel, Min: math.Inf(1), Max: math.Inf(-1)}
+		sum := 0.0
+		for _, sample := range r.Samples {
+			s.Min = math.Min(s.Min, sample[c])
+			s.Max = math.Max(s.Max, sample[c])
+			sum += sample[c]
+		}
+		if len(r.Samples) == 0 {
+			s.Min, s.Max = math.NaN(), math.NaN()
+		}
+		s.Mean = sum / float64(len(r.Samples))
+		stats[c] = s
+	}
+	return stats
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build gonum
+
+// The gonum integration is only built with the gonum build tag, so the
+// default build stays free of numerical libraries:
+//
+//	go get gonum.org/v1/gonum
+//	go build -tags gonum ./...
+
+package lucigo
+
+import "gonum.org/v1/gonum/mat"
+
+// Dense returns the samples as matrix with one row per sample and one
+// column per channel.
+func (r *Recording) Dense() *mat.Dense {
+	if len(r.Samples) == 0 {
+		return &mat.Dense{}
+	}
+	data := make([]float64, 0, len(r.Samples)*len(r.Channels))
+	for _, sample := range r.Samples {
+		data = append(data, sample...)
+	}
+	return mat.NewDense(len(r.Samples), len(r.Channels), data)
+}
+
+// TimeVector returns the sample times as vector.
+func (r *Recording) TimeVector() *mat.VecDense {
+	if len(r.Time) == 0 {
+		return &mat.VecDense{}
+	}
+	return mat.NewVecDense(len(r.Time), append([]float64(nil), r.Time...))
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Time to wait before the first attempt to reattach, doubled for every further one
+var reattachBackoff = time.Second
+
+type attachRunMsg struct {
+	State RunState `json:"state"`
+}
+
+// reattach tries to resume receiving the run after the connection dropped
+// with cause, which is important for long runs over flaky (WiFi) links.
+// The run continues on the device meanwhile.
+//
+// After reconnecting, the firmware is asked with attach_run to replay the
+// data it still buffers for the run as run_data messages, followed by the
+// answer holding the current state of the run. Samples received twice are
+// sorted out by their offsets, see [Integrity].
+func (run *Run) reattach(cause error) error {
+	var malformed *MalformedLineError
+	if errors.As(cause, &malformed) {
+		return cause // the connection is fine, the data is not
+	}
+	backoff := reattachBackoff
+	for attempt := 1; attempt <= run.Reattach; attempt++ {
+		run.hc.logger(LayerProtocol).Warn("Run lost connection, reattaching", "run", run.Id, "cause", cause, "attempt", attempt, "of", run.Reattach)
+		time.Sleep(backoff)
+		backoff *= 2
+
+		if err := run.hc.Reconnect(); err != nil {
+			cause = err
+			continue
+		}
+		run.integrity.Reattached++
+		sent := run.hc.NewEnvelope("attach_run")
+		sent.Msg = map[string]interface{}{"id": run.Id}
+		res, err := run.await(run.hc.Go(sent, nil))
+		if err != nil {
+			cause = err
+			continue
+		}
+		if err := res.Err(); err != nil {
+			return fmt.Errorf("run %s: cannot reattach, %w", run.Id, err)
+		}
+		var msg attachRunMsg
+		if err := res.DecodeMsg(&msg); err != nil {
+			return fmt.Errorf("run %s: cannot decode attach_run: %w", run.Id, err)
+		}
+		run.hc.logger(LayerProtocol).Info("Run reattached", "run", run.Id, "state", msg.State)
+		for len(run.held)+len(run.messages) != 0 && !run.finished {
+			// the data replayed before the answer
+			run.handle(run.next())
+		}
+		if !run.finished {
+			run.setState(msg.State)
+		}
+		return nil
+	}
+	return fmt.Errorf("run %s: connection lost: %w", run.Id, cause)
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Registry is a client of a central registry of devices and proxies, on
+// which institution-wide dashboards are built. Devices and proxies are
+// registered and kept alive by heartbeats, which put their Registration:
+//
+//	PUT <URL>/devices/<name>
+//	PUT <URL>/proxies/<name>
+//	Authorization: Bearer <Token>
+//	Content-Type: application/json
+//
+//	{"kind": "device", "name": "04-E9-E5-14-74-BF", "endpoint": "tcp://192.168.1.101:5732", ...}
+//
+// The registry is expected to answer with a 2xx status and to consider an
+// entry stale once no heartbeat came for some intervals.
+type Registry struct {
+	URL    string       // base URL of the registry service
+	Token  string       // sent as bearer token, optional
+	Client *http.Client // defaults to http.DefaultClient
+}
+
+// Registration describes a device, or a proxy serving one, to a Registry.
+type Registration struct {
+	Kind     string                 `json:"kind"` // "device" or "proxy"
+	Name     string                 `json:"name"`
+	Endpoint string                 `json:"endpoint"`         // where to reach it
+	Device   string                 `json:"device,omitempty"` // of a proxy, the endpoint of the device served
+	Firmware string                 `json:"firmware,omitempty"`
+	Mac      string                 `json:"mac,omitempty"`
+	Up       bool                   `json:"up"`               // whether the device answered
+	Error    string                 `json:"error,omitempty"`  // why the device did not answer
+	Status   map[string]interface{} `json:"status,omitempty"` // as answered to net_status
+	Time     time.Time              `json:"time"`
+}
+
+// Describe fills the registration with the identity and status of the
+// device behind hc. If the device does not answer, Up is false and Error
+// tells why; this is no error of Describe, but worth registering.
+func (reg *Registration) Describe(hc *HybridController) {
+	reg.Time = time.Now()
+	ident, err := hc.SysIdent()
+	if err != nil {
+		reg.Up, reg.Error, reg.Status = false, err.Error(), nil
+		return
+	}
+	reg.Up, reg.Error = true, ""
+	reg.Mac, reg.Firmware = ident.Mac, ident.Firmware()
+	if reg.Name == "" {
+		reg.Name = reg.Mac
+	}
+	if status, err := hc.Query("net_status"); err == nil {
+		reg.Status = status.Msg
+	}
+}
+
+// Put registers, or refreshes, the registration.
+func (r *Registry) Put(reg Registration) error {
+	if reg.Name == "" {
+		return fmt.Errorf("cannot register a %s without name", reg.Kind)
+	}
+	if reg.Time.IsZero() {
+		reg.Time = time.Now()
+	}
+	body, err := json.Marshal(reg)
+	if err != nil {
+		return err
+	}
+	target := strings.TrimSuffix(r.URL, "/") + "/" + kindPath(reg.Kind) + "/" + url.PathEscape(reg.Name)
+	req, err := http.NewRequest(http.MethodPut, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("registering %s at %s: %s %s", reg.Name, r.URL, res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func kindPath(kind string) string {
+	if kind == "proxy" {
+		return "proxies"
+	}
+	return "devices"
+}
+
+// Heartbeat puts the registration every interval, until ctx is done.
+// Before each, update is called, if given, such as to describe the device
+// again:
+//
+//	go registry.Heartbeat(ctx, reg, time.Minute, func(reg *lucigo.Registration) { reg.Describe(hc) }, nil)
+//
+// Failures to reach the registry are passed to onError, if given, and
+// retried with the next heartbeat.
+func (r *Registry) Heartbeat(ctx context.Context, reg Registration, interval time.Duration, update func(reg *Registration), onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if update != nil {
+			update(&reg)
+		}
+		reg.Time = time.Now()
+		if err := r.Put(reg); err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
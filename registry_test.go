@@ -0,0 +1,59 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	put := make(chan Registration, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/api/devices/04-E9-E5-14-74-BF" || r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusBadRequest)
+			return
+		}
+		var reg Registration
+		json.NewDecoder(r.Body).Decode(&reg)
+		put <- reg
+	}))
+	defer server.Close()
+
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		switch sent.Type {
+		case "sys_ident":
+			fmt.Fprintf(w, `{"type":"sys_ident","id":"%s","code":0,"msg":{"fw_name":"LUCIDAC","fw_build":"1.2.3","mac":"04-E9-E5-14-74-BF"}}`+"\n", sent.Id)
+		case "net_status":
+			fmt.Fprintf(w, `{"type":"net_status","id":"%s","code":0,"msg":{"link":true}}`+"\n", sent.Id)
+		}
+	})
+	registry := &Registry{URL: server.URL + "/api/", Token: "s3cret"}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		registry.Heartbeat(ctx, Registration{Kind: "device", Endpoint: "tcp://192.168.1.101:5732"}, time.Hour,
+			func(reg *Registration) { reg.Describe(hc) },
+			func(err error) { t.Errorf("Heartbeat: %v", err) })
+		close(done)
+	}()
+
+	reg := <-put
+	cancel()
+	<-done
+	if reg.Name != "04-E9-E5-14-74-BF" || reg.Firmware != "LUCIDAC 1.2.3" || !reg.Up || reg.Status["link"] != true || reg.Endpoint != "tcp://192.168.1.101:5732" {
+		t.Fatalf("unexpected registration %+v", reg)
+	}
+
+	if err := (&Registry{URL: server.URL}).Put(Registration{Kind: "proxy", Name: "lab"}); err == nil {
+		t.Fatalf("expected the failure of the registry to be reported")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"fmt"
+	"math"
+)
+
+// Aggregate holds the sample-wise statistics over repeated runs of the same
+// circuit, as computed by [HybridController.RepeatRun]. Mean and StdDev are
+// indexed as [sample][channel] just like [Frame.Samples].
+type Aggregate struct {
+	Runs     []*Recording
+	Channels []Channel
+	Time     []float64
+	Mean     [][]float64
+	StdDev   [][]float64 // sample standard deviation, zero for a single run
+}
+
+// RepeatRun executes config.Repetitions runs (at least one) one after
+// another and aggregates their data. This is useful for noisy analog
+// measurements where a single trace is not representative.
+func (hc *HybridController) RepeatRun(config RunConfig, daq DAQConfig) (*Aggregate, error) {
+	repetitions := max(config.Repetitions, 1)
+	runs := make([]*Recording, repetitions)
+	for i := range runs {
+		run, err := hc.StartRun(config, daq)
+		if err != nil {
+			return nil, fmt.Errorf("repetition %d: %w", i+1, err)
+		}
+		runs[i] = &Recording{}
+		if err := run.Capture(runs[i]); err != nil {
+			return nil, fmt.Errorf("repetition %d: %w", i+1, err)
+		}
+	}
+	return NewAggregate(runs), nil
+}
+
+// NewAggregate computes the statistics over the given recordings. If they
+// differ in length, only the samples present in all of them are considered.
+func NewAggregate(runs []*Recording) *Aggregate {
+	agg := &Aggregate{Runs: runs}
+	if len(runs) == 0 {
+		return agg
+	}
+	samples := len(runs[0].Samples)
+	for _, run := range runs {
+		samples = min(samples, len(run.Samples))
+	}
+	agg.Channels = runs[0].Channels
+	agg.Time = runs[0].Time[:samples]
+	agg.Mean = make([][]float64, samples)
+	agg.StdDev = make([][]float64, samples)
+
+	n := float64(len(runs))
+	for i := 0; i < samples; i++ {
+		agg.Mean[i] = make([]float64, len(agg.Channels))
+		agg.StdDev[i] = make([]float64, len(agg.Channels))
+		for c := range agg.Channels {
+			sum := 0.0
+			for _, run := range runs {
+				sum += run.Samples[i][c]
+			}
+			mean := sum / n
+			variance := 0.0
+			for _, run := range runs {
+				variance += (run.Samples[i][c] - mean) * (run.Samples[i][c] - mean)
+			}
+			agg.Mean[i][c] = mean
+			if len(runs) > 1 {
+				agg.StdDev[i][c] = math.Sqrt(variance / (n - 1))
+			}
+		}
+	}
+	return agg
+}
+
+// Frame returns the aggregate as a single frame for writing it to a Sink.
+// For every channel, it holds the mean followed by a channel with the
+// standard deviation, named with a "_stddev" suffix.
+func (agg *Aggregate) Frame() Frame {
+	frame := Frame{Samples: make([][]float64, len(agg.Mean))}
+	for _, channel := range agg.Channels {
+		stddev := channel
+		stddev.Name += "_stddev"
+		frame.Channels = append(frame.Channels, channel, stddev)
+	}
+	for i := range agg.Mean {
+		frame.Samples[i] = make([]float64, 0, 2*len(agg.Channels))
+		for c := range agg.Channels {
+			frame.Samples[i] = append(frame.Samples[i], agg.Mean[i][c], agg.StdDev[i][c])
+		}
+	}
+	if len(agg.Time) > 1 {
+		frame.Start, frame.Interval = agg.Time[0], agg.Time[1]-agg.Time[0]
+	}
+	return frame
+}
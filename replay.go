@@ -0,0 +1,161 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/google/uuid"
+)
+
+// ReplayEndpoint plays back the answers of a protocol trace, as recorded
+// with HybridController.TraceWriter, such that tests and demos run without
+// a device. Every envelope sent is answered with the lines received after
+// the next recorded envelope of the same type, up to the following one
+// sent, such as the run_data of a start_run. Once the recorded envelopes
+// of a type are used up, the last one is answered again. Types not in the
+// trace are answered with CodeFailed.
+//
+// As UUIDs are random, those of the recording, such as the id of the
+// envelope or of a run, are replaced in the answers by the ones sent in
+// their place.
+//
+// As URL, it is given as replay://path/to/trace.jsonl, or with an absolute
+// path as replay:///path/to/trace.jsonl.
+type ReplayEndpoint struct {
+	Path string
+}
+
+func (e ReplayEndpoint) IsValid() bool {
+	return e.Path != ""
+}
+
+func (e ReplayEndpoint) ToURL() string {
+	return "replay://" + e.Path
+}
+
+func (e ReplayEndpoint) Open() (io.ReadWriter, error) {
+	if !e.IsValid() {
+		return nil, fmt.Errorf("Invalid Replay Endpoint (all zero)")
+	}
+	f, err := os.Open(e.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	exchanges, err := readExchanges(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", e.Path, err)
+	}
+	client, server := net.Pipe()
+	go serveReplay(server, exchanges)
+	return client, nil
+}
+
+// exchange is an envelope sent in a trace and the lines received after.
+type exchange struct {
+	sent    interface{}
+	answers [][]byte
+}
+
+// readExchanges reads a trace into the exchanges by type. Lines received
+// before anything was sent are left out.
+func readExchanges(r io.Reader) (map[string][]*exchange, error) {
+	exchanges := make(map[string][]*exchange)
+	var last *exchange
+	lines := NewLineReader(r)
+	for n := 1; lines.Scan(); n++ {
+		line := bytes.TrimSpace(lines.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		var entry traceLine
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("trace line %d: %w", n, err)
+		}
+		switch {
+		case entry.Send != nil:
+			var sent SendEnvelope
+			if err := json.Unmarshal(entry.Send, &sent); err != nil {
+				return nil, fmt.Errorf("trace line %d: %w", n, err)
+			}
+			last = &exchange{}
+			json.Unmarshal(entry.Send, &last.sent)
+			exchanges[sent.Type] = append(exchanges[sent.Type], last)
+		case entry.Recv != nil && last != nil:
+			var noise string
+			if json.Unmarshal(entry.Recv, &noise) == nil {
+				last.answers = append(last.answers, []byte(noise))
+			} else {
+				last.answers = append(last.answers, entry.Recv)
+			}
+		}
+	}
+	return exchanges, lines.Err()
+}
+
+func serveReplay(conn net.Conn, exchanges map[string][]*exchange) {
+	defer conn.Close()
+	played := make(map[string]int) // exchanges by type
+	lines := NewLineReader(conn)
+	for lines.Scan() {
+		var sent SendEnvelope
+		var actual interface{}
+		if json.Unmarshal(lines.Bytes(), &sent) != nil || json.Unmarshal(lines.Bytes(), &actual) != nil {
+			continue // like the firmware, ignore what cannot be understood
+		}
+		recorded := exchanges[sent.Type]
+		if len(recorded) == 0 {
+			answer, _ := json.Marshal(RecvEnvelope{Type: sent.Type, Id: sent.Id, Code: CodeFailed, Error: "not in the replayed trace"})
+			if _, err := conn.Write(append(answer, '\n')); err != nil {
+				return
+			}
+			continue
+		}
+		ex := recorded[min(played[sent.Type], len(recorded)-1)]
+		played[sent.Type]++
+		ids := make(map[string]string)
+		bindIDs(ex.sent, actual, ids)
+		for _, answer := range ex.answers {
+			for recordedID, actualID := range ids {
+				answer = bytes.ReplaceAll(answer, []byte(recordedID), []byte(actualID))
+			}
+			if _, err := conn.Write(append(answer, '\n')); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bindIDs maps the UUIDs in a recorded JSON value to those at the same
+// place in the actual one.
+func bindIDs(recorded, actual interface{}, ids map[string]string) {
+	switch r := recorded.(type) {
+	case map[string]interface{}:
+		if a, ok := actual.(map[string]interface{}); ok {
+			for k, v := range r {
+				bindIDs(v, a[k], ids)
+			}
+		}
+	case []interface{}:
+		if a, ok := actual.([]interface{}); ok {
+			for i := range r {
+				if i < len(a) {
+					bindIDs(r[i], a[i], ids)
+				}
+			}
+		}
+	case string:
+		a, ok := actual.(string)
+		if _, err := uuid.Parse(r); ok && err == nil && len(r) == len(a) {
+			ids[r] = a
+		}
+	}
+}
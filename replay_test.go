@@ -0,0 +1,57 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplayEndpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	trace, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answers := 0
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		answers++
+		fmt.Fprintf(w, `{"type":"%s","id":"%s","code":0,"msg":{"answer":%d}}`+"\n", sent.Type, sent.Id, answers)
+	})
+	hc.TraceWriter = trace
+	for i := 0; i < 2; i++ {
+		if _, err := hc.Query("net_get"); err != nil {
+			t.Fatalf("recording: %v", err)
+		}
+	}
+	hc.Close()
+	trace.Close()
+
+	endpoint, err := ParseEndpoint("replay://" + path)
+	if err != nil {
+		t.Fatalf("ParseEndpoint: %v", err)
+	}
+	hc, err = NewHybridController(endpoint)
+	if err != nil {
+		t.Fatalf("NewHybridController: %v", err)
+	}
+	defer hc.Close()
+	for _, expected := range []float64{1, 2, 2} {
+		res, err := hc.Query("net_get")
+		if err != nil {
+			t.Fatalf("replaying: %v", err)
+		}
+		if res.Msg["answer"] != expected {
+			t.Fatalf("expected answer %v, got %v", expected, res.Msg)
+		}
+	}
+	if _, err := hc.Query("sys_ident"); !errors.Is(err, ErrDeviceFailed) {
+		t.Fatalf("expected a type not in the trace to fail, got %v", err)
+	}
+}
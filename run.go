@@ -0,0 +1,586 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RunConfig describes the timing of a run and the conditions under which
+// it starts and halts. Times are given in nanoseconds, as expected by the
+// firmware.
+//
+// A run halts after OpTime (time-based halt), unless it is halted earlier
+// by an overload or the external trigger input. With OpTime zero, it only
+// halts on the external trigger.
+type RunConfig struct {
+	IcTime uint64 `json:"ic_time"`
+	OpTime uint64 `json:"op_time"`
+
+	// WaitForExternalTrigger arms the run: After IC, OP only begins once
+	// the external trigger input fires.
+	WaitForExternalTrigger bool `json:"wait_for_external_trigger,omitempty"`
+	HaltOnExternalTrigger  bool `json:"halt_on_external_trigger"`
+	HaltOnOverload         bool `json:"halt_on_overload"`
+
+	// Repetitions is the number of runs [HybridController.RepeatRun]
+	// averages over. It is not sent to the device.
+	Repetitions int `json:"-"`
+}
+
+// DAQConfig describes which data is acquired during a run.
+type DAQConfig struct {
+	NumChannels int  `json:"num_channels"`
+	SampleOp    bool `json:"sample_op"`
+	SampleOpEnd bool `json:"sample_op_end"`
+	SampleRate  int  `json:"sample_rate"`
+
+	ChannelNames []string `json:"-"` // optional, see [DAQConfig.Channels]
+}
+
+// Validate checks the configuration for combinations the firmware cannot run.
+func (c RunConfig) Validate() error {
+	if c.OpTime == 0 && !c.HaltOnExternalTrigger {
+		return fmt.Errorf("run would never halt: need either an OP time or halt on external trigger")
+	}
+	if c.Repetitions < 0 {
+		return fmt.Errorf("negative number of repetitions %d", c.Repetitions)
+	}
+	return nil
+}
+
+// SampleTime returns the time of the sample with the given index within
+// the run, in seconds since the begin of OP. Without a known sample rate,
+// the index itself is returned.
+func (daq DAQConfig) SampleTime(index int) float64 {
+	if daq.SampleRate <= 0 {
+		return float64(index)
+	}
+	return float64(index) / float64(daq.SampleRate)
+}
+
+// RunState is the state of a run as reported by the firmware in
+// run_state_change messages.
+type RunState string
+
+const (
+	RunStateNew     RunState = "NEW"
+	RunStateQueued  RunState = "QUEUED"
+	RunStateTakeOff RunState = "TAKE_OFF"
+	RunStateIC      RunState = "IC"
+	RunStateOP      RunState = "OP"
+	RunStateOPEnd   RunState = "OP_END"
+	RunStateTmpHalt RunState = "TMP_HALT"
+	RunStateDone    RunState = "DONE"
+	RunStateError   RunState = "ERROR"
+)
+
+// IsFinal tells whether the firmware will not report any further changes.
+func (s RunState) IsFinal() bool {
+	return s == RunStateDone || s == RunStateError
+}
+
+// Frame holds the samples of a single run_data message in machine units,
+// indexed as Samples[sample][channel].
+type Frame struct {
+	Entity   []string
+	Channels []Channel
+	Samples  [][]float64
+	Offset   int // index of the first sample within the run
+	Gap      int // samples lost right before this frame, see [Integrity]
+
+	Start    float64 // time of the first sample, in seconds since the begin of OP
+	Interval float64 // time between two samples, in seconds
+}
+
+// Time returns the time of the i-th sample of the frame, see [DAQConfig.SampleTime].
+func (f Frame) Time(i int) float64 {
+	return f.Start + float64(i)*f.Interval
+}
+
+// DAQSample is a single sample of a run in machine units, see [Run.Samples].
+type DAQSample struct {
+	Index  int     // within the run
+	Time   float64 // in seconds since the begin of OP
+	Values []float64
+}
+
+// Backpressure selects what happens to incoming frames when the consumer of
+// [Run.Data] falls behind the device and the frame buffer is full.
+type Backpressure string
+
+const (
+	// BackpressureBlock waits for the consumer. No data is lost, but as
+	// the connection is not read meanwhile, the device may stall or drop
+	// data on its side. This is the default.
+	BackpressureBlock Backpressure = "block"
+	// BackpressureDropOldest discards the oldest buffered frame in favour
+	// of the new one.
+	BackpressureDropOldest Backpressure = "drop-oldest"
+	// BackpressureDropNewest discards the new frame.
+	BackpressureDropNewest Backpressure = "drop-newest"
+	// BackpressureAbort stops receiving the run with [ErrBackpressure].
+	BackpressureAbort Backpressure = "abort"
+)
+
+// ErrBackpressure is the error of a run aborted by [BackpressureAbort].
+var ErrBackpressure = errors.New("data consumer too slow")
+
+// ErrRunActive is returned by StartRun while another run of the controller
+// is not finished.
+var ErrRunActive = errors.New("another run is active")
+
+// Valid tells whether b is one of the known policies (or empty for the default).
+func (b Backpressure) Valid() bool {
+	switch b {
+	case "", BackpressureBlock, BackpressureDropOldest, BackpressureDropNewest, BackpressureAbort:
+		return true
+	}
+	return false
+}
+
+type runDataMsg struct {
+	Id     uuid.UUID `json:"id"`
+	Entity []string  `json:"entity"`
+	// Either raw codes as [][]number or a base64 string of packed codes,
+	// see [FrameDecoder]
+	Data        json.RawMessage `json:"data"`
+	NumChannels int             `json:"num_channels,omitempty"` // of packed data
+	// Index of the first sample of the frame within the run, if the
+	// firmware counts them. Allows to detect lost and repeated frames.
+	Offset *int `json:"offset,omitempty"`
+	// The packed data ends within a sample, which is continued by the
+	// next run_data message.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// Integrity reports discontinuities in the data received for a run, as
+// detected from the sample offsets sent by the firmware. Typical causes are
+// hiccups of the USB connection. Firmware not sending offsets is trusted.
+type Integrity struct {
+	Gaps       []Gap `json:"gaps,omitempty"`
+	Duplicates int   `json:"duplicates,omitempty"` // samples received twice and discarded
+	Reattached int   `json:"reattached,omitempty"` // times reconnected after the connection dropped, see [Run.Reattach]
+}
+
+// Gap is a range of samples lost in transmission.
+type Gap struct {
+	Offset  int `json:"offset"`  // index of the first sample after the gap
+	Missing int `json:"missing"` // number of samples lost
+}
+
+// OK tells whether the data was received without gaps or duplicates.
+func (i Integrity) OK() bool {
+	return len(i.Gaps) == 0 && i.Duplicates == 0
+}
+
+type runStateChangeMsg struct {
+	Id  uuid.UUID `json:"id"`
+	Old RunState  `json:"old"`
+	New RunState  `json:"new"`
+}
+
+// Number of frames buffered in the data channel before the receive loop blocks
+const frameBuffer = 64
+
+// Run is a single run on the LUCIDAC, as started with [HybridController.StartRun].
+type Run struct {
+	Id      uuid.UUID
+	Config  RunConfig
+	DAQ     DAQConfig
+	Started time.Time
+
+	// Channels describes the acquired data. It is populated from the
+	// DAQConfig and may be adjusted (e.g. calibrated) before reading Data.
+	Channels []Channel
+
+	// Backpressure is the policy for a consumer of Data falling behind.
+	// It must be set before reading Data.
+	Backpressure Backpressure
+
+	// Reattach is the number of attempts to reconnect if the connection
+	// drops while receiving Data, see [Run.Integrity]. Zero disables this.
+	Reattach int
+
+	// OnStateChange is called on every change of the state while Data is
+	// read, if set.
+	OnStateChange func(run *Run)
+
+	hc        *HybridController
+	stateMu   sync.Mutex // guards state
+	state     RunState
+	messages  chan *RecvEnvelope // of the run, as received
+	held      []*RecvEnvelope    // taken from messages by await, handled first
+	data      chan Frame
+	done      chan struct{} // closed once finished
+	samples   int           // received so far
+	packed    FrameDecoder
+	dropped   struct{ frames, samples atomic.Int64 }
+	integrity Integrity
+	err       error
+	finished  bool
+	stopped   atomic.Bool // asked to stop early, see Stop
+	receiver  sync.Once
+	source    func() // produces the data instead of the device, if set
+}
+
+// StartRun asks the LUCIDAC to start a run with the currently uploaded
+// circuit. Data and state changes of the run are routed to the returned
+// Run, see [Run.Data]. It fails with ErrRunActive until the run started
+// before is finished.
+func (hc *HybridController) StartRun(config RunConfig, daq DAQConfig) (*Run, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid run configuration: %w", err)
+	}
+	run := &Run{
+		Id:       hc.newID(),
+		Config:   config,
+		DAQ:      daq,
+		state:    RunStateNew,
+		Started:  time.Now(),
+		Channels: daq.Channels(),
+		hc:       hc,
+		messages: make(chan *RecvEnvelope, frameBuffer),
+		data:     make(chan Frame, frameBuffer),
+		done:     make(chan struct{}),
+	}
+
+	// register before sending, the firmware may report before it answers
+	if err := hc.attachRun(run); err != nil {
+		return nil, err
+	}
+
+	sent := hc.NewEnvelope("start_run")
+	sent.Msg = map[string]interface{}{
+		"id":         run.Id,
+		"session":    nil,
+		"config":     config,
+		"daq_config": daq,
+	}
+	_, err := answered(run.await(hc.Go(sent, nil)))
+	if err != nil {
+		run.finish(err)
+		return nil, err
+	}
+	return run, nil
+}
+
+// attachRun routes the messages of runs to run. As the LUCIDAC runs one
+// run at a time, and run_data may well come without the id of its run, it
+// fails while another run is not finished.
+func (hc *HybridController) attachRun(run *Run) error {
+	hc.oobMu.Lock()
+	defer hc.oobMu.Unlock()
+	if hc.run != nil {
+		return fmt.Errorf("%w: run %s is not finished", ErrRunActive, hc.run.Id)
+	}
+	if hc.oob == nil {
+		hc.oob = make(map[string]func(*RecvEnvelope))
+	}
+	hc.run = run
+	hc.oob["run_data"] = run.enqueue
+	hc.oob["run_state_change"] = run.enqueue
+	return nil
+}
+
+// detachRun stops routing the messages of runs to run, if they are.
+func (hc *HybridController) detachRun(run *Run) {
+	hc.oobMu.Lock()
+	defer hc.oobMu.Unlock()
+	if hc.run != run {
+		return
+	}
+	hc.run = nil
+	delete(hc.oob, "run_data")
+	delete(hc.oob, "run_state_change")
+}
+
+// Data returns a channel of the sample frames as they arrive during OP.
+// The channel is closed when the run is finished, check [Run.Err] afterwards.
+//
+// The messages of the run are handled while the channel is consumed. Up to
+// a buffer of them, the connection is read on meanwhile; beyond, further
+// commands are answered only as the channel is consumed, unless the
+// Backpressure policy drops frames.
+func (run *Run) Data() <-chan Frame {
+	run.receiver.Do(func() {
+		if run.source != nil {
+			go run.source()
+		} else {
+			go run.receive()
+		}
+	})
+	return run.data
+}
+
+// Stop asks the LUCIDAC to halt the run early with stop_run, such as a run
+// which would only halt on the external trigger. Data still arrives until
+// the firmware reports the run finished, which closes the data channel as
+// usual. Stop may be called while Data is read, and once the run is
+// finished, which does nothing.
+func (run *Run) Stop() error {
+	run.stopped.Store(true)
+	if run.source != nil {
+		return nil // simulated runs check stopped
+	}
+	select {
+	case <-run.done:
+		return nil
+	default:
+	}
+	sent := run.hc.NewEnvelope("stop_run")
+	sent.Msg = map[string]interface{}{"id": run.Id}
+	call := <-run.hc.Go(sent, nil).Done
+	_, err := answered(call.Res, call.Err)
+	return err
+}
+
+// Samples returns a channel of the samples one by one, for consumers not
+// interested in how the firmware framed them. It consumes Data, only one of
+// both may be read.
+func (run *Run) Samples() <-chan DAQSample {
+	samples := make(chan DAQSample, frameBuffer)
+	go func() {
+		defer close(samples)
+		for frame := range run.Data() {
+			for i, values := range frame.Samples {
+				samples <- DAQSample{Index: frame.Offset + i, Time: frame.Time(i), Values: values}
+			}
+		}
+	}()
+	return samples
+}
+
+// Err returns the reason why the run stopped early, if any. It is only
+// meaningful once the data channel is closed.
+func (run *Run) Err() error {
+	return run.err
+}
+
+// Integrity returns the gaps and duplicates detected in the data of the
+// run. Like Err, it is only meaningful once the data channel is closed.
+func (run *Run) Integrity() Integrity {
+	return run.integrity
+}
+
+// enqueue passes a message of the run from the reader of the connection
+// to the goroutine handling them, see receive.
+func (run *Run) enqueue(envelope *RecvEnvelope) {
+	envelope.raw = bytes.Clone(envelope.raw) // the buffer is reused for the next line
+	select {
+	case run.messages <- envelope:
+	case <-run.done:
+	}
+}
+
+func (run *Run) handle(envelope *RecvEnvelope) {
+	switch envelope.Type {
+	case "run_data":
+		run.onData(envelope)
+	case "run_state_change":
+		run.onStateChange(envelope)
+	}
+}
+
+// receive handles the messages of the run until it is finished, and
+// reattaches if the connection is lost before.
+func (run *Run) receive() {
+	lost, cause := run.hc.lost()
+	for !run.finished {
+		if len(run.held) != 0 {
+			run.handle(run.next())
+			continue
+		}
+		select {
+		case envelope := <-run.messages:
+			run.handle(envelope)
+		case <-lost:
+			if len(run.messages) != 0 {
+				continue // received before the connection was lost
+			}
+			if err := run.reattach(cause()); err != nil {
+				run.finish(err)
+				return
+			}
+			lost, cause = run.hc.lost()
+		}
+	}
+}
+
+// await waits for the answer to a command given for the run, handling the
+// messages of the run meanwhile.
+func (run *Run) await(call *Call) (*RecvEnvelope, error) {
+	for {
+		select {
+		case envelope := <-run.messages:
+			select {
+			case <-call.Done:
+				// possibly received after the answer, such as before
+				// StartRun returned and handlers were set
+				run.held = append(run.held, envelope)
+				return call.Res, call.Err
+			default:
+			}
+			run.handle(envelope)
+		case <-call.Done:
+			return call.Res, call.Err
+		}
+	}
+}
+
+// next takes the next message of the run which is already received.
+func (run *Run) next() *RecvEnvelope {
+	if len(run.held) != 0 {
+		envelope := run.held[0]
+		run.held = run.held[1:]
+		return envelope
+	}
+	return <-run.messages
+}
+
+func (run *Run) onData(envelope *RecvEnvelope) {
+	msg, frame, err := decodeRunData(envelope, run.Channels, &run.packed)
+	if msg.Id != run.Id && msg.Id != uuid.Nil {
+		return // belongs to some other run
+	}
+	if err != nil {
+		run.hc.logger(LayerProtocol).Error("Run: Dropping run_data", "err", err)
+		return
+	}
+	run.Channels = frame.Channels // if taken from the data
+	if msg.Partial && len(frame.Samples) == 0 {
+		return // completed by the next message
+	}
+	if msg.Offset != nil && !run.checkSequence(*msg.Offset, &frame) {
+		return
+	}
+	frame.Offset = run.samples
+	frame.Start = run.DAQ.SampleTime(run.samples)
+	frame.Interval = run.DAQ.SampleTime(1)
+	run.samples += len(frame.Samples)
+	run.deliver(frame)
+}
+
+// checkSequence compares the offset the device reports for the frame with
+// the samples received so far. Lost samples are recorded as gap, repeated
+// ones are cut from the frame. It returns false if nothing new remains.
+func (run *Run) checkSequence(offset int, frame *Frame) bool {
+	switch {
+	case offset > run.samples:
+		gap := Gap{Offset: offset, Missing: offset - run.samples}
+		run.hc.logger(LayerProtocol).Warn("Run lost samples", "run", run.Id, "missing", gap.Missing, "before", gap.Offset)
+		run.integrity.Gaps = append(run.integrity.Gaps, gap)
+		frame.Gap = gap.Missing
+		run.samples = offset
+	case offset < run.samples:
+		repeated := min(run.samples-offset, len(frame.Samples))
+		run.hc.logger(LayerProtocol).Warn("Run received samples twice", "run", run.Id, "repeated", repeated, "at", offset)
+		run.integrity.Duplicates += repeated
+		frame.Samples = frame.Samples[repeated:]
+	}
+	return len(frame.Samples) != 0
+}
+
+// deliver passes the frame to the consumer according to the backpressure policy.
+func (run *Run) deliver(frame Frame) {
+	switch run.Backpressure {
+	case "", BackpressureBlock:
+		run.data <- frame
+		return
+	}
+	select {
+	case run.data <- frame:
+		return
+	default:
+	}
+	switch run.Backpressure {
+	case BackpressureDropOldest:
+		select {
+		case oldest := <-run.data:
+			run.drop(oldest)
+		default: // consumer caught up meanwhile
+		}
+		run.data <- frame // cannot block, as only this goroutine sends
+	case BackpressureDropNewest:
+		run.drop(frame)
+	case BackpressureAbort:
+		run.drop(frame)
+		run.finish(fmt.Errorf("run %s: %w after %d samples", run.Id, ErrBackpressure, frame.Offset))
+	}
+}
+
+func (run *Run) drop(frame Frame) {
+	frames := run.dropped.frames.Add(1)
+	run.dropped.samples.Add(int64(len(frame.Samples)))
+	if frames == 1 {
+		run.hc.logger(LayerProtocol).Warn("Run consumer too slow, dropping frames", "run", run.Id, "backpressure", run.Backpressure)
+	}
+}
+
+// Dropped returns the number of frames and samples discarded so far due
+// to the backpressure policy. It may be called while reading Data.
+func (run *Run) Dropped() (frames, samples int64) {
+	return run.dropped.frames.Load(), run.dropped.samples.Load()
+}
+
+func (run *Run) onStateChange(envelope *RecvEnvelope) {
+	var msg runStateChangeMsg
+	if err := envelope.DecodeMsg(&msg); err != nil {
+		run.hc.logger(LayerProtocol).Error("Run: Cannot decode run_state_change", "err", err)
+		return
+	}
+	if msg.Id != run.Id {
+		return
+	}
+	run.hc.logger(LayerProtocol).Info("Run changed state", "run", run.Id, "old", msg.Old, "new", msg.New)
+	run.setState(msg.New)
+}
+
+// State returns the state of the run as last reported by the LUCIDAC. It
+// may be called while reading Data.
+func (run *Run) State() RunState {
+	run.stateMu.Lock()
+	defer run.stateMu.Unlock()
+	return run.state
+}
+
+func (run *Run) setState(state RunState) {
+	run.changeState(state)
+	if state == RunStateError {
+		run.finish(fmt.Errorf("run %s ended in state %s", run.Id, state))
+	} else if state.IsFinal() {
+		run.finish(nil)
+	}
+}
+
+// changeState records the state and calls OnStateChange.
+func (run *Run) changeState(state RunState) {
+	run.stateMu.Lock()
+	run.state = state
+	run.stateMu.Unlock()
+	if run.OnStateChange != nil {
+		run.OnStateChange(run)
+	}
+}
+
+// finish stops routing messages to the run and closes the data channel.
+func (run *Run) finish(err error) {
+	if run.finished {
+		return
+	}
+	run.finished = true
+	run.err = err
+	run.hc.detachRun(run)
+	close(run.data)
+	close(run.done)
+}
@@ -0,0 +1,395 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pipeStream struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+// Close closes both ends, as closing a connection does, such that reading
+// ends.
+func (s pipeStream) Close() error {
+	s.PipeWriter.Close()
+	return s.PipeReader.Close()
+}
+
+// pipeEndpoint is a fake device served by serve, which is called for each
+// envelope sent and writes the device answer lines. Closing w drops the
+// connection.
+type pipeEndpoint struct {
+	serve func(sent SendEnvelope, w io.WriteCloser)
+}
+
+func (e pipeEndpoint) IsValid() bool { return true }
+func (e pipeEndpoint) ToURL() string { return "pipe://" }
+
+func (e pipeEndpoint) Open() (io.ReadWriter, error) {
+	toDevice, fromClient := io.Pipe()
+	fromDevice, toClient := io.Pipe()
+	go func() {
+		requests := bufio.NewScanner(toDevice)
+		for requests.Scan() {
+			var sent SendEnvelope
+			json.Unmarshal(requests.Bytes(), &sent)
+			e.serve(sent, toClient)
+		}
+		toClient.Close()
+	}()
+	return pipeStream{fromDevice, fromClient}, nil
+}
+
+// newPipeController returns a HybridController talking to serve, see pipeEndpoint.
+func newPipeController(serve func(sent SendEnvelope, w io.Writer)) *HybridController {
+	return newPipeEndpointController(pipeEndpoint{func(sent SendEnvelope, w io.WriteCloser) { serve(sent, w) }})
+}
+
+func newPipeEndpointController(endpoint pipeEndpoint) *HybridController {
+	stream, _ := endpoint.Open()
+	return &HybridController{Endpoint: endpoint, Stream: stream, Reader: NewLineReader(stream)}
+}
+
+var testRunConfig = RunConfig{IcTime: 100000, OpTime: 1000000}
+
+// serveRun answers start_run and then streams the given raw data matrices
+// as run_data messages before the run is DONE.
+func serveRun(data ...string) func(sent SendEnvelope, w io.Writer) {
+	return func(sent SendEnvelope, w io.Writer) {
+		runId := sent.Msg.(map[string]interface{})["id"]
+		fmt.Fprintf(w, `{"type":"start_run","id":"%s","code":0,"msg":{}}`+"\n", sent.Id)
+		for _, d := range data {
+			fmt.Fprintf(w, `{"type":"run_data","msg":{"id":"%s","entity":["00"],"data":%s}}`+"\n", runId, d)
+		}
+		fmt.Fprintf(w, `{"type":"run_state_change","msg":{"id":"%s","old":"OP","new":"DONE"}}`+"\n", runId)
+	}
+}
+
+func TestRun_Data(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		runId := sent.Msg.(map[string]interface{})["id"]
+		fmt.Fprintf(w, `{"type":"start_run","id":"%s","code":0,"msg":{}}`+"\n", sent.Id)
+		fmt.Fprintf(w, `{"type":"run_state_change","msg":{"id":"%s","old":"NEW","new":"OP"}}`+"\n", runId)
+		fmt.Fprintf(w, "some logging noise\n")
+		fmt.Fprintf(w, `{"type":"run_data","msg":{"id":"%s","entity":["00"],"data":[[3277,-3277],[0,32768]]}}`+"\n", runId)
+		fmt.Fprintf(w, `{"type":"run_data","msg":{"id":"%s","entity":["00"],"data":[[100,200]]}}`+"\n", runId)
+		fmt.Fprintf(w, `{"type":"run_state_change","msg":{"id":"%s","old":"OP","new":"DONE"}}`+"\n", runId)
+	})
+
+	run, err := hc.StartRun(RunConfig{IcTime: 100000, OpTime: 200000}, DAQConfig{NumChannels: 2, SampleOp: true, SampleRate: 1000})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+
+	samples := 0
+	for frame := range run.Data() {
+		samples += len(frame.Samples)
+	}
+	if run.Err() != nil {
+		t.Fatalf("Run finished with error: %v", run.Err())
+	}
+	if run.State() != RunStateDone {
+		t.Fatalf("expected run state %s, got %s", RunStateDone, run.State())
+	}
+	if samples != 3 {
+		t.Fatalf("expected 3 samples, got %d", samples)
+	}
+}
+
+func TestRun_Stop(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		runId := sent.Msg.(map[string]interface{})["id"]
+		fmt.Fprintf(w, `{"type":"%s","id":"%s","code":0,"msg":{}}`+"\n", sent.Type, sent.Id)
+		switch sent.Type {
+		case "start_run":
+			fmt.Fprintf(w, `{"type":"run_state_change","msg":{"id":"%s","old":"IC","new":"OP"}}`+"\n", runId)
+			fmt.Fprintf(w, `{"type":"run_data","msg":{"id":"%s","entity":["00"],"data":[[100]]}}`+"\n", runId)
+		case "stop_run":
+			fmt.Fprintf(w, `{"type":"run_data","msg":{"id":"%s","entity":["00"],"data":[[200]]}}`+"\n", runId)
+			fmt.Fprintf(w, `{"type":"run_state_change","msg":{"id":"%s","old":"OP","new":"DONE"}}`+"\n", runId)
+		}
+	})
+	run, err := hc.StartRun(RunConfig{IcTime: 100000, HaltOnExternalTrigger: true}, DAQConfig{NumChannels: 1, SampleOp: true, SampleRate: 1000})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	samples := 0
+	for range run.Data() {
+		if samples++; samples == 1 {
+			if err := run.Stop(); err != nil {
+				t.Fatalf("Stop: %v", err)
+			}
+		}
+	}
+	if run.Err() != nil || run.State() != RunStateDone || samples != 2 {
+		t.Fatalf("expected the run DONE with the data until stopped, got %s, %v, %d samples", run.State(), run.Err(), samples)
+	}
+	if err := run.Stop(); err != nil {
+		t.Fatalf("expected Stop to do nothing once finished, got %v", err)
+	}
+}
+
+func TestRun_Active(t *testing.T) {
+	hc := newPipeController(serveRun("[[100]]"))
+	daq := DAQConfig{NumChannels: 1, SampleOp: true, SampleRate: 1000}
+	run, err := hc.StartRun(testRunConfig, daq)
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	if _, err := hc.StartRun(testRunConfig, daq); !errors.Is(err, ErrRunActive) {
+		t.Fatalf("expected a second run to be refused, got %v", err)
+	}
+	for range run.Data() {
+	}
+	if run.Err() != nil || run.State() != RunStateDone {
+		t.Fatalf("expected the first run DONE, got %s, %v", run.State(), run.Err())
+	}
+	run, err = hc.StartRun(testRunConfig, daq)
+	if err != nil {
+		t.Fatalf("expected a run once the first is finished, got %v", err)
+	}
+	for range run.Data() {
+	}
+	if run.Err() != nil || run.State() != RunStateDone {
+		t.Fatalf("expected the second run DONE, got %s, %v", run.State(), run.Err())
+	}
+}
+
+func TestRun_Samples(t *testing.T) {
+	raw, _ := base64.StdEncoding.DecodeString(string(packFrame(1, 2, 3, 4, 5, 6)))
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		runId := sent.Msg.(map[string]interface{})["id"]
+		fmt.Fprintf(w, `{"type":"start_run","id":"%s","code":0,"msg":{}}`+"\n", sent.Id)
+		for i, chunk := range [][]byte{raw[:3], raw[3:]} {
+			fmt.Fprintf(w, `{"type":"run_data","msg":{"id":"%s","entity":["00"],"data":"%s","partial":%v}}`+"\n", runId, base64.StdEncoding.EncodeToString(chunk), i == 0)
+		}
+		fmt.Fprintf(w, `{"type":"run_state_change","msg":{"id":"%s","old":"OP","new":"DONE"}}`+"\n", runId)
+	})
+	run, err := hc.StartRun(testRunConfig, DAQConfig{NumChannels: 2, SampleOp: true, SampleRate: 1000})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	var samples []DAQSample
+	for sample := range run.Samples() {
+		samples = append(samples, sample)
+	}
+	if run.Err() != nil || len(samples) != 3 {
+		t.Fatalf("expected 3 samples, got %d: %v", len(samples), run.Err())
+	}
+	last := samples[2]
+	if last.Index != 2 || last.Time != 0.002 || math.Round(last.Values[1]/DefaultGain) != 6 {
+		t.Fatalf("unexpected last sample %+v", last)
+	}
+}
+
+func TestRun_Backpressure(t *testing.T) {
+	const frames = frameBuffer + 10
+	data := make([]string, frames)
+	for i := range data {
+		data[i] = "[[1]]"
+	}
+	for _, tc := range []struct {
+		policy        Backpressure
+		dropped       int64
+		first, frames int
+	}{
+		{BackpressureDropNewest, 10, 0, frameBuffer},
+		{BackpressureDropOldest, 10, 10, frameBuffer},
+		{BackpressureAbort, 1, 0, frameBuffer},
+	} {
+		hc := newPipeController(serveRun(data...))
+		run, err := hc.StartRun(testRunConfig, DAQConfig{NumChannels: 1, SampleRate: 1})
+		if err != nil {
+			t.Fatalf("StartRun: %v", err)
+		}
+		run.Backpressure = tc.policy
+		ch := run.Data()
+
+		// let the receiver overrun the consumer, which did not read yet
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if dropped, _ := run.Dropped(); dropped >= tc.dropped {
+				break
+			}
+		}
+		received := []Frame{}
+		for frame := range ch {
+			received = append(received, frame)
+		}
+
+		if dropped, samples := run.Dropped(); dropped != tc.dropped || samples != tc.dropped {
+			t.Fatalf("%s: expected %d dropped frames and samples, got %d, %d", tc.policy, tc.dropped, dropped, samples)
+		}
+		if len(received) != tc.frames || received[0].Offset != tc.first {
+			t.Fatalf("%s: expected %d frames from offset %d, got %d from %d", tc.policy, tc.frames, tc.first, len(received), received[0].Offset)
+		}
+		if tc.policy == BackpressureAbort && !errors.Is(run.Err(), ErrBackpressure) {
+			t.Fatalf("%s: expected ErrBackpressure, got %v", tc.policy, run.Err())
+		} else if tc.policy != BackpressureAbort && run.Err() != nil {
+			t.Fatalf("%s: unexpected error %v", tc.policy, run.Err())
+		}
+	}
+}
+
+func TestRun_Integrity(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		runId := sent.Msg.(map[string]interface{})["id"]
+		fmt.Fprintf(w, `{"type":"start_run","id":"%s","code":0,"msg":{}}`+"\n", sent.Id)
+		for _, frame := range []struct {
+			offset int
+			data   string
+		}{{0, "[[1],[2]]"}, {4, "[[5]]"}, {4, "[[5]]"}, {4, "[[5],[6]]"}} {
+			fmt.Fprintf(w, `{"type":"run_data","msg":{"id":"%s","offset":%d,"data":%s}}`+"\n", runId, frame.offset, frame.data)
+		}
+		fmt.Fprintf(w, `{"type":"run_state_change","msg":{"id":"%s","old":"OP","new":"DONE"}}`+"\n", runId)
+	})
+
+	run, err := hc.StartRun(testRunConfig, DAQConfig{NumChannels: 1, SampleRate: 1})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	var out bytes.Buffer
+	if err := run.Capture(NewCSVSink(&out)); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+
+	integrity := run.Integrity()
+	if integrity.OK() || len(integrity.Gaps) != 1 || integrity.Gaps[0] != (Gap{Offset: 4, Missing: 2}) || integrity.Duplicates != 2 {
+		t.Fatalf("expected a gap of 2 samples at 4 and 2 duplicates, got %+v", integrity)
+	}
+	if !strings.Contains(out.String(), "# gap: 2 samples missing before sample 4\n") {
+		t.Fatalf("CSV output lacks the gap:\n%s", out.String())
+	}
+	// the repeated sample is cut, the new one kept
+	times := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			times = append(times, strings.Split(line, ",")[0])
+		}
+	}
+	if strings.Join(times, " ") != "time 0 1 4 5" {
+		t.Fatalf("unexpected CSV output:\n%s", out.String())
+	}
+}
+
+func TestRun_reattach(t *testing.T) {
+	reattachBackoff = time.Millisecond
+	hc := newPipeEndpointController(pipeEndpoint{func(sent SendEnvelope, w io.WriteCloser) {
+		runId := sent.Msg.(map[string]interface{})["id"]
+		switch sent.Type {
+		case "start_run":
+			fmt.Fprintf(w, `{"type":"start_run","id":"%s","code":0,"msg":{}}`+"\n", sent.Id)
+			fmt.Fprintf(w, `{"type":"run_data","msg":{"id":"%s","offset":0,"data":[[1],[2]]}}`+"\n", runId)
+			w.Close()
+		case "attach_run":
+			fmt.Fprintf(w, `{"type":"run_data","msg":{"id":"%s","offset":0,"data":[[1],[2],[3]]}}`+"\n", runId)
+			fmt.Fprintf(w, `{"type":"attach_run","id":"%s","code":0,"msg":{"state":"DONE"}}`+"\n", sent.Id)
+		}
+	}})
+
+	run, err := hc.StartRun(testRunConfig, DAQConfig{NumChannels: 1, SampleRate: 1})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	run.Reattach = 2
+	samples := 0
+	for frame := range run.Data() {
+		samples += len(frame.Samples)
+	}
+	if run.Err() != nil {
+		t.Fatalf("Run finished with error: %v", run.Err())
+	}
+	if samples != 3 || run.State() != RunStateDone {
+		t.Fatalf("expected 3 samples in state DONE, got %d in %s", samples, run.State())
+	}
+	if integrity := run.Integrity(); integrity.Reattached != 1 || integrity.Duplicates != 2 {
+		t.Fatalf("expected 1 reattachment and 2 duplicates, got %+v", integrity)
+	}
+
+	// without reattaching, the lost connection is an error
+	run, _ = hc.StartRun(testRunConfig, DAQConfig{NumChannels: 1, SampleRate: 1})
+	for range run.Data() {
+	}
+	if run.Err() == nil {
+		t.Fatalf("expected an error for the dropped connection")
+	}
+}
+
+func TestRun_Data_error_state(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		runId := sent.Msg.(map[string]interface{})["id"]
+		fmt.Fprintf(w, `{"type":"start_run","code":0,"msg":{}}`+"\n")
+		fmt.Fprintf(w, `{"type":"run_state_change","msg":{"id":"%s","old":"IC","new":"ERROR"}}`+"\n", runId)
+	})
+
+	run, err := hc.StartRun(testRunConfig, DAQConfig{})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	for range run.Data() {
+	}
+	if run.Err() == nil {
+		t.Fatalf("expected an error for a run ending in state ERROR")
+	}
+}
+
+func TestRepeatRun(t *testing.T) {
+	repetition := 0
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		repetition++
+		serveRun(fmt.Sprintf("[[%d],[%d]]", repetition*8192, -repetition*8192))(sent, w)
+	})
+
+	agg, err := hc.RepeatRun(RunConfig{OpTime: 1000, Repetitions: 3}, DAQConfig{NumChannels: 1, SampleRate: 1})
+	if err != nil {
+		t.Fatalf("RepeatRun: %v", err)
+	}
+	if len(agg.Runs) != 3 || len(agg.Mean) != 2 {
+		t.Fatalf("expected 3 runs of 2 samples, got %d runs, %d samples", len(agg.Runs), len(agg.Mean))
+	}
+	// the runs yield 0.3125, 0.625, 0.9375 and their negatives
+	if agg.Mean[0][0] != 0.625 || agg.Mean[1][0] != -0.625 || agg.StdDev[0][0] != 0.3125 {
+		t.Fatalf("unexpected statistics, mean %v, stddev %v", agg.Mean, agg.StdDev)
+	}
+
+	frame := agg.Frame()
+	if len(frame.Channels) != 2 || frame.Channels[1].Name != "ch0_stddev" || frame.Samples[1][1] != 0.3125 {
+		t.Fatalf("unexpected aggregate frame %+v", frame)
+	}
+}
+
+func TestRunConfig_Validate(t *testing.T) {
+	valid := []RunConfig{
+		testRunConfig,
+		{OpTime: 0, HaltOnExternalTrigger: true},
+		{OpTime: 1000, WaitForExternalTrigger: true, HaltOnOverload: true},
+	}
+	for i, config := range valid {
+		if err := config.Validate(); err != nil {
+			t.Fatalf("valid config %d %+v rejected: %v", i, config, err)
+		}
+	}
+	invalid := []RunConfig{
+		{},
+		{OpTime: 1000, Repetitions: -1},
+	}
+	for i, config := range invalid {
+		if err := config.Validate(); err == nil {
+			t.Fatalf("invalid config %d %+v accepted", i, config)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Bucket is a bucket of S3-compatible object storage, such as AWS S3,
+// MinIO or Ceph, which run data files are uploaded to. Requests are signed
+// with AWS Signature Version 4 and address the bucket path-style, as all
+// S3-compatible storages understand it:
+//
+//	bucket := lucigo.NewS3BucketFromEnv("measurements")
+//	err := bucket.PutFile("lucidac/2024-06-10/run.csv", "run.csv")
+type S3Bucket struct {
+	Endpoint string // URL of the storage, defaults to AWS S3 in Region
+	Bucket   string
+	Region   string // defaults to us-east-1, which MinIO accepts by default
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // of temporary credentials, optional
+
+	Retries    int           // attempts after a failed one, such as by a network error or 5xx status
+	RetryDelay time.Duration // before the first retry, doubled for each further, defaults to a second
+	Client     *http.Client  // defaults to http.DefaultClient
+}
+
+// NewS3BucketFromEnv creates an S3Bucket configured by the environment
+// variables of the AWS command line interface: AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION (or
+// AWS_DEFAULT_REGION) and AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL), the
+// latter pointing to an S3-compatible storage such as http://minio:9000.
+func NewS3BucketFromEnv(bucket string) *S3Bucket {
+	env := func(names ...string) string {
+		for _, name := range names {
+			if value := os.Getenv(name); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	return &S3Bucket{
+		Endpoint:     env("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+		Bucket:       bucket,
+		Region:       env("AWS_REGION", "AWS_DEFAULT_REGION"),
+		AccessKey:    env("AWS_ACCESS_KEY_ID"),
+		SecretKey:    env("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: env("AWS_SESSION_TOKEN"),
+	}
+}
+
+// ParseS3URL splits an URL such as s3://bucket/prefix/run.csv into bucket
+// and key.
+func ParseS3URL(s string) (bucket, key string, err error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("need to provide an URL such as s3://bucket/key. Given was '%s'", s)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// PutFile uploads the file at path as object key.
+func (b *S3Bucket) PutFile(key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return b.Put(key, f, "")
+}
+
+// Put uploads the content of body as object key. The body is read twice,
+// for signing and for sending, and once more on every retry. Objects are
+// uploaded in a single request, which S3 limits to 5 GB.
+func (b *S3Bucket) Put(key string, body io.ReadSeeker, contentType string) error {
+	hash := sha256.New()
+	size, err := io.Copy(hash, body)
+	if err != nil {
+		return err
+	}
+	payloadHash := hex.EncodeToString(hash.Sum(nil))
+
+	delay := b.RetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	for attempt := 0; ; attempt++ {
+		if _, err = body.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		var retry bool
+		retry, err = b.put(key, io.NopCloser(body), size, payloadHash, contentType)
+		if err == nil || !retry || attempt >= b.Retries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// put sends a single PUT request and tells whether a failure is worth a retry.
+func (b *S3Bucket) put(key string, body io.ReadCloser, size int64, payloadHash, contentType string) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPut, b.objectURL(key), body)
+	if err != nil {
+		return false, err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	b.sign(req, payloadHash, time.Now())
+
+	client := b.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		// S3 explains failures in an XML document, which is short
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		err = fmt.Errorf("uploading %s to bucket %s: %s %s", key, b.Bucket, res.Status, bytes.TrimSpace(msg))
+		return res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests, err
+	}
+	return false, nil
+}
+
+func (b *S3Bucket) region() string {
+	if b.Region == "" {
+		return "us-east-1"
+	}
+	return b.Region
+}
+
+func (b *S3Bucket) objectURL(key string) string {
+	endpoint := b.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + b.region() + ".amazonaws.com"
+	}
+	return strings.TrimSuffix(endpoint, "/") + "/" + s3Escape(b.Bucket) + "/" + s3Escape(key)
+}
+
+// s3Escape escapes as required for the canonical URI of Signature Version
+// 4: All but the unreserved characters of RFC 3986 and slashes.
+func s3Escape(s string) string {
+	var buf strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+// sign adds the headers of AWS Signature Version 4 to req, signing the
+// host and all headers set on req.
+func (b *S3Bucket) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if b.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := now.Format("20060102") + "/" + b.region() + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + b.SecretKey)
+	for _, part := range []string{now.Format("20060102"), b.region(), "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x",
+		b.AccessKey, scope, signedHeaders, key))
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+)
+
+// Schemas of the settings of firmware which does not describe them itself,
+// one <fw_build>.json per firmware, and default.json for all others.
+//
+//go:embed settings_schema/*.json
+var embeddedSchemas embed.FS
+
+// SettingsSchema describes the permanent settings of a device, as read
+// with net_get and written with net_set.
+type SettingsSchema struct {
+	Firmware string          `json:"firmware"` // fw_build described, "" if any
+	Settings []SettingSchema `json:"settings"`
+}
+
+// SettingSchema describes a single permanent setting.
+type SettingSchema struct {
+	Key       string      `json:"key"`  // flattened, such as "ipv4.dhcp_enabled"
+	Type      string      `json:"type"` // bool, int, float, string, ipv4 or mac
+	Min       *float64    `json:"min,omitempty"`
+	Max       *float64    `json:"max,omitempty"`
+	MaxLength int         `json:"max_length,omitempty"` // of strings
+	Enum      []string    `json:"enum,omitempty"`       // allowed values, if restricted
+	Default   interface{} `json:"default,omitempty"`
+	ReadOnly  bool        `json:"readonly,omitempty"`
+	Doc       string      `json:"doc"`
+}
+
+// SettingsSchema asks the device to describe its settings with
+// net_schema. Firmware which cannot is described by the schema embedded
+// in lucigo for its fw_build, or by a generic one.
+func (hc *HybridController) SettingsSchema() (*SettingsSchema, error) {
+	res, err := hc.Query("net_schema")
+	var refused *DeviceError
+	if err != nil && !errors.As(err, &refused) {
+		return nil, err
+	}
+	if err == nil {
+		schema := &SettingsSchema{}
+		if err := res.DecodeMsg(schema); err != nil {
+			return nil, fmt.Errorf("cannot decode answer to net_schema: %w", err)
+		}
+		return schema, nil
+	}
+	build := ""
+	if ident, err := hc.SysIdent(); err == nil {
+		build = ident.FwBuild
+	}
+	return EmbeddedSettingsSchema(build)
+}
+
+// EmbeddedSettingsSchema returns the schema embedded in lucigo for the
+// firmware build, or the generic one.
+func EmbeddedSettingsSchema(build string) (*SettingsSchema, error) {
+	raw, err := embeddedSchemas.ReadFile(path.Join("settings_schema", unsafeFileName.ReplaceAllString(build, "_")+".json"))
+	if build == "" || err != nil {
+		raw, err = embeddedSchemas.ReadFile("settings_schema/default.json")
+	}
+	if err != nil {
+		return nil, err
+	}
+	schema := &SettingsSchema{}
+	if err := json.Unmarshal(raw, schema); err != nil {
+		return nil, fmt.Errorf("invalid embedded settings schema: %w", err)
+	}
+	return schema, nil
+}
+
+// Lookup finds the setting of the given key. As with lucigo net-set, the
+// key may be given without its section, such as dhcp_enabled for
+// ipv4.dhcp_enabled, if that is unambiguous.
+func (s *SettingsSchema) Lookup(key string) (SettingSchema, bool) {
+	var found []SettingSchema
+	for _, setting := range s.Settings {
+		if setting.Key == key {
+			return setting, true
+		}
+		if strings.HasSuffix(setting.Key, "."+key) {
+			found = append(found, setting)
+		}
+	}
+	if len(found) != 1 {
+		return SettingSchema{}, false
+	}
+	return found[0], true
+}
+
+// Range describes the values allowed, such as "1..65535" or "one of a, b",
+// "" if any value of the type is.
+func (s SettingSchema) Range() string {
+	switch {
+	case len(s.Enum) != 0:
+		return "one of " + strings.Join(s.Enum, ", ")
+	case s.Min != nil && s.Max != nil:
+		return fmt.Sprintf("%g..%g", *s.Min, *s.Max)
+	case s.Min != nil:
+		return fmt.Sprintf(">= %g", *s.Min)
+	case s.Max != nil:
+		return fmt.Sprintf("<= %g", *s.Max)
+	case s.MaxLength != 0:
+		return fmt.Sprintf("up to %d characters", s.MaxLength)
+	}
+	return ""
+}
+
+// Check tells why the value is not allowed for the setting, nil if it is.
+// Values are as decoded from JSON.
+func (s SettingSchema) Check(value interface{}) error {
+	if s.ReadOnly {
+		return fmt.Errorf("%s is read-only", s.Key)
+	}
+	switch s.Type {
+	case "bool":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be true or false, got %v", s.Key, value)
+		}
+	case "int", "float":
+		number, ok := value.(float64)
+		if !ok || (s.Type == "int" && number != float64(int64(number))) {
+			return fmt.Errorf("%s must be %s number, got %v", s.Key, map[string]string{"int": "an integer", "float": "a"}[s.Type], value)
+		}
+		if (s.Min != nil && number < *s.Min) || (s.Max != nil && number > *s.Max) {
+			return fmt.Errorf("%s must be %s, got %v", s.Key, s.Range(), value)
+		}
+	default: // strings
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string, got %v", s.Key, value)
+		}
+		if s.MaxLength != 0 && len(text) > s.MaxLength {
+			return fmt.Errorf("%s must be %s, got %d", s.Key, s.Range(), len(text))
+		}
+		if s.Type == "ipv4" && (net.ParseIP(text) == nil || net.ParseIP(text).To4() == nil) {
+			return fmt.Errorf("%s must be an IPv4 address, got %q", s.Key, text)
+		}
+		if s.Type == "mac" {
+			if _, err := net.ParseMAC(text); err != nil {
+				return fmt.Errorf("%s must be a MAC address, got %q", s.Key, text)
+			}
+		}
+	}
+	if len(s.Enum) != 0 {
+		for _, allowed := range s.Enum {
+			if fmt.Sprint(value) == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s must be %s, got %v", s.Key, s.Range(), value)
+	}
+	return nil
+}
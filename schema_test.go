@@ -0,0 +1,59 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestSettingsSchema(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		fmt.Fprintf(w, `{"type":"net_schema","id":"%s","code":0,"msg":{"firmware":"1.2","settings":[{"key":"jsonl.port","type":"int","min":1,"max":10,"doc":"Port"}]}}`+"\n", sent.Id)
+	})
+	schema, err := hc.SettingsSchema()
+	if err != nil || schema.Firmware != "1.2" || len(schema.Settings) != 1 {
+		t.Fatalf("expected the schema of the device, got %+v, %v", schema, err)
+	}
+	port, ok := schema.Lookup("port")
+	if !ok || port.Range() != "1..10" {
+		t.Fatalf("expected jsonl.port with range 1..10, got %+v", port)
+	}
+	if port.Check(5.0) != nil || port.Check(11.0) == nil || port.Check(1.5) == nil || port.Check("5") == nil {
+		t.Fatalf("expected only integers in 1..10 to pass")
+	}
+}
+
+func TestSettingsSchema_embedded(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		switch sent.Type {
+		case "sys_ident":
+			fmt.Fprintf(w, `{"type":"sys_ident","id":"%s","code":0,"msg":{"fw_build":"unknown build"}}`+"\n", sent.Id)
+		default:
+			fmt.Fprintf(w, `{"type":"%s","id":"%s","code":-1,"error":"unknown type"}`+"\n", sent.Type, sent.Id)
+		}
+	})
+	schema, err := hc.SettingsSchema()
+	if err != nil || len(schema.Settings) == 0 {
+		t.Fatalf("expected the embedded default schema, got %+v, %v", schema, err)
+	}
+	for _, key := range []string{"ipv4.dhcp_enabled", "dhcp_enabled", "mac"} {
+		if _, ok := schema.Lookup(key); !ok {
+			t.Fatalf("expected %s to be found", key)
+		}
+	}
+	if _, ok := schema.Lookup("enabled"); ok {
+		t.Fatalf("expected the ambiguous enabled not to be found")
+	}
+	mac, _ := schema.Lookup("mac")
+	if mac.Check("04:e9:e5:00:00:01") == nil {
+		t.Fatalf("expected the read-only mac to be refused")
+	}
+	gateway, _ := schema.Lookup("static_gateway")
+	if gateway.Check("192.168.1.1") != nil || gateway.Check("192.168.1") == nil {
+		t.Fatalf("expected only IPv4 addresses to pass")
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SCPIPort is the port of SCPI over raw TCP, as used by VISA
+// (TCPIP::host::5025::SOCKET).
+const SCPIPort = 5025
+
+// SCPIServer exposes a LUCIDAC as SCPI instrument over raw TCP, such that
+// lab automation based on VISA (pyvisa, LabVIEW, MATLAB) treats it like any
+// other instrument. It translates a minimal command set to the JSONL
+// protocol:
+//
+//	*IDN?                        anabrid,<fw_name>,<mac>,<fw_build>
+//	*RST                         reset the configuration and clear the data
+//	*CLS                         clear the error queue
+//	*OPC?                        1, as all commands complete before answering
+//	SYSTem:ERRor[:NEXT]?         next error of the queue, 0,"No error" without
+//	CONFigure:ICTime <s>         duration of IC, in seconds (or with unit, 100us)
+//	CONFigure:OPTime <s>         duration of OP
+//	CONFigure:CHANnels <n>       number of DAQ channels
+//	CONFigure:RATE <Hz>          DAQ sample rate
+//	CONFigure:HALT:OVERload ON   halt on overload, ON or OFF
+//	CONFigure:HALT:EXTernal ON   halt on the external trigger, ON or OFF
+//	INITiate                     run and keep the acquired data
+//	FETCh?                       data of the last run, comma separated, sample by sample
+//	FETCh:POINts?                number of samples of the last run
+//	READ?                        INITiate and FETCh?
+//	RUN:STATe?                   state of the last run, such as DONE
+//
+// All CONFigure commands can be queried by appending "?". Commands can be
+// given in short form (CONF:ICT) or long form, in any case, and several in a
+// line separated by ";". Failures are queued as SCPI errors, as usual
+// without an answer, and read with SYSTem:ERRor?.
+//
+// The configuration and data are those of the instrument and shared by all
+// connections, whose commands are executed one after the other.
+type SCPIServer struct {
+	Controller *HybridController
+
+	mu     sync.Mutex
+	config RunConfig
+	daq    DAQConfig
+	run    *Run
+	data   *Recording
+	errors []scpiError
+}
+
+type scpiError struct {
+	code    int
+	message string
+}
+
+// SCPI error codes, see chapter 21.8 of the SCPI standard
+const (
+	scpiSyntaxError      = -102
+	scpiUndefinedHeader  = -113
+	scpiExecutionError   = -200
+	scpiIllegalParameter = -224
+	scpiDataStale        = -230
+	scpiQueueOverflow    = -350
+)
+
+// Errors kept until read with SYSTem:ERRor?, more overflow the queue
+const scpiErrorQueueLength = 16
+
+// NewSCPIServer creates an SCPIServer with the defaults of lucigo run.
+func NewSCPIServer(hc *HybridController) *SCPIServer {
+	s := &SCPIServer{Controller: hc}
+	s.reset()
+	return s
+}
+
+func (s *SCPIServer) reset() {
+	s.config = RunConfig{IcTime: 100000, OpTime: 1000000, HaltOnOverload: true}
+	s.daq = DAQConfig{NumChannels: 1, SampleOp: true, SampleRate: 100000}
+	s.run, s.data = nil, nil
+}
+
+// Serve accepts connections on the listener and serves each. It returns
+// once the listener is closed.
+func (s *SCPIServer) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			s.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn serves the commands read from conn until it is closed.
+func (s *SCPIServer) ServeConn(conn io.ReadWriter) error {
+	lines := bufio.NewScanner(conn)
+	for lines.Scan() {
+		var answers []string
+		for _, command := range strings.Split(lines.Text(), ";") {
+			command = strings.TrimSpace(command)
+			if command == "" {
+				continue
+			}
+			if answer, ok := s.Execute(command); ok {
+				answers = append(answers, answer)
+			}
+		}
+		if len(answers) != 0 {
+			if _, err := io.WriteString(conn, strings.Join(answers, ";")+"\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return lines.Err()
+}
+
+// Execute executes a single command. Queries return their answer and true.
+func (s *SCPIServer) Execute(command string) (answer string, isQuery bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	header, arg, _ := strings.Cut(command, " ")
+	arg = strings.TrimSpace(arg)
+	isQuery = strings.HasSuffix(header, "?")
+	header = strings.TrimSuffix(header, "?")
+
+	answer, err := s.execute(header, arg, isQuery)
+	if err != nil {
+		s.pushError(*err)
+		if isQuery {
+			// an empty answer, such that clients do not wait for one in vain
+			return "", true
+		}
+	}
+	return answer, isQuery
+}
+
+func (s *SCPIServer) pushError(err scpiError) {
+	if len(s.errors) >= scpiErrorQueueLength {
+		s.errors[len(s.errors)-1] = scpiError{scpiQueueOverflow, "Queue overflow"}
+		return
+	}
+	s.errors = append(s.errors, err)
+}
+
+func (s *SCPIServer) execute(header, arg string, isQuery bool) (string, *scpiError) {
+	// the configuration, settable and queryable
+	switch {
+	case scpiMatch(header, "CONFigure:ICTime"):
+		return scpiDuration(&s.config.IcTime, arg, isQuery)
+	case scpiMatch(header, "CONFigure:OPTime"):
+		return scpiDuration(&s.config.OpTime, arg, isQuery)
+	case scpiMatch(header, "CONFigure:CHANnels"):
+		return scpiInt(&s.daq.NumChannels, 0, MaxChannels, arg, isQuery)
+	case scpiMatch(header, "CONFigure:RATE"):
+		return scpiInt(&s.daq.SampleRate, 1, 1<<31-1, arg, isQuery)
+	case scpiMatch(header, "CONFigure:HALT:OVERload"):
+		return scpiBool(&s.config.HaltOnOverload, arg, isQuery)
+	case scpiMatch(header, "CONFigure:HALT:EXTernal"):
+		return scpiBool(&s.config.HaltOnExternalTrigger, arg, isQuery)
+	}
+
+	if isQuery {
+		switch {
+		case strings.EqualFold(header, "*IDN"):
+			return s.identify()
+		case strings.EqualFold(header, "*OPC"):
+			return "1", nil
+		case scpiMatch(header, "SYSTem:ERRor") || scpiMatch(header, "SYSTem:ERRor:NEXT"):
+			if len(s.errors) == 0 {
+				return `0,"No error"`, nil
+			}
+			err := s.errors[0]
+			s.errors = s.errors[1:]
+			// strings quote quotes by doubling them
+			return fmt.Sprintf(`%d,"%s"`, err.code, strings.ReplaceAll(err.message, `"`, `""`)), nil
+		case scpiMatch(header, "FETCh"):
+			return s.fetch()
+		case scpiMatch(header, "FETCh:POINts"):
+			if s.data == nil {
+				return "0", nil
+			}
+			return strconv.Itoa(len(s.data.Samples)), nil
+		case scpiMatch(header, "READ"):
+			if err := s.initiate(); err != nil {
+				return "", err
+			}
+			return s.fetch()
+		case scpiMatch(header, "RUN:STATe"):
+			if s.run == nil {
+				return string(RunStateNew), nil
+			}
+			return string(s.run.State()), nil
+		}
+	} else {
+		switch {
+		case strings.EqualFold(header, "*RST"):
+			s.reset()
+			return "", nil
+		case strings.EqualFold(header, "*CLS"):
+			s.errors = nil
+			return "", nil
+		case scpiMatch(header, "INITiate"):
+			return "", s.initiate()
+		}
+	}
+	return "", &scpiError{scpiUndefinedHeader, "Undefined header " + header}
+}
+
+func (s *SCPIServer) identify() (string, *scpiError) {
+	res, err := s.Controller.Query("sys_ident")
+	if err != nil {
+		return "", &scpiError{scpiExecutionError, err.Error()}
+	}
+	field := func(key string) string {
+		if value, ok := res.Msg[key].(string); ok {
+			// the fields of *IDN? are separated by commas
+			return strings.ReplaceAll(value, ",", " ")
+		}
+		return "0"
+	}
+	return strings.Join([]string{"anabrid", field("fw_name"), field("mac"), field("fw_build")}, ","), nil
+}
+
+func (s *SCPIServer) initiate() *scpiError {
+	s.run, s.data = nil, nil
+	run, err := s.Controller.StartRun(s.config, s.daq)
+	if err != nil {
+		return &scpiError{scpiExecutionError, err.Error()}
+	}
+	s.run = run
+	data := &Recording{}
+	if err := run.Capture(data); err != nil {
+		return &scpiError{scpiExecutionError, err.Error()}
+	}
+	s.data = data
+	return nil
+}
+
+func (s *SCPIServer) fetch() (string, *scpiError) {
+	if s.data == nil {
+		return "", &scpiError{scpiDataStale, "No data, INITiate a run first"}
+	}
+	var buf []byte
+	for _, sample := range s.data.Samples {
+		for _, value := range sample {
+			if len(buf) != 0 {
+				buf = append(buf, ',')
+			}
+			buf = strconv.AppendFloat(buf, value, 'g', -1, 64)
+		}
+	}
+	return string(buf), nil
+}
+
+// scpiMatch tells whether the header matches the pattern, whose nodes are
+// given with the mandatory short form in upper case. Each node of the
+// header has to be either the short or the long form, in any case.
+func scpiMatch(header, pattern string) bool {
+	nodes := strings.Split(strings.TrimPrefix(header, ":"), ":")
+	patterns := strings.Split(pattern, ":")
+	if len(nodes) != len(patterns) {
+		return false
+	}
+	for i, node := range nodes {
+		short := strings.TrimRight(patterns[i], "abcdefghijklmnopqrstuvwxyz")
+		if !strings.EqualFold(node, short) && !strings.EqualFold(node, patterns[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func scpiDuration(v *uint64, arg string, isQuery bool) (string, *scpiError) {
+	if isQuery {
+		return strconv.FormatFloat(float64(*v)*1e-9, 'g', -1, 64), nil
+	}
+	seconds, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		d, derr := time.ParseDuration(strings.ToLower(arg))
+		if derr != nil {
+			return "", &scpiError{scpiIllegalParameter, "Expected a duration, such as 0.001 or 1ms"}
+		}
+		seconds = d.Seconds()
+	}
+	if seconds < 0 {
+		return "", &scpiError{scpiIllegalParameter, "Negative duration"}
+	}
+	*v = uint64(seconds*1e9 + 0.5)
+	return "", nil
+}
+
+func scpiInt(v *int, min, max int, arg string, isQuery bool) (string, *scpiError) {
+	if isQuery {
+		return strconv.Itoa(*v), nil
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return "", &scpiError{scpiSyntaxError, "Expected an integer"}
+	}
+	if n < min || n > max {
+		return "", &scpiError{scpiIllegalParameter, fmt.Sprintf("Out of range %d to %d", min, max)}
+	}
+	*v = n
+	return "", nil
+}
+
+func scpiBool(v *bool, arg string, isQuery bool) (string, *scpiError) {
+	if isQuery {
+		if *v {
+			return "1", nil
+		}
+		return "0", nil
+	}
+	switch strings.ToUpper(arg) {
+	case "ON", "1":
+		*v = true
+	case "OFF", "0":
+		*v = false
+	default:
+		return "", &scpiError{scpiIllegalParameter, "Expected ON or OFF"}
+	}
+	return "", nil
+}
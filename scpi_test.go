@@ -0,0 +1,75 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestSCPIServer(t *testing.T) {
+	var started map[string]interface{}
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		switch sent.Type {
+		case "sys_ident":
+			fmt.Fprintf(w, `{"type":"sys_ident","id":"%s","code":0,"msg":{"fw_name":"LUCIDAC","fw_build":"1.2,3","mac":"04-E9-E5-14-74-BF"}}`+"\n", sent.Id)
+		case "start_run":
+			started = sent.Msg.(map[string]interface{})["config"].(map[string]interface{})
+			serveRun(`[[4096,-4096],[0,4096]]`)(sent, w)
+		}
+	})
+	server := NewSCPIServer(hc)
+	client, conn := net.Pipe()
+	defer client.Close()
+	go server.ServeConn(conn)
+	answers := bufio.NewScanner(client)
+
+	for _, c := range []struct{ send, answer string }{
+		{"*IDN?", "anabrid,LUCIDAC,04-E9-E5-14-74-BF,1.2 3"},
+		{"conf:ict 200us;CONFIGURE:OPTIME 0.002;CONF:CHAN 2;:CONF:HALT:OVER OFF", ""},
+		{"CONF:ICT?;CONF:OPT?;CONF:CHAN?;CONF:HALT:OVER?", "0.0002;0.002;2;0"},
+		{"FETC?;SYST:ERR?", `;-230,"No data, INITiate a run first"`},
+		{"SYST:ERR?", `0,"No error"`},
+		{"CONF:CHAN 9;CONF:HALT:OVER maybe;CONF:NOPE 1", ""},
+		{"SYST:ERR?;SYST:ERR?;SYST:ERR?", `-224,"Out of range 0 to 8";-224,"Expected ON or OFF";-113,"Undefined header CONF:NOPE"`},
+		{"INIT;*OPC?", "1"},
+		{"FETC:POIN?;FETC?;RUN:STAT?", "2;0.15625,-0.15625,0,0.15625;DONE"},
+	} {
+		if _, err := io.WriteString(client, c.send+"\n"); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if c.answer == "" {
+			continue
+		}
+		if !answers.Scan() {
+			t.Fatalf("no answer to %s: %v", c.send, answers.Err())
+		}
+		if answers.Text() != c.answer {
+			t.Fatalf("expected %s to be answered with %s, got %s", c.send, c.answer, answers.Text())
+		}
+	}
+	if started["ic_time"] != 200000.0 || started["op_time"] != 2000000.0 || started["halt_on_overload"] != false {
+		t.Fatalf("unexpected run configuration %v", started)
+	}
+}
+
+func TestSCPIMatch(t *testing.T) {
+	for header, want := range map[string]bool{
+		"CONF:ICT":         true,
+		"configure:ictime": true,
+		":Conf:IcTime":     true,
+		"CON:ICT":          false,
+		"CONF:ICTI":        false,
+		"CONF":             false,
+		"CONF:ICT:NOPE":    false,
+	} {
+		if got := scpiMatch(header, "CONFigure:ICTime"); got != want {
+			t.Fatalf("scpiMatch(%s) = %v, expected %v", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// NetSettings are the permanent settings of a device as read with net_get,
+// nested by section, such as {"ipv4": {"dhcp_enabled": true}}.
+type NetSettings map[string]interface{}
+
+// Get returns the setting of the flattened key, such as "ipv4.dhcp_enabled".
+func (s NetSettings) Get(key string) (interface{}, bool) {
+	section := map[string]interface{}(s)
+	path := strings.Split(key, ".")
+	for _, name := range path[:len(path)-1] {
+		nested, ok := section[name].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		section = nested
+	}
+	value, ok := section[path[len(path)-1]]
+	return value, ok
+}
+
+// Set changes the setting of the flattened key, creating its sections.
+func (s NetSettings) Set(key string, value interface{}) {
+	section := map[string]interface{}(s)
+	path := strings.Split(key, ".")
+	for _, name := range path[:len(path)-1] {
+		nested, ok := section[name].(map[string]interface{})
+		if !ok {
+			nested = map[string]interface{}{}
+			section[name] = nested
+		}
+		section = nested
+	}
+	section[path[len(path)-1]] = value
+}
+
+// ErrSettingsConflict is returned by UpdateSettings if the settings were
+// changed by someone else while updating them.
+var ErrSettingsConflict = errors.New("settings were changed concurrently")
+
+// UpdateSettings changes the permanent settings in one go: It reads them
+// with net_get, lets update change them, checks the changed settings
+// against the SettingsSchema and writes them with net_set, reading them
+// back to verify they took effect:
+//
+//	err := hc.UpdateSettings(func(s *lucigo.NetSettings) error {
+//		s.Set("ethernet.mtu", 9000)
+//		return nil
+//	})
+//
+// An error of update is returned as is, without writing anything. If the
+// settings no longer read as before right before writing, such as as
+// another client changed them meanwhile, nothing is written either and
+// the error is ErrSettingsConflict; the update may be tried again then.
+// Nothing is written if update changes nothing.
+func (hc *HybridController) UpdateSettings(update func(s *NetSettings) error) error {
+	_, _, err := hc.updateSettings(update)
+	return err
+}
+
+// ApplySettings changes the permanent settings given, such as
+// {"ethernet.hostname": "lab-1"} or {"ethernet": {"hostname": "lab-1"}},
+// leaving the others alone, as UpdateSettings does. It tells what actually
+// changed on the device, as read back after writing, in the same form as
+// Apply. If some settings did not take effect, the result is returned
+// along with the error.
+func (hc *HybridController) ApplySettings(patch map[string]interface{}) (*ApplyResult, error) {
+	current, written, err := hc.updateSettings(func(s *NetSettings) error {
+		for key, value := range flattenSettings("", patch, nil) {
+			s.Set(key, value)
+		}
+		return nil
+	})
+	if written == nil {
+		return nil, err
+	}
+	before, after := settingsPatch(current, written)
+	return &ApplyResult{Changed: len(after) != 0, Diff: ApplyDiff{before, after}}, err
+}
+
+// updateSettings is UpdateSettings, returning the settings read before and
+// after writing, unless it failed before reading them back.
+func (hc *HybridController) updateSettings(update func(s *NetSettings) error) (current, written NetSettings, err error) {
+	if current, err = hc.NetSettings(); err != nil {
+		return nil, nil, err
+	}
+	// changed on a copy of its own, as decoded from JSON to be compared
+	var settings NetSettings
+	raw, _ := json.Marshal(current)
+	json.Unmarshal(raw, &settings)
+	if err := update(&settings); err != nil {
+		return nil, nil, err
+	}
+	if raw, err = json.Marshal(settings); err != nil {
+		return nil, nil, err
+	}
+	settings = nil
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return nil, nil, err
+	}
+
+	_, after := settingsPatch(current, settings)
+	changed := flattenSettings("", after, nil)
+	if len(changed) == 0 {
+		return current, current, nil
+	}
+	schema, err := hc.SettingsSchema()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot validate settings: %w", err)
+	}
+	for _, key := range sortedKeys(changed) {
+		if setting, ok := schema.Lookup(key); ok {
+			if err := setting.Check(changed[key]); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	latest, err := hc.NetSettings()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !reflect.DeepEqual(latest, current) {
+		return nil, nil, ErrSettingsConflict
+	}
+	if _, err := hc.QueryMsg("net_set", after); err != nil {
+		return nil, nil, err
+	}
+
+	if written, err = hc.NetSettings(); err != nil {
+		return nil, nil, err
+	}
+	var ignored []string
+	for _, key := range sortedKeys(changed) {
+		if value, _ := written.Get(key); !reflect.DeepEqual(value, changed[key]) {
+			ignored = append(ignored, key)
+		}
+	}
+	if len(ignored) != 0 {
+		return current, written, fmt.Errorf("net_set did not take effect for %s", strings.Join(ignored, ", "))
+	}
+	return current, written, nil
+}
+
+// ResetSettings resets the permanent settings to the factory defaults with
+// net_reset. As with net_set, some only take effect after a reboot, such as
+// the addresses.
+func (hc *HybridController) ResetSettings() error {
+	_, err := hc.Query("net_reset")
+	return err
+}
+
+// NetSettings reads the permanent settings with net_get.
+func (hc *HybridController) NetSettings() (NetSettings, error) {
+	res, err := hc.Query("net_get")
+	if err != nil {
+		return nil, err
+	}
+	if res.Msg == nil {
+		return NetSettings{}, nil
+	}
+	return NetSettings(res.Msg), nil
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SettingsHistory keeps the permanent settings of devices in a local git
+// repository, one file <serial>.json per device, and commits every
+// change. This gives an audit trail (git log -p) and a way back: Any
+// earlier version of the file can be checked out and applied again.
+//
+// The git executable has to be installed. Commits are authored by the git
+// user configured, or by lucigo without.
+type SettingsHistory struct {
+	Dir string // of the repository, created if missing
+	Git string // git executable, defaults to "git"
+}
+
+var unsafeFileName = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Record writes the settings of the device with the given serial (such as
+// its MAC address) and commits them, if changed. The commit message names
+// the action, such as "backup" or "apply", and the device, and summarizes
+// the keys changed. It returns the id of the commit, or "" if the settings
+// were recorded unchanged before.
+func (h *SettingsHistory) Record(serial, action string, settings map[string]interface{}) (commit string, err error) {
+	if serial == "" {
+		serial = "unknown"
+	}
+	if err := h.init(); err != nil {
+		return "", err
+	}
+	name := unsafeFileName.ReplaceAllString(serial, "_") + ".json"
+	path := filepath.Join(h.Dir, name)
+
+	var before map[string]interface{}
+	if old, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(old, &before) // a broken file is replaced as a whole
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	var after map[string]interface{}
+	json.Unmarshal(data, &after) // compared as read back, such as with float64 numbers
+	changes := diffSettings(before, after)
+	if len(changes) == 0 {
+		return "", nil
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return "", err
+	}
+
+	keys := make([]string, len(changes))
+	for i, change := range changes {
+		keys[i] = change.Key
+	}
+	subject := fmt.Sprintf("%s %s: %s", action, serial, summarizeKeys(keys))
+	body := make([]string, len(changes))
+	for i, change := range changes {
+		body[i] = change.String()
+	}
+	if _, err := h.git("add", "--", name); err != nil {
+		return "", err
+	}
+	if _, err := h.git("commit", "--quiet", "-m", subject, "-m", strings.Join(body, "\n"), "--", name); err != nil {
+		return "", err
+	}
+	out, err := h.git("rev-parse", "HEAD")
+	return strings.TrimSpace(out), err
+}
+
+// init creates the repository unless it exists.
+func (h *SettingsHistory) init() error {
+	if _, err := os.Stat(filepath.Join(h.Dir, ".git")); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(h.Dir, 0o700); err != nil {
+		return err
+	}
+	_, err := h.git("init", "--quiet")
+	return err
+}
+
+func (h *SettingsHistory) git(args ...string) (string, error) {
+	command := h.Git
+	if command == "" {
+		command = "git"
+	}
+	subcommand := args[0]
+	if out, _ := exec.Command(command, "-C", h.Dir, "config", "user.email").Output(); len(bytes.TrimSpace(out)) == 0 {
+		args = append([]string{"-c", "user.name=lucigo", "-c", "user.email=lucigo@localhost"}, args...)
+	}
+	cmd := exec.Command(command, append([]string{"-C", h.Dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", subcommand, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return string(out), nil
+}
+
+// SettingsChange is the change of a single setting, with nested settings
+// flattened to keys such as "ethernet.mac".
+type SettingsChange struct {
+	Key      string
+	Old, New interface{} // nil if added or removed
+}
+
+func (c SettingsChange) String() string {
+	switch {
+	case c.Old == nil:
+		return fmt.Sprintf("%s: added %v", c.Key, c.New)
+	case c.New == nil:
+		return fmt.Sprintf("%s: removed %v", c.Key, c.Old)
+	}
+	return fmt.Sprintf("%s: %v -> %v", c.Key, c.Old, c.New)
+}
+
+// diffSettings lists the changes from before to after, sorted by key.
+func diffSettings(before, after map[string]interface{}) []SettingsChange {
+	old, cur := flattenSettings("", before, nil), flattenSettings("", after, nil)
+	var changes []SettingsChange
+	for key, value := range old {
+		if _, ok := cur[key]; !ok {
+			changes = append(changes, SettingsChange{Key: key, Old: value})
+		}
+	}
+	for key, value := range cur {
+		if !reflect.DeepEqual(old[key], value) {
+			changes = append(changes, SettingsChange{Key: key, Old: old[key], New: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+func flattenSettings(prefix string, settings map[string]interface{}, into map[string]interface{}) map[string]interface{} {
+	if into == nil {
+		into = make(map[string]interface{})
+	}
+	for key, value := range settings {
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) != 0 {
+			flattenSettings(prefix+key+".", nested, into)
+		} else {
+			into[prefix+key] = value
+		}
+	}
+	return into
+}
+
+// summarizeKeys lists a few keys for a commit subject.
+func summarizeKeys(keys []string) string {
+	const max = 3
+	if len(keys) <= max {
+		return strings.Join(keys, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(keys[:max], ", "), len(keys)-max)
+}
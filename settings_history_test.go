@@ -0,0 +1,56 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestSettingsHistory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	h := &SettingsHistory{Dir: t.TempDir() + "/settings"}
+	settings := map[string]interface{}{
+		"dhcp_enabled": true,
+		"ethernet":     map[string]interface{}{"mac": "04-E9-E5-14-74-BF"},
+		"jsonl_port":   5732,
+	}
+	first, err := h.Record("04-E9-E5-14-74-BF", "backup", settings)
+	if err != nil || first == "" {
+		t.Fatalf("expected a commit, got %q, %v", first, err)
+	}
+	if again, err := h.Record("04-E9-E5-14-74-BF", "backup", settings); err != nil || again != "" {
+		t.Fatalf("expected no commit for unchanged settings, got %q, %v", again, err)
+	}
+
+	settings["dhcp_enabled"] = false
+	delete(settings, "jsonl_port")
+	if _, err := h.Record("04-E9-E5-14-74-BF", "apply", settings); err != nil {
+		t.Fatalf("%v", err)
+	}
+	log, err := h.git("log", "--format=%s%n%b")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, want := range []string{
+		"apply 04-E9-E5-14-74-BF: dhcp_enabled, jsonl_port",
+		"dhcp_enabled: true -> false",
+		"jsonl_port: removed 5732",
+		"backup 04-E9-E5-14-74-BF: dhcp_enabled, ethernet.mac, jsonl_port",
+	} {
+		if !strings.Contains(log, want) {
+			t.Fatalf("expected %q in the log\n%s", want, log)
+		}
+	}
+}
+
+func TestSummarizeKeys(t *testing.T) {
+	if got := summarizeKeys([]string{"a", "b", "c", "d", "e"}); got != "a, b, c and 2 more" {
+		t.Fatalf("unexpected %s", got)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestUpdateSettings(t *testing.T) {
+	settings := `{"dhcp_enabled":true,"ethernet":{"mtu":1500}}`
+	var set []string     // messages of net_set
+	var interfere func() // changes the settings on the next net_get
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		switch sent.Type {
+		case "net_get":
+			fmt.Fprintf(w, `{"type":"net_get","id":"%s","code":0,"msg":%s}`+"\n", sent.Id, settings)
+			if interfere != nil {
+				interfere()
+				interfere = nil
+			}
+		case "net_schema":
+			fmt.Fprintf(w, `{"type":"net_schema","id":"%s","code":0,"msg":{"settings":[{"key":"ethernet.mtu","type":"int","min":576,"max":9000}]}}`+"\n", sent.Id)
+		case "net_set":
+			msg, _ := json.Marshal(sent.Msg)
+			set = append(set, string(msg))
+			settings = `{"dhcp_enabled":true,"ethernet":{"mtu":9000}}`
+			fmt.Fprintf(w, `{"type":"net_set","id":"%s","code":0,"msg":{}}`+"\n", sent.Id)
+		}
+	})
+
+	err := hc.UpdateSettings(func(s *NetSettings) error {
+		s.Set("ethernet.mtu", 10000)
+		return nil
+	})
+	if err == nil || len(set) != 0 {
+		t.Fatalf("expected an invalid setting refused, got %v, net_set %v", err, set)
+	}
+
+	interfere = func() { settings = `{"dhcp_enabled":false,"ethernet":{"mtu":1500}}` }
+	err = hc.UpdateSettings(func(s *NetSettings) error {
+		s.Set("ethernet.mtu", 9000)
+		return nil
+	})
+	if !errors.Is(err, ErrSettingsConflict) || len(set) != 0 {
+		t.Fatalf("expected ErrSettingsConflict, got %v, net_set %v", err, set)
+	}
+
+	settings = `{"dhcp_enabled":true,"ethernet":{"mtu":1500}}`
+	err = hc.UpdateSettings(func(s *NetSettings) error {
+		if mtu, _ := s.Get("ethernet.mtu"); mtu != 1500.0 {
+			return fmt.Errorf("unexpected mtu %v", mtu)
+		}
+		s.Set("ethernet.mtu", 9000)
+		return nil
+	})
+	if err != nil || len(set) != 1 || set[0] != `{"ethernet":{"mtu":9000}}` {
+		t.Fatalf("expected only the changed setting to be sent, got %v, net_set %v", err, set)
+	}
+
+	err = hc.UpdateSettings(func(s *NetSettings) error {
+		s.Set("hostname", "lab1")
+		return nil
+	})
+	if err == nil || err.Error() != "net_set did not take effect for hostname" {
+		t.Fatalf("expected the setting not taking effect reported, got %v", err)
+	}
+	result, err := hc.ApplySettings(map[string]interface{}{"hostname": "lab1"})
+	if err == nil || result == nil || result.Changed {
+		t.Fatalf("expected the result to tell nothing changed, along with the error, got %+v, %v", result, err)
+	}
+}
+
+func TestApplySettings(t *testing.T) {
+	hc, err := NewHybridControllerFromString("emu://")
+	if err != nil {
+		t.Fatalf("NewHybridControllerFromString: %v", err)
+	}
+	defer hc.Close()
+
+	result, err := hc.ApplySettings(map[string]interface{}{"ethernet.hostname": "lab-1", "ipv4": map[string]interface{}{"dhcp_enabled": true}})
+	if err != nil {
+		t.Fatalf("ApplySettings: %v", err)
+	}
+	before, _ := result.Diff.Before["ethernet"].(map[string]interface{})
+	after, _ := result.Diff.After["ethernet"].(map[string]interface{})
+	if !result.Changed || before["hostname"] != "lucidac-emulator" || after["hostname"] != "lab-1" || result.Diff.After["ipv4"] != nil {
+		t.Fatalf("expected only the hostname changed, got %+v", result)
+	}
+
+	result, err = hc.ApplySettings(map[string]interface{}{"ethernet.hostname": "lab-1"})
+	if err != nil || result.Changed {
+		t.Fatalf("expected nothing to change, got %+v, %v", result, err)
+	}
+}
+
+func TestResetSettings(t *testing.T) {
+	hc, err := NewHybridControllerFromString("emu://")
+	if err != nil {
+		t.Fatalf("NewHybridControllerFromString: %v", err)
+	}
+	defer hc.Close()
+
+	if _, err := hc.ApplySettings(map[string]interface{}{"ethernet.hostname": "lab-1"}); err != nil {
+		t.Fatalf("ApplySettings: %v", err)
+	}
+	if err := hc.ResetSettings(); err != nil {
+		t.Fatalf("ResetSettings: %v", err)
+	}
+	settings, err := hc.NetSettings()
+	if hostname, _ := settings.Get("ethernet.hostname"); err != nil || hostname != "lucidac-emulator" {
+		t.Fatalf("expected the default hostname back, got %v, %v", hostname, err)
+	}
+}
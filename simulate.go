@@ -0,0 +1,209 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Samples per frame produced by the Simulator
+const simulatedFrameSize = 256
+
+// Simulator numerically integrates the ODE system of a Circuit, for
+// validating circuits offline before touching hardware. Its runs behave
+// like the ones of the device, such that their data can be read and
+// written to sinks the same way:
+//
+//	sim := &lucigo.Simulator{Circuit: circuit}
+//	run, err := sim.StartRun(config, daq)
+//	err = run.Capture(lucigo.NewCSVSink(os.Stdout))
+//
+// The elements are modelled ideally: An integrator follows x' = k0 * input,
+// a multiplier yields the product of its two inputs. A run overloads once
+// any integrator leaves the range the DAQ can acquire.
+type Simulator struct {
+	Circuit Circuit
+
+	// Step of the classical Runge-Kutta (RK4) integration, in seconds.
+	// Defaults to a hundredth of the fastest integrator time constant.
+	// Steps are shortened to fit the sample interval.
+	Step float64
+}
+
+// StartRun starts a simulated run, see [HybridController.StartRun].
+func (s *Simulator) StartRun(config RunConfig, daq DAQConfig) (*Run, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid run configuration: %w", err)
+	}
+	if config.WaitForExternalTrigger || config.OpTime == 0 {
+		return nil, fmt.Errorf("simulated runs cannot depend on the external trigger")
+	}
+	if err := s.Circuit.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid circuit: %w", err)
+	}
+	run := &Run{
+		Id:       uuid.New(),
+		Config:   config,
+		DAQ:      daq,
+		state:    RunStateNew,
+		Started:  time.Now(),
+		Channels: daq.Channels(),
+		hc:       &HybridController{}, // not connected to anything
+		data:     make(chan Frame, frameBuffer),
+		done:     make(chan struct{}),
+	}
+	run.source = func() { s.simulate(run) }
+	return run, nil
+}
+
+func (s *Simulator) simulate(run *Run) {
+	run.setState(RunStateIC)
+	var x [NumIntegrators]float64
+	for i, integrator := range s.Circuit.Integrators {
+		x[i] = integrator.IC
+	}
+	run.setState(RunStateOP)
+
+	opTime := float64(run.Config.OpTime) * 1e-9
+	samples := 0
+	if run.DAQ.SampleOp && run.DAQ.SampleRate > 0 {
+		samples = int(opTime * float64(run.DAQ.SampleRate))
+	}
+	interval := opTime // without samples, integrate in one go
+	if samples > 0 {
+		interval = run.DAQ.SampleTime(1)
+	}
+	substeps := int(math.Ceil(interval / s.step()))
+	h := interval / float64(substeps)
+
+	frame := s.frame(run)
+	flush := func() {
+		if len(frame.Samples) != 0 {
+			run.samples += len(frame.Samples)
+			run.deliver(frame)
+			frame = s.frame(run)
+		}
+	}
+	for i := 0; i < max(samples, 1) && !run.finished && !run.stopped.Load(); i++ {
+		if samples > 0 {
+			out := s.outputs(&x)
+			sample := make([]float64, len(run.Channels))
+			for c := range sample {
+				sample[c] = out[s.Circuit.adcOutput(c)]
+			}
+			frame.Samples = append(frame.Samples, sample)
+			if len(frame.Samples) == simulatedFrameSize {
+				flush()
+			}
+		}
+		for j := 0; j < substeps; j++ {
+			s.rk4(&x, h)
+		}
+		if overload := overloaded(&x); overload >= 0 && run.Config.HaltOnOverload {
+			flush()
+			run.changeState(RunStateError)
+			run.finish(fmt.Errorf("run %s: integrator %d overloaded at %gs", run.Id, overload, float64(i+1)*interval))
+			return
+		}
+	}
+	flush()
+	if !run.finished {
+		run.setState(RunStateOPEnd)
+		run.setState(RunStateDone)
+	}
+}
+
+func (s *Simulator) frame(run *Run) Frame {
+	return Frame{
+		Channels: run.Channels,
+		Offset:   run.samples,
+		Start:    run.DAQ.SampleTime(run.samples),
+		Interval: run.DAQ.SampleTime(1),
+	}
+}
+
+func (s *Simulator) step() float64 {
+	if s.Step > 0 {
+		return s.Step
+	}
+	k0 := 0.0
+	for _, integrator := range s.Circuit.Integrators {
+		k0 = math.Max(k0, integrator.k0())
+	}
+	return 0.01 / k0
+}
+
+func (i Integrator) k0() float64 {
+	if i.K0 == 0 {
+		return DefaultK0
+	}
+	return i.K0
+}
+
+// outputs computes the outputs of the math blocks for the integrator states x.
+func (s *Simulator) outputs(x *[NumIntegrators]float64) [NumMathPorts]float64 {
+	var out [NumMathPorts]float64
+	copy(out[:], x[:])
+	// multipliers may feed each other, a chain of them settles after one
+	// pass per multiplier
+	for pass := 0; pass < NumMultipliers; pass++ {
+		in := s.inputs(&out)
+		for m := 0; m < NumMultipliers; m++ {
+			out[NumIntegrators+m] = in[NumIntegrators+2*m] * in[NumIntegrators+2*m+1]
+		}
+	}
+	return out
+}
+
+// inputs sums the signals routed to each input of the math blocks.
+func (s *Simulator) inputs(out *[NumMathPorts]float64) [NumMathPorts]float64 {
+	var in [NumMathPorts]float64
+	for _, r := range s.Circuit.Routes {
+		in[r.To] += r.Coefficient * out[r.From]
+	}
+	return in
+}
+
+// derivative is the right hand side of the ODE system.
+func (s *Simulator) derivative(x *[NumIntegrators]float64) (dx [NumIntegrators]float64) {
+	out := s.outputs(x)
+	in := s.inputs(&out)
+	for i, integrator := range s.Circuit.Integrators {
+		dx[i] = integrator.k0() * in[i]
+	}
+	return dx
+}
+
+// rk4 advances the integrator states x by one step of length h.
+func (s *Simulator) rk4(x *[NumIntegrators]float64, h float64) {
+	var tmp [NumIntegrators]float64
+	at := func(k *[NumIntegrators]float64, f float64) *[NumIntegrators]float64 {
+		for i := range tmp {
+			tmp[i] = x[i] + f*h*k[i]
+		}
+		return &tmp
+	}
+	k1 := s.derivative(x)
+	k2 := s.derivative(at(&k1, 0.5))
+	k3 := s.derivative(at(&k2, 0.5))
+	k4 := s.derivative(at(&k3, 1))
+	for i := range x {
+		x[i] += h / 6 * (k1[i] + 2*k2[i] + 2*k3[i] + k4[i])
+	}
+}
+
+// overloaded returns the first integrator out of range, or -1.
+func overloaded(x *[NumIntegrators]float64) int {
+	for i, v := range x {
+		if math.Abs(v) > daqMachineUnitRange {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"math"
+	"testing"
+)
+
+// harmonicOscillator yields x0 = cos(k0 t) and x1 = sin(k0 t)
+var harmonicOscillator = Circuit{
+	Integrators: [NumIntegrators]Integrator{{IC: 1}, {IC: 0}},
+	Routes: []Route{
+		{From: 1, Lane: 0, Coefficient: -1, To: 0},
+		{From: 0, Lane: 1, Coefficient: 1, To: 1},
+	},
+}
+
+func TestCircuit_Validate(t *testing.T) {
+	if err := harmonicOscillator.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	for _, route := range []Route{{From: 16}, {To: -1}, {Lane: 32}, {Lane: 0}, {Lane: 2, Coefficient: 21}} {
+		c := harmonicOscillator
+		c.Routes = append([]Route{}, c.Routes...)
+		c.Routes = append(c.Routes, route)
+		if c.Validate() == nil {
+			t.Fatalf("expected route %+v to be invalid", route)
+		}
+	}
+}
+
+func TestSimulator(t *testing.T) {
+	sim := &Simulator{Circuit: harmonicOscillator}
+	run, err := sim.StartRun(RunConfig{OpTime: 1000000}, DAQConfig{NumChannels: 2, SampleOp: true, SampleRate: 1000000})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	rec := &Recording{}
+	if err := run.Capture(rec); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if len(rec.Samples) != 1000 || run.State() != RunStateDone {
+		t.Fatalf("expected 1000 samples in state DONE, got %d in %s", len(rec.Samples), run.State())
+	}
+	for i, sample := range rec.Samples {
+		phase := DefaultK0 * rec.Time[i]
+		if math.Abs(sample[0]-math.Cos(phase)) > 1e-6 || math.Abs(sample[1]-math.Sin(phase)) > 1e-6 {
+			t.Fatalf("sample %d at %gs: expected cos and sin of %g, got %v", i, rec.Time[i], phase, sample)
+		}
+	}
+}
+
+func TestSimulator_overload(t *testing.T) {
+	growth := Circuit{
+		Integrators: [NumIntegrators]Integrator{{IC: 0.5}},
+		Routes:      []Route{{From: 0, Lane: 0, Coefficient: 1, To: 0}},
+	}
+	sim := &Simulator{Circuit: growth}
+	run, err := sim.StartRun(RunConfig{OpTime: 1000000, HaltOnOverload: true}, DAQConfig{NumChannels: 1, SampleOp: true, SampleRate: 100000})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	rec := &Recording{}
+	if err := run.Capture(rec); err == nil || run.State() != RunStateError {
+		t.Fatalf("expected the run to fail with an overload, got %v in %s", err, run.State())
+	}
+	// x = 0.5 exp(k0 t) leaves the range at ln(2.5)/k0, about 92us
+	if len(rec.Samples) != 10 {
+		t.Fatalf("expected 10 samples before the overload, got %d", len(rec.Samples))
+	}
+}
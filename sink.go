@@ -0,0 +1,46 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+// A Sink consumes the data of a run, for instance by writing it to a file.
+// Begin is called once before the first frame, Close once after the last
+// one, also if the run failed, but not if Begin failed.
+type Sink interface {
+	Begin(run *Run) error
+	WriteFrame(frame Frame) error
+	Close() error
+}
+
+// Capture feeds all data of the run into the given sinks until the run is
+// finished. It returns the first error of either the run or the sinks.
+func (run *Run) Capture(sinks ...Sink) error {
+	var err error
+	begun := 0 // sinks to close, those after have not begun
+	for _, sink := range sinks {
+		if err = sink.Begin(run); err != nil {
+			break
+		}
+		begun++
+	}
+	for frame := range run.Data() {
+		if err != nil {
+			continue // drain, the run cannot be left half-read
+		}
+		for _, sink := range sinks {
+			if err = sink.WriteFrame(frame); err != nil {
+				break
+			}
+		}
+	}
+	for _, sink := range sinks[:begun] {
+		if cerr := sink.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err == nil {
+		err = run.Err()
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSVSink writes run data as comma separated values: A time column (in
+// seconds, see [Frame.Time]) followed by one column per channel.
+// Run metadata is written as leading comment lines starting with '#', as
+// are gaps in the data (see [Integrity]) right where they occur.
+//
+// Every frame is flushed to the underlying writer as soon as it arrives,
+// so the data received so far survives an interrupted run.
+type CSVSink struct {
+	out    io.Writer
+	csv    *csv.Writer
+	run    *Run
+	header bool // column header written
+}
+
+// NewCSVSink creates a CSVSink writing to w. Closing the sink does not close w.
+func NewCSVSink(w io.Writer) *CSVSink {
+	return &CSVSink{out: w, csv: csv.NewWriter(w)}
+}
+
+func (s *CSVSink) Begin(run *Run) error {
+	s.run = run
+	_, err := fmt.Fprintf(s.out,
+		"# run: %s\n# started: %s\n# ic_time: %dns\n# op_time: %dns\n# sample_rate: %d\n",
+		run.Id, run.Started.Format(time.RFC3339), run.Config.IcTime, run.Config.OpTime, run.DAQ.SampleRate)
+	return err
+}
+
+func (s *CSVSink) WriteFrame(frame Frame) error {
+	if !s.header {
+		// written lazily as channels are only known with the first frame
+		// if the DAQConfig did not state them
+		header := []string{"time"}
+		for _, channel := range frame.Channels {
+			header = append(header, channel.Name)
+		}
+		s.csv.Write(header)
+		s.header = true
+	}
+	if frame.Gap != 0 {
+		s.csv.Flush()
+		if _, err := fmt.Fprintf(s.out, "# gap: %d samples missing before sample %d\n", frame.Gap, frame.Offset); err != nil {
+			return err
+		}
+	}
+	for i, sample := range frame.Samples {
+		record := make([]string, 0, len(sample)+1)
+		record = append(record, formatFloat(frame.Time(i)))
+		for _, value := range sample {
+			record = append(record, formatFloat(value))
+		}
+		s.csv.Write(record)
+	}
+	s.csv.Flush()
+	return s.csv.Error()
+}
+
+func (s *CSVSink) Close() error {
+	s.csv.Flush()
+	return s.csv.Error()
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
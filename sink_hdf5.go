@@ -0,0 +1,129 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build hdf5
+
+// HDF5 support requires CGO and the HDF5 C library, which is why it is only
+// built with the hdf5 build tag. Get the go bindings first with
+//
+//	go get gonum.org/v1/hdf5
+//	go build -tags hdf5 ./...
+
+package lucigo
+
+import (
+	"strings"
+	"time"
+
+	"gonum.org/v1/hdf5"
+)
+
+// HDF5Sink writes run data into a HDF5 file with two datasets:
+//
+//	/time     float64[samples], in seconds
+//	/samples  float64[samples][channels], in machine units
+//
+// The run configuration and channel names are stored as attributes of
+// /samples. As HDF5 files cannot be read while being written, the data is
+// kept in memory and the file is only written on Close.
+type HDF5Sink struct {
+	path     string
+	run      *Run
+	channels []Channel
+	time     []float64
+	samples  []float64 // row major
+}
+
+// NewHDF5Sink creates a HDF5Sink writing to the file at path.
+func NewHDF5Sink(path string) *HDF5Sink {
+	return &HDF5Sink{path: path}
+}
+
+func (s *HDF5Sink) Begin(run *Run) error {
+	s.run = run
+	return nil
+}
+
+func (s *HDF5Sink) WriteFrame(frame Frame) error {
+	s.channels = frame.Channels
+	for i, sample := range frame.Samples {
+		s.time = append(s.time, frame.Time(i))
+		s.samples = append(s.samples, sample...)
+	}
+	return nil
+}
+
+func (s *HDF5Sink) Close() error {
+	f, err := hdf5.CreateFile(s.path, hdf5.F_ACC_TRUNC)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := writeHDF5Dataset(f, "time", s.time, uint(len(s.time))); err != nil {
+		return err
+	}
+	samples, err := createHDF5Dataset(f, "samples", uint(len(s.time)), uint(len(s.channels)))
+	if err != nil {
+		return err
+	}
+	defer samples.Close()
+	if err := samples.Write(&s.samples); err != nil {
+		return err
+	}
+
+	names := make([]string, len(s.channels))
+	for i, channel := range s.channels {
+		names[i] = channel.Name
+	}
+	for _, err := range []error{
+		writeHDF5Attribute(samples, "run_id", s.run.Id.String()),
+		writeHDF5Attribute(samples, "started", s.run.Started.Format(time.RFC3339)),
+		writeHDF5Attribute(samples, "ic_time_ns", s.run.Config.IcTime),
+		writeHDF5Attribute(samples, "op_time_ns", s.run.Config.OpTime),
+		writeHDF5Attribute(samples, "sample_rate", int64(s.run.DAQ.SampleRate)),
+		writeHDF5Attribute(samples, "channels", strings.Join(names, ",")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createHDF5Dataset(f *hdf5.File, name string, dims ...uint) (*hdf5.Dataset, error) {
+	space, err := hdf5.CreateSimpleDataspace(dims, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer space.Close()
+	return f.CreateDataset(name, hdf5.T_NATIVE_DOUBLE, space)
+}
+
+func writeHDF5Dataset(f *hdf5.File, name string, data []float64, dims ...uint) error {
+	dataset, err := createHDF5Dataset(f, name, dims...)
+	if err != nil {
+		return err
+	}
+	defer dataset.Close()
+	return dataset.Write(&data)
+}
+
+func writeHDF5Attribute[T any](dataset *hdf5.Dataset, name string, value T) error {
+	dtype, err := hdf5.NewDatatypeFromValue(value)
+	if err != nil {
+		return err
+	}
+	space, err := hdf5.CreateDataspace(hdf5.S_SCALAR)
+	if err != nil {
+		return err
+	}
+	defer space.Close()
+	attr, err := dataset.CreateAttribute(name, dtype, space)
+	if err != nil {
+		return err
+	}
+	defer attr.Close()
+	return attr.Write(&value, dtype)
+}
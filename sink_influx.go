@@ -0,0 +1,120 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InfluxPoint is a data point in the InfluxDB line protocol, as understood
+// by InfluxDB, Telegraf and VictoriaMetrics:
+//
+//	lucidac,run=5b0e...,entity=00 x=0.5,y=-0.25 1718000000000000000
+type InfluxPoint struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]float64
+	Time        time.Time
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	influxKeyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+// AppendLine appends the point as line, including the newline. Tags and
+// fields are sorted by key. A point without fields is not valid.
+func (p InfluxPoint) AppendLine(buf []byte) []byte {
+	buf = append(buf, influxMeasurementEscaper.Replace(p.Measurement)...)
+	for _, key := range sortedKeys(p.Tags) {
+		if p.Tags[key] == "" {
+			continue // empty tag values are not allowed
+		}
+		buf = append(buf, ',')
+		buf = append(buf, influxKeyEscaper.Replace(key)...)
+		buf = append(buf, '=')
+		buf = append(buf, influxKeyEscaper.Replace(p.Tags[key])...)
+	}
+	for i, key := range sortedKeys(p.Fields) {
+		if i == 0 {
+			buf = append(buf, ' ')
+		} else {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, influxKeyEscaper.Replace(key)...)
+		buf = append(buf, '=')
+		buf = strconv.AppendFloat(buf, p.Fields[key], 'g', -1, 64)
+	}
+	if !p.Time.IsZero() {
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, p.Time.UnixNano(), 10)
+	}
+	return append(buf, '\n')
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// InfluxSink writes run data in the InfluxDB line protocol, one point per
+// sample with a field per channel, named by the channel. Points are tagged
+// with the run id and entity and stamped with the time the sample was
+// taken, counted from the start of the run. Ship them to InfluxDB with
+// its HTTP write API or through Telegraf.
+type InfluxSink struct {
+	Measurement string            // defaults to "lucidac"
+	Tags        map[string]string // added to every point, such as the device
+
+	out io.Writer
+	run *Run
+	buf []byte
+}
+
+// NewInfluxSink creates an InfluxSink writing to w. Closing the sink does not close w.
+func NewInfluxSink(w io.Writer) *InfluxSink {
+	return &InfluxSink{out: w}
+}
+
+func (s *InfluxSink) Begin(run *Run) error {
+	s.run = run
+	return nil
+}
+
+func (s *InfluxSink) WriteFrame(frame Frame) error {
+	point := InfluxPoint{
+		Measurement: s.Measurement,
+		Tags:        map[string]string{"run": s.run.Id.String(), "entity": strings.Join(frame.Entity, "/")},
+		Fields:      make(map[string]float64, len(frame.Channels)),
+	}
+	if point.Measurement == "" {
+		point.Measurement = "lucidac"
+	}
+	for key, value := range s.Tags {
+		point.Tags[key] = value
+	}
+	s.buf = s.buf[:0]
+	for i, sample := range frame.Samples {
+		for c, value := range sample {
+			point.Fields[frame.Channels[c].Name] = value
+		}
+		point.Time = s.run.Started.Add(time.Duration(frame.Time(i) * float64(time.Second)))
+		s.buf = point.AppendLine(s.buf)
+	}
+	_, err := s.out.Write(s.buf)
+	return err
+}
+
+func (s *InfluxSink) Close() error {
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+)
+
+// DefaultChunkSize is the size by which a MmapSink grows its file.
+const DefaultChunkSize = 64 << 20
+
+// MmapSink writes the data of a run as NumPy .npy file like NPYSink, but
+// is made for continuous acquisitions over hours: Instead of keeping the
+// data in memory, the file is preallocated in chunks and memory-mapped.
+// Frames are copied into the mapping, without a write system call for each,
+// and the preallocated file does not fragment on slow or busy disks. On
+// Close, the file is cut to the data written and the shape in the header
+// is filled in; until then, the header claims the largest possible shape.
+//
+// The file is mapped on Linux only. Elsewhere, it is still preallocated,
+// but written with WriteAt.
+type MmapSink struct {
+	ChunkSize int64 // bytes preallocated and mapped at once, defaults to DefaultChunkSize
+
+	path    string
+	file    *os.File
+	fields  []string
+	header  int64  // length of the NPY header
+	size    int64  // of the file as preallocated
+	offset  int64  // end of the data written
+	chunk   []byte // the mapping of the chunk at chunkAt, nil without
+	chunkAt int64
+	buf     []byte // encoded frame
+}
+
+// NewMmapSink creates a MmapSink writing to the file at path, which is
+// created on Begin.
+func NewMmapSink(path string) *MmapSink {
+	return &MmapSink{path: path}
+}
+
+func (s *MmapSink) Begin(run *Run) error {
+	if s.ChunkSize <= 0 {
+		s.ChunkSize = DefaultChunkSize
+	}
+	// mappings start at multiples of the page size
+	page := int64(os.Getpagesize())
+	s.ChunkSize = (s.ChunkSize + page - 1) / page * page
+	var err error
+	s.file, err = os.Create(s.path)
+	return err
+}
+
+func (s *MmapSink) WriteFrame(frame Frame) error {
+	if s.fields == nil {
+		s.fields = []string{"time"}
+		for _, channel := range frame.Channels {
+			s.fields = append(s.fields, channel.Name)
+		}
+		// reserve room for the header with the final shape
+		header, err := npyHeader(s.fields, math.MaxInt64, 0)
+		if err != nil {
+			return err
+		}
+		s.header = int64(len(header))
+		if err := s.write(header); err != nil {
+			return err
+		}
+	}
+	s.buf = s.buf[:0]
+	for i, sample := range frame.Samples {
+		s.buf = binary.LittleEndian.AppendUint64(s.buf, math.Float64bits(frame.Time(i)))
+		for _, value := range sample {
+			s.buf = binary.LittleEndian.AppendUint64(s.buf, math.Float64bits(value))
+		}
+	}
+	return s.write(s.buf)
+}
+
+// write appends p to the data, growing and mapping the file as needed.
+func (s *MmapSink) write(p []byte) error {
+	for len(p) != 0 {
+		if s.offset == s.size {
+			if err := s.grow(); err != nil {
+				return err
+			}
+		}
+		if s.chunk == nil {
+			n := min(int64(len(p)), s.size-s.offset)
+			if _, err := s.file.WriteAt(p[:n], s.offset); err != nil {
+				return err
+			}
+			s.offset += n
+			p = p[n:]
+			continue
+		}
+		n := copy(s.chunk[s.offset-s.chunkAt:], p)
+		s.offset += int64(n)
+		p = p[n:]
+	}
+	return nil
+}
+
+// grow preallocates the next chunk of the file and maps it.
+func (s *MmapSink) grow() error {
+	if err := s.unmap(); err != nil {
+		return err
+	}
+	if err := preallocate(s.file, s.size+s.ChunkSize); err != nil {
+		return err
+	}
+	chunk, err := mmapFile(s.file, s.size, int(s.ChunkSize))
+	if err == nil {
+		s.chunk, s.chunkAt = chunk, s.size
+	} // else written with WriteAt
+	s.size += s.ChunkSize
+	return nil
+}
+
+func (s *MmapSink) unmap() error {
+	if s.chunk == nil {
+		return nil
+	}
+	chunk := s.chunk
+	s.chunk = nil
+	return munmapFile(chunk)
+}
+
+// Close cuts the file to the data written and fills in the final shape.
+func (s *MmapSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.unmap()
+	if s.fields == nil {
+		s.fields = []string{"time"}
+	}
+	rows := 0
+	if s.header != 0 {
+		rows = int((s.offset - s.header) / int64(8*len(s.fields)))
+	}
+	header, herr := npyHeader(s.fields, rows, int(s.header))
+	for _, e := range []error{
+		herr,
+		s.file.Truncate(max(s.offset, int64(len(header)))),
+		func() error { _, err := s.file.WriteAt(header, 0); return err }(),
+		s.file.Sync(),
+		s.file.Close(),
+	} {
+		if err == nil {
+			err = e
+		}
+	}
+	s.file = nil
+	return err
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"os"
+	"syscall"
+)
+
+// preallocate reserves the blocks of the file up to size, contiguous as
+// far as the file system manages. File systems without fallocate get a
+// sparse file instead.
+func preallocate(f *os.File, size int64) error {
+	err := syscall.Fallocate(int(f.Fd()), 0, 0, size)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return f.Truncate(size)
+	}
+	return err
+}
+
+func mmapFile(f *os.File, offset int64, length int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), offset, length, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+func munmapFile(b []byte) error {
+	return syscall.Munmap(b)
+}
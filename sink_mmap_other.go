@@ -0,0 +1,24 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build !linux
+
+package lucigo
+
+import (
+	"errors"
+	"os"
+)
+
+func preallocate(f *os.File, size int64) error {
+	return f.Truncate(size)
+}
+
+func mmapFile(f *os.File, offset int64, length int) ([]byte, error) {
+	return nil, errors.New("memory-mapped files are only supported on Linux")
+}
+
+func munmapFile(b []byte) error {
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// NDJSONSink writes run data as newline delimited JSON, one object per
+// sample:
+//
+//	{"seq":0,"time":0,"values":{"x":0.5,"y":-0.25}}
+//
+// where seq counts the samples of the run and time is given in seconds
+// (see [Frame.Time]). This is readily consumed by jq, pandas
+// (read_json with lines=True) or log pipelines. Samples lost in
+// transmission (see [Integrity]) are marked by an object of its own
+// right where they are missing:
+//
+//	{"gap":{"offset":1024,"missing":256}}
+type NDJSONSink struct {
+	enc *json.Encoder
+}
+
+type ndjsonSample struct {
+	Seq    int                `json:"seq"`
+	Time   float64            `json:"time"`
+	Values map[string]float64 `json:"values"`
+}
+
+// NewNDJSONSink creates a NDJSONSink writing to w. Closing the sink does not close w.
+func NewNDJSONSink(w io.Writer) *NDJSONSink {
+	return &NDJSONSink{enc: json.NewEncoder(w)}
+}
+
+func (s *NDJSONSink) Begin(run *Run) error {
+	return nil
+}
+
+func (s *NDJSONSink) WriteFrame(frame Frame) error {
+	if frame.Gap != 0 {
+		gap := struct {
+			Gap Gap `json:"gap"`
+		}{Gap{Offset: frame.Offset, Missing: frame.Gap}}
+		if err := s.enc.Encode(gap); err != nil {
+			return err
+		}
+	}
+	for i, sample := range frame.Samples {
+		line := ndjsonSample{
+			Seq:    frame.Offset + i,
+			Time:   frame.Time(i),
+			Values: make(map[string]float64, len(sample)),
+		}
+		for c, value := range sample {
+			line.Values[frame.Channels[c].Name] = value
+		}
+		if err := s.enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *NDJSONSink) Close() error {
+	return nil
+}
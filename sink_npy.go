@@ -0,0 +1,150 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// NPYSink writes the data of a run as NumPy .npy file, i.e. a structured
+// array with a float64 field "time" (in seconds) followed by one float64
+// field per channel:
+//
+//	data = np.load("run.npy")
+//	plt.plot(data["time"], data["x"])
+//
+// The shape of the array has to be known before writing, so the data is
+// kept in memory and written on Close.
+type NPYSink struct {
+	out     io.Writer
+	fields  []string
+	samples []float64 // row major, including the time column
+}
+
+// NewNPYSink creates a NPYSink writing to w. Closing the sink does not close w.
+func NewNPYSink(w io.Writer) *NPYSink {
+	return &NPYSink{out: w}
+}
+
+func (s *NPYSink) Begin(run *Run) error {
+	return nil
+}
+
+func (s *NPYSink) WriteFrame(frame Frame) error {
+	if s.fields == nil {
+		s.fields = []string{"time"}
+		for _, channel := range frame.Channels {
+			s.fields = append(s.fields, channel.Name)
+		}
+	}
+	for i, sample := range frame.Samples {
+		s.samples = append(s.samples, frame.Time(i))
+		s.samples = append(s.samples, sample...)
+	}
+	return nil
+}
+
+func (s *NPYSink) Close() error {
+	if s.fields == nil {
+		s.fields = []string{"time"}
+	}
+	return writeNPY(s.out, s.fields, s.samples)
+}
+
+// NPZWriter collects the data of several runs (such as a parameter sweep)
+// into a single NumPy .npz archive, one array per run:
+//
+//	sweep = np.load("sweep.npz")
+//	for name in sweep.files: ...
+type NPZWriter struct {
+	zip *zip.Writer
+}
+
+// NewNPZWriter creates a NPZWriter writing to w. Closing the writer does not close w.
+func NewNPZWriter(w io.Writer) *NPZWriter {
+	return &NPZWriter{zip: zip.NewWriter(w)}
+}
+
+// Sink returns a sink adding the data of a single run to the archive, as
+// array with the given name. Arrays are added when the sink is closed.
+func (z *NPZWriter) Sink(name string) Sink {
+	return &npzEntry{NPYSink: NewNPYSink(&bytes.Buffer{}), zip: z.zip, name: name}
+}
+
+// Close finishes the archive, after all sinks have been closed.
+func (z *NPZWriter) Close() error {
+	return z.zip.Close()
+}
+
+type npzEntry struct {
+	*NPYSink
+	zip  *zip.Writer
+	name string
+}
+
+func (e *npzEntry) Close() error {
+	w, err := e.zip.Create(e.name + ".npy")
+	if err != nil {
+		return err
+	}
+	e.out = w
+	return e.NPYSink.Close()
+}
+
+// writeNPY writes a structured array with float64 fields in the NPY format,
+// version 1.0. See https://numpy.org/doc/stable/reference/generated/numpy.lib.format.html
+func writeNPY(w io.Writer, fields []string, data []float64) error {
+	header, err := npyHeader(fields, len(data)/len(fields), 0)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, data)
+}
+
+// npyHeader returns the magic, version and header of a NPY file holding
+// rows records of the fields, padded to at least size bytes.
+func npyHeader(fields []string, rows int, size int) ([]byte, error) {
+	descr := make([]string, len(fields))
+	for i, field := range fields {
+		descr[i] = fmt.Sprintf("(%s, '<f8')", pyString(field))
+	}
+	header := fmt.Sprintf("{'descr': [%s], 'fortran_order': False, 'shape': (%d,), }",
+		strings.Join(descr, ", "), rows)
+
+	// magic, version and header length take 10 bytes. The header is padded
+	// with spaces and a final newline, such that the data is 64 byte aligned.
+	padding := 64 - (10+len(header)+1)%64
+	if padding == 64 {
+		padding = 0
+	}
+	if short := size - (10 + len(header) + 1 + padding); short > 0 {
+		padding += (short + 63) / 64 * 64
+	}
+	header += strings.Repeat(" ", padding) + "\n"
+	if len(header) > math.MaxUint16 {
+		return nil, fmt.Errorf("NPY header too long for %d fields", len(fields))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(&buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	return buf.Bytes(), nil
+}
+
+// pyString quotes s as a Python string literal.
+func pyString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+//go:build parquet
+
+// Parquet support pulls in a sizeable dependency and is therefore only
+// built with the parquet build tag:
+//
+//	go get github.com/parquet-go/parquet-go
+//	go build -tags parquet ./...
+
+package lucigo
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// ParquetSink writes run data as Apache Parquet with a DOUBLE column "time"
+// (in seconds) and one DOUBLE column per channel, named by the channel.
+// The run configuration is stored in the key/value metadata of the file,
+// with keys prefixed by "lucigo.". The file is complete once the sink is
+// closed, also without any data. The names of the channels have to be
+// unique and other than "time".
+type ParquetSink struct {
+	out     io.Writer
+	run     *Run
+	writer  *parquet.Writer
+	columns []int // index of the time column followed by the channel columns
+}
+
+// NewParquetSink creates a ParquetSink writing to w. Closing the sink does not close w.
+func NewParquetSink(w io.Writer) *ParquetSink {
+	return &ParquetSink{out: w}
+}
+
+func (s *ParquetSink) Begin(run *Run) error {
+	s.run = run
+	return checkParquetColumns(run.Channels)
+}
+
+// checkParquetColumns tells whether the channels can be columns next to
+// the time column, whose names have to be unique.
+func checkParquetColumns(channels []Channel) error {
+	names := map[string]bool{"time": true}
+	for _, channel := range channels {
+		if names[channel.Name] {
+			return fmt.Errorf("parquet: channel %q collides with another column", channel.Name)
+		}
+		names[channel.Name] = true
+	}
+	return nil
+}
+
+// open creates the writer, which can only happen once the channels are known.
+func (s *ParquetSink) open(channels []Channel) error {
+	if err := checkParquetColumns(channels); err != nil {
+		return err
+	}
+	group := parquet.Group{"time": parquet.Leaf(parquet.DoubleType)}
+	for _, channel := range channels {
+		group[channel.Name] = parquet.Leaf(parquet.DoubleType)
+	}
+	schema := parquet.NewSchema("run", group)
+
+	// columns of a group are sorted by name, so look up where ours ended up
+	index := make(map[string]int)
+	for i, path := range schema.Columns() {
+		index[path[0]] = i
+	}
+	s.columns = []int{index["time"]}
+	for _, channel := range channels {
+		s.columns = append(s.columns, index[channel.Name])
+	}
+
+	s.writer = parquet.NewWriter(s.out, schema,
+		parquet.KeyValueMetadata("lucigo.run_id", s.run.Id.String()),
+		parquet.KeyValueMetadata("lucigo.started", s.run.Started.Format(time.RFC3339)),
+		parquet.KeyValueMetadata("lucigo.ic_time_ns", fmt.Sprint(s.run.Config.IcTime)),
+		parquet.KeyValueMetadata("lucigo.op_time_ns", fmt.Sprint(s.run.Config.OpTime)),
+		parquet.KeyValueMetadata("lucigo.sample_rate", fmt.Sprint(s.run.DAQ.SampleRate)),
+	)
+	return nil
+}
+
+func (s *ParquetSink) WriteFrame(frame Frame) error {
+	if s.writer == nil {
+		if err := s.open(frame.Channels); err != nil {
+			return err
+		}
+	}
+	rows := make([]parquet.Row, len(frame.Samples))
+	for i, sample := range frame.Samples {
+		row := make(parquet.Row, len(s.columns))
+		column := s.columns[0]
+		row[column] = parquet.DoubleValue(frame.Time(i)).Level(0, 0, column)
+		for c, value := range sample {
+			column = s.columns[c+1]
+			row[column] = parquet.DoubleValue(value).Level(0, 0, column)
+		}
+		rows[i] = row
+	}
+	_, err := s.writer.WriteRows(rows)
+	return err
+}
+
+func (s *ParquetSink) Close() error {
+	if s.writer == nil {
+		// no data, but still a file of the columns there would be
+		if err := s.open(s.run.Channels); err != nil {
+			return err
+		}
+	}
+	return s.writer.Close()
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import "sync"
+
+// RingBuffer is a Sink keeping only the most recent samples of a run in
+// memory, for continuous acquisitions where the memory use of a
+// [Recording] would grow without bounds. To keep the last ten seconds,
+// use
+//
+//	buf := lucigo.NewRingBuffer(10 * daq.SampleRate)
+//
+// Snapshot may be called at any time from any goroutine, for instance by
+// a monitoring dashboard while the run is still being captured.
+type RingBuffer struct {
+	mu       sync.Mutex
+	run      *Run
+	channels []Channel
+	time     []float64
+	samples  [][]float64
+	next     int  // index to be written next
+	full     bool // whether next has wrapped around
+}
+
+// NewRingBuffer creates a RingBuffer holding at most capacity samples.
+func NewRingBuffer(capacity int) *RingBuffer {
+	return &RingBuffer{
+		time:    make([]float64, capacity),
+		samples: make([][]float64, capacity),
+	}
+}
+
+func (b *RingBuffer) Begin(run *Run) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.run = run
+	b.next, b.full = 0, false
+	return nil
+}
+
+func (b *RingBuffer) WriteFrame(frame Frame) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.samples) == 0 {
+		return nil
+	}
+	b.channels = frame.Channels
+	for i, sample := range frame.Samples {
+		b.time[b.next] = frame.Time(i)
+		b.samples[b.next] = sample
+		b.next++
+		if b.next == len(b.samples) {
+			b.next, b.full = 0, true
+		}
+	}
+	return nil
+}
+
+func (b *RingBuffer) Close() error {
+	return nil
+}
+
+// Len returns the number of samples currently held.
+func (b *RingBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.full {
+		return len(b.samples)
+	}
+	return b.next
+}
+
+// Snapshot returns a copy of the samples currently held, oldest first.
+func (b *RingBuffer) Snapshot() *Recording {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rec := &Recording{Run: b.run, Channels: b.channels}
+	if b.full {
+		rec.Time = append(rec.Time, b.time[b.next:]...)
+		rec.Samples = append(rec.Samples, b.samples[b.next:]...)
+	}
+	rec.Time = append(rec.Time, b.time[:b.next]...)
+	rec.Samples = append(rec.Samples, b.samples[:b.next]...)
+	return rec
+}
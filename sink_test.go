@@ -0,0 +1,278 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVSink(t *testing.T) {
+	hc := newPipeController(serveRun("[[0,16384],[32768,0]]", "[[-16384,0]]"))
+	run, err := hc.StartRun(testRunConfig, DAQConfig{NumChannels: 2, SampleRate: 4, ChannelNames: []string{"x", "y"}})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := run.Capture(NewCSVSink(&out)); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+
+	var data []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			data = append(data, line)
+		}
+	}
+	expected := []string{"time,x,y", "0,0,0.625", "0.25,1.25,0", "0.5,-0.625,0"}
+	if strings.Join(data, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected CSV output:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "# run: "+run.Id.String()) {
+		t.Fatalf("CSV output lacks run metadata:\n%s", out.String())
+	}
+}
+
+func TestNDJSONSink(t *testing.T) {
+	hc := newPipeController(serveRun("[[0,16384]]", "[[32768,0]]"))
+	run, err := hc.StartRun(testRunConfig, DAQConfig{NumChannels: 2, SampleRate: 2, ChannelNames: []string{"x", "y"}})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := run.Capture(NewNDJSONSink(&out)); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+
+	expected := `{"seq":0,"time":0,"values":{"x":0,"y":0.625}}` + "\n" +
+		`{"seq":1,"time":0.5,"values":{"x":1.25,"y":0}}` + "\n"
+	if out.String() != expected {
+		t.Fatalf("unexpected NDJSON output:\n%s", out.String())
+	}
+}
+
+func TestInfluxSink(t *testing.T) {
+	hc := newPipeController(serveRun("[[0,16384]]", "[[32768,0]]"))
+	run, err := hc.StartRun(testRunConfig, DAQConfig{NumChannels: 2, SampleRate: 2, ChannelNames: []string{"x", "y pos"}})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	run.Started = time.Unix(1718000000, 0)
+
+	var out bytes.Buffer
+	sink := NewInfluxSink(&out)
+	sink.Tags = map[string]string{"device": "lab,1"}
+	if err := run.Capture(sink); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+
+	tags := `lucidac,device=lab\,1,entity=00,run=` + run.Id.String()
+	expected := tags + ` x=0,y\ pos=0.625 1718000000000000000` + "\n" +
+		tags + ` x=1.25,y\ pos=0 1718000000500000000` + "\n"
+	if out.String() != expected {
+		t.Fatalf("unexpected line protocol output:\n%s", out.String())
+	}
+}
+
+func TestNPYSink(t *testing.T) {
+	hc := newPipeController(serveRun("[[0,16384],[32768,0]]"))
+	run, err := hc.StartRun(testRunConfig, DAQConfig{NumChannels: 2, SampleRate: 2, ChannelNames: []string{"x", "y's"}})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := run.Capture(NewNPYSink(&out)); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+
+	npy := out.Bytes()
+	if !bytes.HasPrefix(npy, []byte("\x93NUMPY\x01\x00")) {
+		t.Fatalf("missing NPY magic: %q", npy[:8])
+	}
+	headerLen := int(npy[8]) | int(npy[9])<<8
+	if (10+headerLen)%64 != 0 {
+		t.Fatalf("NPY data not aligned, header length %d", headerLen)
+	}
+	header := string(npy[10 : 10+headerLen])
+	expected := `{'descr': [('time', '<f8'), ('x', '<f8'), ('y\'s', '<f8')], 'fortran_order': False, 'shape': (2,), }`
+	if strings.TrimRight(header, " \n") != expected || !strings.HasSuffix(header, "\n") {
+		t.Fatalf("unexpected NPY header %q", header)
+	}
+	if len(npy)-10-headerLen != 2*3*8 {
+		t.Fatalf("expected 48 bytes of data, got %d", len(npy)-10-headerLen)
+	}
+}
+
+func TestMmapSink(t *testing.T) {
+	frame := "[" + strings.TrimSuffix(strings.Repeat("[16384,-16384],", 300), ",") + "]"
+	config := DAQConfig{NumChannels: 2, SampleRate: 1000, ChannelNames: []string{"x", "y"}}
+	var npy bytes.Buffer
+	run, _ := newPipeController(serveRun(frame, frame, frame)).StartRun(testRunConfig, config)
+	if err := run.Capture(NewNPYSink(&npy)); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "run.npy")
+	sink := NewMmapSink(path)
+	sink.ChunkSize = 1 // a page, such that the data spans several chunks
+	run, _ = newPipeController(serveRun(frame, frame, frame)).StartRun(testRunConfig, config)
+	if err := run.Capture(sink); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	mapped, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	headerLen := int(mapped[8]) | int(mapped[9])<<8
+	if (10+headerLen)%64 != 0 {
+		t.Fatalf("NPY data not aligned, header length %d", headerLen)
+	}
+	header := string(mapped[10 : 10+headerLen])
+	if !strings.Contains(header, "'shape': (900,)") {
+		t.Fatalf("expected the final shape in the header %q", header)
+	}
+	want := npy.Bytes()[10+(int(npy.Bytes()[8])|int(npy.Bytes()[9])<<8):]
+	if !bytes.Equal(mapped[10+headerLen:], want) {
+		t.Fatalf("expected the data written as by NPYSink, got %d bytes instead of %d", len(mapped)-10-headerLen, len(want))
+	}
+}
+
+func TestRecording_Stats(t *testing.T) {
+	hc := newPipeController(serveRun("[[0,16384],[32768,0]]", "[[-16384,-32768]]"))
+	run, err := hc.StartRun(testRunConfig, DAQConfig{NumChannels: 2, SampleRate: 2})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+
+	rec := &Recording{}
+	if err := run.Capture(rec); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if len(rec.Samples) != 3 || len(rec.Time) != 3 || rec.Time[2] != 1 {
+		t.Fatalf("unexpected recording %+v", rec)
+	}
+
+	expected := []ChannelStats{
+		{Channel: rec.Channels[0], Min: -0.625, Max: 1.25, Mean: 0.625 / 3},
+		{Channel: rec.Channels[1], Min: -1.25, Max: 0.625, Mean: -0.625 / 3},
+	}
+	for i, stats := range rec.Stats() {
+		if stats != expected[i] {
+			t.Fatalf("channel %d: expected %+v, got %+v", i, expected[i], stats)
+		}
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	hc := newPipeController(serveRun("[[1],[2],[3]]", "[[4],[5]]"))
+	run, err := hc.StartRun(testRunConfig, DAQConfig{NumChannels: 1, SampleRate: 1})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+
+	buf := NewRingBuffer(3)
+	if err := run.Capture(buf); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if buf.Len() != 3 {
+		t.Fatalf("expected 3 samples, got %d", buf.Len())
+	}
+	snapshot := buf.Snapshot()
+	for i, expected := range []float64{2, 3, 4} {
+		if snapshot.Time[i] != expected {
+			t.Fatalf("sample %d: expected time %v, got %v", i, expected, snapshot.Time[i])
+		}
+	}
+}
+
+func TestMetadataSink(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		switch sent.Type {
+		case "sys_ident":
+			fmt.Fprintf(w, `{"type":"sys_ident","msg":{"fw_build":{"firmware_version":"1.2.3"}}}`+"\n")
+		case "get_config":
+			fmt.Fprintf(w, `{"type":"get_config","msg":{"/0":{}}}`+"\n")
+		default:
+			serveRun("[[1],[2]]")(sent, w)
+		}
+	})
+
+	var out bytes.Buffer
+	meta := NewMetadataSink(&out, hc)
+	run, err := hc.StartRun(RunConfig{OpTime: 1000}, DAQConfig{NumChannels: 1})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	if err := run.Capture(meta); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+
+	var written RunMetadata
+	if err := json.Unmarshal(out.Bytes(), &written); err != nil {
+		t.Fatalf("cannot read back metadata: %v\n%s", err, out.String())
+	}
+	if written.RunId != run.Id || written.Samples != 2 || written.State != RunStateDone || written.Config.OpTime != 1000 {
+		t.Fatalf("unexpected run metadata %+v", written)
+	}
+	if written.Device["fw_build"] == nil || len(written.CircuitHash) != 64 {
+		t.Fatalf("unexpected device metadata %+v", written)
+	}
+}
+
+func TestMetadataSink_Repeated(t *testing.T) {
+	hc := newPipeController(serveRun("[[1],[2]]"))
+	agg, err := hc.RepeatRun(RunConfig{OpTime: 1000, Repetitions: 2}, DAQConfig{NumChannels: 1})
+	if err != nil {
+		t.Fatalf("RepeatRun: %v", err)
+	}
+
+	var out bytes.Buffer
+	meta := &MetadataSink{out: &out}
+	meta.Begin(agg.Runs[1].Run)
+	meta.WriteFrame(agg.Frame())
+	if err := meta.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	var written RunMetadata
+	if err := json.Unmarshal(out.Bytes(), &written); err != nil || written.Repetitions != 2 || written.Samples != 2 {
+		t.Fatalf("expected the metadata of the aggregate of 2 runs, got %+v, %v", written, err)
+	}
+}
+
+// testSink records which of its methods were called, failing Begin with err.
+type testSink struct {
+	err           error
+	begun, closed bool
+}
+
+func (s *testSink) Begin(run *Run) error         { s.begun = true; return s.err }
+func (s *testSink) WriteFrame(frame Frame) error { return nil }
+func (s *testSink) Close() error                 { s.closed = true; return nil }
+
+func TestCapture_BeginFails(t *testing.T) {
+	hc := newPipeController(serveRun("[[1]]"))
+	run, err := hc.StartRun(testRunConfig, DAQConfig{NumChannels: 1})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	sinks := []*testSink{{}, {err: fmt.Errorf("disk full")}, {}}
+	if err := run.Capture(sinks[0], sinks[1], sinks[2]); err == nil || err.Error() != "disk full" {
+		t.Fatalf("expected the error of Begin, got %v", err)
+	}
+	if !sinks[0].closed || sinks[1].closed || sinks[2].begun || sinks[2].closed {
+		t.Fatalf("expected only the sink begun to be closed, got %+v, %+v, %+v", *sinks[0], *sinks[1], *sinks[2])
+	}
+}
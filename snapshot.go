@@ -0,0 +1,207 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Snapshot is the complete state of a device, such that it can be archived,
+// shared with support or moved to replacement hardware. It is kept in a zip
+// archive, by convention with the extension .lucisnap, of JSON files:
+//
+//	snapshot.json   when and from where it was taken, and the device identity
+//	settings.json   the permanent settings, including the calibration
+//	circuit.json    the circuit configured, as answered to get_config
+//	entities.json   the entity tree, as answered to get_entities
+//
+// Parts the device did not answer are nil and missing in the archive.
+type Snapshot struct {
+	Created  time.Time              `json:"created"`
+	Endpoint string                 `json:"endpoint,omitempty"`
+	Device   map[string]interface{} `json:"device"` // as answered to sys_ident
+	Lucigo   string                 `json:"lucigo,omitempty"`
+
+	Settings NetSettings            `json:"-"`
+	Circuit  map[string]interface{} `json:"-"`
+	Entities map[string]interface{} `json:"-"`
+}
+
+// TakeSnapshot reads the state of the device. Identity and settings are
+// required, devices which cannot tell their circuit or entities are
+// tolerated.
+func TakeSnapshot(hc *HybridController) (*Snapshot, error) {
+	snap := &Snapshot{Created: time.Now().UTC()}
+	if hc.Endpoint != nil {
+		snap.Endpoint = hc.Endpoint.ToURL()
+	}
+	ident, err := hc.Query("sys_ident")
+	if err != nil {
+		return nil, err
+	}
+	snap.Device = ident.Msg
+	if snap.Settings, err = hc.NetSettings(); err != nil {
+		return nil, err
+	}
+	if res, err := hc.Query("get_config"); err == nil {
+		snap.Circuit = res.Msg
+	} else {
+		hc.logger(LayerProtocol).Warn("TakeSnapshot: No circuit configuration", "err", err)
+	}
+	if res, err := hc.Query("get_entities"); err == nil {
+		snap.Entities = res.Msg
+	} else {
+		hc.logger(LayerProtocol).Warn("TakeSnapshot: No entities", "err", err)
+	}
+	return snap, nil
+}
+
+// Firmware describes the firmware the snapshot was taken from, such as
+// "LUCIDAC 0.3.1-12-gabcdef", as far as the device told.
+func (s *Snapshot) Firmware() string {
+	name, _ := s.Device["fw_name"].(string)
+	build, _ := s.Device["fw_build"].(string)
+	switch {
+	case name == "":
+		return build
+	case build == "":
+		return name
+	}
+	return name + " " + build
+}
+
+// Calibration returns the calibration section of the settings, nil if the
+// device has none.
+func (s *Snapshot) Calibration() map[string]interface{} {
+	calibration, _ := s.Settings["calibration"].(map[string]interface{})
+	return calibration
+}
+
+// Write writes the snapshot as zip archive.
+func (s *Snapshot) Write(w io.Writer) error {
+	archive := zip.NewWriter(w)
+	parts := []struct {
+		name    string
+		part    interface{}
+		present bool
+	}{
+		{"snapshot.json", s, true},
+		{"settings.json", s.Settings, s.Settings != nil},
+		{"circuit.json", s.Circuit, s.Circuit != nil},
+		{"entities.json", s.Entities, s.Entities != nil},
+	}
+	for _, p := range parts {
+		if !p.present {
+			continue
+		}
+		f, err := archive.Create(p.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(p.part); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// Save writes the snapshot to the file at path.
+func (s *Snapshot) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadSnapshot reads a snapshot from a zip archive of the given size.
+func ReadSnapshot(r io.ReaderAt, size int64) (*Snapshot, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not a snapshot: %w", err)
+	}
+	snap := &Snapshot{}
+	parts := map[string]interface{}{"snapshot.json": snap, "settings.json": &snap.Settings, "circuit.json": &snap.Circuit, "entities.json": &snap.Entities}
+	for _, f := range archive.File {
+		part, ok := parts[f.Name]
+		if !ok {
+			continue // of later versions
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		err = json.NewDecoder(rc).Decode(part)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in snapshot: %w", f.Name, err)
+		}
+		delete(parts, f.Name)
+	}
+	if _, missing := parts["snapshot.json"]; missing {
+		return nil, errors.New("not a snapshot: no snapshot.json")
+	}
+	return snap, nil
+}
+
+// LoadSnapshot reads the snapshot in the file at path.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ReadSnapshot(f, info.Size())
+}
+
+// RestoreSnapshot brings the device into the state of the snapshot: The
+// settings are written as with UpdateSettings, except for the read-only
+// ones such as the MAC address of the device taken from, and the circuit
+// is configured with set_config. Parts which are nil are left alone, such
+// as to restore only the settings. The entities are not restored, they
+// describe the hardware.
+func (hc *HybridController) RestoreSnapshot(snap *Snapshot) error {
+	if snap.Settings != nil {
+		schema, err := hc.SettingsSchema()
+		if err != nil {
+			return fmt.Errorf("cannot restore settings: %w", err)
+		}
+		flat := flattenSettings("", snap.Settings, nil)
+		err = hc.UpdateSettings(func(s *NetSettings) error {
+			for _, key := range sortedKeys(flat) {
+				if setting, ok := schema.Lookup(key); ok && setting.ReadOnly {
+					continue
+				}
+				s.Set(key, flat[key])
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("cannot restore settings: %w", err)
+		}
+	}
+	if snap.Circuit != nil {
+		if _, err := hc.QueryMsg("set_config", snap.Circuit); err != nil {
+			return fmt.Errorf("cannot restore circuit: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// snapshotDevice answers like a device with the given settings, which
+// net_set changes, and records the messages of net_set and set_config.
+func snapshotDevice(settings map[string]interface{}, sent map[string][]string) *HybridController {
+	return newPipeController(func(env SendEnvelope, w io.Writer) {
+		msg := "{}"
+		switch env.Type {
+		case "sys_ident":
+			msg = `{"fw_name":"LUCIDAC","fw_build":"0.3.1"}`
+		case "net_get":
+			raw, _ := json.Marshal(settings)
+			msg = string(raw)
+		case "net_set":
+			raw, _ := json.Marshal(env.Msg)
+			sent["net_set"] = append(sent["net_set"], string(raw))
+			for key, value := range flattenSettings("", env.Msg.(map[string]interface{}), nil) {
+				NetSettings(settings).Set(key, value)
+			}
+		case "get_config":
+			msg = `{"entity":["04-E9-E5-14-74-BF"],"config":{"/0":{"/M0":{"elements":[{"ic":0.5}]}}}}`
+		case "get_entities":
+			msg = `{"entities":{"04-E9-E5-14-74-BF":{"class":1}}}`
+		case "set_config":
+			raw, _ := json.Marshal(env.Msg)
+			sent["set_config"] = append(sent["set_config"], string(raw))
+		default:
+			fmt.Fprintf(w, `{"type":"%s","id":"%s","code":-1,"error":"unknown type","msg":{}}`+"\n", env.Type, env.Id)
+			return
+		}
+		fmt.Fprintf(w, `{"type":"%s","id":"%s","code":0,"msg":%s}`+"\n", env.Type, env.Id, msg)
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	sent := map[string][]string{}
+	hc := snapshotDevice(map[string]interface{}{
+		"ethernet":    map[string]interface{}{"mac": "04-E9-E5-14-74-BF", "mtu": 9000},
+		"calibration": map[string]interface{}{"offset": -0.00012},
+	}, sent)
+	snap, err := TakeSnapshot(hc)
+	if err != nil {
+		t.Fatalf("TakeSnapshot: %v", err)
+	}
+	if snap.Firmware() != "LUCIDAC 0.3.1" || snap.Calibration()["offset"] != -0.00012 || snap.Entities == nil {
+		t.Fatalf("unexpected snapshot %+v", snap)
+	}
+
+	var archive bytes.Buffer
+	if err := snap.Write(&archive); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	read, err := ReadSnapshot(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatalf("ReadSnapshot: %v", err)
+	}
+	if read.Firmware() != snap.Firmware() || !snap.Created.Equal(read.Created) || fmt.Sprint(read.Settings) != fmt.Sprint(snap.Settings) || fmt.Sprint(read.Circuit) != fmt.Sprint(snap.Circuit) {
+		t.Fatalf("expected the snapshot read back unchanged, got %+v", read)
+	}
+	if _, err := ReadSnapshot(bytes.NewReader([]byte("not a zip")), 9); err == nil {
+		t.Fatalf("expected an error for no archive")
+	}
+
+	replacement := map[string]interface{}{"ethernet": map[string]interface{}{"mac": "04-E9-E5-00-00-01", "mtu": 1500}}
+	hc = snapshotDevice(replacement, sent)
+	if err := hc.RestoreSnapshot(read); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	if len(sent["net_set"]) != 1 || sent["net_set"][0] != `{"calibration":{"offset":-0.00012},"ethernet":{"mtu":9000}}` {
+		t.Fatalf("expected the settings restored but the MAC address, got net_set %v", sent["net_set"])
+	}
+	if len(sent["set_config"]) != 1 || sent["set_config"][0] != `{"config":{"/0":{"/M0":{"elements":[{"ic":0.5}]}}},"entity":["04-E9-E5-14-74-BF"]}` {
+		t.Fatalf("expected the circuit restored, got set_config %v", sent["set_config"])
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SysIdent is the identity of a device, as answered to sys_ident:
+//
+//	{"fw_name": "LUCIDAC", "fw_build": "0.3.1-12-gabcdef", "mac": "04-E9-E5-14-74-BF"}
+type SysIdent struct {
+	FwName  string `json:"fw_name"`
+	FwBuild string `json:"fw_build"`
+	Mac     string `json:"mac"` // which also serves as serial number
+}
+
+// Firmware describes the firmware, such as "LUCIDAC 0.3.1-12-gabcdef".
+func (id *SysIdent) Firmware() string {
+	return strings.TrimSpace(id.FwName + " " + id.FwBuild)
+}
+
+// NetStatus is the network status of a device, as answered to net_status:
+//
+//	{"has_ethernet": true, "link": true}
+type NetStatus struct {
+	HasEthernet bool `json:"has_ethernet"`
+	Link        bool `json:"link"` // whether the ethernet cable is plugged in
+}
+
+// SysIdent asks the device for its identity.
+func (hc *HybridController) SysIdent() (*SysIdent, error) {
+	res, err := hc.Query("sys_ident")
+	if err != nil {
+		return nil, err
+	}
+	return DecodeSysIdent(res)
+}
+
+// DecodeSysIdent decodes the answer to sys_ident.
+func DecodeSysIdent(res *RecvEnvelope) (*SysIdent, error) {
+	ident := &SysIdent{}
+	if err := decodeAnswer(res, "sys_ident", ident); err != nil {
+		return nil, err
+	}
+	return ident, nil
+}
+
+// NetStatus asks the device for its network status.
+func (hc *HybridController) NetStatus() (*NetStatus, error) {
+	res, err := hc.Query("net_status")
+	if err != nil {
+		return nil, err
+	}
+	return DecodeNetStatus(res)
+}
+
+// DecodeNetStatus decodes the answer to net_status.
+func DecodeNetStatus(res *RecvEnvelope) (*NetStatus, error) {
+	status := &NetStatus{}
+	if err := decodeAnswer(res, "net_status", status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// decodeAnswer decodes the message of a successful answer, the error code
+// of any other is returned as error.
+func decodeAnswer(res *RecvEnvelope, Type string, into interface{}) error {
+	if !res.IsSuccess() {
+		return &DeviceError{Type: Type, Code: res.Code, Message: res.Error}
+	}
+	if err := res.DecodeMsg(into); err != nil {
+		return fmt.Errorf("cannot decode answer to %s: %w", Type, err)
+	}
+	return nil
+}
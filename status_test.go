@@ -0,0 +1,35 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestSysIdent_NetStatus(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		switch sent.Type {
+		case "sys_ident":
+			fmt.Fprintf(w, `{"type":"sys_ident","id":"%s","code":0,"msg":{"fw_name":"LUCIDAC","fw_build":"0.3.1","mac":"04-E9-E5-14-74-BF","uptime":42}}`+"\n", sent.Id)
+		case "net_status":
+			fmt.Fprintf(w, `{"type":"net_status","id":"%s","code":0,"msg":{"has_ethernet":true,"link":"yes"}}`+"\n", sent.Id)
+		}
+	})
+	ident, err := hc.SysIdent()
+	if err != nil {
+		t.Fatalf("SysIdent: %v", err)
+	}
+	if ident.Mac != "04-E9-E5-14-74-BF" || ident.Firmware() != "LUCIDAC 0.3.1" {
+		t.Fatalf("unexpected identity %+v", ident)
+	}
+	if _, err := hc.NetStatus(); err == nil {
+		t.Fatalf("expected a link of the wrong type refused")
+	}
+	if _, err := DecodeNetStatus(&RecvEnvelope{Type: "net_status", Code: -2, Error: "not now"}); err == nil || err.Error() != "net_status returned code -2: not now" {
+		t.Fatalf("expected the error code returned, got %v", err)
+	}
+}
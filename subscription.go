@@ -0,0 +1,142 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"sync/atomic"
+)
+
+// Number of messages buffered for a Subscription before further ones are dropped
+const subscriptionBuffer = 64
+
+// Subscription receives messages the device sends without being asked
+// for, such as its log or the state changes of runs, on C:
+//
+//	sub := hc.Subscribe("log", "overload")
+//	defer sub.Close()
+//	for event := range sub.C {
+//		fmt.Printf("%s: %v\n", event.Type, event.Msg)
+//	}
+//
+// The messages are shared between subscriptions and must not be modified.
+// A subscriber falling behind misses messages rather than stalling the
+// connection, see Dropped.
+type Subscription struct {
+	C <-chan *RecvEnvelope
+
+	hc      *HybridController
+	c       chan *RecvEnvelope
+	handler func(*RecvEnvelope) // instead of c, see Handle
+	types   map[string]bool     // all if empty
+	dropped atomic.Int64
+}
+
+// Subscribe registers for the unsolicited messages of the given types,
+// such as log, run_state_change, overload or settings_changed, and for all
+// of them without types. Answers to commands are not passed on.
+//
+// The connection is read from then on, see Go. The subscription stays
+// across a Reconnect, until it or the controller is closed.
+func (hc *HybridController) Subscribe(types ...string) *Subscription {
+	sub := &Subscription{hc: hc, c: make(chan *RecvEnvelope, subscriptionBuffer)}
+	sub.C = sub.c
+	return hc.subscribe(sub, types)
+}
+
+// Handle registers a handler for the unsolicited messages of the given
+// types, as Subscribe does, which is called for each of them while the
+// connection is read:
+//
+//	sub := hc.Handle(func(event *lucigo.RecvEnvelope) {
+//		log.Printf("device: %v", event.Msg["text"])
+//	}, "log")
+//	defer sub.Close()
+//
+// No message is missed, but the next line is only read once the handler
+// returns; it must not wait for the answers to commands. Messages read
+// after the subscription, whose C is nil, is closed are not handled.
+func (hc *HybridController) Handle(handler func(*RecvEnvelope), types ...string) *Subscription {
+	return hc.subscribe(&Subscription{hc: hc, handler: handler}, types)
+}
+
+func (hc *HybridController) subscribe(sub *Subscription, types []string) *Subscription {
+	sub.types = make(map[string]bool)
+	for _, Type := range types {
+		sub.types[Type] = true
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.closed {
+		if sub.c != nil {
+			close(sub.c)
+		}
+		return sub
+	}
+	hc.subMu.Lock()
+	if hc.subscriptions == nil {
+		hc.subscriptions = make(map[*Subscription]bool)
+	}
+	hc.subscriptions[sub] = true
+	hc.subMu.Unlock()
+	if hc.Reader != nil {
+		hc.reading()
+	}
+	return sub
+}
+
+// Close ends the subscription and closes C.
+func (sub *Subscription) Close() {
+	sub.hc.subMu.Lock()
+	defer sub.hc.subMu.Unlock()
+	if sub.hc.subscriptions[sub] {
+		delete(sub.hc.subscriptions, sub)
+		if sub.c != nil {
+			close(sub.c)
+		}
+	}
+}
+
+// Dropped returns the number of messages missed as C was full.
+func (sub *Subscription) Dropped() int64 {
+	return sub.dropped.Load()
+}
+
+// publish passes an unsolicited message on to the subscriptions for its
+// type. It reports whether there was any.
+func (hc *HybridController) publish(envelope *RecvEnvelope) bool {
+	var handlers []func(*RecvEnvelope)
+	hc.subMu.Lock()
+	var event *RecvEnvelope
+	for sub := range hc.subscriptions {
+		if len(sub.types) != 0 && !sub.types[envelope.Type] {
+			continue
+		}
+		if event == nil {
+			// a copy of its own, as the envelope is handled further
+			event = &RecvEnvelope{}
+			*event = *envelope
+			if event.raw != nil {
+				json.Unmarshal(event.raw, &event.Msg)
+				event.raw = nil
+			}
+		}
+		if sub.handler != nil {
+			handlers = append(handlers, sub.handler)
+			continue
+		}
+		select {
+		case sub.c <- event:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+	hc.subMu.Unlock()
+	// called without the lock, such that handlers may close subscriptions
+	for _, handler := range handlers {
+		handler(event)
+	}
+	return event != nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestHybridController_Subscribe(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		fmt.Fprintf(w, `{"type":"log","msg":{"text":"booted"}}`+"\n")
+		fmt.Fprintf(w, `{"type":"run_state_change","msg":{"old":"IC","new":"OP"}}`+"\n")
+		for i := 0; i < subscriptionBuffer; i++ {
+			fmt.Fprintf(w, `{"type":"overload","msg":{"element":%d}}`+"\n", i)
+		}
+		fmt.Fprintf(w, `{"type":"%s","id":"%s","code":0,"msg":{}}`+"\n", sent.Type, sent.Id)
+	})
+	logs := hc.Subscribe("log", "run_state_change")
+	all := hc.Subscribe()
+	if _, err := hc.Query("sys_ident"); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+
+	for _, expected := range []string{"log", "run_state_change"} {
+		if event := <-logs.C; event.Type != expected {
+			t.Fatalf("expected a %s message, got %+v", expected, event)
+		}
+	}
+	if len(logs.C) != 0 || logs.Dropped() != 0 {
+		t.Fatalf("expected only the subscribed messages, got %d more and %d dropped", len(logs.C), logs.Dropped())
+	}
+	if event := <-all.C; event.Type != "log" || event.Msg["text"] != "booted" {
+		t.Fatalf("expected the decoded log message, got %+v", event)
+	}
+	if all.Dropped() != 2 {
+		t.Fatalf("expected 2 messages dropped beyond the buffer, got %d", all.Dropped())
+	}
+
+	logs.Close()
+	if _, ok := <-logs.C; ok {
+		t.Fatalf("expected the channel to be closed")
+	}
+	logs.Close()
+}
+
+func TestHybridController_Handle(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		for i := 0; i < 2*subscriptionBuffer; i++ {
+			fmt.Fprintf(w, `{"type":"log","msg":{"text":"line %d"}}`+"\n", i)
+		}
+		fmt.Fprintf(w, `{"type":"%s","id":"%s","code":0,"msg":{}}`+"\n", sent.Type, sent.Id)
+	})
+	var lines []string
+	sub := hc.Handle(func(event *RecvEnvelope) {
+		lines = append(lines, event.Msg["text"].(string))
+	}, "log")
+	if _, err := hc.Query("sys_ident"); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(lines) != 2*subscriptionBuffer || lines[0] != "line 0" {
+		t.Fatalf("expected all %d log lines handled, got %d", 2*subscriptionBuffer, len(lines))
+	}
+
+	sub.Close()
+	hc.Query("sys_ident")
+	if len(lines) != 2*subscriptionBuffer {
+		t.Fatalf("expected no messages handled after Close, got %d", len(lines))
+	}
+}
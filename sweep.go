@@ -0,0 +1,116 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Sweep runs the same experiment for every combination of parameter values
+// (the cartesian product of Parameters). For each point, Apply configures
+// the device (for instance by setting coefficients of the circuit), then a
+// run is executed and recorded.
+//
+//	sweep := &lucigo.Sweep{
+//		Parameters: map[string][]float64{"k": {0.1, 0.2, 0.5}},
+//		Apply:      func(hc *lucigo.HybridController, p map[string]float64) error { ... },
+//		Config:     lucigo.RunConfig{IcTime: 100000, OpTime: 1000000},
+//		DAQ:        lucigo.DAQConfig{NumChannels: 2, SampleOp: true, SampleRate: 100000},
+//	}
+//	for result := range sweep.Run(ctx, hc) { ... }
+//
+// An interrupted sweep can be resumed by setting Start to the index of the
+// first point which did not complete.
+type Sweep struct {
+	Parameters map[string][]float64
+	Apply      func(hc *HybridController, parameters map[string]float64) error
+	Config     RunConfig
+	DAQ        DAQConfig
+	Start      int // index into Points to begin with
+}
+
+// SweepResult is the outcome of a single point of a Sweep.
+type SweepResult struct {
+	Index      int // into Points
+	Parameters map[string]float64
+	Data       *Recording
+	Err        error
+}
+
+// Points returns all parameter combinations in the order they are run.
+// The last parameter (in sorted order of the names) varies fastest.
+func (s *Sweep) Points() []map[string]float64 {
+	names := make([]string, 0, len(s.Parameters))
+	for name := range s.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	points := []map[string]float64{{}}
+	for _, name := range names {
+		var next []map[string]float64
+		for _, point := range points {
+			for _, value := range s.Parameters[name] {
+				p := make(map[string]float64, len(point)+1)
+				for k, v := range point {
+					p[k] = v
+				}
+				p[name] = value
+				next = append(next, p)
+			}
+		}
+		points = next
+	}
+	return points
+}
+
+// Run executes the sweep in the background and delivers a result per point.
+// The channel is closed after the last point, after the first failing point
+// (whose result carries the error) or once ctx is cancelled. Cancellation
+// takes effect between points, a run in progress is completed.
+//
+// No other runs may be started on the controller until the channel is closed.
+func (s *Sweep) Run(ctx context.Context, hc *HybridController) <-chan SweepResult {
+	results := make(chan SweepResult)
+	go func() {
+		defer close(results)
+		points := s.Points()
+		for i := s.Start; i < len(points); i++ {
+			if ctx.Err() != nil {
+				return
+			}
+			result := s.runPoint(hc, i, points[i])
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				return
+			}
+			if result.Err != nil {
+				return
+			}
+		}
+	}()
+	return results
+}
+
+func (s *Sweep) runPoint(hc *HybridController, index int, parameters map[string]float64) SweepResult {
+	result := SweepResult{Index: index, Parameters: parameters}
+	if s.Apply != nil {
+		if err := s.Apply(hc, parameters); err != nil {
+			result.Err = fmt.Errorf("applying %v: %w", parameters, err)
+			return result
+		}
+	}
+	run, err := hc.StartRun(s.Config, s.DAQ)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Data = &Recording{}
+	result.Err = run.Capture(result.Data)
+	return result
+}
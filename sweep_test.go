@@ -0,0 +1,53 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSweep_Points(t *testing.T) {
+	sweep := &Sweep{Parameters: map[string][]float64{"b": {1, 2}, "a": {10, 20, 30}}}
+	points := sweep.Points()
+	if len(points) != 6 {
+		t.Fatalf("expected 6 points, got %d", len(points))
+	}
+	if !reflect.DeepEqual(points[1], map[string]float64{"a": 10, "b": 2}) {
+		t.Fatalf("unexpected order of points %v", points)
+	}
+}
+
+func TestSweep_Run(t *testing.T) {
+	hc := newPipeController(serveRun("[[1],[2]]"))
+	var applied []float64
+	sweep := &Sweep{
+		Parameters: map[string][]float64{"k": {0.1, 0.2, 0.3}},
+		Apply: func(hc *HybridController, p map[string]float64) error {
+			applied = append(applied, p["k"])
+			return nil
+		},
+		Config: testRunConfig,
+		DAQ:    DAQConfig{NumChannels: 1},
+		Start:  1, // resume
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var indices []int
+	for result := range sweep.Run(ctx, hc) {
+		if result.Err != nil {
+			t.Fatalf("point %d failed: %v", result.Index, result.Err)
+		}
+		if len(result.Data.Samples) != 2 {
+			t.Fatalf("point %d: expected 2 samples, got %d", result.Index, len(result.Data.Samples))
+		}
+		indices = append(indices, result.Index)
+	}
+	if !reflect.DeepEqual(indices, []int{1, 2}) || !reflect.DeepEqual(applied, []float64{0.2, 0.3}) {
+		t.Fatalf("unexpected points run: indices %v, applied %v", indices, applied)
+	}
+}
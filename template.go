@@ -0,0 +1,111 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CircuitTemplate is a circuit file with variables such as {{k1}} in
+// place of numbers, serving a whole family of experiments:
+//
+//	{"integrators": [{"ic": {{ic_x}}}, {"ic": 0}],
+//	 "routes": [{"from": 0, "lane": 0, "coefficient": {{k1}}, "to": 1}]}
+//
+// The variables are filled in before the circuit is used, such as for each
+// point of a Sweep:
+//
+//	tmpl, err := lucigo.LoadCircuitTemplate("oscillator.json")
+//	sweep := &lucigo.Sweep{
+//		Parameters: map[string][]float64{"k1": {0.5, 1, 2}, "ic_x": {0.1}},
+//		Apply: func(hc *lucigo.HybridController, p map[string]float64) error {
+//			circuit, err := tmpl.Circuit(p)
+//			...
+//		},
+//	}
+type CircuitTemplate struct {
+	Text []byte
+}
+
+// templateVariable matches {{name}}, also with spaces inside the braces.
+var templateVariable = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// LoadCircuitTemplate reads the template in the file at path. Files without
+// variables are templates as well, which expand to themselves.
+func LoadCircuitTemplate(path string) (*CircuitTemplate, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &CircuitTemplate{Text: text}, nil
+}
+
+// Variables returns the names of the variables used, sorted.
+func (t *CircuitTemplate) Variables() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, m := range templateVariable.FindAllSubmatch(t.Text, -1) {
+		if name := string(m[1]); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Expand fills in the values of the variables. All variables used must be
+// given a value; values of variables not used are an error as well, as
+// they are likely misspelled.
+func (t *CircuitTemplate) Expand(values map[string]float64) ([]byte, error) {
+	var missing, unused []string
+	for _, name := range t.Variables() {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	used := map[string]bool{}
+	for _, name := range t.Variables() {
+		used[name] = true
+	}
+	for name := range values {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	switch {
+	case len(missing) != 0:
+		return nil, fmt.Errorf("no value for the variables %s of the circuit", strings.Join(missing, ", "))
+	case len(unused) != 0:
+		return nil, fmt.Errorf("the circuit has no variables %s", strings.Join(unused, ", "))
+	}
+	return templateVariable.ReplaceAllFunc(t.Text, func(m []byte) []byte {
+		name := string(templateVariable.FindSubmatch(m)[1])
+		return strconv.AppendFloat(nil, values[name], 'g', -1, 64)
+	}), nil
+}
+
+// Circuit expands the template and reads the circuit, which is validated.
+func (t *CircuitTemplate) Circuit(values map[string]float64) (*Circuit, error) {
+	text, err := t.Expand(values)
+	if err != nil {
+		return nil, err
+	}
+	circuit := &Circuit{}
+	if err := json.Unmarshal(text, circuit); err != nil {
+		return nil, fmt.Errorf("cannot read circuit: %w", err)
+	}
+	if err := circuit.Validate(); err != nil {
+		return nil, err
+	}
+	return circuit, nil
+}
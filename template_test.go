@@ -0,0 +1,36 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCircuitTemplate(t *testing.T) {
+	tmpl := &CircuitTemplate{Text: []byte(`{"integrators": [{"ic": {{ ic_x }}}, {"ic": 0}],
+		"routes": [{"from": 0, "lane": 0, "coefficient": {{k1}}, "to": 1}, {"from": 1, "lane": 1, "coefficient": {{k1}}, "to": 0}]}`)}
+	if got := tmpl.Variables(); !reflect.DeepEqual(got, []string{"ic_x", "k1"}) {
+		t.Fatalf("expected the variables ic_x and k1, got %v", got)
+	}
+	circuit, err := tmpl.Circuit(map[string]float64{"k1": -0.5, "ic_x": 0.1})
+	if err != nil {
+		t.Fatalf("Circuit: %v", err)
+	}
+	if circuit.Integrators[0].IC != 0.1 || circuit.Routes[0].Coefficient != -0.5 || circuit.Routes[1].Coefficient != -0.5 {
+		t.Fatalf("expected the values filled in, got %+v", circuit)
+	}
+
+	if _, err := tmpl.Expand(map[string]float64{"k1": 1}); err == nil || !strings.Contains(err.Error(), "ic_x") {
+		t.Fatalf("expected the missing ic_x to be reported, got %v", err)
+	}
+	if _, err := tmpl.Expand(map[string]float64{"k1": 1, "ic_x": 0, "k2": 1}); err == nil || !strings.Contains(err.Error(), "k2") {
+		t.Fatalf("expected the unused k2 to be reported, got %v", err)
+	}
+	if _, err := tmpl.Circuit(map[string]float64{"k1": 100, "ic_x": 0}); err == nil {
+		t.Fatalf("expected the coefficient out of range to fail validation")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// TLSEndpoint connects to a LUCIDAC over TCP encrypted with TLS, such as
+// through a TLS terminating proxy in front of it. As URL, it is given as
+// tcps://host:port with the socket options of TCPEndpoint and the TLS
+// options, for instance
+//
+//	tcps://lucidac.lab.example?ca=/etc/lucigo/ca.pem&cert=client.pem&key=client.key
+//
+// Without ca, the certificate of the server is verified against the CAs of
+// the system.
+type TLSEndpoint struct {
+	TCPEndpoint
+
+	CAFile             string // PEM file of the CAs to verify the server with, URL: ca
+	CertFile           string // PEM file of the client certificate, URL: cert
+	KeyFile            string // PEM file of the key of the client certificate, URL: key
+	ServerName         string // to verify the certificate for, defaults to Host, URL: servername
+	InsecureSkipVerify bool   // do not verify the server at all, URL: insecure=1
+
+	// Config is the TLS configuration to start from, such as with client
+	// certificates not kept in files, if set.
+	Config *tls.Config
+}
+
+func (e TLSEndpoint) ToURL() string {
+	url := "tcps://" + e.urlHost()
+	options := e.options()
+	for key, value := range e.TCPEndpoint.options() {
+		options[key] = value
+	}
+	if encoded := options.Encode(); encoded != "" {
+		url += "?" + encoded
+	}
+	return url
+}
+
+// options returns the TLS options as URL query, see ParseEndpoint.
+func (e TLSEndpoint) options() url.Values {
+	options := url.Values{}
+	if e.CAFile != "" {
+		options.Set("ca", e.CAFile)
+	}
+	if e.CertFile != "" {
+		options.Set("cert", e.CertFile)
+	}
+	if e.KeyFile != "" {
+		options.Set("key", e.KeyFile)
+	}
+	if e.ServerName != "" {
+		options.Set("servername", e.ServerName)
+	}
+	if e.InsecureSkipVerify {
+		options.Set("insecure", "1")
+	}
+	return options
+}
+
+// parseOptions sets the TLS and socket options given in the URL query.
+func (e *TLSEndpoint) parseOptions(query url.Values) (err error) {
+	socket := url.Values{}
+	for key := range query {
+		value := query.Get(key)
+		switch key {
+		case "ca":
+			e.CAFile = value
+		case "cert":
+			e.CertFile = value
+		case "key":
+			e.KeyFile = value
+		case "servername":
+			e.ServerName = value
+		case "insecure":
+			e.InsecureSkipVerify, err = strconv.ParseBool(value)
+		default:
+			socket[key] = query[key]
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", key, err)
+		}
+	}
+	if (e.CertFile == "") != (e.KeyFile == "") {
+		return fmt.Errorf("need both cert and key for a client certificate")
+	}
+	return e.TCPEndpoint.parseOptions(socket)
+}
+
+// TLSConfig returns the TLS configuration connections are made with.
+func (e TLSEndpoint) TLSConfig() (*tls.Config, error) {
+	config := &tls.Config{}
+	if e.Config != nil {
+		config = e.Config.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = e.Host
+	}
+	if e.ServerName != "" {
+		config.ServerName = e.ServerName
+	}
+	if e.InsecureSkipVerify {
+		config.InsecureSkipVerify = true
+	}
+	if e.CAFile != "" {
+		pem, err := os.ReadFile(e.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CAs: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", e.CAFile)
+		}
+	}
+	if e.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(e.CertFile, e.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %w", err)
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+	return config, nil
+}
+
+func (e TLSEndpoint) Open() (io.ReadWriter, error) {
+	if !e.IsValid() {
+		return nil, fmt.Errorf("Invalid TLS Endpoint (all zero)")
+	}
+	config, err := e.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	dialer := tls.Dialer{NetDialer: &net.Dialer{KeepAlive: e.KeepAlive}, Config: config}
+	c, err := dialer.Dial("tcp", e.HostPort())
+	if err != nil {
+		return nil, err
+	}
+	if err := e.tune(c.(*tls.Conn).NetConn().(*net.TCPConn)); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
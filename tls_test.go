@@ -0,0 +1,102 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// selfSigned makes a certificate for 127.0.0.1, written as PEM to ca.pem
+// in dir.
+func selfSigned(t *testing.T, dir string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "lucitest"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, "ca.pem"), ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTLSEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{selfSigned(t, dir)}})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	trusted := TLSEndpoint{TCPEndpoint: TCPEndpoint{Host: "127.0.0.1", Port: port}, CAFile: filepath.Join(dir, "ca.pem")}
+	stream, err := trusted.Open()
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	stream.Write([]byte("ping\n"))
+	if line, err := bufio.NewReader(stream).ReadString('\n'); err != nil || line != "ping\n" {
+		t.Fatalf("expected the echo over TLS, got %q, %v", line, err)
+	}
+	stream.(io.Closer).Close()
+
+	untrusted := TLSEndpoint{TCPEndpoint: TCPEndpoint{Host: "127.0.0.1", Port: port}}
+	if _, err := untrusted.Open(); err == nil {
+		t.Fatalf("expected the self-signed certificate to be refused without its CA")
+	}
+	untrusted.InsecureSkipVerify = true
+	stream, err = untrusted.Open()
+	if err != nil {
+		t.Fatalf("expected no verification with InsecureSkipVerify, got %v", err)
+	}
+	stream.(io.Closer).Close()
+
+	endpoint, err := ParseEndpoint(trusted.ToURL())
+	if err != nil || endpoint != trusted || !strings.HasPrefix(trusted.ToURL(), "tcps://127.0.0.1:") {
+		t.Fatalf("expected %s to round-trip, got %#v, %v", trusted.ToURL(), endpoint, err)
+	}
+}
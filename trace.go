@@ -0,0 +1,82 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// CommandTracer observes the commands sent by a HybridController, for
+// instance to record them as OpenTelemetry spans (see NewOTelTracer, built
+// with the otel build tag).
+type CommandTracer interface {
+	// StartCommand is called before the envelope is sent. The returned
+	// function is called with the outcome once the command is answered
+	// or failed.
+	StartCommand(hc *HybridController, sent SendEnvelope) (end func(res *RecvEnvelope, err error))
+}
+
+// traceLine is a line of the protocol trace, see HybridController.TraceWriter.
+type traceLine struct {
+	Time time.Time       `json:"time"`
+	Send json.RawMessage `json:"send,omitempty"`
+	Recv json.RawMessage `json:"recv,omitempty"`
+}
+
+// trace writes a line sent or received to hc.TraceWriter, if set. Lines
+// which are no JSON, such as boot noise, are recorded as JSON strings.
+// Failing to write the trace does not fail the connection.
+func (hc *HybridController) trace(sent bool, line []byte) {
+	if hc.TraceWriter == nil {
+		return
+	}
+	message := json.RawMessage(line)
+	if !json.Valid(line) {
+		message, _ = json.Marshal(string(line))
+	}
+	// also received, as the serial line echoes what was sent
+	message = redactPassword(message)
+	entry := traceLine{Time: time.Now().UTC()}
+	if sent {
+		entry.Send = message
+	} else {
+		entry.Recv = message
+	}
+	out, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	hc.traceMu.Lock()
+	defer hc.traceMu.Unlock()
+	hc.TraceWriter.Write(append(out, '\n'))
+}
+
+// redactPassword replaces the password of a login envelope, such that
+// traces can be passed on.
+func redactPassword(line json.RawMessage) json.RawMessage {
+	if !bytes.Contains(line, []byte(`"password"`)) {
+		return line
+	}
+	var envelope map[string]interface{}
+	if json.Unmarshal(line, &envelope) != nil {
+		return line
+	}
+	if msg, ok := envelope["msg"].(map[string]interface{}); ok && msg["password"] != nil {
+		msg["password"] = "redacted"
+		if redacted, err := json.Marshal(envelope); err == nil {
+			return redacted
+		}
+	}
+	return line
+}
+
+// TraceReceived records a line received to hc.TraceWriter, for those
+// reading hc.Reader themselves, such as a proxy. Lines sent with WriteLine
+// and those read by the commands are recorded anyway.
+func (hc *HybridController) TraceReceived(line []byte) {
+	hc.trace(false, line)
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+type recordingTracer []string
+
+func (t *recordingTracer) StartCommand(hc *HybridController, sent SendEnvelope) func(*RecvEnvelope, error) {
+	return func(res *RecvEnvelope, err error) {
+		*t = append(*t, fmt.Sprintf("%s %s code=%d err=%v", hc.Endpoint.ToURL(), sent.Type, res.Code, err))
+	}
+}
+
+func TestHybridController_Tracer(t *testing.T) {
+	fail := func(sent SendEnvelope) RecvEnvelope {
+		return RecvEnvelope{Type: sent.Type, Id: sent.Id, Code: 3, Error: "refused"}
+	}
+	hc, err := NewHybridController(LoopbackEndpoint{Transform: fail})
+	if err != nil {
+		t.Fatalf("NewHybridController: %v", err)
+	}
+	tracer := &recordingTracer{}
+	hc.Tracer = tracer
+	hc.Query("net_get")
+	hc.QueryMsg("net_set", map[string]interface{}{"dhcp": true})
+
+	expected := []string{"loopback:// net_get code=3 err=<nil>", "loopback:// net_set code=3 err=<nil>"}
+	if fmt.Sprint(*tracer) != fmt.Sprint(expected) {
+		t.Fatalf("expected %q traced, got %q", expected, *tracer)
+	}
+}
+
+func TestHybridController_TraceWriter(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		fmt.Fprintln(w, "booting...")
+		fmt.Fprintf(w, `{"type":"%s","id":"%s","code":0,"msg":{}}`+"\n", sent.Type, sent.Id)
+	})
+	var trace bytes.Buffer
+	hc.TraceWriter = &trace
+	if _, err := hc.Query("net_get"); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	hc.Close()
+
+	var lines []traceLine
+	scanner := bufio.NewScanner(&trace)
+	for scanner.Scan() {
+		var line traceLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("expected JSON lines, got %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 3 || lines[0].Send == nil || lines[1].Recv == nil || lines[2].Recv == nil {
+		t.Fatalf("expected the line sent, the noise and the answer, got %s", trace.String())
+	}
+	if lines[0].Time.IsZero() || lines[2].Time.Before(lines[0].Time) {
+		t.Fatalf("expected the lines with their time, got %s", trace.String())
+	}
+	var noise string
+	if err := json.Unmarshal(lines[1].Recv, &noise); err != nil || noise != "booting..." {
+		t.Fatalf("expected the noise as string, got %s", lines[1].Recv)
+	}
+	var sent SendEnvelope
+	if err := json.Unmarshal(lines[0].Send, &sent); err != nil || sent.Type != "net_get" {
+		t.Fatalf("expected net_get sent, got %s", lines[0].Send)
+	}
+}
+
+func TestHybridController_TraceWriter_Echo(t *testing.T) {
+	hc := newPipeController(func(sent SendEnvelope, w io.Writer) {
+		echo, _ := json.Marshal(sent)
+		fmt.Fprintf(w, "%s\n", echo)
+		fmt.Fprintf(w, `{"type":"%s","id":"%s","code":0,"msg":{}}`+"\n", sent.Type, sent.Id)
+	})
+	var trace bytes.Buffer
+	hc.TraceWriter = &trace
+	if err := hc.Login("admin", "s3cret"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	hc.Close()
+	if strings.Contains(trace.String(), "s3cret") || strings.Count(trace.String(), "redacted") != 2 {
+		t.Fatalf("expected the password redacted, also where echoed, got %s", trace.String())
+	}
+}
+
+func TestRedactPassword(t *testing.T) {
+	line := json.RawMessage(`{"type":"login","id":"00000000-0000-0000-0000-000000000000","msg":{"user":"admin","password":"s3cret"}}`)
+	if redacted := redactPassword(line); bytes.Contains(redacted, []byte("s3cret")) || !bytes.Contains(redacted, []byte("admin")) {
+		t.Fatalf("expected the password redacted, got %s", redacted)
+	}
+	line = json.RawMessage(`{"type":"net_get","msg":{}}`)
+	if redacted := redactPassword(line); !bytes.Equal(redacted, line) {
+		t.Fatalf("expected other lines as they are, got %s", redacted)
+	}
+}
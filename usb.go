@@ -0,0 +1,48 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"strings"
+
+	"go.bug.st/serial/enumerator"
+)
+
+// USBIDs are the USB vendor and product ids, as VID:PID in hex, which the
+// serial ports of LUCIDACs enumerate with. The LUCIDAC is built around a
+// Teensy microcontroller board, i.e. these are the ids of PJRC for USB
+// serial, dual serial and triple serial.
+var USBIDs = []string{"16C0:0483", "16C0:048B", "16C0:048C"}
+
+// FindUSB enumerates the serial ports of USB devices with one of the
+// USBIDs, on Linux, macOS and Windows alike.
+func FindUSB() ([]DeviceInfo, error) {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return nil, err
+	}
+	return usbEndpoints(ports), nil
+}
+
+// usbEndpoints describes the LUCIDACs among the ports.
+func usbEndpoints(ports []*enumerator.PortDetails) []DeviceInfo {
+	var endpoints []DeviceInfo
+	for _, port := range ports {
+		if !port.IsUSB {
+			continue
+		}
+		for _, id := range USBIDs {
+			if strings.EqualFold(port.VID+":"+port.PID, id) {
+				endpoints = append(endpoints, DeviceInfo{
+					Endpoint:     SerialEndpoint{Device: port.Name},
+					Name:         port.Product,
+					SerialNumber: port.SerialNumber,
+				})
+				break
+			}
+		}
+	}
+	return endpoints
+}
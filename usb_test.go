@@ -0,0 +1,28 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"reflect"
+	"testing"
+
+	"go.bug.st/serial/enumerator"
+)
+
+func TestUSBEndpoints(t *testing.T) {
+	ports := []*enumerator.PortDetails{
+		{Name: "/dev/ttyS0"},
+		{Name: "/dev/ttyACM0", IsUSB: true, VID: "16c0", PID: "0483", Product: "USB Serial", SerialNumber: "12345"},
+		{Name: "/dev/ttyUSB0", IsUSB: true, VID: "0403", PID: "6001", Product: "FT232R USB UART"},
+		{Name: "COM7", IsUSB: true, VID: "16C0", PID: "048B"},
+	}
+	expected := []DeviceInfo{
+		{Endpoint: SerialEndpoint{Device: "/dev/ttyACM0"}, Name: "USB Serial", SerialNumber: "12345"},
+		{Endpoint: SerialEndpoint{Device: "COM7"}},
+	}
+	if found := usbEndpoints(ports); !reflect.DeepEqual(found, expected) {
+		t.Fatalf("expected %v, got %v", expected, found)
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventType names something noteworthy happening to a device.
+type EventType string
+
+const (
+	EventDeviceUp        EventType = "device_up"        // answers again after being down
+	EventDeviceDown      EventType = "device_down"      // a command failed on the connection
+	EventRunDone         EventType = "run_done"         // a run ended in state DONE
+	EventRunError        EventType = "run_error"        // a run ended in state ERROR, such as by an overload
+	EventSettingsChanged EventType = "settings_changed" // permanent settings were written with net_set
+	EventSettingsDrift   EventType = "settings_drift"   // settings differ from the desired state of the fleet inventory
+)
+
+// EventTypes are all types of events, in the order of the constants.
+var EventTypes = []EventType{EventDeviceUp, EventDeviceDown, EventRunDone, EventRunError, EventSettingsChanged, EventSettingsDrift}
+
+// Event is the payload posted to webhooks. The Text field makes it
+// readable as it is by chat systems such as Slack, Mattermost or the
+// webhooks of Matrix bridges.
+type Event struct {
+	Type     EventType              `json:"type"`
+	Time     time.Time              `json:"time"`
+	Endpoint string                 `json:"endpoint,omitempty"`
+	Run      *uuid.UUID             `json:"run,omitempty"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+	Text     string                 `json:"text"`
+}
+
+// Webhook is a URL events are posted to as JSON, see [Event].
+type Webhook struct {
+	URL    string
+	Events []EventType // posted, all if empty
+}
+
+// ParseWebhook parses a webhook given as URL, optionally with the events
+// to post as fragment, such as https://hooks.example.com/lab#run_done,run_error.
+func ParseWebhook(spec string) (Webhook, error) {
+	u, err := url.Parse(spec)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, fmt.Errorf("need to provide a webhook as http(s) URL. Given was '%s'", spec)
+	}
+	hook := Webhook{URL: spec}
+	if u.Fragment != "" {
+		for _, name := range strings.Split(u.Fragment, ",") {
+			if !slices.Contains(EventTypes, EventType(name)) {
+				return Webhook{}, fmt.Errorf("unknown event '%s' in webhook %s, known are %v", name, spec, EventTypes)
+			}
+			hook.Events = append(hook.Events, EventType(name))
+		}
+		u.Fragment = ""
+		hook.URL = u.String()
+	}
+	return hook, nil
+}
+
+// Wants tells whether the event shall be posted to the webhook.
+func (w Webhook) Wants(event EventType) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// Notifier posts the events of devices and runs to webhooks:
+//
+//	notifier := &lucigo.Notifier{Webhooks: hooks}
+//	notifier.Observe(hc)
+//	run, err := hc.StartRun(config, daq)
+//	notifier.ObserveRun(run)
+//
+// Events are posted in the background, failures are logged.
+type Notifier struct {
+	Webhooks []Webhook
+	Client   *http.Client // defaults to http.DefaultClient
+
+	mu   sync.Mutex
+	down map[string]bool // by endpoint
+	sent sync.WaitGroup
+}
+
+// Notify posts the event to all webhooks wanting it.
+func (n *Notifier) Notify(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Text == "" {
+		event.Text = event.String()
+	}
+	for _, hook := range n.Webhooks {
+		if hook.Wants(event.Type) {
+			n.sent.Add(1)
+			go func(hook Webhook) {
+				defer n.sent.Done()
+				if err := n.post(hook, event); err != nil {
+					logger(LayerWebhook).Error("Notifier: Cannot post", "err", err)
+				}
+			}(hook)
+		}
+	}
+}
+
+// Wait waits until all events are posted.
+func (n *Notifier) Wait() {
+	n.sent.Wait()
+}
+
+func (n *Notifier) post(hook Webhook, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Post(hook.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("posting %s to %s: %s", event.Type, hook.URL, res.Status)
+	}
+	return nil
+}
+
+// String describes the event in a sentence.
+func (e Event) String() string {
+	device := e.Endpoint
+	if device == "" {
+		device = "LUCIDAC"
+	}
+	switch e.Type {
+	case EventDeviceUp:
+		return fmt.Sprintf("%s is up again", device)
+	case EventDeviceDown:
+		return fmt.Sprintf("%s is down: %v", device, e.Details["error"])
+	case EventRunDone:
+		return fmt.Sprintf("Run %s on %s is done", e.Run, device)
+	case EventRunError:
+		return fmt.Sprintf("Run %s on %s ended in state ERROR", e.Run, device)
+	case EventSettingsChanged:
+		return fmt.Sprintf("Settings of %s were changed", device)
+	case EventSettingsDrift:
+		return fmt.Sprintf("Settings of %s drifted from the desired state: %v", device, e.Details["settings"])
+	}
+	return fmt.Sprintf("%s: %s", device, e.Type)
+}
+
+// Observe notifies about the device going down and up again and settings
+// changed through hc. It watches the commands as hc.Tracer, passing them
+// on to the tracer set before.
+func (n *Notifier) Observe(hc *HybridController) {
+	hc.Tracer = notifyingTracer{n, hc.Tracer}
+}
+
+// ObserveRun notifies about the run ending, as hooked into
+// run.OnStateChange, passing the changes on to the hook set before.
+func (n *Notifier) ObserveRun(run *Run) {
+	next := run.OnStateChange
+	run.OnStateChange = func(run *Run) {
+		if next != nil {
+			next(run)
+		}
+		event := Event{Run: &run.Id}
+		if run.hc != nil && run.hc.Endpoint != nil {
+			event.Endpoint = run.hc.Endpoint.ToURL()
+		}
+		switch run.State() {
+		case RunStateDone:
+			event.Type = EventRunDone
+		case RunStateError:
+			event.Type = EventRunError
+		default:
+			return
+		}
+		n.Notify(event)
+	}
+}
+
+// setDown records whether the endpoint is down and reports a change.
+func (n *Notifier) setDown(endpoint string, down bool) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.down == nil {
+		n.down = make(map[string]bool)
+	}
+	changed := n.down[endpoint] != down
+	n.down[endpoint] = down
+	return changed
+}
+
+type notifyingTracer struct {
+	n    *Notifier
+	next CommandTracer
+}
+
+func (t notifyingTracer) StartCommand(hc *HybridController, sent SendEnvelope) func(*RecvEnvelope, error) {
+	var end func(*RecvEnvelope, error)
+	if t.next != nil {
+		end = t.next.StartCommand(hc, sent)
+	}
+	return func(res *RecvEnvelope, err error) {
+		if end != nil {
+			end(res, err)
+		}
+		event := Event{}
+		if hc.Endpoint != nil {
+			event.Endpoint = hc.Endpoint.ToURL()
+		}
+		if err != nil {
+			if t.n.setDown(event.Endpoint, true) {
+				event.Type = EventDeviceDown
+				event.Details = map[string]interface{}{"error": err.Error()}
+				t.n.Notify(event)
+			}
+			return
+		}
+		if t.n.setDown(event.Endpoint, false) {
+			event.Type = EventDeviceUp
+			t.n.Notify(event)
+		}
+		if sent.Type == "net_set" && res != nil && res.IsSuccess() {
+			// the settings themselves are not posted, they may hold credentials
+			event.Type = EventSettingsChanged
+			t.n.Notify(event)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseWebhook(t *testing.T) {
+	hook, err := ParseWebhook("https://hooks.example.com/lab?token=1#run_done,run_error")
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	if hook.URL != "https://hooks.example.com/lab?token=1" || !hook.Wants(EventRunError) || hook.Wants(EventDeviceUp) {
+		t.Fatalf("unexpected webhook %+v", hook)
+	}
+	for _, spec := range []string{"hooks.example.com", "https://hooks.example.com#reboot"} {
+		if _, err := ParseWebhook(spec); err == nil {
+			t.Fatalf("expected an error for webhook %s", spec)
+		}
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var posted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil || event.Text == "" {
+			t.Errorf("unexpected event %+v, %v", event, err)
+		}
+		mu.Lock()
+		posted = append(posted, string(event.Type))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	var down atomic.Bool
+	hc := newPipeEndpointController(pipeEndpoint{func(sent SendEnvelope, w io.WriteCloser) {
+		if sent.Type == "start_run" {
+			serveRun("[[1]]")(sent, w)
+		} else if !down.Load() {
+			io.WriteString(w, `{"type":"`+sent.Type+`","id":"`+sent.Id.String()+`","code":0,"msg":{}}`+"\n")
+		} else {
+			w.Close()
+		}
+	}})
+	notifier := &Notifier{Webhooks: []Webhook{{URL: server.URL}, {URL: server.URL, Events: []EventType{EventRunDone}}}}
+	notifier.Observe(hc)
+
+	hc.QueryMsg("net_set", map[string]interface{}{"dhcp": true})
+	down.Store(true)
+	hc.Query("net_get")
+	hc.Query("net_get") // still down
+	down.Store(false)
+	hc.Reconnect()
+	hc.Query("net_get")
+	run, err := hc.StartRun(testRunConfig, DAQConfig{NumChannels: 1})
+	if err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	notifier.ObserveRun(run)
+	if err := run.Capture(&Recording{}); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	notifier.Wait()
+
+	sort.Strings(posted)
+	expected := []string{"device_down", "device_up", "run_done", "run_done", "settings_changed"}
+	if len(posted) != len(expected) {
+		t.Fatalf("expected %v posted, got %v", expected, posted)
+	}
+	for i := range expected {
+		if posted[i] != expected[i] {
+			t.Fatalf("expected %v posted, got %v", expected, posted)
+		}
+	}
+}
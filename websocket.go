@@ -0,0 +1,103 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketEndpoint connects to a LUCIDAC through a websocket, such as the
+// one of `lucigo webserver` at /ws, which may itself be connected to the
+// LUCIDAC by USB, or the websocket server built into the firmware. Every
+// message is a line of the JSONL protocol.
+//
+// As URL, it is given as is, for instance ws://localhost:8080/ws, or
+// wss://lucidac.lab.example/ws for websockets secured with TLS.
+type WebSocketEndpoint struct {
+	URL string
+
+	// TLSConfig is the TLS configuration for wss:// URLs, if not the
+	// default one.
+	TLSConfig *tls.Config
+}
+
+func (e WebSocketEndpoint) IsValid() bool {
+	u, err := url.Parse(e.URL)
+	return err == nil && (u.Scheme == "ws" || u.Scheme == "wss") && u.Host != ""
+}
+
+func (e WebSocketEndpoint) ToURL() string {
+	return e.URL
+}
+
+func (e WebSocketEndpoint) Open() (io.ReadWriter, error) {
+	if !e.IsValid() {
+		return nil, fmt.Errorf("Invalid WebSocket Endpoint %q", e.URL)
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = e.TLSConfig
+	conn, _, err := dialer.Dial(e.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &wsStream{conn: conn}, nil
+}
+
+// wsStream reads and writes the messages of a websocket as lines.
+type wsStream struct {
+	conn    *websocket.Conn
+	message io.Reader // being read, followed by the newline
+}
+
+// Read reads the messages, each ending with a newline. A websocket closed
+// by the server ends in io.EOF, as a TCP connection does.
+func (s *wsStream) Read(p []byte) (int, error) {
+	for {
+		if s.message == nil {
+			_, r, err := s.conn.NextReader()
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return 0, io.EOF
+			}
+			if err != nil {
+				return 0, err
+			}
+			s.message = io.MultiReader(r, bytes.NewReader([]byte{'\n'}))
+		}
+		n, err := s.message.Read(p)
+		if err == io.EOF {
+			s.message = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Write sends every line written as message of its own, without the line
+// ending. Lines must be written at once, as WriteLine does.
+func (s *wsStream) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(p, []byte{'\n'}) {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+		if err := s.conn.WriteMessage(websocket.TextMessage, line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (s *wsStream) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Workspace keeps the runs of an experiment in a directory, instead of
+// loose data files. Each run gets a directory of its own, named by the
+// time it was started, holding circuit, configuration, data and metadata:
+//
+//	exp42/
+//	  workspace.json
+//	  runs/
+//	    20241016-153000/
+//	      circuit.json     the circuit configured, as answered to get_config
+//	      run.json         RunConfig and DAQConfig
+//	      data.csv
+//	      data.meta.json   RunMetadata, as written by MetadataSink
+//
+// The Index lists the runs, to find and re-open earlier results.
+type Workspace struct {
+	Dir     string    `json:"-"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+// WorkspaceRun is the directory of a run in a Workspace.
+type WorkspaceRun struct {
+	Name string // such as 20241016-153000
+	Dir  string
+
+	// Read by Index, nil for runs without metadata (such as runs which
+	// failed to start)
+	Metadata *RunMetadata `json:",omitempty"`
+	Files    []string     // in Dir
+}
+
+const workspaceFile = "workspace.json"
+
+// OpenWorkspace opens the workspace in dir, creating it if missing.
+func OpenWorkspace(dir string) (*Workspace, error) {
+	w, err := LoadWorkspace(dir)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return w, err
+	}
+	w = &Workspace{Dir: dir, Name: filepath.Base(dir), Created: time.Now()}
+	if err := os.MkdirAll(filepath.Join(dir, "runs"), 0o755); err != nil {
+		return nil, err
+	}
+	return w, writeJSONFile(filepath.Join(dir, workspaceFile), w)
+}
+
+// LoadWorkspace opens the existing workspace in dir.
+func LoadWorkspace(dir string) (*Workspace, error) {
+	data, err := os.ReadFile(filepath.Join(dir, workspaceFile))
+	if err != nil {
+		return nil, err
+	}
+	w := &Workspace{Dir: dir}
+	if err := json.Unmarshal(data, w); err != nil {
+		return nil, fmt.Errorf("cannot read workspace %s: %w", dir, err)
+	}
+	return w, nil
+}
+
+// NewRun creates the directory of a run started now.
+func (w *Workspace) NewRun() (*WorkspaceRun, error) {
+	name := time.Now().Format("20060102-150405")
+	for i := 2; ; i++ {
+		dir := filepath.Join(w.Dir, "runs", name)
+		err := os.Mkdir(dir, 0o755)
+		if err == nil {
+			return &WorkspaceRun{Name: name, Dir: dir}, nil
+		} else if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		name = fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), i)
+	}
+}
+
+// Path returns the path of the file in the directory of the run.
+func (r *WorkspaceRun) Path(file string) string {
+	return filepath.Join(r.Dir, file)
+}
+
+// WriteJSON writes v as indented JSON to the file in the directory of the
+// run, such as the circuit to circuit.json.
+func (r *WorkspaceRun) WriteJSON(file string, v interface{}) error {
+	return writeJSONFile(r.Path(file), v)
+}
+
+// Index lists the runs of the workspace, oldest first.
+func (w *Workspace) Index() ([]WorkspaceRun, error) {
+	entries, err := os.ReadDir(filepath.Join(w.Dir, "runs"))
+	if err != nil {
+		return nil, err
+	}
+	var runs []WorkspaceRun
+	for _, entry := range entries {
+		if entry.IsDir() {
+			runs = append(runs, w.readRun(entry.Name()))
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Name < runs[j].Name })
+	return runs, nil
+}
+
+// Run re-opens the run of the given name, or of the unique one beginning
+// with it, such as 20241016 if there was only one run that day.
+func (w *Workspace) Run(name string) (WorkspaceRun, error) {
+	runs, err := w.Index()
+	if err != nil {
+		return WorkspaceRun{}, err
+	}
+	var found []WorkspaceRun
+	for _, run := range runs {
+		if run.Name == name {
+			return run, nil
+		}
+		if strings.HasPrefix(run.Name, name) {
+			found = append(found, run)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return WorkspaceRun{}, fmt.Errorf("no run %s in workspace %s", name, w.Dir)
+	case 1:
+		return found[0], nil
+	}
+	return WorkspaceRun{}, fmt.Errorf("%d runs in workspace %s begin with %s", len(found), w.Dir, name)
+}
+
+func (w *Workspace) readRun(name string) WorkspaceRun {
+	run := WorkspaceRun{Name: name, Dir: filepath.Join(w.Dir, "runs", name)}
+	entries, _ := os.ReadDir(run.Dir)
+	for _, entry := range entries {
+		run.Files = append(run.Files, entry.Name())
+		if strings.HasSuffix(entry.Name(), ".meta.json") && run.Metadata == nil {
+			if data, err := os.ReadFile(run.Path(entry.Name())); err == nil {
+				meta := &RunMetadata{}
+				if json.Unmarshal(data, meta) == nil {
+					run.Metadata = meta
+				}
+			}
+		}
+	}
+	return run
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2024 anabrid GmbH
+// Contact: https://www.anabrid.com/licensing/
+// SPDX-License-Identifier: MIT OR GPL-2.0-or-later
+
+package lucigo
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestWorkspace(t *testing.T) {
+	dir := t.TempDir() + "/exp42"
+	if _, err := LoadWorkspace(dir); err == nil {
+		t.Fatalf("expected no workspace before it is opened")
+	}
+	w, err := OpenWorkspace(dir)
+	if err != nil || w.Name != "exp42" {
+		t.Fatalf("expected workspace exp42, got %+v, %v", w, err)
+	}
+
+	first, err := w.NewRun()
+	if err != nil {
+		t.Fatalf("NewRun: %v", err)
+	}
+	first.WriteJSON("run.json", testRunConfig)
+	first.WriteJSON("data.meta.json", RunMetadata{State: RunStateDone, Samples: 42})
+	second, err := w.NewRun()
+	if err != nil || second.Name == first.Name {
+		t.Fatalf("expected a second run of another name, got %+v, %v", second, err)
+	}
+
+	w, err = LoadWorkspace(dir)
+	if err != nil {
+		t.Fatalf("LoadWorkspace: %v", err)
+	}
+	runs, err := w.Index()
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %+v, %v", runs, err)
+	}
+	if runs[0].Metadata == nil || runs[0].Metadata.Samples != 42 || !reflect.DeepEqual(runs[0].Files, []string{"data.meta.json", "run.json"}) {
+		t.Fatalf("expected the first run with metadata and files, got %+v", runs[0])
+	}
+	if runs[1].Metadata != nil {
+		t.Fatalf("expected the second run without metadata, got %+v", runs[1])
+	}
+
+	if run, err := w.Run(second.Name); err != nil || run.Dir != second.Dir {
+		t.Fatalf("expected to re-open %s, got %+v, %v", second.Name, run, err)
+	}
+	if _, err := w.Run(first.Name[:8]); err == nil {
+		t.Fatalf("expected the ambiguous prefix %s to fail", first.Name[:8])
+	}
+	if _, err := os.Stat(second.Path("")); err != nil {
+		t.Fatalf("expected the run directory to exist: %v", err)
+	}
+}